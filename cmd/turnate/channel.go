@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"turnate/internal/handlers"
+	"turnate/internal/models"
+	"turnate/internal/service"
+	"turnate/internal/store"
+)
+
+func runChannelCreate(args []string) error {
+	flags, configPath := newFlagSet("channel create", "Create a channel with the given user as its owner and first member.")
+	name := flags.String("name", "", "channel name (required)")
+	description := flags.String("description", "", "channel description")
+	private := flags.Bool("private", false, "make the channel private")
+	owner := flags.String("owner", "", "username or email of the owner (required)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *owner == "" {
+		return errors.New("-owner is required")
+	}
+
+	channelType := models.ChannelTypePublic
+	if *private {
+		channelType = models.ChannelTypePrivate
+	}
+	err := validate(&handlers.CreateChannelRequest{Name: *name, Description: *description, Type: channelType})
+	if err != nil {
+		return err
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	user, err := w.stores.Users.GetByLogin(ctx, *owner)
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("user %s not found", *owner)
+	} else if err != nil {
+		return err
+	}
+
+	// The operator acts with admin rights, so any owner may get a private channel
+	channels := service.NewChannelService(w.stores, service.Policy{})
+	actor := service.Actor{UserID: user.ID, Role: models.UserRoleAdmin}
+	channel, err := channels.Create(ctx, actor, *name, *description, channelType)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s channel #%s (%s) owned by %s\n", channel.Type, channel.Name, channel.ID, user.Username)
+	return nil
+}
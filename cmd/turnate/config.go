@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"turnate/internal/config"
+)
+
+func runConfigCheck(args []string) error {
+	flags, configPath := newFlagSet("config check", "Validate the configuration file and environment, then print the settings the\nserver would start with. Secrets are not printed.")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath, io.Discard)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Configuration is valid")
+	fmt.Printf("  environment: %s\n", cfg.Environment)
+	fmt.Printf("  port:        %s\n", cfg.Port)
+	fmt.Printf("  database:    %s\n", cfg.DatabaseURL)
+	fmt.Printf("  log level:   %s (%s)\n", cfg.Log.Level, cfg.Log.Format)
+	fmt.Printf("  tracing:     %s\n", cfg.Tracing.Exporter)
+	fmt.Printf("  metrics:     %s\n", enabled(cfg.Metrics.Enabled))
+	fmt.Printf("  email:       %s\n", enabled(cfg.SMTP.Host != ""))
+	if cfg.Retention.Days > 0 {
+		fmt.Printf("  retention:   %d days\n", cfg.Retention.Days)
+	} else {
+		fmt.Println("  retention:   keep forever")
+	}
+
+	if cfg.JWTSecret == config.DefaultJWTSecret {
+		fmt.Println("Warning: jwt_secret is the built-in default; set JWT_SECRET before going to production")
+	}
+	return nil
+}
+
+func enabled(on bool) string {
+	if on {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"turnate/internal/database"
+)
+
+func runDBBackup(args []string) error {
+	flags, configPath := newFlagSet("db backup", "Write a verified copy of the database. Safe while the server is running.\nWithout -output the copy goes to the backup directory, which keeps the\nnewest backup.keep copies.")
+	output := flags.String("output", "", "path of the backup file, which must not exist")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	if *output != "" {
+		if err := database.Backup(ctx, w.db, *output); err != nil {
+			return err
+		}
+		if err := database.Verify(ctx, *output); err != nil {
+			return err
+		}
+		fmt.Printf("Backed up the database to %s\n", *output)
+		return nil
+	}
+
+	backup, err := database.NewBackups(w.db, w.cfg.Backup.Dir, w.cfg.Backup.Keep).Create(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up the database to %s\n", backup.Path)
+	return nil
+}
+
+func runDBBackups(args []string) error {
+	flags, configPath := newFlagSet("db backups", "List the backups in the backup directory, newest first.")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	files, err := database.NewBackups(nil, cfg.Backup.Dir, cfg.Backup.Keep).List()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Printf("No backups in %s\n", cfg.Backup.Dir)
+		return nil
+	}
+	for _, file := range files {
+		fmt.Printf("%s  %s  %d bytes\n", file.CreatedAt.Format(time.RFC3339), file.Path, file.Size)
+	}
+	return nil
+}
+
+func runDBRestore(args []string) error {
+	flags, configPath := newFlagSet("db restore", "Replace the database with a verified backup. Stop the server first. The\ncurrent database is kept beside it with a .before-restore suffix.")
+	backupPath := flags.String("backup", "", "path of the backup file to restore")
+	at := flags.String("at", "", "restore the newest backup in the backup directory taken at or before this RFC 3339 time")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if (*backupPath == "") == (*at == "") {
+		return errors.New("exactly one of -backup and -at is required")
+	}
+
+	cfg, err := loadConfig(*configPath, os.Stderr)
+	if err != nil {
+		return err
+	}
+	dbPath, err := database.FilePath(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+
+	if *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("-at must be an RFC 3339 time such as 2024-05-01T09:00:00Z: %w", err)
+		}
+		backup, err := database.NewBackups(nil, cfg.Backup.Dir, cfg.Backup.Keep).At(t)
+		if errors.Is(err, database.ErrBackupNotFound) {
+			return fmt.Errorf("no backup in %s was taken at or before %s", cfg.Backup.Dir, *at)
+		} else if err != nil {
+			return err
+		}
+		*backupPath = backup.Path
+	}
+
+	previous, err := database.Restore(context.Background(), *backupPath, dbPath, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from %s\n", dbPath, *backupPath)
+	if previous != "" {
+		fmt.Printf("The replaced database was kept at %s\n", previous)
+	}
+	return nil
+}
+
+func runDBVacuum(args []string) error {
+	flags, configPath := newFlagSet("db vacuum", "Rebuild the database file to return the space of deleted rows. Writes wait\nuntil it finishes, so prefer a quiet period.")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := database.Vacuum(context.Background(), w.db); err != nil {
+		return err
+	}
+
+	fmt.Println("Vacuumed the database")
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"turnate/internal/export"
+)
+
+func runExport(args []string) error {
+	flags, configPath := newFlagSet("export", "Write the workspace to a zip of JSON files, described in\ndocs/EXPORT_FORMAT.md. Public channels are always included.")
+	output := flags.String("output", "", `path of the zip file, which must not exist, or "-" for stdout (required)`)
+	includePrivate := flags.Bool("include-private", false, "include every private channel")
+	privateChannels := flags.String("private-channels", "", "comma-separated names of private channels to include")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("-output is required")
+	}
+
+	opts := export.Options{IncludePrivate: *includePrivate}
+	for _, name := range strings.Split(*privateChannels, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.PrivateChannels = append(opts.PrivateChannels, name)
+		}
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create export: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	manifest, err := export.Write(context.Background(), w.db, out, opts, time.Now())
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return err
+	}
+
+	// The summary goes to stderr so it never mixes with an export on stdout
+	fmt.Fprintf(os.Stderr, "Exported %d users, %d channels and %d messages\n",
+		manifest.Counts.Users, manifest.Counts.Channels, manifest.Counts.Messages)
+	return nil
+}
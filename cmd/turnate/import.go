@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/importer"
+)
+
+func runImportSlack(args []string) error {
+	flags, configPath := newFlagSet("import slack", "Import users, channels, direct messages and messages from a Slack export zip.\nRunning it again imports only what is new.")
+	file := flags.String("file", "", "path of the Slack export zip (required)")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+
+	archive, err := zip.OpenReader(*file)
+	if err != nil {
+		return fmt.Errorf("failed to open export: %w", err)
+	}
+	defer archive.Close()
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	report, err := importer.Slack(context.Background(), w.db, &archive.Reader, time.Now())
+	if err != nil {
+		return err
+	}
+	return writeImportReport(report, *asJSON)
+}
+
+func runImportMattermost(args []string) error {
+	return runImportJSONLFile(args, "import mattermost",
+		"Import users, channels, direct messages and posts from a Mattermost bulk export (JSONL).\nRunning it again imports only what is new, and an interrupted import resumes.",
+		"path of the Mattermost bulk export .jsonl file (required)", importer.Mattermost)
+}
+
+func runImportJSONL(args []string) error {
+	return runImportJSONLFile(args, "import jsonl",
+		"Import users, channels, memberships and messages in Turnate's JSONL format (docs/IMPORT_FORMAT.md).\nRunning it again imports only what is new, and an interrupted import resumes.",
+		"path of the .jsonl file (required)", importer.JSONL)
+}
+
+type jsonlImporter func(context.Context, *gorm.DB, io.ReadSeeker, importer.JSONLOptions, time.Time) (*importer.Report, error)
+
+func runImportJSONLFile(args []string, name, usage, fileUsage string, run jsonlImporter) error {
+	flags, configPath := newFlagSet(name, usage)
+	file := flags.String("file", "", fileUsage)
+	dryRun := flags.Bool("dry-run", false, "validate every line and report the invalid ones, without writing")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return fmt.Errorf("failed to open export: %w", err)
+	}
+	defer f.Close()
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	report, err := run(context.Background(), w.db, f, importer.JSONLOptions{DryRun: *dryRun}, time.Now())
+	if err != nil {
+		return err
+	}
+	return writeImportReport(report, *asJSON)
+}
+
+func writeImportReport(report *importer.Report, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	printImportReport(report)
+	return nil
+}
+
+func printImportReport(report *importer.Report) {
+	fmt.Printf("%-12s %8s %8s\n", "", "created", "existing")
+	fmt.Printf("%-12s %8d %8d\n", "users", report.Created.Users, report.Existing.Users)
+	fmt.Printf("%-12s %8d %8d\n", "channels", report.Created.Channels, report.Existing.Channels)
+	fmt.Printf("%-12s %8d %8d\n", "memberships", report.Created.Memberships, report.Existing.Memberships)
+	fmt.Printf("%-12s %8d %8d\n", "messages", report.Created.Messages, report.Existing.Messages)
+
+	if len(report.Unmapped) > 0 {
+		fmt.Println("\nWithout an equivalent in Turnate:")
+		keys := make([]string, 0, len(report.Unmapped))
+		for key := range report.Unmapped {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Printf("  %-20s %d\n", key, report.Unmapped[key])
+		}
+	}
+
+	if report.SkippedCount > 0 {
+		fmt.Printf("\nSkipped %d records:\n", report.SkippedCount)
+		for _, skipped := range report.Skipped {
+			fmt.Printf("  %-8s %-30s %s\n", skipped.Kind, skipped.ID, skipped.Reason)
+		}
+		if more := report.SkippedCount - len(report.Skipped); more > 0 {
+			fmt.Printf("  ... and %d more\n", more)
+		}
+	}
+}
@@ -1,124 +1,208 @@
+// Command turnate runs the Turnate server and the operator commands that
+// manage a deployment, sharing its configuration and database.
 package main
 
 import (
-	"log"
-	"time"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
 
-	"github.com/gin-gonic/gin"
-	
 	"turnate/internal/config"
 	"turnate/internal/database"
-	"turnate/internal/handlers"
-	"turnate/internal/middleware"
+	"turnate/internal/logging"
+	"turnate/internal/models"
+	"turnate/internal/service"
+	"turnate/internal/store"
+	"turnate/internal/store/sqlstore"
 )
 
-func main() {
-	// Load configuration
-	cfg := config.Load()
+const usage = `Usage: turnate <command> [flags]
+
+Commands:
+  serve                 Run the HTTP server and background jobs (default)
+  user create           Create a user, optionally as an administrator
+  user reset-password   Set a new password for a user
+  user deactivate       Disable a user's account
+  channel create        Create a channel owned by a user
+  db backup             Write a verified copy of the database
+  db backups            List the backups in the backup directory
+  db restore            Replace the database with a verified backup
+  db vacuum             Rebuild the database file to reclaim space
+  export                Write the workspace to a zip of JSON files
+  import slack          Import users, channels and messages from a Slack export
+  import mattermost     Import users, channels and messages from a Mattermost bulk export
+  import jsonl          Import users, channels and messages in Turnate's JSONL format
+  retention purge       Delete messages past their retention period
+  config check          Validate the configuration and print a summary
+
+Every command accepts -config (default $TURNATE_CONFIG) and reads the same
+environment variables as the server. Run "turnate <command> -h" for its flags.
+`
+
+// errUsage reports invalid flags or arguments; the flag package has already
+// printed the details
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{"serve", runServe},
+	{"user create", runUserCreate},
+	{"user reset-password", runUserResetPassword},
+	{"user deactivate", runUserDeactivate},
+	{"channel create", runChannelCreate},
+	{"db backup", runDBBackup},
+	{"db backups", runDBBackups},
+	{"db restore", runDBRestore},
+	{"db vacuum", runDBVacuum},
+	{"export", runExport},
+	{"import slack", runImportSlack},
+	{"import mattermost", runImportMattermost},
+	{"import jsonl", runImportJSONL},
+	{"retention purge", runRetentionPurge},
+	{"config check", runConfigCheck},
+}
 
-	// Connect to database
-	if err := database.Connect(cfg.DatabaseURL); err != nil {
-		log.Fatal("Failed to connect to database:", err)
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && slices.Contains([]string{"help", "-h", "-help", "--help"}, args[0]) {
+		fmt.Print(usage)
+		return
+	}
+	// Without a command the binary serves, as it did before it had commands
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"serve"}, args...)
 	}
 
-	// Run auto-migrations
-	if err := database.AutoMigrateModels(database.GetDB()); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+	cmd, rest, ok := findCommand(args)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "turnate: unknown command %q\n\n%s", strings.Join(args, " "), usage)
+		os.Exit(2)
 	}
 
-	// Set up Gin router
-	r := gin.Default()
-
-	// Global middleware
-	r.Use(middleware.CORSMiddleware())
-	r.Use(middleware.ContentSecurityMiddleware())
-	r.Use(middleware.RateLimitMiddleware())
-	r.Use(middleware.InputValidationMiddleware())
-	r.Use(middleware.ValidateContentType())
-	r.Use(middleware.TimeoutMiddleware(30 * time.Second))
-
-	// Serve static files
-	r.Static("/static", "./web/static")
-	r.LoadHTMLGlob("web/templates/*")
-
-	// Create handlers
-	authHandler := handlers.NewAuthHandler(cfg)
-	userHandler := handlers.NewUserHandler()
-	channelHandler := handlers.NewChannelHandler()
-	messageHandler := handlers.NewMessageHandler()
-
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "turnate"})
-	})
-
-	// Serve the main app
-	r.GET("/", func(c *gin.Context) {
-		c.HTML(200, "index.html", gin.H{"title": "Turnate"})
-	})
-
-	// API routes
-	api := r.Group("/api/v1")
-	api.Use(middleware.APIRateLimitMiddleware())
-	{
-		// Public auth routes
-		auth := api.Group("/auth")
-		auth.Use(middleware.AuthRateLimitMiddleware())
-		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+	err := cmd.run(rest)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "turnate %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+// findCommand matches the leading arguments against the command names
+func findCommand(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			return cmd, args[len(words):], true
 		}
-
-		// Protected routes
-		protected := api.Group("/")
-		protected.Use(middleware.AuthMiddleware(cfg))
-		{
-			// User routes
-			users := protected.Group("/users")
-			{
-				users.GET("", userHandler.GetUsers)
-				users.GET("/me", authHandler.Profile)
-				users.GET("/:id", userHandler.GetUserByID)
-				users.PATCH("/:id", userHandler.UpdateUser)
-			}
-
-			// Channel routes
-			channels := protected.Group("/channels")
-			{
-				channels.POST("", channelHandler.CreateChannel)
-				channels.GET("", channelHandler.GetChannels)
-				channels.GET("/:id", channelHandler.GetChannel)
-				channels.POST("/:id/join", channelHandler.JoinChannel)
-				channels.DELETE("/:id/leave", channelHandler.LeaveChannel)
-				channels.GET("/:id/members", channelHandler.GetChannelMembers)
-				
-				// Message routes (using :id instead of :channelId to avoid conflict)
-				channels.POST("/:id/messages", messageHandler.CreateMessage)
-				channels.GET("/:id/messages", messageHandler.GetMessages)
-				channels.GET("/:id/messages/:threadId/replies", messageHandler.GetThreadMessages)
-			}
-
-			// Message routes
-			messages := protected.Group("/messages")
-			{
-				messages.GET("/recent", messageHandler.GetRecentMessages)
-			}
+	}
+	return command{}, nil, false
+}
+
+// newFlagSet creates the flags of a command, including the shared -config flag
+func newFlagSet(name, summary string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("turnate "+name, flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("TURNATE_CONFIG"), "path to a YAML or TOML config file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: turnate %s [flags]\n\n%s\n\nFlags:\n", name, summary)
+		flags.PrintDefaults()
+	}
+	return flags, configPath
+}
+
+// parseFlags parses a command's flags; commands take no positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
 		}
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected argument %q\n", flags.Arg(0))
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// loadConfig loads and validates the configuration and applies the settings
+// every command shares
+func loadConfig(path string, logOutput io.Writer) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	logging.Setup(cfg.Log, logOutput)
+	models.BcryptCost = cfg.BcryptCost
+	return cfg, nil
+}
+
+// workspace is the migrated database and stores an operator command works on
+type workspace struct {
+	cfg    *config.Config
+	db     *gorm.DB
+	stores *store.Stores
+	// lock is nil for in-memory databases
+	lock *database.Lock
+}
+
+// openWorkspace loads the configuration and opens and migrates the database,
+// so commands also work before the server has ever started. Logs go to
+// stderr to keep the command's output clean.
+func openWorkspace(configPath string) (*workspace, error) {
+	cfg, err := loadConfig(configPath, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
 
-		// Admin routes
-		admin := api.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(cfg))
-		admin.Use(middleware.AdminMiddleware())
-		{
-			admin.GET("/users", userHandler.GetUsers)
-			admin.GET("/channels", channelHandler.GetChannels)
+	var dbLock *database.Lock
+	if dbPath, err := database.FilePath(cfg.DatabaseURL); err == nil {
+		if dbLock, err = database.Share(dbPath); err != nil {
+			return nil, err
 		}
 	}
 
-	log.Printf("🚀 Turnate server starting on port %s", cfg.Port)
-	log.Printf("🌐 Visit http://localhost:%s to get started!", cfg.Port)
-	
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	db, err := database.Connect(cfg)
+	if err != nil {
+		dbLock.Release()
+		return nil, err
+	}
+	if err := database.AutoMigrateModels(db); err != nil {
+		dbLock.Release()
+		return nil, err
+	}
+
+	return &workspace{cfg: cfg, db: db, stores: sqlstore.New(db), lock: dbLock}, nil
+}
+
+func (w *workspace) users() *service.UserService {
+	return service.NewUserService(w.stores)
+}
+
+func (w *workspace) Close() error {
+	defer w.lock.Release()
+	sqlDB, err := w.db.DB()
+	if err != nil {
+		return err
 	}
-}
\ No newline at end of file
+	return sqlDB.Close()
+}
+
+// fatal logs a startup failure and exits
+func fatal(msg string, err error) {
+	logging.Component(logging.ComponentServer).Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"turnate/internal/retention"
+)
+
+func runRetentionPurge(args []string) error {
+	flags, configPath := newFlagSet("retention purge", "Delete expired messages now, as the server does every retention.interval.\nChannels and users on legal hold are never purged.")
+	dryRun := flags.Bool("dry-run", false, "count the messages that would be purged, without deleting")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	purger := retention.NewPurger(w.db, retention.Policy{Days: w.cfg.Retention.Days, BatchSize: w.cfg.Retention.BatchSize})
+	if *dryRun {
+		result, err := purger.Preview(context.Background(), time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Would purge %d messages\n", result.Messages)
+		return nil
+	}
+
+	result, err := purger.Purge(context.Background(), time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d messages and %d related records\n", result.Messages, result.Related)
+	return nil
+}
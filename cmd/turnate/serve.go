@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/config"
+	"turnate/internal/database"
+	"turnate/internal/erasure"
+	"turnate/internal/export"
+	"turnate/internal/handlers"
+	"turnate/internal/importer"
+	"turnate/internal/logging"
+	"turnate/internal/mail"
+	"turnate/internal/metrics"
+	"turnate/internal/middleware"
+	"turnate/internal/push"
+	"turnate/internal/retention"
+	"turnate/internal/scheduler"
+	"turnate/internal/service"
+	"turnate/internal/store/sqlstore"
+	"turnate/internal/tracing"
+)
+
+// runServe runs the HTTP server and background jobs until SIGINT or SIGTERM
+func runServe(args []string) error {
+	flags, configPath := newFlagSet("serve", "Run the HTTP server and background jobs until SIGINT or SIGTERM.")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	// Load configuration
+	cfg, err := loadConfig(*configPath, os.Stdout)
+	if err != nil {
+		return err
+	}
+	logger := logging.Component(logging.ComponentServer)
+
+	if cfg.IsProduction() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	// Hold the database lock while running, so that db restore refuses to
+	// replace the file underneath the server
+	if dbPath, err := database.FilePath(cfg.DatabaseURL); err == nil {
+		dbLock, err := database.Share(dbPath)
+		if err != nil {
+			fatal("failed to lock database", err)
+		}
+		defer dbLock.Release()
+	}
+
+	// Connect to database
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fatal("failed to connect to database", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("failed to access database pool", err)
+	}
+
+	// Run auto-migrations
+	if err := database.AutoMigrateModels(db); err != nil {
+		fatal("failed to run migrations", err)
+	}
+	// The schema only changes on startup, so readiness reuses this result
+	// instead of inspecting every table on each probe
+	migrationStatus := database.PendingMigrations(db)
+	if migrationStatus != nil {
+		logger.Error("database schema is incomplete", "error", migrationStatus)
+	}
+
+	// Set up Gin router
+	r := gin.New()
+	// Client IPs feed the rate limits and the metrics allowlist, so forwarding
+	// headers are only believed from the configured proxies
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("invalid trusted proxies", err)
+	}
+
+	// Global middleware
+	r.Use(tracing.Middleware())
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.RequestLogger())
+	r.Use(middleware.RecoveryMiddleware())
+	r.Use(metrics.Middleware())
+	r.Use(middleware.CORSMiddleware(cfg.AllowedOrigins))
+	r.Use(middleware.ContentSecurityMiddleware())
+	r.Use(middleware.RateLimitMiddleware(cfg.RateLimits.Global))
+	r.Use(middleware.BodyLimitMiddleware(cfg.Uploads.MaxBytes))
+	r.Use(middleware.InputValidationMiddleware())
+	// Unsubscribe links are posted by a plain HTML form or by mail clients
+	r.Use(middleware.ValidateContentType("/api/v1/email/unsubscribe"))
+	// Downloads stream large files and would be buffered and cut off
+	r.Use(middleware.TimeoutMiddleware(cfg.RequestTimeout.Std(),
+		"/api/v1/users/me/export/download",
+		"/api/v1/admin/backups/:name",
+		"/api/v1/admin/export/:name",
+	))
+
+	// Serve static files
+	r.Static("/static", "./web/static")
+	r.LoadHTMLGlob("web/templates/*")
+
+	// Create stores and services
+	stores := sqlstore.New(db)
+	userService := service.NewUserService(stores)
+	channelService := service.NewChannelService(stores, service.Policy{
+		RestrictPinsToOwners: cfg.Channels.RestrictPinsToOwners,
+	})
+	notificationService := service.NewNotificationService(stores, channelService)
+	messageService := service.NewMessageService(stores, channelService, notificationService)
+	scheduledService := service.NewScheduledMessageService(stores, channelService, messageService)
+	threadService := service.NewThreadService(stores, channelService)
+	savedService := service.NewSavedService(stores, channelService)
+	reminderService := service.NewReminderService(stores, channelService)
+	groupService := service.NewGroupService(stores, channelService)
+	retentionService := service.NewRetentionService(stores)
+	erasureService := service.NewErasureService(stores)
+
+	var sender mail.Sender
+	if cfg.SMTP.Host != "" {
+		sender = mail.NewSMTPSender(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+	}
+	emailService := service.NewEmailService(stores, sender, service.EmailOptions{
+		BaseURL:      cfg.Email.BaseURL,
+		Secret:       cfg.JWTSecret,
+		MentionDelay: cfg.Email.MentionDelay.Std(),
+		DigestHour:   cfg.Email.DigestHour,
+	})
+
+	pushKeys, err := service.LoadPushKeys(context.Background(), stores, push.Keys{
+		PublicKey:  cfg.Push.VAPIDPublicKey,
+		PrivateKey: cfg.Push.VAPIDPrivateKey,
+	})
+	if err != nil {
+		fatal("failed to load push keys", err)
+	}
+	pushClient, err := push.NewClient(pushKeys, cfg.PushSubject(), tracing.HTTPClient(10*time.Second, push.PublicTransport()))
+	if err != nil {
+		fatal("invalid push keys", err)
+	}
+	pushService := service.NewPushService(stores, pushClient)
+	backups := database.NewBackups(db, cfg.Backup.Dir, cfg.Backup.Keep)
+	exports := export.NewExports(db, cfg.Export.Dir, cfg.Export.Keep)
+	imports := importer.NewImports(db)
+	purger := retention.NewPurger(db, retention.Policy{Days: cfg.Retention.Days, BatchSize: cfg.Retention.BatchSize})
+	personalExports := export.NewPersonalExports(db, cfg.Export.Dir)
+	erasures := erasure.NewErasures(db, erasure.Policy{DeleteMessages: cfg.Erasure.Messages == config.ErasureMessagesDelete}, personalExports)
+
+	// Background jobs keep their queues in the database and catch up on start.
+	// Each runs on its own goroutine, so slow purges, backups and push
+	// fan-out do not delay reminders and scheduled messages.
+	backgroundJobs := []scheduler.Job{
+		{Name: "reminders", Run: func(ctx context.Context, now time.Time) error {
+			_, err := reminderService.DeliverDue(ctx, now)
+			return err
+		}},
+		{Name: "scheduled_messages", Run: func(ctx context.Context, now time.Time) error {
+			_, err := scheduledService.SendDue(ctx, now)
+			return err
+		}},
+		{Name: "push_notifications", Run: func(ctx context.Context, now time.Time) error {
+			_, err := pushService.DeliverPending(ctx, now)
+			return err
+		}},
+		{Name: "retention", Interval: cfg.Retention.Interval.Std(), Run: func(ctx context.Context, now time.Time) error {
+			result, err := purger.PurgeDue(ctx, now, cfg.Retention.Interval.Std())
+			if result != nil && result.Messages > 0 {
+				logger.Info("expired messages purged", "messages", result.Messages, "related", result.Related)
+			}
+			return err
+		}},
+		{Name: "erasures", Run: func(ctx context.Context, now time.Time) error {
+			_, err := erasures.EraseApproved(ctx, now)
+			return err
+		}},
+	}
+	if cfg.Backup.Interval > 0 {
+		// The newest backup file decides when the next one is due, so check at
+		// least hourly rather than waiting a whole interval after a restart
+		backupCheck := min(cfg.Backup.Interval.Std(), time.Hour)
+		backgroundJobs = append(backgroundJobs, scheduler.Job{Name: "database_backup", Interval: backupCheck, Run: func(ctx context.Context, now time.Time) error {
+			backup, err := backups.CreateDue(ctx, now, cfg.Backup.Interval.Std())
+			if backup != nil {
+				logger.Info("database backed up", "file", backup.Path, "bytes", backup.Size)
+			}
+			return err
+		}})
+	}
+	if sender != nil {
+		backgroundJobs = append(backgroundJobs,
+			scheduler.Job{Name: "mention_emails", Run: func(ctx context.Context, now time.Time) error {
+				_, err := emailService.SendMentionEmails(ctx, now)
+				return err
+			}},
+			scheduler.Job{Name: "email_digests", Run: func(ctx context.Context, now time.Time) error {
+				_, err := emailService.SendDigests(ctx, now)
+				return err
+			}},
+		)
+	} else {
+		logger.Warn("SMTP is not configured; notification emails are disabled")
+	}
+	jobs := scheduler.New(cfg.Scheduler.PollInterval.Std(), backgroundJobs...)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		jobs.Run(jobsCtx)
+	}()
+
+	// Create handlers
+	authHandler := handlers.NewAuthHandler(cfg, userService)
+	userHandler := handlers.NewUserHandler(userService)
+	channelHandler := handlers.NewChannelHandler(channelService)
+	messageHandler := handlers.NewMessageHandler(messageService, scheduledService)
+	threadHandler := handlers.NewThreadHandler(threadService)
+	savedHandler := handlers.NewSavedHandler(savedService)
+	reminderHandler := handlers.NewReminderHandler(reminderService)
+	groupHandler := handlers.NewGroupHandler(groupService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	emailHandler := handlers.NewEmailHandler(emailService)
+	healthHandler := handlers.NewHealthHandler(
+		handlers.HealthCheck{Name: "database", Check: sqlDB.PingContext},
+		handlers.HealthCheck{Name: "migrations", Check: func(ctx context.Context) error {
+			return migrationStatus
+		}},
+		handlers.HealthCheck{Name: "scheduler", Check: func(ctx context.Context) error {
+			return jobs.Healthy(time.Now())
+		}},
+	)
+	pushHandler := handlers.NewPushHandler(pushService)
+	backupHandler := handlers.NewBackupHandler(backups)
+	exportHandler := handlers.NewExportHandler(exports)
+	importHandler := handlers.NewImportHandler(imports)
+	retentionHandler := handlers.NewRetentionHandler(retentionService, purger)
+	personalExportHandler := handlers.NewPersonalExportHandler(personalExports)
+	erasureHandler := handlers.NewErasureHandler(erasureService, erasures)
+
+	// Health checks: liveness for restarts, readiness for load balancers
+	r.GET("/health", healthHandler.Health)
+	r.GET("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
+
+	// Prometheus metrics
+	if cfg.Metrics.Enabled {
+		r.GET("/metrics", middleware.MetricsAccessMiddleware(cfg.Metrics), gin.WrapH(metrics.Handler()))
+	}
+
+	// The service worker must be served from the root to control the whole app
+	r.GET("/sw.js", func(c *gin.Context) {
+		c.File("./web/static/sw.js")
+	})
+
+	// Serve the main app
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(200, "index.html", gin.H{"title": "Turnate"})
+	})
+
+	// API routes
+	api := r.Group("/api/v1")
+	api.Use(middleware.APIRateLimitMiddleware(cfg.RateLimits.API))
+	{
+		// Public auth routes
+		auth := api.Group("/auth")
+		auth.Use(middleware.AuthRateLimitMiddleware(cfg.RateLimits.Auth))
+		{
+			auth.POST("/register", authHandler.Register)
+			auth.POST("/login", authHandler.Login)
+		}
+		api.POST("/auth/logout", middleware.CSRFMiddleware(), authHandler.Logout)
+
+		// Unsubscribe links in emails are signed and work without a session.
+		// Visiting one asks for confirmation; posting to it unsubscribes.
+		api.GET("/email/unsubscribe", emailHandler.UnsubscribePage)
+		api.POST("/email/unsubscribe", emailHandler.Unsubscribe)
+
+		// Protected routes
+		protected := api.Group("/")
+		protected.Use(middleware.AuthMiddleware(cfg, stores.Users))
+		{
+			// User routes
+			users := protected.Group("/users")
+			{
+				users.GET("", userHandler.GetUsers)
+				users.GET("/me", authHandler.Profile)
+				users.POST("/me/export", personalExportHandler.CreatePersonalExport)
+				users.GET("/me/export", personalExportHandler.GetPersonalExport)
+				users.GET("/me/export/download", personalExportHandler.DownloadPersonalExport)
+				users.POST("/me/erasure", erasureHandler.RequestErasure)
+				users.GET("/me/erasure", erasureHandler.GetErasure)
+				users.DELETE("/me/erasure", erasureHandler.CancelErasure)
+				users.GET("/:id", userHandler.GetUserByID)
+				users.PATCH("/:id", userHandler.UpdateUser)
+			}
+
+			// Channel routes
+			channels := protected.Group("/channels")
+			{
+				channels.POST("", channelHandler.CreateChannel)
+				channels.GET("", channelHandler.GetChannels)
+				channels.GET("/:id", channelHandler.GetChannel)
+				channels.POST("/:id/join", channelHandler.JoinChannel)
+				channels.DELETE("/:id/leave", channelHandler.LeaveChannel)
+				channels.GET("/:id/members", channelHandler.GetChannelMembers)
+
+				// Message routes (using :id instead of :channelId to avoid conflict)
+				channels.POST("/:id/messages", messageHandler.CreateMessage)
+				channels.GET("/:id/messages", messageHandler.GetMessages)
+				channels.GET("/:id/messages/:threadId/replies", messageHandler.GetThreadMessages)
+
+				// Pins and bookmarks
+				channels.GET("/:id/pins", messageHandler.GetPins)
+				channels.POST("/:id/pins", messageHandler.PinMessage)
+				channels.DELETE("/:id/pins/:messageId", messageHandler.UnpinMessage)
+				channels.POST("/:id/bookmarks", channelHandler.AddBookmark)
+				channels.DELETE("/:id/bookmarks/:bookmarkId", channelHandler.RemoveBookmark)
+
+				// Per-channel notification level
+				channels.GET("/:id/notifications", notificationHandler.GetChannelNotificationLevel)
+				channels.PUT("/:id/notifications", notificationHandler.SetChannelNotificationLevel)
+			}
+
+			// User groups, mentioned by handle. Admins create and delete them;
+			// admins and group owners manage the rest.
+			groups := protected.Group("/groups")
+			{
+				groups.GET("", groupHandler.GetGroups)
+				groups.POST("", groupHandler.CreateGroup)
+				groups.GET("/:id", groupHandler.GetGroup)
+				groups.PATCH("/:id", groupHandler.UpdateGroup)
+				groups.DELETE("/:id", groupHandler.DeleteGroup)
+				groups.POST("/:id/members", groupHandler.AddMember)
+				groups.DELETE("/:id/members/:userId", groupHandler.RemoveMember)
+			}
+
+			// Message routes
+			messages := protected.Group("/messages")
+			{
+				messages.GET("/recent", messageHandler.GetRecentMessages)
+			}
+
+			// Followed threads
+			threads := protected.Group("/threads")
+			{
+				threads.GET("", threadHandler.GetThreads)
+				threads.POST("/:id/follow", threadHandler.FollowThread)
+				threads.DELETE("/:id/follow", threadHandler.UnfollowThread)
+				threads.POST("/:id/read", threadHandler.MarkThreadRead)
+			}
+
+			// Scheduled messages
+			scheduled := protected.Group("/scheduled-messages")
+			{
+				scheduled.GET("", messageHandler.GetScheduledMessages)
+				scheduled.PATCH("/:id", messageHandler.UpdateScheduledMessage)
+				scheduled.DELETE("/:id", messageHandler.CancelScheduledMessage)
+			}
+
+			// Saved items
+			saved := protected.Group("/saved")
+			{
+				saved.GET("", savedHandler.GetSaved)
+				saved.POST("", savedHandler.SaveMessage)
+				saved.DELETE("/:id", savedHandler.UnsaveMessage)
+			}
+
+			// Reminders
+			reminders := protected.Group("/reminders")
+			{
+				reminders.GET("", reminderHandler.GetReminders)
+				reminders.POST("", reminderHandler.CreateReminder)
+				reminders.DELETE("/:id", reminderHandler.CancelReminder)
+			}
+
+			// Notifications
+			notifications := protected.Group("/notifications")
+			{
+				notifications.GET("", notificationHandler.GetNotifications)
+				notifications.POST("/read-all", notificationHandler.MarkAllNotificationsRead)
+				notifications.GET("/settings", notificationHandler.GetNotificationSettings)
+				notifications.PUT("/settings", notificationHandler.UpdateNotificationSettings)
+				notifications.POST("/:id/read", notificationHandler.MarkNotificationRead)
+			}
+
+			// Web Push subscriptions, one per browser session
+			pushRoutes := protected.Group("/push")
+			{
+				pushRoutes.GET("/key", pushHandler.GetPushKey)
+				pushRoutes.GET("/subscriptions", pushHandler.GetPushSubscriptions)
+				pushRoutes.POST("/subscriptions", pushHandler.CreatePushSubscription)
+				pushRoutes.DELETE("/subscriptions/:id", pushHandler.DeletePushSubscription)
+			}
+		}
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(cfg, stores.Users))
+		admin.Use(middleware.AdminMiddleware())
+		{
+			admin.GET("/users", userHandler.GetUsers)
+			admin.GET("/channels", channelHandler.GetChannels)
+			admin.GET("/backups", backupHandler.GetBackups)
+			admin.POST("/backups", backupHandler.CreateBackup)
+			admin.GET("/backups/:name", backupHandler.DownloadBackup)
+			admin.GET("/export", exportHandler.GetExports)
+			admin.POST("/export", exportHandler.CreateExport)
+			admin.GET("/export/:name", exportHandler.DownloadExport)
+			admin.GET("/import", importHandler.GetImports)
+			admin.GET("/import/:id", importHandler.GetImport)
+			admin.POST("/import/:source", importHandler.CreateImport)
+			admin.GET("/retention", retentionHandler.GetRetention)
+			admin.PUT("/channels/:id/retention", retentionHandler.SetChannelRetention)
+			admin.PUT("/users/:id/legal-hold", retentionHandler.SetLegalHold)
+			admin.GET("/erasure-requests", erasureHandler.GetErasureRequests)
+			admin.POST("/erasure-requests/:id/approve", erasureHandler.ApproveErasure)
+			admin.POST("/erasure-requests/:id/reject", erasureHandler.RejectErasure)
+		}
+	}
+
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: r}
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server starting", "port", cfg.Port, "url", "http://localhost:"+cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	stop, cancelSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancelSignals()
+	select {
+	case err := <-serverErr:
+		fatal("failed to start server", err)
+	case <-stop.Done():
+	}
+
+	// Stop taking traffic, let in-flight requests and the current round of
+	// jobs finish, cancel running exports and imports, then flush traces and
+	// close the database
+	logger.Info("shutting down", "timeout", cfg.ShutdownTimeout.Std().String())
+	healthHandler.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Std())
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("failed to drain HTTP connections", "error", err)
+	}
+	stopJobs()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		logger.Error("background jobs did not stop in time")
+	}
+	exports.Close()
+	personalExports.Close()
+	imports.Close()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		logger.Error("failed to close database", "error", err)
+	}
+	logger.Info("server stopped")
+	return nil
+}
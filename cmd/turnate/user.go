@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"turnate/internal/handlers"
+	"turnate/internal/middleware"
+	"turnate/internal/models"
+)
+
+// passwordInput applies the API's password rules to passwords set from the CLI
+type passwordInput struct {
+	Password string `json:"password" binding:"required,min=6,max=72"`
+}
+
+func runUserCreate(args []string) error {
+	flags, configPath := newFlagSet("user create", "Create a user and add them to #general if it exists. Without -password-stdin\na random password is generated and printed once.")
+	username := flags.String("username", "", "username (required)")
+	email := flags.String("email", "", "email address (required)")
+	displayName := flags.String("display-name", "", "display name (defaults to the username)")
+	admin := flags.Bool("admin", false, "make the user an administrator")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	password, generated, err := readPassword(*passwordStdin, os.Stdin)
+	if err != nil {
+		return err
+	}
+	err = validate(&handlers.RegisterRequest{
+		Username:    *username,
+		Email:       *email,
+		Password:    password,
+		DisplayName: *displayName,
+	})
+	if err != nil {
+		return err
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	role := models.UserRoleNormal
+	if *admin {
+		role = models.UserRoleAdmin
+	}
+	user, err := w.users().Create(context.Background(), *username, *email, *displayName, password, role)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s user %s (%s)\n", user.Role, user.Username, user.ID)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+func runUserResetPassword(args []string) error {
+	flags, configPath := newFlagSet("user reset-password", "Set a new password for a user. Without -password-stdin a random password is\ngenerated and printed once. Existing sessions stay valid until they expire.")
+	login := flags.String("user", "", "username or email (required)")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *login == "" {
+		return errors.New("-user is required")
+	}
+
+	password, generated, err := readPassword(*passwordStdin, os.Stdin)
+	if err != nil {
+		return err
+	}
+	if err := validate(&passwordInput{Password: password}); err != nil {
+		return err
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	user, err := w.users().ResetPassword(context.Background(), *login, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reset the password of %s\n", user.Username)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+func runUserDeactivate(args []string) error {
+	flags, configPath := newFlagSet("user deactivate", "Disable a user's account. Their sessions stop working on the next request.")
+	login := flags.String("user", "", "username or email (required)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *login == "" {
+		return errors.New("-user is required")
+	}
+
+	w, err := openWorkspace(*configPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	user, err := w.users().Deactivate(context.Background(), *login)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deactivated %s\n", user.Username)
+	return nil
+}
+
+// readPassword reads a password from the first line of r, or generates one
+func readPassword(fromStdin bool, r io.Reader) (password string, generated bool, err error) {
+	if !fromStdin {
+		password, err = generatePassword()
+		return password, true, err
+	}
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), false, nil
+}
+
+// generatePassword returns 24 random URL-safe characters
+func generatePassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// validate checks CLI input against the same rules as the API request schemas
+func validate(obj any) error {
+	err := binding.Validator.ValidateStruct(obj)
+	if err == nil {
+		return nil
+	}
+
+	// Field names follow the flags, which use dashes where JSON uses underscores
+	var problems []string
+	for _, field := range middleware.FieldErrors(err) {
+		problems = append(problems, strings.ReplaceAll(field.Field, "_", "-")+" "+field.Message)
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
@@ -1,22 +1,570 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+	EnvTest        = "test"
+
+	// DefaultJWTSecret is only acceptable outside production
+	DefaultJWTSecret = "your-super-secret-jwt-key-change-in-production"
+
+	minProductionSecretLength = 32
 )
 
 type Config struct {
-	Port        string
-	DatabaseURL string
-	JWTSecret   string
+	Environment    string   `yaml:"environment" toml:"environment"`
+	Port           string   `yaml:"port" toml:"port"`
+	DatabaseURL    string   `yaml:"database_url" toml:"database_url"`
+	JWTSecret      string   `yaml:"jwt_secret" toml:"jwt_secret"`
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	CookieSecure   bool     `yaml:"cookie_secure" toml:"cookie_secure"`
+	// TrustedProxies lists the reverse proxies, as IPs or CIDR ranges, whose
+	// X-Forwarded-For header gives the client IP. With none, the client IP is
+	// the address of the connection.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	BcryptCost     int      `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	RequestTimeout Duration `yaml:"request_timeout" toml:"request_timeout"`
+	// ShutdownTimeout is how long shutdown waits for requests and jobs to finish
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	RateLimits RateLimitConfig `yaml:"rate_limits" toml:"rate_limits"`
+	Channels   ChannelConfig   `yaml:"channels" toml:"channels"`
+	Scheduler  SchedulerConfig `yaml:"scheduler" toml:"scheduler"`
+	Uploads    UploadConfig    `yaml:"uploads" toml:"uploads"`
+	SMTP       SMTPConfig      `yaml:"smtp" toml:"smtp"`
+	Email      EmailConfig     `yaml:"email" toml:"email"`
+	Push       PushConfig      `yaml:"push" toml:"push"`
+	Metrics    MetricsConfig   `yaml:"metrics" toml:"metrics"`
+	Tracing    TracingConfig   `yaml:"tracing" toml:"tracing"`
+	Log        LogConfig       `yaml:"log" toml:"log"`
+	DBPool     DBPoolConfig    `yaml:"db_pool" toml:"db_pool"`
+	SQLite     SQLiteConfig    `yaml:"sqlite" toml:"sqlite"`
+	Backup     BackupConfig    `yaml:"backup" toml:"backup"`
+	Export     ExportConfig    `yaml:"export" toml:"export"`
+	Retention  RetentionConfig `yaml:"retention" toml:"retention"`
+	Erasure    ErasureConfig   `yaml:"erasure" toml:"erasure"`
+}
+
+// RateLimit allows Requests per Per interval with the given Burst
+type RateLimit struct {
+	Requests int      `yaml:"requests" toml:"requests"`
+	Per      Duration `yaml:"per" toml:"per"`
+	Burst    int      `yaml:"burst" toml:"burst"`
+}
+
+type RateLimitConfig struct {
+	Global RateLimit `yaml:"global" toml:"global"`
+	Auth   RateLimit `yaml:"auth" toml:"auth"`
+	API    RateLimit `yaml:"api" toml:"api"`
+}
+
+type ChannelConfig struct {
+	// RestrictPinsToOwners limits pinning to channel owners and admins instead of all members
+	RestrictPinsToOwners bool `yaml:"restrict_pins_to_owners" toml:"restrict_pins_to_owners"`
+}
+
+type SchedulerConfig struct {
+	// PollInterval is how often background jobs such as reminders look for due work
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"`
+}
+
+type UploadConfig struct {
+	MaxBytes int64 `yaml:"max_bytes" toml:"max_bytes"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	From     string `yaml:"from" toml:"from"`
+}
+
+// EmailConfig controls notification emails, which are sent when smtp.host is set
+type EmailConfig struct {
+	// BaseURL is the public address of the server, used for links in emails
+	BaseURL string `yaml:"base_url" toml:"base_url"`
+	// MentionDelay is how long a mention stays unread before it is emailed
+	MentionDelay Duration `yaml:"mention_delay" toml:"mention_delay"`
+	// DigestHour is the hour of the day, in each user's timezone, at which daily digests go out
+	DigestHour int `yaml:"digest_hour" toml:"digest_hour"`
+}
+
+// PushConfig holds the VAPID key pair for Web Push. When both keys are empty
+// a pair is generated on first start and kept in the database.
+type PushConfig struct {
+	VAPIDPublicKey  string `yaml:"vapid_public_key" toml:"vapid_public_key"`
+	VAPIDPrivateKey string `yaml:"vapid_private_key" toml:"vapid_private_key"`
+	// Subject is a mailto: or https: contact for push services, defaulting to email.base_url
+	Subject string `yaml:"subject" toml:"subject"`
+}
+
+// MetricsConfig controls the Prometheus /metrics endpoint. With a username it
+// requires basic auth; with allowed IPs it only answers those addresses. When
+// both are set a scrape must pass both checks.
+type MetricsConfig struct {
+	Enabled  bool   `yaml:"enabled" toml:"enabled"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	// AllowedIPs are addresses or CIDR ranges such as 10.0.0.0/8
+	AllowedIPs []string `yaml:"allowed_ips" toml:"allowed_ips"`
+}
+
+// Tracing exporters
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// TracingConfig controls OpenTelemetry tracing. Spans are exported over OTLP
+// HTTP to a collector, or written to stdout for local debugging.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// Endpoint is the collector's OTLP HTTP address, used by the otlp exporter
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// SampleRatio is the fraction of new traces recorded; requests that
+	// arrive with a sampled parent are always recorded
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name" toml:"service_name"`
+}
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogComponents are the component names accepted in log.components
+var LogComponents = []string{"server", "http", "sql", "scheduler", "notifications"}
+
+// LogConfig controls structured logging. Levels are debug, info, warn or error.
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+	// Components overrides the level for individual components, such as http: warn
+	Components map[string]string `yaml:"components" toml:"components"`
+	SQL        SQLLogConfig      `yaml:"sql" toml:"sql"`
+}
+
+// SQLLogConfig controls statement logging. Failed statements are always
+// logged; when enabled, so are statements slower than SlowThreshold.
+type SQLLogConfig struct {
+	Enabled       bool     `yaml:"enabled" toml:"enabled"`
+	SlowThreshold Duration `yaml:"slow_threshold" toml:"slow_threshold"`
+}
+
+type DBPoolConfig struct {
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+// SQLiteConfig tunes the database connection. WAL mode lets readers, such as
+// backups, run alongside the writer; BusyTimeout is how long a connection
+// waits for a lock before failing.
+type SQLiteConfig struct {
+	WAL         bool     `yaml:"wal" toml:"wal"`
+	BusyTimeout Duration `yaml:"busy_timeout" toml:"busy_timeout"`
+}
+
+// BackupConfig controls online backups. Every Interval the server copies the
+// database into Dir and keeps the newest Keep copies. An interval of 0 turns
+// scheduled backups off; the admin API and CLI still write to Dir.
+type BackupConfig struct {
+	Dir      string   `yaml:"dir" toml:"dir"`
+	Interval Duration `yaml:"interval" toml:"interval"`
+	Keep     int      `yaml:"keep" toml:"keep"`
+}
+
+// ExportConfig controls workspace exports started from the admin API, which
+// are written into Dir; the newest Keep are kept
+type ExportConfig struct {
+	Dir  string `yaml:"dir" toml:"dir"`
+	Keep int    `yaml:"keep" toml:"keep"`
+}
+
+// RetentionConfig controls message retention. Messages older than Days are
+// purged, unless their channel sets its own period or either their channel
+// or a participant is on legal hold; 0 keeps messages forever. The purger
+// runs every Interval, deleting up to BatchSize threads per transaction.
+type RetentionConfig struct {
+	Days      int      `yaml:"days" toml:"days"`
+	Interval  Duration `yaml:"interval" toml:"interval"`
+	BatchSize int      `yaml:"batch_size" toml:"batch_size"`
+}
+
+// What happens to an erased user's messages
+const (
+	// ErasureMessagesKeep keeps the messages, attributed to the anonymized account
+	ErasureMessagesKeep = "keep"
+	// ErasureMessagesDelete deletes the messages
+	ErasureMessagesDelete = "delete"
+)
+
+// ErasureConfig controls account erasure, which users request and admins
+// approve. Messages chooses whether an erased user's messages are kept or
+// deleted.
+type ErasureConfig struct {
+	Messages string `yaml:"messages" toml:"messages"`
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in config files
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
 }
 
-func Load() *Config {
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Std returns the value as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Default returns the built-in configuration used when nothing is overridden
+func Default() *Config {
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		DatabaseURL: getEnv("DATABASE_URL", "turnate.db"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
+		Environment:     EnvDevelopment,
+		Port:            "8080",
+		DatabaseURL:     "turnate.db",
+		JWTSecret:       DefaultJWTSecret,
+		BcryptCost:      10,
+		RequestTimeout:  Duration(30 * time.Second),
+		ShutdownTimeout: Duration(30 * time.Second),
+		RateLimits: RateLimitConfig{
+			Global: RateLimit{Requests: 10, Per: Duration(time.Second), Burst: 20},
+			Auth:   RateLimit{Requests: 5, Per: Duration(time.Minute), Burst: 5},
+			API:    RateLimit{Requests: 5, Per: Duration(time.Second), Burst: 10},
+		},
+		Scheduler: SchedulerConfig{PollInterval: Duration(15 * time.Second)},
+		Uploads:   UploadConfig{MaxBytes: 10 << 20},
+		SMTP:      SMTPConfig{Port: 587},
+		Email: EmailConfig{
+			BaseURL:      "http://localhost:8080",
+			MentionDelay: Duration(15 * time.Minute),
+			DigestHour:   8,
+		},
+		Metrics: MetricsConfig{Enabled: true},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			Endpoint:    "http://localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "turnate",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatJSON,
+			SQL:    SQLLogConfig{SlowThreshold: Duration(200 * time.Millisecond)},
+		},
+		DBPool: DBPoolConfig{
+			MaxOpenConns:    1,
+			MaxIdleConns:    1,
+			ConnMaxLifetime: Duration(time.Hour),
+		},
+		SQLite:    SQLiteConfig{WAL: true, BusyTimeout: Duration(5 * time.Second)},
+		Backup:    BackupConfig{Dir: "backups", Interval: Duration(24 * time.Hour), Keep: 7},
+		Export:    ExportConfig{Dir: "exports", Keep: 3},
+		Retention: RetentionConfig{Interval: Duration(time.Hour), BatchSize: 500},
+		Erasure:   ErasureConfig{Messages: ErasureMessagesKeep},
+	}
+}
+
+// Load builds the configuration from defaults, then the optional YAML or TOML
+// file at path, then environment variables, and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// PushSubject is the contact sent to push services, falling back to the base URL
+func (c *Config) PushSubject() string {
+	if c.Push.Subject != "" {
+		return c.Push.Subject
+	}
+	return c.Email.BaseURL
+}
+
+// validPushSubject reports whether subject is a contact push services accept
+func validPushSubject(subject string) bool {
+	return strings.HasPrefix(subject, "mailto:") || strings.HasPrefix(subject, "https://")
+}
+
+// IsProduction reports whether the server runs in production mode
+func (c *Config) IsProduction() bool {
+	return c.Environment == EnvProduction
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	return nil
+}
+
+func (c *Config) applyEnv() error {
+	env := &envReader{}
+
+	c.Environment = getEnv("TURNATE_ENV", c.Environment)
+	c.Port = getEnv("PORT", c.Port)
+	c.DatabaseURL = getEnv("DATABASE_URL", c.DatabaseURL)
+	c.JWTSecret = getEnv("JWT_SECRET", c.JWTSecret)
+	c.AllowedOrigins = getEnvAsList("CORS_ALLOWED_ORIGINS", c.AllowedOrigins)
+	c.CookieSecure = env.getEnvAsBool("COOKIE_SECURE", c.CookieSecure)
+	c.TrustedProxies = getEnvAsList("TRUSTED_PROXIES", c.TrustedProxies)
+	c.BcryptCost = env.getEnvAsInt("BCRYPT_COST", c.BcryptCost)
+	c.RequestTimeout = env.getEnvAsDuration("REQUEST_TIMEOUT", c.RequestTimeout)
+	c.ShutdownTimeout = env.getEnvAsDuration("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+
+	c.RateLimits.Global.Requests = env.getEnvAsInt("RATE_LIMIT_GLOBAL_REQUESTS", c.RateLimits.Global.Requests)
+	c.RateLimits.Global.Burst = env.getEnvAsInt("RATE_LIMIT_GLOBAL_BURST", c.RateLimits.Global.Burst)
+	c.RateLimits.Auth.Requests = env.getEnvAsInt("RATE_LIMIT_AUTH_REQUESTS", c.RateLimits.Auth.Requests)
+	c.RateLimits.Auth.Burst = env.getEnvAsInt("RATE_LIMIT_AUTH_BURST", c.RateLimits.Auth.Burst)
+	c.RateLimits.API.Requests = env.getEnvAsInt("RATE_LIMIT_API_REQUESTS", c.RateLimits.API.Requests)
+	c.RateLimits.API.Burst = env.getEnvAsInt("RATE_LIMIT_API_BURST", c.RateLimits.API.Burst)
+
+	c.Channels.RestrictPinsToOwners = env.getEnvAsBool("RESTRICT_PINS_TO_OWNERS", c.Channels.RestrictPinsToOwners)
+
+	c.Scheduler.PollInterval = env.getEnvAsDuration("SCHEDULER_POLL_INTERVAL", c.Scheduler.PollInterval)
+
+	c.Uploads.MaxBytes = int64(env.getEnvAsInt("UPLOAD_MAX_BYTES", int(c.Uploads.MaxBytes)))
+
+	c.SMTP.Host = getEnv("SMTP_HOST", c.SMTP.Host)
+	c.SMTP.Port = env.getEnvAsInt("SMTP_PORT", c.SMTP.Port)
+	c.SMTP.Username = getEnv("SMTP_USERNAME", c.SMTP.Username)
+	c.SMTP.Password = getEnv("SMTP_PASSWORD", c.SMTP.Password)
+	c.SMTP.From = getEnv("SMTP_FROM", c.SMTP.From)
+
+	c.Email.BaseURL = getEnv("EMAIL_BASE_URL", c.Email.BaseURL)
+	c.Email.MentionDelay = env.getEnvAsDuration("EMAIL_MENTION_DELAY", c.Email.MentionDelay)
+	c.Email.DigestHour = env.getEnvAsInt("EMAIL_DIGEST_HOUR", c.Email.DigestHour)
+
+	c.Push.VAPIDPublicKey = getEnv("PUSH_VAPID_PUBLIC_KEY", c.Push.VAPIDPublicKey)
+	c.Push.VAPIDPrivateKey = getEnv("PUSH_VAPID_PRIVATE_KEY", c.Push.VAPIDPrivateKey)
+	c.Push.Subject = getEnv("PUSH_SUBJECT", c.Push.Subject)
+
+	c.Metrics.Enabled = env.getEnvAsBool("METRICS_ENABLED", c.Metrics.Enabled)
+	c.Metrics.Username = getEnv("METRICS_USERNAME", c.Metrics.Username)
+	c.Metrics.Password = getEnv("METRICS_PASSWORD", c.Metrics.Password)
+	c.Metrics.AllowedIPs = getEnvAsList("METRICS_ALLOWED_IPS", c.Metrics.AllowedIPs)
+
+	c.Tracing.Exporter = getEnv("TRACING_EXPORTER", c.Tracing.Exporter)
+	c.Tracing.Endpoint = getEnv("TRACING_ENDPOINT", c.Tracing.Endpoint)
+	c.Tracing.SampleRatio = env.getEnvAsFloat("TRACING_SAMPLE_RATIO", c.Tracing.SampleRatio)
+	c.Tracing.ServiceName = getEnv("TRACING_SERVICE_NAME", c.Tracing.ServiceName)
+
+	c.Log.Level = getEnv("LOG_LEVEL", c.Log.Level)
+	c.Log.Format = getEnv("LOG_FORMAT", c.Log.Format)
+	c.Log.Components = env.getEnvAsMap("LOG_COMPONENTS", c.Log.Components)
+	c.Log.SQL.Enabled = env.getEnvAsBool("LOG_SQL", c.Log.SQL.Enabled)
+	c.Log.SQL.SlowThreshold = env.getEnvAsDuration("LOG_SQL_SLOW_THRESHOLD", c.Log.SQL.SlowThreshold)
+
+	c.DBPool.MaxOpenConns = env.getEnvAsInt("DB_MAX_OPEN_CONNS", c.DBPool.MaxOpenConns)
+	c.DBPool.MaxIdleConns = env.getEnvAsInt("DB_MAX_IDLE_CONNS", c.DBPool.MaxIdleConns)
+	c.DBPool.ConnMaxLifetime = env.getEnvAsDuration("DB_CONN_MAX_LIFETIME", c.DBPool.ConnMaxLifetime)
+
+	c.SQLite.WAL = env.getEnvAsBool("SQLITE_WAL", c.SQLite.WAL)
+	c.SQLite.BusyTimeout = env.getEnvAsDuration("SQLITE_BUSY_TIMEOUT", c.SQLite.BusyTimeout)
+
+	c.Backup.Dir = getEnv("BACKUP_DIR", c.Backup.Dir)
+	c.Backup.Interval = env.getEnvAsDuration("BACKUP_INTERVAL", c.Backup.Interval)
+	c.Backup.Keep = env.getEnvAsInt("BACKUP_KEEP", c.Backup.Keep)
+
+	c.Export.Dir = getEnv("EXPORT_DIR", c.Export.Dir)
+	c.Export.Keep = env.getEnvAsInt("EXPORT_KEEP", c.Export.Keep)
+
+	c.Retention.Days = env.getEnvAsInt("RETENTION_DAYS", c.Retention.Days)
+	c.Retention.Interval = env.getEnvAsDuration("RETENTION_INTERVAL", c.Retention.Interval)
+	c.Retention.BatchSize = env.getEnvAsInt("RETENTION_BATCH_SIZE", c.Retention.BatchSize)
+
+	c.Erasure.Messages = getEnv("ERASURE_MESSAGES", c.Erasure.Messages)
+
+	return errors.Join(env.errs...)
+}
+
+// Validate reports every invalid setting at once so operators can fix them together
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Environment == EnvDevelopment || c.Environment == EnvProduction || c.Environment == EnvTest,
+		"environment must be one of %s, %s, %s (got %q)", EnvDevelopment, EnvProduction, EnvTest, c.Environment)
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port <= 65535, "port must be between 1 and 65535 (got %q)", c.Port)
+	check(c.DatabaseURL != "", "database_url is required")
+	check(c.JWTSecret != "", "jwt_secret is required")
+	check(c.BcryptCost >= 4 && c.BcryptCost <= 31, "bcrypt_cost must be between 4 and 31 (got %d)", c.BcryptCost)
+	check(c.RequestTimeout > 0, "request_timeout must be positive")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && parsed.Path == "",
+			"allowed_origins entry %q must be \"*\" or a scheme and host such as https://chat.example.com", origin)
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil,
+			"trusted_proxies entry %q must be an IP address or CIDR range", proxy)
+	}
+
+	for name, limit := range map[string]RateLimit{
+		"global": c.RateLimits.Global,
+		"auth":   c.RateLimits.Auth,
+		"api":    c.RateLimits.API,
+	} {
+		check(limit.Requests > 0, "rate_limits.%s.requests must be positive", name)
+		check(limit.Per > 0, "rate_limits.%s.per must be positive", name)
+		check(limit.Burst > 0, "rate_limits.%s.burst must be positive", name)
+	}
+
+	check(c.Scheduler.PollInterval > 0, "scheduler.poll_interval must be positive")
+	check(c.Uploads.MaxBytes > 0, "uploads.max_bytes must be positive")
+
+	if c.SMTP.Host != "" {
+		check(c.SMTP.Port > 0 && c.SMTP.Port <= 65535, "smtp.port must be between 1 and 65535 (got %d)", c.SMTP.Port)
+		check(strings.Contains(c.SMTP.From, "@"), "smtp.from must be an email address when smtp.host is set")
+	}
+
+	baseURL, err := url.Parse(c.Email.BaseURL)
+	check(err == nil && (baseURL.Scheme == "http" || baseURL.Scheme == "https") && baseURL.Host != "",
+		"email.base_url must be an http or https URL (got %q)", c.Email.BaseURL)
+	check(c.Email.MentionDelay >= 0, "email.mention_delay must not be negative")
+	check(c.Email.DigestHour >= 0 && c.Email.DigestHour <= 23, "email.digest_hour must be between 0 and 23 (got %d)", c.Email.DigestHour)
+
+	check((c.Push.VAPIDPublicKey == "") == (c.Push.VAPIDPrivateKey == ""),
+		"push.vapid_public_key and push.vapid_private_key must be set together")
+	check(c.Push.Subject == "" || validPushSubject(c.Push.Subject),
+		"push.subject must be a mailto: or https:// contact (got %q)", c.Push.Subject)
+
+	check((c.Metrics.Username == "") == (c.Metrics.Password == ""),
+		"metrics.username and metrics.password must be set together")
+	for _, allowed := range c.Metrics.AllowedIPs {
+		_, _, cidrErr := net.ParseCIDR(allowed)
+		check(cidrErr == nil || net.ParseIP(allowed) != nil,
+			"metrics.allowed_ips entry %q must be an IP address or CIDR range", allowed)
+	}
+
+	check(c.Tracing.Exporter == TracingExporterNone || c.Tracing.Exporter == TracingExporterOTLP || c.Tracing.Exporter == TracingExporterStdout,
+		"tracing.exporter must be one of %s, %s, %s (got %q)", TracingExporterNone, TracingExporterOTLP, TracingExporterStdout, c.Tracing.Exporter)
+	if c.Tracing.Exporter == TracingExporterOTLP {
+		endpoint, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "",
+			"tracing.endpoint must be an http or https URL (got %q)", c.Tracing.Endpoint)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1 (got %g)", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+
+	check(validLogLevel(c.Log.Level), "log.level must be one of debug, info, warn, error (got %q)", c.Log.Level)
+	check(c.Log.Format == LogFormatJSON || c.Log.Format == LogFormatText,
+		"log.format must be %s or %s (got %q)", LogFormatJSON, LogFormatText, c.Log.Format)
+	for component, level := range c.Log.Components {
+		check(slices.Contains(LogComponents, component),
+			"log.components has unknown component %q; use one of %s", component, strings.Join(LogComponents, ", "))
+		check(validLogLevel(level), "log.components.%s must be one of debug, info, warn, error (got %q)", component, level)
 	}
+	check(c.Log.SQL.SlowThreshold >= 0, "log.sql.slow_threshold must not be negative")
+
+	check(c.DBPool.MaxOpenConns >= 0, "db_pool.max_open_conns must not be negative")
+	check(c.DBPool.MaxIdleConns >= 0, "db_pool.max_idle_conns must not be negative")
+	check(c.DBPool.ConnMaxLifetime >= 0, "db_pool.conn_max_lifetime must not be negative")
+	check(c.SQLite.BusyTimeout >= 0, "sqlite.busy_timeout must not be negative")
+
+	check(c.Backup.Dir != "", "backup.dir is required")
+	check(c.Backup.Interval >= 0, "backup.interval must not be negative")
+	check(c.Backup.Keep > 0, "backup.keep must be positive (got %d)", c.Backup.Keep)
+	check(c.Export.Dir != "", "export.dir is required")
+	check(c.Export.Keep > 0, "export.keep must be positive (got %d)", c.Export.Keep)
+	check(c.Retention.Days >= 0, "retention.days must not be negative (got %d)", c.Retention.Days)
+	check(c.Retention.Interval > 0, "retention.interval must be positive")
+	check(c.Retention.BatchSize > 0, "retention.batch_size must be positive (got %d)", c.Retention.BatchSize)
+	check(c.Erasure.Messages == ErasureMessagesKeep || c.Erasure.Messages == ErasureMessagesDelete,
+		"erasure.messages must be %s or %s (got %q)", ErasureMessagesKeep, ErasureMessagesDelete, c.Erasure.Messages)
+
+	if c.IsProduction() {
+		check(c.JWTSecret != DefaultJWTSecret, "jwt_secret must be changed from the default in production")
+		check(len(c.JWTSecret) >= minProductionSecretLength,
+			"jwt_secret must be at least %d characters in production", minProductionSecretLength)
+		check(c.CookieSecure, "cookie_secure must be true in production, where the server is behind HTTPS")
+		// Push services may refuse messages whose VAPID subject is not a
+		// mailto: or https: contact, such as the default http://localhost base URL
+		check(validPushSubject(c.PushSubject()),
+			"push.subject must be set, or email.base_url be https, in production (push subject is %q)", c.PushSubject())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -26,11 +574,98 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func validLogLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
+
+// envReader parses typed environment overrides and remembers malformed values
+// instead of silently falling back to the default
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be an integer (got %q)", key, value))
+			return defaultValue
+		}
+		return intValue
+	}
+	return defaultValue
+}
+
+func (r *envReader) getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be true or false (got %q)", key, value))
+			return defaultValue
 		}
+		return boolValue
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func (r *envReader) getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a number (got %q)", key, value))
+			return defaultValue
+		}
+		return floatValue
+	}
+	return defaultValue
+}
+
+// getEnvAsMap parses comma-separated key=value pairs such as "http=warn,sql=debug"
+func (r *envReader) getEnvAsMap(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	items := make(map[string]string)
+	for _, pair := range getEnvAsList(key, nil) {
+		name, item, ok := strings.Cut(pair, "=")
+		if !ok {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a list of key=value pairs (got %q)", key, value))
+			return defaultValue
+		}
+		items[strings.TrimSpace(name)] = strings.TrimSpace(item)
+	}
+	return items
+}
+
+func (r *envReader) getEnvAsDuration(key string, defaultValue Duration) Duration {
+	if value := os.Getenv(key); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a duration such as 30s (got %q)", key, value))
+			return defaultValue
+		}
+		return Duration(duration)
+	}
+	return defaultValue
+}
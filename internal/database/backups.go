@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"turnate/internal/models"
+)
+
+// Backups are named after the time they were taken, so their age is known
+// from the name alone and they sort chronologically
+const (
+	backupPrefix     = "turnate-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// ErrBackupNotFound is returned for a name or time that matches no backup
+var ErrBackupNotFound = errors.New("backup not found")
+
+// BackupFile is one backup in the backup directory
+type BackupFile struct {
+	Name      string
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// Backups writes verified backups into a directory and keeps the newest few.
+// Files in the directory that are not named like its backups are left alone.
+type Backups struct {
+	db   *gorm.DB
+	dir  string
+	keep int
+	// mu serializes backups started by the scheduler and the admin API
+	mu sync.Mutex
+}
+
+func NewBackups(db *gorm.DB, dir string, keep int) *Backups {
+	return &Backups{db: db, dir: dir, keep: keep}
+}
+
+// Create backs up the database now, verifies the copy and removes the oldest
+// backups beyond the retention count
+func (b *Backups) Create(ctx context.Context, now time.Time) (*BackupFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.create(ctx, now)
+}
+
+// CreateDue backs up the database if the newest backup is at least interval
+// old, and returns nil otherwise. Because it goes by the files, restarts do
+// not cause extra backups.
+func (b *Backups) CreateDue(ctx context.Context, now time.Time, interval time.Duration) (*BackupFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	files, err := b.list()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 && now.Sub(files[0].CreatedAt) < interval {
+		return nil, nil
+	}
+	return b.create(ctx, now)
+}
+
+// List returns the backups, newest first
+func (b *Backups) List() ([]BackupFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.list()
+}
+
+// Get returns the backup with the given name. Only names of backups in the
+// directory are accepted, so the name cannot reach other files.
+func (b *Backups) Get(name string) (*BackupFile, error) {
+	if _, ok := parseBackupName(name); !ok {
+		return nil, ErrBackupNotFound
+	}
+	return b.stat(name)
+}
+
+// At returns the newest backup taken at or before t, to restore the database
+// as it was then
+func (b *Backups) At(t time.Time) (*BackupFile, error) {
+	files, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !file.CreatedAt.After(t) {
+			return &file, nil
+		}
+	}
+	return nil, ErrBackupNotFound
+}
+
+func (b *Backups) create(ctx context.Context, now time.Time) (*BackupFile, error) {
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := backupPrefix + now.UTC().Format(backupTimeFormat) + backupSuffix
+	path := filepath.Join(b.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	// Write under a temporary name so a failed or partial backup is never listed
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale backup: %w", err)
+	}
+	if err := Backup(ctx, b.db, tmp); err != nil {
+		return nil, err
+	}
+	if err := Verify(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("failed to save backup: %w", err)
+	}
+
+	if err := b.prune(); err != nil {
+		return nil, err
+	}
+	return b.stat(name)
+}
+
+func (b *Backups) list() ([]BackupFile, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var files []BackupFile
+	for _, entry := range entries {
+		createdAt, ok := parseBackupName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups: %w", err)
+		}
+		files = append(files, BackupFile{
+			Name:      entry.Name(),
+			Path:      filepath.Join(b.dir, entry.Name()),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+
+	slices.SortFunc(files, func(a, b BackupFile) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return files, nil
+}
+
+// prune removes the backups beyond the newest keep
+func (b *Backups) prune() error {
+	files, err := b.list()
+	if err != nil || len(files) <= b.keep {
+		return err
+	}
+	for _, file := range files[b.keep:] {
+		if err := os.Remove(file.Path); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *Backups) stat(name string) (*BackupFile, error) {
+	createdAt, _ := parseBackupName(name)
+	path := filepath.Join(b.dir, name)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBackupNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return &BackupFile{Name: name, Path: path, Size: info.Size(), CreatedAt: createdAt}, nil
+}
+
+func parseBackupName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, backupPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, backupSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	createdAt, err := time.Parse(backupTimeFormat, stamp)
+	return createdAt, err == nil
+}
+
+// Verify checks that the file at path is an intact Turnate database: SQLite's
+// integrity check passes and the users table exists
+func Verify(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	db, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer sqlDB.Close()
+
+	var result string
+	if err := db.WithContext(ctx).Raw("PRAGMA integrity_check").Row().Scan(&result); err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s failed the integrity check: %s", path, result)
+	}
+	if !db.Migrator().HasTable(&models.User{}) {
+		return fmt.Errorf("%s is not a Turnate database", path)
+	}
+	return nil
+}
+
+// Restore replaces the database file at dbPath with a verified copy of the
+// backup. The server must be stopped first: Restore takes the database lock
+// exclusively and returns ErrInUse while a server or command holds it. The
+// replaced database and its WAL are kept beside it with a .before-restore
+// suffix; the returned path is empty if there was no database to replace.
+func Restore(ctx context.Context, backupPath, dbPath string, now time.Time) (string, error) {
+	dbLock, err := lock(dbPath, true)
+	if errors.Is(err, ErrInUse) {
+		return "", fmt.Errorf("%w; stop the server before restoring", err)
+	} else if err != nil {
+		return "", err
+	}
+	defer dbLock.Release()
+
+	if err := Verify(ctx, backupPath); err != nil {
+		return "", err
+	}
+
+	tmp := dbPath + ".restoring"
+	if err := copyFile(backupPath, tmp); err != nil {
+		return "", fmt.Errorf("failed to copy backup: %w", err)
+	}
+	if err := Verify(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + ".before-restore-" + now.UTC().Format(backupTimeFormat)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Rename(dbPath+suffix, previous+suffix)
+			if err != nil && !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to move the current database aside: %w", err)
+			}
+		}
+	}
+
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return "", fmt.Errorf("failed to restore database: %w", err)
+	}
+	return previous, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// FilePath returns the file behind a database URL such as turnate.db or
+// file:/data/turnate.db?cache=shared
+func FilePath(databaseURL string) (string, error) {
+	path, _, _ := strings.Cut(strings.TrimPrefix(databaseURL, "file:"), "?")
+	if path == "" || path == ":memory:" || strings.Contains(databaseURL, "mode=memory") {
+		return "", fmt.Errorf("database %q is not a file", databaseURL)
+	}
+	return path, nil
+}
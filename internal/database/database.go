@@ -2,30 +2,64 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"net/url"
+	"strings"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-)
 
-var DB *gorm.DB
+	"turnate/internal/config"
+	"turnate/internal/logging"
+	"turnate/internal/metrics"
+	"turnate/internal/tracing"
+)
 
-func Connect(databaseURL string) error {
-	var err error
-	
-	DB, err = gorm.Open(sqlite.Open(databaseURL), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+// Connect opens the database and applies the configured pool limits
+func Connect(cfg *config.Config) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(DSN(cfg)), &gorm.Config{
+		Logger: logging.NewGORMLogger(cfg.Log.SQL),
 	})
 	
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+
+	if err := db.Use(metrics.GORMPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to register database metrics: %w", err)
+	}
+	if err := db.Use(tracing.GORMPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to register database tracing: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access database pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.DBPool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBPool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DBPool.ConnMaxLifetime.Std())
 	
-	log.Println("Database connected successfully")
-	return nil
+	logging.Component(logging.ComponentServer).Info("database connected")
+	return db, nil
 }
 
-func GetDB() *gorm.DB {
-	return DB
-}
\ No newline at end of file
+// DSN adds the configured journal mode and busy timeout to the database URL.
+// Both are applied by the driver to every connection in the pool.
+func DSN(cfg *config.Config) string {
+	params := url.Values{}
+	if cfg.SQLite.WAL {
+		// NORMAL is durable against application crashes in WAL mode and only
+		// risks the last transactions on power loss
+		params.Set("_journal_mode", "WAL")
+		params.Set("_synchronous", "NORMAL")
+	} else {
+		params.Set("_journal_mode", "DELETE")
+	}
+	params.Set("_busy_timeout", fmt.Sprint(cfg.SQLite.BusyTimeout.Std().Milliseconds()))
+
+	separator := "?"
+	if strings.Contains(cfg.DatabaseURL, "?") {
+		separator = "&"
+	}
+	return cfg.DatabaseURL + separator + params.Encode()
+}
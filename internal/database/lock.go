@@ -0,0 +1,45 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrInUse means another process holds the database lock: a running server
+// or operator command while restoring, or a restore while starting
+var ErrInUse = errors.New("database is in use by another process")
+
+// Lock is an advisory lock on a database file, kept in a .lock file beside
+// it. The server and operator commands hold it shared for as long as they
+// use the database; Restore holds it exclusively while it swaps the files.
+type Lock struct {
+	file *os.File
+}
+
+// Share takes the lock shared without waiting, returning ErrInUse while a
+// restore holds it
+func Share(dbPath string) (*Lock, error) {
+	return lock(dbPath, false)
+}
+
+func lock(dbPath string, exclusive bool) (*Lock, error) {
+	file, err := os.OpenFile(dbPath+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database lock: %w", err)
+	}
+	if err := flock(file, exclusive); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Lock{file: file}, nil
+}
+
+// Release gives up the lock. A nil lock, as for in-memory databases, is
+// allowed.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
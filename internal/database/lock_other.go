@@ -0,0 +1,11 @@
+//go:build !unix
+
+package database
+
+import "os"
+
+// flock is only implemented on Unix; elsewhere the operator must make sure
+// the server is stopped before restoring
+func flock(*os.File, bool) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// Backup writes a consistent copy of the database to path with VACUUM INTO.
+// It is safe while the server is running and refuses to overwrite a file.
+func Backup(ctx context.Context, db *gorm.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to check backup file: %w", err)
+	}
+
+	if err := db.WithContext(ctx).Exec("VACUUM INTO ?", path).Error; err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file, returning the space of deleted rows to
+// the filesystem. It needs free disk space of about the database size.
+func Vacuum(ctx context.Context, db *gorm.DB) error {
+	if err := db.WithContext(ctx).Exec("VACUUM").Error; err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
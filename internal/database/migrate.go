@@ -2,10 +2,13 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"strings"
+	"time"
 	
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	
+	"turnate/internal/logging"
 	"turnate/internal/models"
 )
 
@@ -18,6 +21,81 @@ func AutoMigrateModels(db *gorm.DB) error {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 
-	log.Println("Auto-migration completed successfully")
+	if err := backfillThreadStats(db); err != nil {
+		return fmt.Errorf("failed to backfill thread statistics: %w", err)
+	}
+
+	if err := backfillThreadFollows(db); err != nil {
+		return fmt.Errorf("failed to backfill thread follows: %w", err)
+	}
+
+	logging.Component(logging.ComponentServer).Info("auto-migration completed")
+	return nil
+}
+
+// PendingMigrations checks that every model's table and columns exist, so a
+// server pointed at a database from an older version, or one whose migration
+// failed, is not reported ready
+func PendingMigrations(db *gorm.DB) error {
+	var missing []string
+	migrator := db.Migrator()
+	for _, model := range models.All() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if !migrator.HasTable(model) {
+			missing = append(missing, stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				missing = append(missing, stmt.Schema.Table+"."+field.DBName)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("pending migrations for %s", strings.Join(missing, ", "))
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// backfillThreadStats fills the denormalized reply count and last reply time of
+// thread roots written before those columns existed. Roots that already have a
+// count are maintained at write time and left alone.
+func backfillThreadStats(db *gorm.DB) error {
+	return db.Exec(`UPDATE messages SET
+		reply_count = (SELECT COUNT(*) FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL),
+		last_reply_at = (SELECT MAX(created_at) FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL)
+		WHERE thread_id IS NULL AND reply_count = 0
+		AND EXISTS (SELECT 1 FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL)`).Error
+}
+
+// backfillThreadFollows makes the participants of threads written before
+// follows existed follow them, with everything so far marked read. It only
+// runs while no follows exist; afterwards replies maintain follows themselves.
+func backfillThreadFollows(db *gorm.DB) error {
+	var existing int64
+	if err := db.Model(&models.ThreadFollow{}).Count(&existing).Error; err != nil || existing > 0 {
+		return err
+	}
+
+	var participants []struct {
+		ThreadID models.UUIDv7
+		UserID   models.UUIDv7
+	}
+	err := db.Raw(`SELECT thread_id, user_id FROM messages WHERE thread_id IS NOT NULL AND deleted_at IS NULL
+		UNION
+		SELECT id, user_id FROM messages WHERE thread_id IS NULL AND reply_count > 0 AND deleted_at IS NULL`).
+		Scan(&participants).Error
+	if err != nil || len(participants) == 0 {
+		return err
+	}
+
+	now := time.Now()
+	follows := make([]models.ThreadFollow, len(participants))
+	for i, p := range participants {
+		follows[i] = models.ThreadFollow{ThreadID: p.ThreadID, UserID: p.UserID, Following: true, LastReadAt: &now}
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(follows, 500).Error
+}
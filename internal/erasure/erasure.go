@@ -0,0 +1,193 @@
+// Package erasure erases user accounts on request. Requests are made and
+// reviewed through the erasure service; the erasure job here then anonymizes
+// approved accounts, removes their memberships, sessions and personal data,
+// and keeps or deletes their messages according to the workspace policy.
+package erasure
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/export"
+	"turnate/internal/logging"
+	"turnate/internal/models"
+)
+
+// DeletedContent replaces the content of an erased user's thread roots that
+// others replied to, when messages are deleted
+const DeletedContent = "This message was deleted."
+
+// Policy chooses what happens to an erased user's messages: kept, attributed
+// to the anonymized account, or deleted
+type Policy struct {
+	DeleteMessages bool
+}
+
+// Erasures erases the accounts of approved erasure requests
+type Erasures struct {
+	db      *gorm.DB
+	policy  Policy
+	exports *export.PersonalExports
+}
+
+// NewErasures returns the erasure manager. Erased users' personal exports are
+// deleted from exports when it is set.
+func NewErasures(db *gorm.DB, policy Policy, exports *export.PersonalExports) *Erasures {
+	return &Erasures{db: db, policy: policy, exports: exports}
+}
+
+// Policy returns the message policy erasures apply
+func (e *Erasures) Policy() Policy {
+	return e.policy
+}
+
+// EraseApproved erases the accounts of approved requests, one transaction per
+// account, and returns how many were erased. Requests of users put on legal
+// hold since approval wait until the hold is lifted.
+func (e *Erasures) EraseApproved(ctx context.Context, now time.Time) (int, error) {
+	db := e.db.WithContext(ctx)
+	var requests []models.ErasureRequest
+	err := db.Where("status = ?", models.ErasureStatusApproved).
+		Where("user_id NOT IN (?)", db.Unscoped().Model(&models.User{}).Select("id").Where("legal_hold = ?", true)).
+		Order("id").Find(&requests).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find approved erasure requests: %w", err)
+	}
+
+	erased := 0
+	for _, request := range requests {
+		if err := ctx.Err(); err != nil {
+			return erased, err
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := e.erase(tx, request.UserID); err != nil {
+				return err
+			}
+			return tx.Model(&request).Updates(map[string]any{"status": models.ErasureStatusCompleted, "completed_at": now.UTC()}).Error
+		})
+		if err != nil {
+			return erased, fmt.Errorf("failed to erase user %s: %w", request.UserID, err)
+		}
+		erased++
+		logging.Component(logging.ComponentServer).Info("user erased", "user_id", request.UserID, "request_id", request.ID)
+
+		if e.exports != nil {
+			if err := e.exports.Delete(request.UserID); err != nil {
+				return erased, err
+			}
+		}
+	}
+	return erased, nil
+}
+
+// erase removes everything personal about the user and anonymizes the
+// account. Deactivating it signs every session out.
+func (e *Erasures) erase(tx *gorm.DB, userID models.UUIDv7) error {
+	if e.policy.DeleteMessages {
+		if err := deleteMessages(tx, userID); err != nil {
+			return err
+		}
+	}
+
+	personal := []any{
+		&models.ChannelMember{},
+		&models.PushSubscription{},
+		&models.SavedItem{},
+		&models.Reminder{},
+		&models.Notification{},
+		&models.ScheduledMessage{},
+		&models.ThreadFollow{},
+		&models.NotificationSettings{},
+		&models.ChannelNotificationPreference{},
+		&models.UserGroupMember{},
+	}
+	for _, model := range personal {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return fmt.Errorf("failed to delete %T: %w", model, err)
+		}
+	}
+
+	// The username keeps to the characters allowed at registration
+	anonymous := "erased_" + hex.EncodeToString(userID[:])
+	err := tx.Unscoped().Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"username":     anonymous,
+		"email":        userID.String() + "@erased.invalid",
+		"display_name": "Erased user",
+		"password":     "!erased",
+		"role":         models.UserRoleNormal,
+		"is_active":    false,
+		"last_seen_at": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+	return nil
+}
+
+// deleteMessages deletes the user's replies and the threads they started that
+// nobody else replied to, together with the rows that refer to them. Threads
+// others replied to keep their root with its content replaced, so the replies
+// stay readable. Messages in channels on legal hold are kept.
+func deleteMessages(tx *gorm.DB, userID models.UUIDv7) error {
+	held := tx.Unscoped().Model(&models.Channel{}).Select("id").Where("legal_hold = ?", true)
+	authored := func() *gorm.DB {
+		return tx.Unscoped().Model(&models.Message{}).Where("user_id = ? AND channel_id NOT IN (?)", userID, held)
+	}
+
+	var threads []models.UUIDv7
+	if err := authored().Where("thread_id IS NOT NULL").Distinct().Pluck("thread_id", &threads).Error; err != nil {
+		return fmt.Errorf("failed to find replies: %w", err)
+	}
+
+	others := `EXISTS (SELECT 1 FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.user_id <> ?)`
+	var ids []models.UUIDv7
+	err := authored().Where("(thread_id IS NOT NULL OR NOT "+others+")", userID).Pluck("id", &ids).Error
+	if err != nil {
+		return fmt.Errorf("failed to find messages: %w", err)
+	}
+
+	for start := 0; start < len(ids); start += 500 {
+		batch := ids[start:min(start+500, len(ids))]
+		related := []struct {
+			model  any
+			column string
+		}{
+			{&models.SavedItem{}, "message_id"},
+			{&models.Reminder{}, "message_id"},
+			{&models.Notification{}, "message_id"},
+			{&models.ScheduledMessage{}, "message_id"},
+			{&models.ThreadFollow{}, "thread_id"},
+		}
+		for _, r := range related {
+			if err := tx.Unscoped().Where(r.column+" IN ?", batch).Delete(r.model).Error; err != nil {
+				return fmt.Errorf("failed to delete %T: %w", r.model, err)
+			}
+		}
+		if err := tx.Unscoped().Where("id IN ?", batch).Delete(&models.Message{}).Error; err != nil {
+			return fmt.Errorf("failed to delete messages: %w", err)
+		}
+	}
+
+	err = authored().Where("thread_id IS NULL AND "+others, userID).
+		Updates(map[string]any{"content": DeletedContent, "pinned_at": nil, "pinned_by": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to clear messages: %w", err)
+	}
+
+	// The threads the user replied to lost replies
+	for start := 0; start < len(threads); start += 500 {
+		batch := threads[start:min(start+500, len(threads))]
+		err := tx.Exec(`UPDATE messages SET
+			reply_count = (SELECT COUNT(*) FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL),
+			last_reply_at = (SELECT MAX(created_at) FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL)
+			WHERE id IN ?`, batch).Error
+		if err != nil {
+			return fmt.Errorf("failed to update thread statistics: %w", err)
+		}
+	}
+	return nil
+}
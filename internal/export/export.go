@@ -0,0 +1,381 @@
+// Package export writes the workspace to a zip of JSON files for archiving
+// or migrating. The format is described in docs/EXPORT_FORMAT.md.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/models"
+)
+
+// Format and Version identify the export format; Version increases whenever
+// a field is removed or changes meaning
+const (
+	Format  = "turnate-export"
+	Version = 1
+)
+
+// batchSize is how many rows are read at a time, so memory use does not grow
+// with the size of the workspace
+const batchSize = 500
+
+const timeFormat = "2006-01-02T15:04:05Z"
+
+// Options choose what goes into an export. Public channels are always
+// included. Private channels are included when named in PrivateChannels, or
+// all of them when IncludePrivate is set.
+type Options struct {
+	IncludePrivate  bool     `json:"include_private"`
+	PrivateChannels []string `json:"private_channels,omitempty"`
+}
+
+// Manifest is manifest.json, written last so it can carry the counts
+type Manifest struct {
+	Format     string  `json:"format"`
+	Version    int     `json:"version"`
+	ExportedAt string  `json:"exported_at"`
+	Options    Options `json:"options"`
+	Counts     Counts  `json:"counts"`
+	// Channels names the exported channels
+	Channels []string `json:"channels"`
+}
+
+type Counts struct {
+	Users       int `json:"users"`
+	Channels    int `json:"channels"`
+	Memberships int `json:"memberships"`
+	Messages    int `json:"messages"`
+	Bookmarks   int `json:"bookmarks"`
+}
+
+type User struct {
+	ID          string  `json:"id"`
+	Username    string  `json:"username"`
+	Email       string  `json:"email"`
+	DisplayName string  `json:"display_name"`
+	Role        string  `json:"role"`
+	IsActive    bool    `json:"is_active"`
+	CreatedAt   string  `json:"created_at"`
+	LastSeenAt  *string `json:"last_seen_at,omitempty"`
+}
+
+type Channel struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Type        string     `json:"type"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   string     `json:"created_at"`
+	Bookmarks   []Bookmark `json:"bookmarks"`
+}
+
+type Bookmark struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Kind      string `json:"kind"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Membership struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	JoinedAt  string `json:"joined_at"`
+}
+
+// Message is a channel message or, with ThreadID set, a reply in a thread
+type Message struct {
+	ID                string  `json:"id"`
+	ChannelID         string  `json:"channel_id"`
+	UserID            string  `json:"user_id"`
+	ThreadID          *string `json:"thread_id,omitempty"`
+	Type              string  `json:"type"`
+	Content           string  `json:"content"`
+	CreatedAt         string  `json:"created_at"`
+	UpdatedAt         string  `json:"updated_at"`
+	AlsoSentToChannel bool    `json:"also_sent_to_channel,omitempty"`
+	ReplyCount        int     `json:"reply_count,omitempty"`
+	PinnedAt          *string `json:"pinned_at,omitempty"`
+	PinnedBy          *string `json:"pinned_by,omitempty"`
+}
+
+// Write streams an export of the workspace to w as a zip archive. Rows are
+// read in batches and each file is written as it is read.
+func Write(ctx context.Context, db *gorm.DB, w io.Writer, opts Options, now time.Time) (*Manifest, error) {
+	db = db.WithContext(ctx)
+	archive := zip.NewWriter(w)
+	manifest := &Manifest{
+		Format:     Format,
+		Version:    Version,
+		ExportedAt: now.UTC().Format(timeFormat),
+		Options:    opts,
+		Channels:   []string{},
+	}
+
+	if err := writeUsers(db, archive, manifest); err != nil {
+		return nil, err
+	}
+
+	channels, err := selectChannels(db, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeChannels(db, archive, manifest, channels); err != nil {
+		return nil, err
+	}
+	if err := writeMemberships(db, archive, manifest, channels); err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if err := writeMessages(db, archive, manifest, channel); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeJSON(archive, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish export: %w", err)
+	}
+	return manifest, nil
+}
+
+// selectChannels returns the channels the options include, by name
+func selectChannels(db *gorm.DB, opts Options) ([]models.Channel, error) {
+	var channels []models.Channel
+	if err := db.Order("name").Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to read channels: %w", err)
+	}
+
+	selected := channels[:0]
+	for _, channel := range channels {
+		if channel.Type == models.ChannelTypePrivate && !opts.IncludePrivate && !slices.Contains(opts.PrivateChannels, channel.Name) {
+			continue
+		}
+		selected = append(selected, channel)
+	}
+	return selected, nil
+}
+
+func writeUsers(db *gorm.DB, archive *zip.Writer, manifest *Manifest) error {
+	array, err := createArray(archive, "users.json")
+	if err != nil {
+		return err
+	}
+
+	var batch []models.User
+	err = db.FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, user := range batch {
+			// The password hash is never exported
+			exported := User{
+				ID:          user.ID.String(),
+				Username:    user.Username,
+				Email:       user.Email,
+				DisplayName: user.DisplayName,
+				Role:        string(user.Role),
+				IsActive:    user.IsActive,
+				CreatedAt:   user.CreatedAt.UTC().Format(timeFormat),
+				LastSeenAt:  formatTime(user.LastSeenAt),
+			}
+			if err := array.write(exported); err != nil {
+				return err
+			}
+			manifest.Counts.Users++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to export users: %w", err)
+	}
+	return array.close()
+}
+
+func writeChannels(db *gorm.DB, archive *zip.Writer, manifest *Manifest, channels []models.Channel) error {
+	array, err := createArray(archive, "channels.json")
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		var bookmarks []models.ChannelBookmark
+		if err := db.Where("channel_id = ?", channel.ID).Order("id").Find(&bookmarks).Error; err != nil {
+			return fmt.Errorf("failed to export bookmarks: %w", err)
+		}
+
+		exported := Channel{
+			ID:          channel.ID.String(),
+			Name:        channel.Name,
+			Description: channel.Description,
+			Type:        string(channel.Type),
+			CreatedBy:   channel.CreatedBy.String(),
+			CreatedAt:   channel.CreatedAt.UTC().Format(timeFormat),
+			Bookmarks:   []Bookmark{},
+		}
+		for _, bookmark := range bookmarks {
+			exported.Bookmarks = append(exported.Bookmarks, Bookmark{
+				ID:        bookmark.ID.String(),
+				Title:     bookmark.Title,
+				URL:       bookmark.URL,
+				Kind:      string(bookmark.Kind),
+				CreatedBy: bookmark.CreatedBy.String(),
+				CreatedAt: bookmark.CreatedAt.UTC().Format(timeFormat),
+			})
+		}
+		if err := array.write(exported); err != nil {
+			return err
+		}
+		manifest.Counts.Channels++
+		manifest.Counts.Bookmarks += len(bookmarks)
+		manifest.Channels = append(manifest.Channels, channel.Name)
+	}
+	return array.close()
+}
+
+func writeMemberships(db *gorm.DB, archive *zip.Writer, manifest *Manifest, channels []models.Channel) error {
+	array, err := createArray(archive, "memberships.json")
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		var batch []models.ChannelMember
+		err := db.Where("channel_id = ?", channel.ID).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			for _, member := range batch {
+				exported := Membership{
+					ChannelID: member.ChannelID.String(),
+					UserID:    member.UserID.String(),
+					JoinedAt:  member.CreatedAt.UTC().Format(timeFormat),
+				}
+				if err := array.write(exported); err != nil {
+					return err
+				}
+				manifest.Counts.Memberships++
+			}
+			return nil
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to export memberships: %w", err)
+		}
+	}
+	return array.close()
+}
+
+// writeMessages writes a channel's messages and thread replies, oldest first,
+// to messages/<channel id>.json
+func writeMessages(db *gorm.DB, archive *zip.Writer, manifest *Manifest, channel models.Channel) error {
+	array, err := createArray(archive, "messages/"+channel.ID.String()+".json")
+	if err != nil {
+		return err
+	}
+
+	var batch []models.Message
+	err = db.Where("channel_id = ?", channel.ID).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, message := range batch {
+			exported := Message{
+				ID:                message.ID.String(),
+				ChannelID:         message.ChannelID.String(),
+				UserID:            message.UserID.String(),
+				Type:              string(message.Type),
+				Content:           message.Content,
+				CreatedAt:         message.CreatedAt.UTC().Format(timeFormat),
+				UpdatedAt:         message.UpdatedAt.UTC().Format(timeFormat),
+				AlsoSentToChannel: message.AlsoSentToChannel,
+				ReplyCount:        message.ReplyCount,
+				PinnedAt:          formatTime(message.PinnedAt),
+			}
+			if message.ThreadID != nil {
+				threadID := message.ThreadID.String()
+				exported.ThreadID = &threadID
+			}
+			if message.PinnedBy != nil {
+				pinnedBy := message.PinnedBy.String()
+				exported.PinnedBy = &pinnedBy
+			}
+			if err := array.write(exported); err != nil {
+				return err
+			}
+			manifest.Counts.Messages++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to export messages of #%s: %w", channel.Name, err)
+	}
+	return array.close()
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.UTC().Format(timeFormat)
+	return &formatted
+}
+
+func writeJSON(archive *zip.Writer, name string, v any) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// jsonArray writes a JSON array one element at a time, one element per line
+type jsonArray struct {
+	name  string
+	w     io.Writer
+	count int
+}
+
+func createArray(archive *zip.Writer, name string) (*jsonArray, error) {
+	file, err := archive.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return &jsonArray{name: name, w: file}, nil
+}
+
+func (a *jsonArray) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", a.name, err)
+	}
+	separator := ",\n"
+	if a.count == 0 {
+		separator = "[\n"
+	}
+	if _, err := io.WriteString(a.w, separator); err != nil {
+		return fmt.Errorf("failed to write %s: %w", a.name, err)
+	}
+	if _, err := a.w.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", a.name, err)
+	}
+	a.count++
+	return nil
+}
+
+func (a *jsonArray) close() error {
+	closing := "\n]\n"
+	if a.count == 0 {
+		closing = "[]\n"
+	}
+	if _, err := io.WriteString(a.w, closing); err != nil {
+		return fmt.Errorf("failed to write %s: %w", a.name, err)
+	}
+	return nil
+}
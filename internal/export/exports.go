@@ -0,0 +1,249 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/logging"
+)
+
+// Exports are named after the time they were started
+const (
+	filePrefix     = "turnate-export-"
+	fileSuffix     = ".zip"
+	fileTimeFormat = "20060102T150405Z"
+)
+
+var (
+	// ErrNotFound is returned for a name that matches no export
+	ErrNotFound = errors.New("export not found")
+	// ErrRunning is returned when an export is started while another runs
+	ErrRunning = errors.New("an export is already running")
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// File is an export in the export directory, or one that is still running or
+// failed since the server started
+type File struct {
+	Name      string
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+	Status    Status
+	Error     string
+}
+
+// Exports runs one export at a time in the background, writing into a
+// directory that keeps the newest few. Exports that have not finished when
+// the server stops are discarded.
+type Exports struct {
+	db   *gorm.DB
+	dir  string
+	keep int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running *File
+	failed  []File
+}
+
+func NewExports(db *gorm.DB, dir string, keep int) *Exports {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Exports{db: db, dir: dir, keep: keep, ctx: ctx, cancel: cancel}
+}
+
+// Start begins an export in the background and returns it as running
+func (e *Exports) Start(opts Options, now time.Time) (*File, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running != nil {
+		return nil, ErrRunning
+	}
+	if err := os.MkdirAll(e.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	name := filePrefix + now.UTC().Format(fileTimeFormat) + fileSuffix
+	file := &File{Name: name, Path: filepath.Join(e.dir, name), CreatedAt: now.UTC().Truncate(time.Second), Status: StatusRunning}
+	if _, err := os.Stat(file.Path); err == nil {
+		return nil, fmt.Errorf("export %s already exists", name)
+	}
+	e.running = file
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		err := e.run(file, opts, now)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.running = nil
+		if err != nil {
+			logging.Component(logging.ComponentServer).Error("export failed", "file", file.Name, "error", err)
+			failed := *file
+			failed.Status = StatusFailed
+			failed.Error = err.Error()
+			e.failed = append([]File{failed}, e.failed...)
+			if len(e.failed) > e.keep {
+				e.failed = e.failed[:e.keep]
+			}
+			return
+		}
+		if err := e.prune(); err != nil {
+			logging.Component(logging.ComponentServer).Error("failed to remove old exports", "error", err)
+		}
+	}()
+
+	running := *file
+	return &running, nil
+}
+
+// run writes the export under a temporary name so an unfinished export is
+// never offered for download
+func (e *Exports) run(file *File, opts Options, now time.Time) error {
+	tmp := file.Path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create export: %w", err)
+	}
+
+	manifest, err := Write(e.ctx, e.db, out, opts, now)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, file.Path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save export: %w", err)
+	}
+	logging.Component(logging.ComponentServer).Info("export completed", "file", file.Name,
+		"channels", manifest.Counts.Channels, "messages", manifest.Counts.Messages)
+	return nil
+}
+
+// List returns the running export, completed exports and recent failures,
+// newest first
+func (e *Exports) List() ([]File, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	files, err := e.completed()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, e.failed...)
+	if e.running != nil {
+		files = append(files, *e.running)
+	}
+	slices.SortStableFunc(files, func(a, b File) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return files, nil
+}
+
+// Get returns the export with the given name. Only names of exports in the
+// directory are accepted, so the name cannot reach other files.
+func (e *Exports) Get(name string) (*File, error) {
+	files, err := e.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Name == name {
+			return &file, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Close cancels a running export and waits for it to stop
+func (e *Exports) Close() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+func (e *Exports) completed() ([]File, error) {
+	entries, err := os.ReadDir(e.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+
+	var files []File
+	for _, entry := range entries {
+		createdAt, ok := parseFileName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list exports: %w", err)
+		}
+		files = append(files, File{
+			Name:      entry.Name(),
+			Path:      filepath.Join(e.dir, entry.Name()),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+			Status:    StatusCompleted,
+		})
+	}
+	return files, nil
+}
+
+// prune removes the completed exports beyond the newest keep
+func (e *Exports) prune() error {
+	files, err := e.completed()
+	if err != nil || len(files) <= e.keep {
+		return err
+	}
+	slices.SortFunc(files, func(a, b File) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	for _, file := range files[e.keep:] {
+		if err := os.Remove(file.Path); err != nil {
+			return fmt.Errorf("failed to remove old export: %w", err)
+		}
+	}
+	return nil
+}
+
+func parseFileName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, filePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, fileSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	createdAt, err := time.Parse(fileTimeFormat, stamp)
+	return createdAt, err == nil
+}
@@ -0,0 +1,463 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/models"
+)
+
+// PersonalFormat identifies the export of one user's data, which they can
+// request for themselves
+const PersonalFormat = "turnate-personal-export"
+
+// PersonalManifest is manifest.json of a personal export
+type PersonalManifest struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	ExportedAt string         `json:"exported_at"`
+	UserID     string         `json:"user_id"`
+	Counts     PersonalCounts `json:"counts"`
+}
+
+type PersonalCounts struct {
+	Channels          int `json:"channels"`
+	Memberships       int `json:"memberships"`
+	Messages          int `json:"messages"`
+	Bookmarks         int `json:"bookmarks"`
+	SavedItems        int `json:"saved_items"`
+	Reminders         int `json:"reminders"`
+	ScheduledMessages int `json:"scheduled_messages"`
+	Notifications     int `json:"notifications"`
+	PushSubscriptions int `json:"push_subscriptions"`
+}
+
+// Profile is profile.json: the account and its notification settings
+type Profile struct {
+	User
+	LegalHold bool `json:"legal_hold,omitempty"`
+	// Settings are the notification settings; absent when never changed
+	Settings *Settings `json:"notification_settings,omitempty"`
+	// ChannelLevels are the notification levels set for single channels, by channel ID
+	ChannelLevels map[string]string `json:"channel_notification_levels"`
+}
+
+type Settings struct {
+	Keywords              []string `json:"keywords"`
+	Timezone              string   `json:"timezone"`
+	DNDEnabled            bool     `json:"dnd_enabled"`
+	DNDStart              string   `json:"dnd_start,omitempty"`
+	DNDEnd                string   `json:"dnd_end,omitempty"`
+	MentionEmailsDisabled bool     `json:"mention_emails_disabled"`
+	DigestEnabled         bool     `json:"digest_enabled"`
+}
+
+// ChannelRef names a channel that other files of a personal export refer to
+type ChannelRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ChannelBookmark is a bookmark the user added, with its channel
+type ChannelBookmark struct {
+	Bookmark
+	ChannelID string `json:"channel_id"`
+}
+
+type SavedItem struct {
+	MessageID string `json:"message_id"`
+	SavedAt   string `json:"saved_at"`
+}
+
+type Reminder struct {
+	ID          string  `json:"id"`
+	MessageID   *string `json:"message_id,omitempty"`
+	Text        string  `json:"text"`
+	RemindAt    string  `json:"remind_at"`
+	DeliveredAt *string `json:"delivered_at,omitempty"`
+}
+
+type ScheduledMessage struct {
+	ID        string  `json:"id"`
+	ChannelID string  `json:"channel_id"`
+	ThreadID  *string `json:"thread_id,omitempty"`
+	Content   string  `json:"content"`
+	SendAt    string  `json:"send_at"`
+	Status    string  `json:"status"`
+	MessageID *string `json:"message_id,omitempty"`
+}
+
+type Notification struct {
+	ID        string  `json:"id"`
+	Kind      string  `json:"kind"`
+	Title     string  `json:"title"`
+	Body      string  `json:"body"`
+	ChannelID *string `json:"channel_id,omitempty"`
+	MessageID *string `json:"message_id,omitempty"`
+	CreatedAt string  `json:"created_at"`
+	ReadAt    *string `json:"read_at,omitempty"`
+}
+
+// PushSubscription is a browser registered for notifications; its keys are
+// not exported
+type PushSubscription struct {
+	Endpoint  string `json:"endpoint"`
+	UserAgent string `json:"user_agent,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// WritePersonal streams everything stored about one user to w as a zip
+// archive: their profile, memberships, the messages they wrote in any
+// channel, the bookmarks and files they shared, and their saved items,
+// reminders, scheduled messages, notifications and push subscriptions.
+// Password hashes are never exported.
+func WritePersonal(ctx context.Context, db *gorm.DB, w io.Writer, userID models.UUIDv7, now time.Time) (*PersonalManifest, error) {
+	db = db.WithContext(ctx)
+	var user models.User
+	if err := db.First(&user, "id = ?", userID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read user: %w", err)
+	}
+
+	archive := zip.NewWriter(w)
+	manifest := &PersonalManifest{
+		Format:     PersonalFormat,
+		Version:    Version,
+		ExportedAt: now.UTC().Format(timeFormat),
+		UserID:     user.ID.String(),
+	}
+
+	steps := []func(*gorm.DB, *zip.Writer, *models.User, *PersonalManifest) error{
+		writeProfile,
+		writePersonalChannels,
+		writePersonalMemberships,
+		writePersonalMessages,
+		writePersonalBookmarks,
+		writePersonalSaved,
+		writePersonalReminders,
+		writePersonalScheduled,
+		writePersonalNotifications,
+		writePersonalPush,
+	}
+	for _, step := range steps {
+		if err := step(db, archive, &user, manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeJSON(archive, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish export: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeProfile(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	profile := Profile{
+		User: User{
+			ID:          user.ID.String(),
+			Username:    user.Username,
+			Email:       user.Email,
+			DisplayName: user.DisplayName,
+			Role:        string(user.Role),
+			IsActive:    user.IsActive,
+			CreatedAt:   user.CreatedAt.UTC().Format(timeFormat),
+			LastSeenAt:  formatTime(user.LastSeenAt),
+		},
+		LegalHold:     user.LegalHold,
+		ChannelLevels: map[string]string{},
+	}
+
+	var settings models.NotificationSettings
+	err := db.Where("user_id = ?", user.ID).First(&settings).Error
+	if err == nil {
+		profile.Settings = &Settings{
+			Keywords:              settings.Keywords,
+			Timezone:              settings.Timezone,
+			DNDEnabled:            settings.DNDEnabled,
+			DNDStart:              settings.DNDStart,
+			DNDEnd:                settings.DNDEnd,
+			MentionEmailsDisabled: settings.MentionEmailsDisabled,
+			DigestEnabled:         settings.DigestEnabled,
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to export notification settings: %w", err)
+	}
+
+	var preferences []models.ChannelNotificationPreference
+	if err := db.Where("user_id = ?", user.ID).Find(&preferences).Error; err != nil {
+		return fmt.Errorf("failed to export notification settings: %w", err)
+	}
+	for _, preference := range preferences {
+		profile.ChannelLevels[preference.ChannelID.String()] = string(preference.Level)
+	}
+	return writeJSON(archive, "profile.json", profile)
+}
+
+// writePersonalChannels names every channel the user belongs to or wrote in,
+// so the IDs in the other files can be read
+func writePersonalChannels(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "channels.json")
+	if err != nil {
+		return err
+	}
+
+	var channels []models.Channel
+	err = db.Unscoped().
+		Where("id IN (?) OR id IN (?)",
+			db.Model(&models.ChannelMember{}).Select("channel_id").Where("user_id = ?", user.ID),
+			db.Model(&models.Message{}).Distinct("channel_id").Where("user_id = ?", user.ID)).
+		Order("name").Find(&channels).Error
+	if err != nil {
+		return fmt.Errorf("failed to export channels: %w", err)
+	}
+	for _, channel := range channels {
+		if err := array.write(ChannelRef{ID: channel.ID.String(), Name: channel.Name, Type: string(channel.Type)}); err != nil {
+			return err
+		}
+		manifest.Counts.Channels++
+	}
+	return array.close()
+}
+
+func writePersonalMemberships(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "memberships.json")
+	if err != nil {
+		return err
+	}
+
+	var members []models.ChannelMember
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&members).Error; err != nil {
+		return fmt.Errorf("failed to export memberships: %w", err)
+	}
+	for _, member := range members {
+		exported := Membership{
+			ChannelID: member.ChannelID.String(),
+			UserID:    member.UserID.String(),
+			JoinedAt:  member.CreatedAt.UTC().Format(timeFormat),
+		}
+		if err := array.write(exported); err != nil {
+			return err
+		}
+		manifest.Counts.Memberships++
+	}
+	return array.close()
+}
+
+// writePersonalMessages writes the messages the user wrote, in every channel
+// and including those in channels they have left, oldest first
+func writePersonalMessages(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "messages.json")
+	if err != nil {
+		return err
+	}
+
+	var batch []models.Message
+	err = db.Where("user_id = ?", user.ID).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, message := range batch {
+			exported := Message{
+				ID:                message.ID.String(),
+				ChannelID:         message.ChannelID.String(),
+				UserID:            message.UserID.String(),
+				ThreadID:          formatID(message.ThreadID),
+				Type:              string(message.Type),
+				Content:           message.Content,
+				CreatedAt:         message.CreatedAt.UTC().Format(timeFormat),
+				UpdatedAt:         message.UpdatedAt.UTC().Format(timeFormat),
+				AlsoSentToChannel: message.AlsoSentToChannel,
+				ReplyCount:        message.ReplyCount,
+				PinnedAt:          formatTime(message.PinnedAt),
+				PinnedBy:          formatID(message.PinnedBy),
+			}
+			if err := array.write(exported); err != nil {
+				return err
+			}
+			manifest.Counts.Messages++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to export messages: %w", err)
+	}
+	return array.close()
+}
+
+// writePersonalBookmarks writes the links and files the user added to
+// channel headers. Turnate stores files as links, so their contents are not
+// in the archive.
+func writePersonalBookmarks(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "bookmarks.json")
+	if err != nil {
+		return err
+	}
+
+	var bookmarks []models.ChannelBookmark
+	if err := db.Where("created_by = ?", user.ID).Order("id").Find(&bookmarks).Error; err != nil {
+		return fmt.Errorf("failed to export bookmarks: %w", err)
+	}
+	for _, bookmark := range bookmarks {
+		exported := ChannelBookmark{
+			Bookmark: Bookmark{
+				ID:        bookmark.ID.String(),
+				Title:     bookmark.Title,
+				URL:       bookmark.URL,
+				Kind:      string(bookmark.Kind),
+				CreatedBy: bookmark.CreatedBy.String(),
+				CreatedAt: bookmark.CreatedAt.UTC().Format(timeFormat),
+			},
+			ChannelID: bookmark.ChannelID.String(),
+		}
+		if err := array.write(exported); err != nil {
+			return err
+		}
+		manifest.Counts.Bookmarks++
+	}
+	return array.close()
+}
+
+func writePersonalSaved(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "saved_items.json")
+	if err != nil {
+		return err
+	}
+
+	var items []models.SavedItem
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&items).Error; err != nil {
+		return fmt.Errorf("failed to export saved items: %w", err)
+	}
+	for _, item := range items {
+		if err := array.write(SavedItem{MessageID: item.MessageID.String(), SavedAt: item.CreatedAt.UTC().Format(timeFormat)}); err != nil {
+			return err
+		}
+		manifest.Counts.SavedItems++
+	}
+	return array.close()
+}
+
+func writePersonalReminders(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "reminders.json")
+	if err != nil {
+		return err
+	}
+
+	var reminders []models.Reminder
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&reminders).Error; err != nil {
+		return fmt.Errorf("failed to export reminders: %w", err)
+	}
+	for _, reminder := range reminders {
+		exported := Reminder{
+			ID:          reminder.ID.String(),
+			MessageID:   formatID(reminder.MessageID),
+			Text:        reminder.Text,
+			RemindAt:    reminder.RemindAt.UTC().Format(timeFormat),
+			DeliveredAt: formatTime(reminder.DeliveredAt),
+		}
+		if err := array.write(exported); err != nil {
+			return err
+		}
+		manifest.Counts.Reminders++
+	}
+	return array.close()
+}
+
+func writePersonalScheduled(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "scheduled_messages.json")
+	if err != nil {
+		return err
+	}
+
+	var scheduled []models.ScheduledMessage
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&scheduled).Error; err != nil {
+		return fmt.Errorf("failed to export scheduled messages: %w", err)
+	}
+	for _, message := range scheduled {
+		exported := ScheduledMessage{
+			ID:        message.ID.String(),
+			ChannelID: message.ChannelID.String(),
+			ThreadID:  formatID(message.ThreadID),
+			Content:   message.Content,
+			SendAt:    message.SendAt.UTC().Format(timeFormat),
+			Status:    string(message.Status),
+			MessageID: formatID(message.MessageID),
+		}
+		if err := array.write(exported); err != nil {
+			return err
+		}
+		manifest.Counts.ScheduledMessages++
+	}
+	return array.close()
+}
+
+func writePersonalNotifications(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "notifications.json")
+	if err != nil {
+		return err
+	}
+
+	var batch []models.Notification
+	err = db.Where("user_id = ?", user.ID).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for _, notification := range batch {
+			exported := Notification{
+				ID:        notification.ID.String(),
+				Kind:      string(notification.Kind),
+				Title:     notification.Title,
+				Body:      notification.Body,
+				ChannelID: formatID(notification.ChannelID),
+				MessageID: formatID(notification.MessageID),
+				CreatedAt: notification.CreatedAt.UTC().Format(timeFormat),
+				ReadAt:    formatTime(notification.ReadAt),
+			}
+			if err := array.write(exported); err != nil {
+				return err
+			}
+			manifest.Counts.Notifications++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to export notifications: %w", err)
+	}
+	return array.close()
+}
+
+func writePersonalPush(db *gorm.DB, archive *zip.Writer, user *models.User, manifest *PersonalManifest) error {
+	array, err := createArray(archive, "push_subscriptions.json")
+	if err != nil {
+		return err
+	}
+
+	var subscriptions []models.PushSubscription
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&subscriptions).Error; err != nil {
+		return fmt.Errorf("failed to export push subscriptions: %w", err)
+	}
+	for _, subscription := range subscriptions {
+		exported := PushSubscription{
+			Endpoint:  subscription.Endpoint,
+			UserAgent: subscription.UserAgent,
+			CreatedAt: subscription.CreatedAt.UTC().Format(timeFormat),
+		}
+		if err := array.write(exported); err != nil {
+			return err
+		}
+		manifest.Counts.PushSubscriptions++
+	}
+	return array.close()
+}
+
+func formatID(id *models.UUIDv7) *string {
+	if id == nil {
+		return nil
+	}
+	formatted := id.String()
+	return &formatted
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/logging"
+	"turnate/internal/models"
+)
+
+// personalDir is the subdirectory of the export directory holding personal
+// exports, one per user named after their ID
+const personalDir = "personal"
+
+// PersonalExports runs users' exports of their own data in the background.
+// Each user has at most one export; a new one replaces the last.
+type PersonalExports struct {
+	db  *gorm.DB
+	dir string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[models.UUIDv7]*File
+	failed  map[models.UUIDv7]File
+	// discard marks running exports of users whose export was deleted meanwhile
+	discard map[models.UUIDv7]bool
+}
+
+func NewPersonalExports(db *gorm.DB, dir string) *PersonalExports {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PersonalExports{
+		db:      db,
+		dir:     filepath.Join(dir, personalDir),
+		ctx:     ctx,
+		cancel:  cancel,
+		running: map[models.UUIDv7]*File{},
+		failed:  map[models.UUIDv7]File{},
+		discard: map[models.UUIDv7]bool{},
+	}
+}
+
+// Start begins an export of the user's data and returns it as running
+func (p *PersonalExports) Start(userID models.UUIDv7, now time.Time) (*File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.running[userID]; ok {
+		return nil, ErrRunning
+	}
+	if err := os.MkdirAll(p.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	file := &File{
+		Name:      p.fileName(userID),
+		Path:      filepath.Join(p.dir, p.fileName(userID)),
+		CreatedAt: now.UTC().Truncate(time.Second),
+		Status:    StatusRunning,
+	}
+	p.running[userID] = file
+	delete(p.failed, userID)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := p.run(file, userID, now)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.running, userID)
+		if p.discard[userID] {
+			delete(p.discard, userID)
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				logging.Component(logging.ComponentServer).Error("failed to remove personal export", "user_id", userID, "error", err)
+			}
+			return
+		}
+		if err != nil {
+			logging.Component(logging.ComponentServer).Error("personal export failed", "user_id", userID, "error", err)
+			failed := *file
+			failed.Status = StatusFailed
+			failed.Error = err.Error()
+			p.failed[userID] = failed
+		}
+	}()
+
+	running := *file
+	return &running, nil
+}
+
+// run writes the export under a temporary name, so the previous export stays
+// available until the new one is complete
+func (p *PersonalExports) run(file *File, userID models.UUIDv7, now time.Time) error {
+	tmp := file.Path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create export: %w", err)
+	}
+
+	manifest, err := WritePersonal(p.ctx, p.db, out, userID, now)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, file.Path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save export: %w", err)
+	}
+	logging.Component(logging.ComponentServer).Info("personal export completed", "user_id", userID,
+		"messages", manifest.Counts.Messages)
+	return nil
+}
+
+// Get returns the user's running, failed or last completed export
+func (p *PersonalExports) Get(userID models.UUIDv7) (*File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if running, ok := p.running[userID]; ok {
+		file := *running
+		return &file, nil
+	}
+	if failed, ok := p.failed[userID]; ok {
+		return &failed, nil
+	}
+
+	path := filepath.Join(p.dir, p.fileName(userID))
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	return &File{
+		Name:      p.fileName(userID),
+		Path:      path,
+		Size:      info.Size(),
+		CreatedAt: info.ModTime().UTC().Truncate(time.Second),
+		Status:    StatusCompleted,
+	}, nil
+}
+
+// Delete removes the user's export, as part of erasing the account. An export
+// still running is removed when it finishes.
+func (p *PersonalExports) Delete(userID models.UUIDv7) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.running[userID]; ok {
+		p.discard[userID] = true
+	}
+	delete(p.failed, userID)
+	err := os.Remove(filepath.Join(p.dir, p.fileName(userID)))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove export: %w", err)
+	}
+	return nil
+}
+
+// Close cancels running exports and waits for them to stop
+func (p *PersonalExports) Close() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *PersonalExports) fileName(userID models.UUIDv7) string {
+	return userID.String() + fileSuffix
+}
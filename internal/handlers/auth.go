@@ -2,37 +2,43 @@ package handlers
 
 import (
 	"net/http"
-	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	
 	"turnate/internal/config"
-	"turnate/internal/database"
+	"turnate/internal/metrics"
 	"turnate/internal/middleware"
 	"turnate/internal/models"
+	"turnate/internal/service"
 )
 
 type AuthHandler struct {
 	Config *config.Config
+	users  *service.UserService
 }
 
 type RegisterRequest struct {
-	Username    string `json:"username" binding:"required,min=3,max=50"`
-	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=6"`
-	DisplayName string `json:"display_name,omitempty"`
+	Username    string `json:"username" binding:"required,min=3,max=50,username"`
+	Email       string `json:"email" binding:"required,email,max=100"`
+	Password    string `json:"password" binding:"required,min=6,max=72"`
+	DisplayName string `json:"display_name,omitempty" binding:"omitempty,max=100"`
+	UseCookie   bool   `json:"use_cookie,omitempty"`
 }
 
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username" binding:"required,max=100"`
+	Password  string `json:"password" binding:"required,max=72"`
+	UseCookie bool   `json:"use_cookie,omitempty"`
 }
 
+// AuthResponse carries either a bearer token or, for cookie sessions, the CSRF
+// token the client must echo in the X-CSRF-Token header.
 type AuthResponse struct {
-	Token   string      `json:"token"`
-	User    UserProfile `json:"user"`
-	Message string      `json:"message"`
+	Token     string      `json:"token,omitempty"`
+	CSRFToken string      `json:"csrf_token,omitempty"`
+	User      UserProfile `json:"user"`
+	Message   string      `json:"message"`
 }
 
 type UserProfile struct {
@@ -44,132 +50,114 @@ type UserProfile struct {
 	IsActive    bool   `json:"is_active"`
 }
 
-func NewAuthHandler(config *config.Config) *AuthHandler {
-	return &AuthHandler{Config: config}
+// newUserProfile includes the email address, so it is only used for the
+// authenticated user's own profile
+func newUserProfile(user *models.User) UserProfile {
+	return UserProfile{
+		ID:          user.ID.String(),
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Role:        string(user.Role),
+		IsActive:    user.IsActive,
+	}
+}
+
+func NewAuthHandler(config *config.Config, users *service.UserService) *AuthHandler {
+	return &AuthHandler{Config: config, users: users}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
-		return
-	}
-
-	// Validate username format
-	if !isValidUsername(req.Username) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username must contain only letters, numbers, and underscores"})
-		return
-	}
-
-	// Check if user already exists
-	var existingUser models.User
-	if err := database.GetDB().Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	// Create new user (sanitize inputs)
-	user := models.User{
-		Username:    strings.ToLower(middleware.SanitizeString(req.Username)),
-		Email:       strings.ToLower(middleware.SanitizeString(req.Email)),
-		DisplayName: middleware.SanitizeString(req.DisplayName),
-		Role:        models.UserRoleNormal,
-		IsActive:    true,
-	}
-
-	if req.DisplayName == "" {
-		user.DisplayName = req.Username
-	}
-
-	if err := user.SetPassword(req.Password); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	if err := database.GetDB().Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	user, err := h.users.Register(c.Request.Context(),
+		strings.ToLower(middleware.SanitizeString(req.Username)),
+		strings.ToLower(middleware.SanitizeString(req.Email)),
+		middleware.SanitizeString(req.DisplayName),
+		req.Password)
+	if err != nil {
+		respondError(c, err, "Failed to create user")
 		return
 	}
 
-	// Add user to general channel
-	var generalChannel models.Channel
-	if err := database.GetDB().Where("name = ?", "general").First(&generalChannel).Error; err == nil {
-		member := models.ChannelMember{
-			ChannelID: generalChannel.ID,
-			UserID:    user.ID,
-		}
-		database.GetDB().Create(&member)
-	}
-
 	// Generate JWT token
-	token, err := middleware.GenerateJWT(&user, h.Config)
+	token, err := middleware.GenerateJWT(user, h.Config)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	response := AuthResponse{
-		Token: token,
-		User: UserProfile{
-			ID:          user.ID.String(),
-			Username:    user.Username,
-			Email:       user.Email,
-			DisplayName: user.DisplayName,
-			Role:        string(user.Role),
-			IsActive:    user.IsActive,
-		},
+		User:    newUserProfile(user),
 		Message: "Registration successful! Welcome to Turnate! 🎉",
 	}
 
+	if !h.issueSession(c, token, req.UseCookie, &response) {
+		return
+	}
+
 	c.JSON(http.StatusCreated, response)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	var user models.User
 	sanitizedUsername := strings.ToLower(middleware.SanitizeString(req.Username))
-	if err := database.GetDB().Where("username = ? OR email = ?", sanitizedUsername, sanitizedUsername).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
-		return
-	}
-
-	if !user.IsActive {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
-		return
-	}
-
-	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+	user, err := h.users.Authenticate(c.Request.Context(), sanitizedUsername, req.Password)
+	if err != nil {
+		metrics.Logins.WithLabelValues("failure").Inc()
+		respondError(c, err, "Failed to log in")
 		return
 	}
+	metrics.Logins.WithLabelValues("success").Inc()
 
-	token, err := middleware.GenerateJWT(&user, h.Config)
+	token, err := middleware.GenerateJWT(user, h.Config)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	response := AuthResponse{
-		Token: token,
-		User: UserProfile{
-			ID:          user.ID.String(),
-			Username:    user.Username,
-			Email:       user.Email,
-			DisplayName: user.DisplayName,
-			Role:        string(user.Role),
-			IsActive:    user.IsActive,
-		},
+		User:    newUserProfile(user),
 		Message: "Login successful! Welcome back! 👋",
 	}
 
+	if !h.issueSession(c, token, req.UseCookie, &response) {
+		return
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *AuthHandler) Logout(c *gin.Context) {
+	middleware.ClearSessionCookies(c, h.Config)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully! 👋"})
+}
+
+// issueSession hands the token to the client either in the response body or as
+// HttpOnly session cookies, depending on what the client asked for.
+func (h *AuthHandler) issueSession(c *gin.Context, token string, useCookie bool, response *AuthResponse) bool {
+	if !useCookie {
+		response.Token = token
+		return true
+	}
+
+	csrfToken, err := middleware.SetSessionCookies(c, token, h.Config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return false
+	}
+	response.CSRFToken = csrfToken
+	return true
+}
+
 func (h *AuthHandler) Profile(c *gin.Context) {
 	userInterface, exists := c.Get("user")
 	if !exists {
@@ -178,19 +166,5 @@ func (h *AuthHandler) Profile(c *gin.Context) {
 	}
 
 	user := userInterface.(*models.User)
-	profile := UserProfile{
-		ID:          user.ID.String(),
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		Role:        string(user.Role),
-		IsActive:    user.IsActive,
-	}
-
-	c.JSON(http.StatusOK, gin.H{"user": profile})
+	c.JSON(http.StatusOK, gin.H{"user": newUserProfile(user)})
 }
-
-func isValidUsername(username string) bool {
-	matched, _ := regexp.MatchString(`^[a-zA-Z0-9_]+$`, username)
-	return matched
-}
\ No newline at end of file
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/database"
+	"turnate/internal/logging"
+)
+
+type BackupHandler struct {
+	backups *database.Backups
+}
+
+func NewBackupHandler(backups *database.Backups) *BackupHandler {
+	return &BackupHandler{backups: backups}
+}
+
+// BackupURI addresses a backup file by name
+type BackupURI struct {
+	Name string `uri:"name" binding:"required,max=100"`
+}
+
+type BackupResponse struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newBackupResponse(file database.BackupFile) BackupResponse {
+	return BackupResponse{
+		Name:      file.Name,
+		SizeBytes: file.Size,
+		CreatedAt: file.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func (h *BackupHandler) GetBackups(c *gin.Context) {
+	files, err := h.backups.List()
+	if err != nil {
+		respondError(c, err, "Failed to fetch backups")
+		return
+	}
+
+	backupResponses := []BackupResponse{}
+	for _, file := range files {
+		backupResponses = append(backupResponses, newBackupResponse(file))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backups": backupResponses})
+}
+
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	file, err := h.backups.Create(c.Request.Context(), time.Now())
+	if err != nil {
+		logging.Component(logging.ComponentServer).ErrorContext(c.Request.Context(), "backup failed", "error", err)
+		respondError(c, err, "Failed to create backup")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"backup": newBackupResponse(*file)})
+}
+
+func (h *BackupHandler) DownloadBackup(c *gin.Context) {
+	var uri BackupURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	file, err := h.backups.Get(uri.Name)
+	if errors.Is(err, database.ErrBackupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to fetch backup")
+		return
+	}
+
+	c.FileAttachment(file.Path, file.Name)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/middleware"
+	"turnate/internal/models"
+)
+
+// ResourceURI addresses a single resource by its UUID path parameter
+type ResourceURI struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// ThreadURI addresses a thread root inside a channel
+type ThreadURI struct {
+	ID       string `uri:"id" binding:"required,uuid"`
+	ThreadID string `uri:"threadId" binding:"required,uuid"`
+}
+
+// BookmarkURI addresses a bookmark inside a channel
+type BookmarkURI struct {
+	ID         string `uri:"id" binding:"required,uuid"`
+	BookmarkID string `uri:"bookmarkId" binding:"required,uuid"`
+}
+
+// PinURI addresses a pinned message inside a channel
+type PinURI struct {
+	ID        string `uri:"id" binding:"required,uuid"`
+	MessageID string `uri:"messageId" binding:"required,uuid"`
+}
+
+// PaginationQuery holds the limit/offset query parameters of list endpoints
+type PaginationQuery struct {
+	Limit  int `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset int `form:"offset" binding:"omitempty,min=0"`
+}
+
+// LimitOrDefault returns the requested limit, or 50 when none was given
+func (q PaginationQuery) LimitOrDefault() int {
+	if q.Limit == 0 {
+		return 50
+	}
+	return q.Limit
+}
+
+// MessageListQuery positions a window of channel history. Before and After take
+// opaque cursors returned with a previous window; Around takes a message ID so
+// permalinks and search results can be opened with context on both sides.
+type MessageListQuery struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Before string `form:"before" binding:"omitempty,max=64,excluded_with=After Around"`
+	After  string `form:"after" binding:"omitempty,max=64,excluded_with=Around"`
+	Around string `form:"around" binding:"omitempty,uuid"`
+}
+
+// LimitOrDefault returns the requested limit, or 50 when none was given
+func (q MessageListQuery) LimitOrDefault() int {
+	return PaginationQuery{Limit: q.Limit}.LimitOrDefault()
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns a message ID into an opaque pagination cursor
+func encodeCursor(id models.UUIDv7) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (models.UUIDv7, error) {
+	var id models.UUIDv7
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) != len(id) {
+		return id, errInvalidCursor
+	}
+	copy(id[:], raw)
+	return id, nil
+}
+
+// bindJSON binds the request body into obj, responding with field errors on failure
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		middleware.AbortWithValidationErrors(c, middleware.FieldErrors(err))
+		return false
+	}
+	return true
+}
+
+// bindURI binds path parameters into obj, responding with field errors on failure
+func bindURI(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindUri(obj); err != nil {
+		middleware.AbortWithValidationErrors(c, middleware.FieldErrors(err))
+		return false
+	}
+	return true
+}
+
+// bindQuery binds query parameters into obj, responding with field errors on failure
+func bindQuery(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindQuery(obj); err != nil {
+		middleware.AbortWithValidationErrors(c, middleware.FieldErrors(err))
+		return false
+	}
+	return true
+}
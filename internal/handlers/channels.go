@@ -2,233 +2,167 @@ package handlers
 
 import (
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
-	
-	"turnate/internal/database"
+
 	"turnate/internal/middleware"
 	"turnate/internal/models"
+	"turnate/internal/service"
 )
 
-type ChannelHandler struct{}
+type ChannelHandler struct {
+	channels *service.ChannelService
+}
 
-func NewChannelHandler() *ChannelHandler {
-	return &ChannelHandler{}
+func NewChannelHandler(channels *service.ChannelService) *ChannelHandler {
+	return &ChannelHandler{channels: channels}
 }
 
 type CreateChannelRequest struct {
 	Name        string                `json:"name" binding:"required,min=1,max=100"`
-	Description string                `json:"description,omitempty"`
-	Type        models.ChannelType    `json:"type,omitempty"`
+	Description string                `json:"description,omitempty" binding:"omitempty,max=500"`
+	Type        models.ChannelType    `json:"type,omitempty" binding:"omitempty,oneof=public private"`
 }
 
 type ChannelResponse struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Type        string `json:"type"`
-	CreatedBy   string `json:"created_by"`
-	CreatedAt   string `json:"created_at"`
-	MemberCount int    `json:"member_count"`
-	IsMember    bool   `json:"is_member"`
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Type        string             `json:"type"`
+	CreatedBy   string             `json:"created_by"`
+	CreatedAt   string             `json:"created_at"`
+	MemberCount int                `json:"member_count"`
+	IsMember    bool               `json:"is_member"`
+	Bookmarks   []BookmarkResponse `json:"bookmarks,omitempty"`
 }
 
-func (h *ChannelHandler) CreateChannel(c *gin.Context) {
-	var req CreateChannelRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
-		return
-	}
-
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	// Clean and sanitize channel name
-	channelName := middleware.SanitizeString(req.Name)
-	channelName = strings.ToLower(strings.TrimSpace(channelName))
-	channelName = strings.ReplaceAll(channelName, " ", "-")
+type CreateBookmarkRequest struct {
+	Title string              `json:"title" binding:"required,min=1,max=100"`
+	URL   string              `json:"url" binding:"required,max=2048,http_url"`
+	Kind  models.BookmarkKind `json:"kind,omitempty" binding:"omitempty,oneof=link file"`
+}
 
-	// Check if channel already exists
-	var existingChannel models.Channel
-	if err := database.GetDB().Where("name = ?", channelName).First(&existingChannel).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Channel already exists"})
-		return
-	}
+type BookmarkResponse struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Kind      string `json:"kind"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+}
 
-	// Only admins can create private channels by default (can be modified)
-	channelType := models.ChannelTypePublic
-	if req.Type != "" {
-		if req.Type == models.ChannelTypePrivate && role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create private channels"})
-			return
-		}
-		channelType = req.Type
+func newBookmarkResponse(bookmark models.ChannelBookmark) BookmarkResponse {
+	return BookmarkResponse{
+		ID:        bookmark.ID.String(),
+		Title:     bookmark.Title,
+		URL:       bookmark.URL,
+		Kind:      string(bookmark.Kind),
+		CreatedBy: bookmark.CreatedBy.String(),
+		CreatedAt: bookmark.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
+}
 
-	userIDStr := userID.(string)
-	channel := models.Channel{
-		Name:        channelName,
-		Description: middleware.SanitizeString(req.Description),
-		Type:        channelType,
-		CreatedBy:   models.UUIDv7{},
+func newChannelResponse(summary service.ChannelSummary) ChannelResponse {
+	channel := summary.Channel
+	return ChannelResponse{
+		ID:          channel.ID.String(),
+		Name:        channel.Name,
+		Description: channel.Description,
+		Type:        string(channel.Type),
+		CreatedBy:   channel.CreatedBy.String(),
+		CreatedAt:   channel.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MemberCount: int(summary.MemberCount),
+		IsMember:    summary.IsMember,
 	}
+}
 
-	// Convert string to UUIDv7
-	if err := channel.CreatedBy.Scan(userIDStr); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+func (h *ChannelHandler) CreateChannel(c *gin.Context) {
+	var req CreateChannelRequest
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := database.GetDB().Create(&channel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create channel"})
+	actor, ok := actorFromContext(c)
+	if !ok {
 		return
 	}
 
-	// Add creator as member
-	member := models.ChannelMember{
-		ChannelID: channel.ID,
-		UserID:    channel.CreatedBy,
+	channel, err := h.channels.Create(c.Request.Context(), actor,
+		middleware.SanitizeString(req.Name), middleware.SanitizeString(req.Description), req.Type)
+	if err != nil {
+		respondError(c, err, "Failed to create channel")
+		return
 	}
-	database.GetDB().Create(&member)
 
-	response := ChannelResponse{
-		ID:          channel.ID.String(),
-		Name:        channel.Name,
-		Description: channel.Description,
-		Type:        string(channel.Type),
-		CreatedBy:   channel.CreatedBy.String(),
-		CreatedAt:   channel.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		MemberCount: 1,
-		IsMember:    true,
-	}
+	response := newChannelResponse(service.ChannelSummary{Channel: *channel, MemberCount: 1, IsMember: true})
 
 	c.JSON(http.StatusCreated, gin.H{"channel": response, "message": "Channel created successfully! 🎉"})
 }
 
 func (h *ChannelHandler) GetChannels(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var channels []models.Channel
-	query := database.GetDB()
-
-	// Regular users only see public channels and private channels they're members of
-	if role != "admin" {
-		query = query.Where("type = ? OR id IN (SELECT channel_id FROM channel_members WHERE user_id = ? AND deleted_at IS NULL)", 
-			models.ChannelTypePublic, userID)
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
 	}
 
-	if err := query.Find(&channels).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channels"})
+	summaries, err := h.channels.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch channels")
 		return
 	}
 
 	var channelResponses []ChannelResponse
-	for _, channel := range channels {
-		// Count members
-		var memberCount int64
-		database.GetDB().Model(&models.ChannelMember{}).Where("channel_id = ?", channel.ID).Count(&memberCount)
-
-		// Check if user is member
-		var membership models.ChannelMember
-		isMember := database.GetDB().Where("channel_id = ? AND user_id = ?", channel.ID, userID).First(&membership).Error == nil
-
-		channelResponses = append(channelResponses, ChannelResponse{
-			ID:          channel.ID.String(),
-			Name:        channel.Name,
-			Description: channel.Description,
-			Type:        string(channel.Type),
-			CreatedBy:   channel.CreatedBy.String(),
-			CreatedAt:   channel.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			MemberCount: int(memberCount),
-			IsMember:    isMember,
-		})
+	for _, summary := range summaries {
+		channelResponses = append(channelResponses, newChannelResponse(summary))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"channels": channelResponses})
 }
 
 func (h *ChannelHandler) GetChannel(c *gin.Context) {
-	channelID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var channel models.Channel
-	if err := database.GetDB().Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
 		return
 	}
 
-	// Check permissions for private channels
-	if channel.Type == models.ChannelTypePrivate && role != "admin" {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to private channel"})
-			return
-		}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
 	}
 
-	// Count members
-	var memberCount int64
-	database.GetDB().Model(&models.ChannelMember{}).Where("channel_id = ?", channel.ID).Count(&memberCount)
+	summary, err := h.channels.Get(c.Request.Context(), actor, parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch channel")
+		return
+	}
 
-	// Check if user is member
-	var membership models.ChannelMember
-	isMember := database.GetDB().Where("channel_id = ? AND user_id = ?", channel.ID, userID).First(&membership).Error == nil
+	bookmarks, err := h.channels.Bookmarks(c.Request.Context(), actor, parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch channel")
+		return
+	}
 
-	response := ChannelResponse{
-		ID:          channel.ID.String(),
-		Name:        channel.Name,
-		Description: channel.Description,
-		Type:        string(channel.Type),
-		CreatedBy:   channel.CreatedBy.String(),
-		CreatedAt:   channel.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		MemberCount: int(memberCount),
-		IsMember:    isMember,
+	response := newChannelResponse(*summary)
+	for _, bookmark := range bookmarks {
+		response.Bookmarks = append(response.Bookmarks, newBookmarkResponse(bookmark))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"channel": response})
 }
 
 func (h *ChannelHandler) JoinChannel(c *gin.Context) {
-	channelID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var channel models.Channel
-	if err := database.GetDB().Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
 		return
 	}
 
-	// Check if it's a private channel and user is not admin
-	if channel.Type == models.ChannelTypePrivate && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot join private channel"})
+	actor, ok := actorFromContext(c)
+	if !ok {
 		return
 	}
 
-	// Check if already a member
-	var existingMembership models.ChannelMember
-	if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&existingMembership).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Already a member of this channel"})
-		return
-	}
-
-	// Create membership
-	var userUUID models.UUIDv7
-	if err := userUUID.Scan(userID.(string)); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	member := models.ChannelMember{
-		ChannelID: channel.ID,
-		UserID:    userUUID,
-	}
-
-	if err := database.GetDB().Create(&member).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join channel"})
+	if err := h.channels.Join(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to join channel")
 		return
 	}
 
@@ -236,25 +170,18 @@ func (h *ChannelHandler) JoinChannel(c *gin.Context) {
 }
 
 func (h *ChannelHandler) LeaveChannel(c *gin.Context) {
-	channelID := c.Param("id")
-	userID, _ := c.Get("user_id")
-
-	// Check if member
-	var membership models.ChannelMember
-	if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Not a member of this channel"})
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
 		return
 	}
 
-	// Don't allow leaving general channel
-	var channel models.Channel
-	if database.GetDB().Where("id = ? AND name = ?", channelID, "general").First(&channel).Error == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot leave the general channel"})
+	actor, ok := actorFromContext(c)
+	if !ok {
 		return
 	}
 
-	if err := database.GetDB().Delete(&membership).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave channel"})
+	if err := h.channels.Leave(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to leave channel")
 		return
 	}
 
@@ -262,32 +189,19 @@ func (h *ChannelHandler) LeaveChannel(c *gin.Context) {
 }
 
 func (h *ChannelHandler) GetChannelMembers(c *gin.Context) {
-	channelID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var channel models.Channel
-	if err := database.GetDB().Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
 		return
 	}
 
-	// Check permissions for private channels
-	if channel.Type == models.ChannelTypePrivate && role != "admin" {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to private channel"})
-			return
-		}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
 	}
 
-	var members []models.User
-	if err := database.GetDB().
-		Joins("JOIN channel_members ON users.id = channel_members.user_id").
-		Where("channel_members.channel_id = ? AND channel_members.deleted_at IS NULL", channelID).
-		Select("users.id, users.username, users.display_name, users.role, users.is_active, users.last_seen_at").
-		Find(&members).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channel members"})
+	members, err := h.channels.Members(c.Request.Context(), actor, parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch channel members")
 		return
 	}
 
@@ -303,4 +217,49 @@ func (h *ChannelHandler) GetChannelMembers(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"members": memberProfiles})
-}
\ No newline at end of file
+}
+
+func (h *ChannelHandler) AddBookmark(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	var req CreateBookmarkRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	bookmark, err := h.channels.AddBookmark(c.Request.Context(), actor, parseID(uri.ID),
+		middleware.SanitizeString(req.Title), req.URL, req.Kind)
+	if err != nil {
+		respondError(c, err, "Failed to add bookmark")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"bookmark": newBookmarkResponse(*bookmark), "message": "Bookmark added! 🔖"})
+}
+
+func (h *ChannelHandler) RemoveBookmark(c *gin.Context) {
+	var uri BookmarkURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.channels.RemoveBookmark(c.Request.Context(), actor, parseID(uri.ID), parseID(uri.BookmarkID)); err != nil {
+		respondError(c, err, "Failed to remove bookmark")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
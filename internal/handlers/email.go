@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/mail"
+	"turnate/internal/service"
+)
+
+type EmailHandler struct {
+	emails *service.EmailService
+}
+
+func NewEmailHandler(emails *service.EmailService) *EmailHandler {
+	return &EmailHandler{emails: emails}
+}
+
+type UnsubscribeQuery struct {
+	Token string `form:"token" binding:"required,max=256"`
+}
+
+// listNames describes the mailing lists on the unsubscribe page
+var listNames = map[string]string{
+	mail.ListMentions: "mention emails",
+	mail.ListDigest:   "the daily digest",
+}
+
+// UnsubscribePage shows the confirmation for a signed link in a notification
+// email. Mail scanners follow links, so visiting it changes nothing; the page
+// posts the form back to Unsubscribe.
+func (h *EmailHandler) UnsubscribePage(c *gin.Context) {
+	var query UnsubscribeQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	list, err := h.emails.CheckUnsubscribe(c.Request.Context(), query.Token)
+	if err != nil {
+		h.unsubscribeError(c, err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "unsubscribe.html", gin.H{"list": listNames[list], "token": query.Token})
+}
+
+// Unsubscribe handles the confirmation form and one-click unsubscribes from
+// mail clients (RFC 8058), which both post to the link, so it needs no session
+func (h *EmailHandler) Unsubscribe(c *gin.Context) {
+	var query UnsubscribeQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	list, err := h.emails.Unsubscribe(c.Request.Context(), query.Token)
+	if err != nil {
+		h.unsubscribeError(c, err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "unsubscribe.html", gin.H{"list": listNames[list], "done": true})
+}
+
+func (h *EmailHandler) unsubscribeError(c *gin.Context, err error) {
+	status, message, ok := errorStatus(err)
+	if !ok {
+		message = "Failed to unsubscribe"
+	}
+	c.HTML(status, "unsubscribe.html", gin.H{"error": message})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/erasure"
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type ErasureHandler struct {
+	erasures *service.ErasureService
+	eraser   *erasure.Erasures
+}
+
+func NewErasureHandler(erasures *service.ErasureService, eraser *erasure.Erasures) *ErasureHandler {
+	return &ErasureHandler{erasures: erasures, eraser: eraser}
+}
+
+type CreateErasureRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// ReviewErasureRequest carries the admin's note to the user
+type ReviewErasureRequest struct {
+	Note string `json:"note" binding:"max=500"`
+}
+
+// ErasureQuery filters the admin's list of requests by status
+type ErasureQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending approved rejected cancelled completed"`
+}
+
+type ErasureRequestResponse struct {
+	ID          string  `json:"id"`
+	UserID      string  `json:"user_id"`
+	Username    string  `json:"username,omitempty"`
+	Status      string  `json:"status"`
+	Reason      string  `json:"reason"`
+	ReviewedBy  *string `json:"reviewed_by,omitempty"`
+	ReviewedAt  *string `json:"reviewed_at,omitempty"`
+	ReviewNote  string  `json:"review_note,omitempty"`
+	CompletedAt *string `json:"completed_at,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+func newErasureRequestResponse(request models.ErasureRequest) ErasureRequestResponse {
+	response := ErasureRequestResponse{
+		ID:         request.ID.String(),
+		UserID:     request.UserID.String(),
+		Username:   request.User.Username,
+		Status:     string(request.Status),
+		Reason:     request.Reason,
+		ReviewNote: request.ReviewNote,
+		CreatedAt:  request.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if request.ReviewedBy != nil {
+		reviewedBy := request.ReviewedBy.String()
+		response.ReviewedBy = &reviewedBy
+	}
+	if request.ReviewedAt != nil {
+		reviewedAt := request.ReviewedAt.UTC().Format("2006-01-02T15:04:05Z")
+		response.ReviewedAt = &reviewedAt
+	}
+	if request.CompletedAt != nil {
+		completedAt := request.CompletedAt.UTC().Format("2006-01-02T15:04:05Z")
+		response.CompletedAt = &completedAt
+	}
+	return response
+}
+
+func (h *ErasureHandler) RequestErasure(c *gin.Context) {
+	var req CreateErasureRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.erasures.Request(c.Request.Context(), actor, req.Reason)
+	if err != nil {
+		respondError(c, err, "Failed to request erasure")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"erasure_request": newErasureRequestResponse(*request)})
+}
+
+func (h *ErasureHandler) GetErasure(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.erasures.Latest(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch erasure request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"erasure_request": newErasureRequestResponse(*request)})
+}
+
+func (h *ErasureHandler) CancelErasure(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	request, err := h.erasures.Cancel(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to cancel erasure request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"erasure_request": newErasureRequestResponse(*request)})
+}
+
+func (h *ErasureHandler) GetErasureRequests(c *gin.Context) {
+	var query ErasureQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	requests, err := h.erasures.List(c.Request.Context(), actor, models.ErasureStatus(query.Status))
+	if err != nil {
+		respondError(c, err, "Failed to fetch erasure requests")
+		return
+	}
+
+	requestResponses := []ErasureRequestResponse{}
+	for _, request := range requests {
+		requestResponses = append(requestResponses, newErasureRequestResponse(request))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"erasure_requests": requestResponses, "delete_messages": h.eraser.Policy().DeleteMessages})
+}
+
+func (h *ErasureHandler) ApproveErasure(c *gin.Context) {
+	h.review(c, h.erasures.Approve, "Failed to approve erasure request")
+}
+
+func (h *ErasureHandler) RejectErasure(c *gin.Context) {
+	h.review(c, h.erasures.Reject, "Failed to reject erasure request")
+}
+
+func (h *ErasureHandler) review(c *gin.Context, review func(ctx context.Context, actor service.Actor, id models.UUIDv7, note string, now time.Time) (*models.ErasureRequest, error), fallback string) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+	var req ReviewErasureRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	request, err := review(c.Request.Context(), actor, parseID(uri.ID), req.Note, time.Now())
+	if err != nil {
+		respondError(c, err, fallback)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"erasure_request": newErasureRequestResponse(*request)})
+}
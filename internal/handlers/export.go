@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/export"
+)
+
+type ExportHandler struct {
+	exports *export.Exports
+}
+
+func NewExportHandler(exports *export.Exports) *ExportHandler {
+	return &ExportHandler{exports: exports}
+}
+
+// CreateExportRequest chooses the private channels to include: all of them,
+// or those named. Public channels are always exported.
+type CreateExportRequest struct {
+	IncludePrivate  bool     `json:"include_private"`
+	PrivateChannels []string `json:"private_channels,omitempty" binding:"omitempty,dive,min=1,max=100"`
+}
+
+// ExportURI addresses an export file by name
+type ExportURI struct {
+	Name string `uri:"name" binding:"required,max=100"`
+}
+
+type ExportResponse struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newExportResponse(file export.File) ExportResponse {
+	return ExportResponse{
+		Name:      file.Name,
+		Status:    string(file.Status),
+		SizeBytes: file.Size,
+		Error:     file.Error,
+		CreatedAt: file.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func (h *ExportHandler) GetExports(c *gin.Context) {
+	files, err := h.exports.List()
+	if err != nil {
+		respondError(c, err, "Failed to fetch exports")
+		return
+	}
+
+	exportResponses := []ExportResponse{}
+	for _, file := range files {
+		exportResponses = append(exportResponses, newExportResponse(file))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": exportResponses})
+}
+
+func (h *ExportHandler) CreateExport(c *gin.Context) {
+	var req CreateExportRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	file, err := h.exports.Start(export.Options{
+		IncludePrivate:  req.IncludePrivate,
+		PrivateChannels: req.PrivateChannels,
+	}, time.Now())
+	if errors.Is(err, export.ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export is already running"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to start export")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"export": newExportResponse(*file)})
+}
+
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	var uri ExportURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	file, err := h.exports.Get(uri.Name)
+	if errors.Is(err, export.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to fetch export")
+		return
+	}
+	if file.Status != export.StatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is " + string(file.Status)})
+		return
+	}
+
+	c.FileAttachment(file.Path, file.Name)
+}
+
+// PersonalExportHandler lets users export their own data
+type PersonalExportHandler struct {
+	exports *export.PersonalExports
+}
+
+func NewPersonalExportHandler(exports *export.PersonalExports) *PersonalExportHandler {
+	return &PersonalExportHandler{exports: exports}
+}
+
+func (h *PersonalExportHandler) CreatePersonalExport(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.exports.Start(actor.UserID, time.Now())
+	if errors.Is(err, export.ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your export is already running"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to start export")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"export": newExportResponse(*file)})
+}
+
+func (h *PersonalExportHandler) GetPersonalExport(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.exports.Get(actor.UserID)
+	if errors.Is(err, export.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to fetch export")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"export": newExportResponse(*file)})
+}
+
+func (h *PersonalExportHandler) DownloadPersonalExport(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.exports.Get(actor.UserID)
+	if errors.Is(err, export.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to fetch export")
+		return
+	}
+	if file.Status != export.StatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is " + string(file.Status)})
+		return
+	}
+
+	c.FileAttachment(file.Path, "turnate-personal-export-"+file.CreatedAt.Format("20060102T150405Z")+".zip")
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/middleware"
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type GroupHandler struct {
+	groups *service.GroupService
+}
+
+func NewGroupHandler(groups *service.GroupService) *GroupHandler {
+	return &GroupHandler{groups: groups}
+}
+
+// GroupMemberURI addresses a member of a group
+type GroupMemberURI struct {
+	ID     string `uri:"id" binding:"required,uuid"`
+	UserID string `uri:"userId" binding:"required,uuid"`
+}
+
+// CreateGroupRequest names a new group. The handle is how it is mentioned, so
+// it follows the username rules.
+type CreateGroupRequest struct {
+	Handle      string `json:"handle" binding:"required,min=2,max=50,username"`
+	Name        string `json:"name,omitempty" binding:"omitempty,max=100"`
+	Description string `json:"description,omitempty" binding:"omitempty,max=500"`
+}
+
+type UpdateGroupRequest struct {
+	Name        *string   `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string   `json:"description,omitempty" binding:"omitempty,max=500"`
+	ChannelIDs  *[]string `json:"channel_ids,omitempty" binding:"omitempty,max=20,dive,uuid"`
+}
+
+type AddGroupMemberRequest struct {
+	UserID string `json:"user_id" binding:"required,uuid"`
+	Owner  bool   `json:"owner"`
+}
+
+type GroupResponse struct {
+	ID          string                `json:"id"`
+	Handle      string                `json:"handle"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	CreatedBy   string                `json:"created_by"`
+	CreatedAt   string                `json:"created_at"`
+	MemberCount int                   `json:"member_count"`
+	Members     []GroupMemberResponse `json:"members,omitempty"`
+	ChannelIDs  []string              `json:"channel_ids,omitempty"`
+}
+
+type GroupMemberResponse struct {
+	UserID      string `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Owner       bool   `json:"owner"`
+	AddedAt     string `json:"added_at"`
+}
+
+func newGroupResponse(group models.UserGroup, memberCount int) GroupResponse {
+	return GroupResponse{
+		ID:          group.ID.String(),
+		Handle:      group.Handle,
+		Name:        group.Name,
+		Description: group.Description,
+		CreatedBy:   group.CreatedBy.String(),
+		CreatedAt:   group.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MemberCount: memberCount,
+	}
+}
+
+func newGroupMemberResponse(member models.UserGroupMember) GroupMemberResponse {
+	return GroupMemberResponse{
+		UserID:      member.UserID.String(),
+		Username:    member.User.Username,
+		DisplayName: member.User.DisplayName,
+		Owner:       member.Owner,
+		AddedAt:     member.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func newGroupDetailsResponse(details service.GroupDetails) GroupResponse {
+	response := newGroupResponse(details.Group, len(details.Members))
+	response.Members = make([]GroupMemberResponse, 0, len(details.Members))
+	for _, member := range details.Members {
+		response.Members = append(response.Members, newGroupMemberResponse(member))
+	}
+	response.ChannelIDs = make([]string, 0, len(details.ChannelIDs))
+	for _, channelID := range details.ChannelIDs {
+		response.ChannelIDs = append(response.ChannelIDs, channelID.String())
+	}
+	return response
+}
+
+func (h *GroupHandler) GetGroups(c *gin.Context) {
+	summaries, err := h.groups.List(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to fetch groups")
+		return
+	}
+
+	response := []GroupResponse{}
+	for _, summary := range summaries {
+		response = append(response, newGroupResponse(summary.Group, summary.MemberCount))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": response})
+}
+
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	var req CreateGroupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.Create(c.Request.Context(), actor, req.Handle,
+		middleware.SanitizeString(req.Name), middleware.SanitizeString(req.Description))
+	if err != nil {
+		respondError(c, err, "Failed to create group")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"group": newGroupResponse(*group, 0), "message": "Group created"})
+}
+
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	details, err := h.groups.Get(c.Request.Context(), parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"group": newGroupDetailsResponse(*details)})
+}
+
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	var req UpdateGroupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	var update service.GroupUpdate
+	if req.Name != nil {
+		name := middleware.SanitizeString(*req.Name)
+		update.Name = &name
+	}
+	if req.Description != nil {
+		description := middleware.SanitizeString(*req.Description)
+		update.Description = &description
+	}
+	if req.ChannelIDs != nil {
+		channelIDs := make([]models.UUIDv7, len(*req.ChannelIDs))
+		for i, id := range *req.ChannelIDs {
+			channelIDs[i] = parseID(id)
+		}
+		update.ChannelIDs = &channelIDs
+	}
+
+	details, err := h.groups.Update(c.Request.Context(), actor, parseID(uri.ID), update)
+	if err != nil {
+		respondError(c, err, "Failed to update group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"group": newGroupDetailsResponse(*details)})
+}
+
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groups.Delete(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to delete group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
+
+func (h *GroupHandler) AddMember(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	var req AddGroupMemberRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	member, err := h.groups.AddMember(c.Request.Context(), actor, parseID(uri.ID), parseID(req.UserID), req.Owner)
+	if err != nil {
+		respondError(c, err, "Failed to add group member")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"member": newGroupMemberResponse(*member)})
+}
+
+func (h *GroupHandler) RemoveMember(c *gin.Context) {
+	var uri GroupMemberURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groups.RemoveMember(c.Request.Context(), actor, parseID(uri.ID), parseID(uri.UserID)); err != nil {
+		respondError(c, err, "Failed to remove group member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout bounds each readiness check so a hung database cannot
+// hang the probe
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck is one dependency the readiness probe verifies
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	checks   []HealthCheck
+	draining atomic.Bool
+}
+
+func NewHealthHandler(checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks}
+}
+
+// Drain makes the readiness probe fail from now on, so load balancers stop
+// sending new requests while the server shuts down
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Health is the original health endpoint, kept for existing monitors. It does
+// not check dependencies; use Readyz for that.
+func (h *HealthHandler) Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "turnate"})
+}
+
+// Livez reports that the process is up and serving requests
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz runs every check and reports 503 if any fails or the server is draining
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+
+	ready := true
+	results := make(map[string]string, len(h.checks))
+	for _, check := range h.checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+		err := check.Check(ctx)
+		cancel()
+
+		if err != nil {
+			ready = false
+			results[check.Name] = err.Error()
+		} else {
+			results[check.Name] = "ok"
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": results})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": results})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/importer"
+)
+
+type ImportHandler struct {
+	imports *importer.Imports
+}
+
+func NewImportHandler(imports *importer.Imports) *ImportHandler {
+	return &ImportHandler{imports: imports}
+}
+
+// ImportSourceURI names the system an upload comes from
+type ImportSourceURI struct {
+	Source string `uri:"source" binding:"required,oneof=slack mattermost jsonl"`
+}
+
+// ImportURI addresses an import by ID
+type ImportURI struct {
+	ID string `uri:"id" binding:"required,max=100"`
+}
+
+type ImportResponse struct {
+	ID         string           `json:"id"`
+	Source     string           `json:"source"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Report     *importer.Report `json:"report,omitempty"`
+	StartedAt  string           `json:"started_at"`
+	FinishedAt *string          `json:"finished_at,omitempty"`
+}
+
+func newImportResponse(job importer.Job) ImportResponse {
+	response := ImportResponse{
+		ID:        job.ID,
+		Source:    job.Source,
+		Status:    string(job.Status),
+		Error:     job.Error,
+		Report:    job.Report,
+		StartedAt: job.StartedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if job.FinishedAt != nil {
+		finishedAt := job.FinishedAt.UTC().Format("2006-01-02T15:04:05Z")
+		response.FinishedAt = &finishedAt
+	}
+	return response
+}
+
+func (h *ImportHandler) GetImports(c *gin.Context) {
+	importResponses := []ImportResponse{}
+	for _, job := range h.imports.List() {
+		importResponses = append(importResponses, newImportResponse(job))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imports": importResponses})
+}
+
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	var uri ImportURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	job, err := h.imports.Get(uri.ID)
+	if errors.Is(err, importer.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"import": newImportResponse(*job)})
+}
+
+// CreateImport accepts an export of another chat system as the multipart
+// form field "file" and imports it in the background
+func (h *ImportHandler) CreateImport(c *gin.Context) {
+	var uri ImportSourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	upload, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An export archive is required as the form field \"file\""})
+		return
+	}
+	file, err := upload.Open()
+	if err != nil {
+		respondError(c, err, "Failed to read upload")
+		return
+	}
+	defer file.Close()
+
+	job, err := h.imports.Start(uri.Source, file, time.Now())
+	if errors.Is(err, importer.ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An import is already running"})
+		return
+	} else if err != nil {
+		respondError(c, err, "Failed to start import")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"import": newImportResponse(*job)})
+}
@@ -2,342 +2,326 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	
-	"turnate/internal/database"
+
 	"turnate/internal/middleware"
 	"turnate/internal/models"
+	"turnate/internal/service"
 )
 
-type MessageHandler struct{}
+type MessageHandler struct {
+	messages  *service.MessageService
+	scheduled *service.ScheduledMessageService
+}
 
-func NewMessageHandler() *MessageHandler {
-	return &MessageHandler{}
+func NewMessageHandler(messages *service.MessageService, scheduled *service.ScheduledMessageService) *MessageHandler {
+	return &MessageHandler{messages: messages, scheduled: scheduled}
 }
 
+// CreateMessageRequest posts a message now, or at SendAt when it is set. SendAt
+// takes the same forms as reminder times, such as "tomorrow at 9am" in the
+// sender's timezone. AlsoSendToChannel shows a reply in the channel timeline
+// as well.
 type CreateMessageRequest struct {
-	Content  string  `json:"content" binding:"required,min=1,max=2000"`
-	ThreadID *string `json:"thread_id,omitempty"`
+	Content           string  `json:"content" binding:"required,min=1,max=2000"`
+	ThreadID          *string `json:"thread_id,omitempty" binding:"omitempty,uuid"`
+	AlsoSendToChannel bool    `json:"also_send_to_channel,omitempty"`
+	SendAt            string  `json:"send_at,omitempty" binding:"omitempty,max=64"`
 }
 
-func (h *MessageHandler) CreateMessage(c *gin.Context) {
-	channelID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
+func newMessageResponse(message models.Message) models.MessageResponse {
+	response := models.MessageResponse{
+		ID:          message.ID.String(),
+		Content:     message.Content,
+		UserID:      message.User.ID.String(),
+		Username:    message.User.Username,
+		DisplayName: message.User.DisplayName,
+		ChannelID:   message.ChannelID.String(),
+		CreatedAt:   message.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:   message.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		ReplyCount:  message.ReplyCount,
+	}
 
-	var req CreateMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
-		return
+	if message.LastReplyAt != nil {
+		lastReplyAt := message.LastReplyAt.Format("2006-01-02T15:04:05Z")
+		response.LastReplyAt = &lastReplyAt
 	}
 
-	// Verify channel exists and user has access
-	var channel models.Channel
-	if err := database.GetDB().Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
-		return
+	if message.ThreadID != nil {
+		threadIDStr := message.ThreadID.String()
+		response.ThreadID = &threadIDStr
 	}
 
-	// Check channel membership for private channels
-	if channel.Type == models.ChannelTypePrivate && role != "admin" {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to private channel"})
-			return
-		}
+	response.AlsoSentToChannel = message.AlsoSentToChannel
+
+	response.Type = string(message.Type)
+	if response.Type == "" {
+		response.Type = string(models.MessageTypeUser)
 	}
 
-	// For public channels, check if user is a member
-	if channel.Type == models.ChannelTypePublic {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Must join channel to post messages"})
-			return
-		}
+	if message.PinnedAt != nil && message.PinnedBy != nil {
+		pinnedAt := message.PinnedAt.Format("2006-01-02T15:04:05Z")
+		pinnedBy := message.PinnedBy.String()
+		response.PinnedAt = &pinnedAt
+		response.PinnedBy = &pinnedBy
 	}
 
-	// Convert user ID and channel ID to UUIDv7
-	var userUUID, channelUUID models.UUIDv7
-	if err := userUUID.Scan(userID.(string)); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	return response
+}
+
+func (h *MessageHandler) CreateMessage(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
 		return
 	}
-	if err := channelUUID.Scan(channelID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+
+	var req CreateMessageRequest
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	message := models.Message{
-		Content:   middleware.SanitizeString(req.Content),
-		UserID:    userUUID,
-		ChannelID: channelUUID,
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
 	}
 
-	// Handle threading
+	var threadID *models.UUIDv7
 	if req.ThreadID != nil && *req.ThreadID != "" {
-		// Verify thread message exists and belongs to same channel
-		var threadMessage models.Message
-		if err := database.GetDB().Where("id = ? AND channel_id = ?", *req.ThreadID, channelID).First(&threadMessage).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid thread message"})
-			return
-		}
+		id := parseID(*req.ThreadID)
+		threadID = &id
+	}
+	if req.AlsoSendToChannel && threadID == nil {
+		middleware.AbortWithValidationErrors(c, []middleware.FieldError{{Field: "also_send_to_channel", Message: "requires thread_id"}})
+		return
+	}
 
-		var threadUUID models.UUIDv7
-		if err := threadUUID.Scan(*req.ThreadID); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid thread ID"})
+	content := middleware.SanitizeString(req.Content)
+
+	if req.SendAt != "" {
+		scheduled, err := h.scheduled.Schedule(c.Request.Context(), actor, parseID(uri.ID), content, threadID, req.AlsoSendToChannel, req.SendAt, time.Now().UTC())
+		if err != nil {
+			respondError(c, err, "Failed to schedule message")
 			return
 		}
-		message.ThreadID = &threadUUID
+		c.JSON(http.StatusAccepted, gin.H{"scheduled_message": newScheduledMessageResponse(*scheduled), "message": "Message scheduled! 🗓️"})
+		return
 	}
 
-	if err := database.GetDB().Create(&message).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
+	var message *models.Message
+	var err error
+	if threadID != nil {
+		message, err = h.messages.Reply(c.Request.Context(), actor, parseID(uri.ID), *threadID, content, req.AlsoSendToChannel)
+	} else {
+		message, err = h.messages.Create(c.Request.Context(), actor, parseID(uri.ID), content, nil)
+	}
+	if err != nil {
+		respondError(c, err, "Failed to create message")
 		return
 	}
 
-	// Load user data for response
-	var user models.User
-	database.GetDB().Where("id = ?", userID).First(&user)
+	c.JSON(http.StatusCreated, gin.H{"message": newMessageResponse(*message)})
+}
 
-	// Count replies if this is a thread
-	replyCount := 0
-	if message.ThreadID == nil {
-		var count int64
-		database.GetDB().Model(&models.Message{}).Where("thread_id = ?", message.ID).Count(&count)
-		replyCount = int(count)
+func (h *MessageHandler) GetMessages(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
 	}
 
-	response := models.MessageResponse{
-		ID:          message.ID.String(),
-		Content:     message.Content,
-		UserID:      user.ID.String(),
-		Username:    user.Username,
-		DisplayName: user.DisplayName,
-		ChannelID:   message.ChannelID.String(),
-		CreatedAt:   message.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:   message.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		ReplyCount:  replyCount,
+	var query MessageListQuery
+	if !bindQuery(c, &query) {
+		return
 	}
 
-	if message.ThreadID != nil {
-		threadIDStr := message.ThreadID.String()
-		response.ThreadID = &threadIDStr
+	position, ok := messagePosition(c, query)
+	if !ok {
+		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": response})
-}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
 
-func (h *MessageHandler) GetMessages(c *gin.Context) {
-	channelID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	// Parse query parameters
-	limitStr := c.DefaultQuery("limit", "50")
-	offsetStr := c.DefaultQuery("offset", "0")
-	
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 || limit > 100 {
-		limit = 50
-	}
-	
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0
-	}
-
-	// Verify channel exists and user has access
-	var channel models.Channel
-	if err := database.GetDB().Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+	window, err := h.messages.List(c.Request.Context(), actor, parseID(uri.ID), position, query.LimitOrDefault())
+	if err != nil {
+		respondError(c, err, "Failed to fetch messages")
 		return
 	}
 
-	// Check permissions
-	if channel.Type == models.ChannelTypePrivate && role != "admin" {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to private channel"})
-			return
-		}
+	messageResponses := []models.MessageResponse{}
+	for _, message := range window.Messages {
+		messageResponses = append(messageResponses, newMessageResponse(message))
 	}
 
-	if channel.Type == models.ChannelTypePublic {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Must join channel to view messages"})
-			return
+	response := gin.H{"messages": messageResponses}
+	if len(window.Messages) > 0 {
+		if window.HasOlder {
+			response["older_cursor"] = encodeCursor(window.Messages[0].ID)
+		}
+		if window.HasNewer {
+			response["newer_cursor"] = encodeCursor(window.Messages[len(window.Messages)-1].ID)
 		}
 	}
-
-	// Get messages (only top-level messages, not replies)
-	var messages []models.Message
-	if err := database.GetDB().
-		Preload("User").
-		Where("channel_id = ? AND thread_id IS NULL", channelID).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&messages).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
-		return
+	if window.Anchor != nil {
+		response["anchor_id"] = window.Anchor.String()
 	}
 
-	var messageResponses []models.MessageResponse
-	for _, message := range messages {
-		// Count replies
-		var replyCount int64
-		database.GetDB().Model(&models.Message{}).Where("thread_id = ?", message.ID).Count(&replyCount)
-
-		response := models.MessageResponse{
-			ID:          message.ID.String(),
-			Content:     message.Content,
-			UserID:      message.User.ID.String(),
-			Username:    message.User.Username,
-			DisplayName: message.User.DisplayName,
-			ChannelID:   message.ChannelID.String(),
-			CreatedAt:   message.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt:   message.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-			ReplyCount:  int(replyCount),
-		}
+	c.JSON(http.StatusOK, response)
+}
 
-		messageResponses = append(messageResponses, response)
+// messagePosition decodes the cursors of a history query
+func messagePosition(c *gin.Context, query MessageListQuery) (service.MessagePosition, bool) {
+	var position service.MessagePosition
+
+	for _, param := range []struct {
+		name   string
+		cursor string
+		target **models.UUIDv7
+	}{
+		{"before", query.Before, &position.Before},
+		{"after", query.After, &position.After},
+	} {
+		if param.cursor == "" {
+			continue
+		}
+		id, err := decodeCursor(param.cursor)
+		if err != nil {
+			middleware.AbortWithValidationErrors(c, []middleware.FieldError{{Field: param.name, Message: "must be a cursor returned by a previous page"}})
+			return position, false
+		}
+		*param.target = &id
 	}
 
-	// Reverse to get chronological order
-	for i, j := 0, len(messageResponses)-1; i < j; i, j = i+1, j-1 {
-		messageResponses[i], messageResponses[j] = messageResponses[j], messageResponses[i]
+	if query.Around != "" {
+		id := parseID(query.Around)
+		position.Around = &id
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messageResponses})
+	return position, true
 }
 
 func (h *MessageHandler) GetThreadMessages(c *gin.Context) {
-	channelID := c.Param("id")
-	threadID := c.Param("threadId")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	// Parse query parameters
-	limitStr := c.DefaultQuery("limit", "50")
-	offsetStr := c.DefaultQuery("offset", "0")
-	
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 || limit > 100 {
-		limit = 50
-	}
-	
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0
-	}
-
-	// Verify channel and thread
-	var channel models.Channel
-	if err := database.GetDB().Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+	var uri ThreadURI
+	if !bindURI(c, &uri) {
 		return
 	}
 
-	var threadMessage models.Message
-	if err := database.GetDB().Where("id = ? AND channel_id = ?", threadID, channelID).First(&threadMessage).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Thread not found"})
+	var query PaginationQuery
+	if !bindQuery(c, &query) {
 		return
 	}
 
-	// Check permissions
-	if channel.Type == models.ChannelTypePrivate && role != "admin" {
-		var membership models.ChannelMember
-		if err := database.GetDB().Where("channel_id = ? AND user_id = ?", channelID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to private channel"})
-			return
-		}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
 	}
 
-	// Get thread replies
-	var replies []models.Message
-	if err := database.GetDB().
-		Preload("User").
-		Where("thread_id = ?", threadID).
-		Order("created_at ASC").
-		Limit(limit).
-		Offset(offset).
-		Find(&replies).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch thread replies"})
+	replies, err := h.messages.ListReplies(c.Request.Context(), actor, parseID(uri.ID), parseID(uri.ThreadID),
+		query.LimitOrDefault(), query.Offset)
+	if err != nil {
+		respondError(c, err, "Failed to fetch thread replies")
 		return
 	}
 
-	var replyResponses []models.MessageResponse
+	replyResponses := []models.MessageResponse{}
 	for _, reply := range replies {
-		threadIDStr := threadID
-		response := models.MessageResponse{
-			ID:          reply.ID.String(),
-			Content:     reply.Content,
-			UserID:      reply.User.ID.String(),
-			Username:    reply.User.Username,
-			DisplayName: reply.User.DisplayName,
-			ChannelID:   reply.ChannelID.String(),
-			ThreadID:    &threadIDStr,
-			CreatedAt:   reply.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt:   reply.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		}
-		replyResponses = append(replyResponses, response)
+		replyResponses = append(replyResponses, newMessageResponse(reply))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"replies": replyResponses})
 }
 
 func (h *MessageHandler) GetRecentMessages(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	
-	// Get channels user is member of
-	var channelIDs []string
-	database.GetDB().Model(&models.ChannelMember{}).
-		Where("user_id = ?", userID).
-		Pluck("channel_id", &channelIDs)
-
-	if len(channelIDs) == 0 {
-		c.JSON(http.StatusOK, gin.H{"messages": []models.MessageResponse{}})
+	actor, ok := actorFromContext(c)
+	if !ok {
 		return
 	}
 
-	// Get recent messages from user's channels
-	var messages []models.Message
-	if err := database.GetDB().
-		Preload("User").
-		Preload("Channel").
-		Where("channel_id IN ? AND thread_id IS NULL", channelIDs).
-		Where("created_at > ?", time.Now().Add(-24*time.Hour)).
-		Order("created_at DESC").
-		Limit(20).
-		Find(&messages).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recent messages"})
+	messages, err := h.messages.Recent(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch recent messages")
 		return
 	}
 
-	var messageResponses []models.MessageResponse
+	messageResponses := []models.MessageResponse{}
 	for _, message := range messages {
-		// Count replies
-		var replyCount int64
-		database.GetDB().Model(&models.Message{}).Where("thread_id = ?", message.ID).Count(&replyCount)
-
-		response := models.MessageResponse{
-			ID:          message.ID.String(),
-			Content:     message.Content,
-			UserID:      message.User.ID.String(),
-			Username:    message.User.Username,
-			DisplayName: message.User.DisplayName,
-			ChannelID:   message.ChannelID.String(),
-			CreatedAt:   message.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt:   message.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-			ReplyCount:  int(replyCount),
-		}
-
-		messageResponses = append(messageResponses, response)
+		messageResponses = append(messageResponses, newMessageResponse(message))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"messages": messageResponses})
-}
\ No newline at end of file
+}
+
+type PinMessageRequest struct {
+	MessageID string `json:"message_id" binding:"required,uuid"`
+}
+
+func (h *MessageHandler) GetPins(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	pins, err := h.messages.Pins(c.Request.Context(), actor, parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch pinned messages")
+		return
+	}
+
+	pinResponses := []models.MessageResponse{}
+	for _, pin := range pins {
+		pinResponses = append(pinResponses, newMessageResponse(pin))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pins": pinResponses})
+}
+
+func (h *MessageHandler) PinMessage(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	var req PinMessageRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.messages.Pin(c.Request.Context(), actor, parseID(uri.ID), parseID(req.MessageID)); err != nil {
+		respondError(c, err, "Failed to pin message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message pinned! 📌"})
+}
+
+func (h *MessageHandler) UnpinMessage(c *gin.Context) {
+	var uri PinURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.messages.Unpin(c.Request.Context(), actor, parseID(uri.ID), parseID(uri.MessageID)); err != nil {
+		respondError(c, err, "Failed to unpin message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message unpinned"})
+}
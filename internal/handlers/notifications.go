@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type NotificationHandler struct {
+	notifications *service.NotificationService
+}
+
+func NewNotificationHandler(notifications *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications}
+}
+
+type NotificationResponse struct {
+	ID        string  `json:"id"`
+	Kind      string  `json:"kind"`
+	Title     string  `json:"title"`
+	Body      string  `json:"body"`
+	ChannelID *string `json:"channel_id,omitempty"`
+	MessageID *string `json:"message_id,omitempty"`
+	Read      bool    `json:"read"`
+	Quiet     bool    `json:"quiet"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// UpdateNotificationSettingsRequest changes only the fields present. Times of
+// day are HH:MM in the user's timezone; a snooze of 0 minutes ends a snooze.
+type UpdateNotificationSettingsRequest struct {
+	Keywords      *[]string `json:"keywords,omitempty" binding:"omitempty,dive,min=2,max=50"`
+	Timezone      *string   `json:"timezone,omitempty" binding:"omitempty,max=64"`
+	DNDEnabled    *bool     `json:"dnd_enabled,omitempty"`
+	DNDStart      *string   `json:"dnd_start,omitempty" binding:"omitempty,max=5"`
+	DNDEnd        *string   `json:"dnd_end,omitempty" binding:"omitempty,max=5"`
+	SnoozeMinutes *int      `json:"snooze_minutes,omitempty" binding:"omitempty,min=0"`
+	EmailMentions *bool     `json:"email_mentions,omitempty"`
+	EmailDigest   *bool     `json:"email_digest,omitempty"`
+}
+
+type NotificationSettingsResponse struct {
+	Keywords    []string `json:"keywords"`
+	Timezone    string   `json:"timezone"`
+	DNDEnabled  bool     `json:"dnd_enabled"`
+	DNDStart    string   `json:"dnd_start,omitempty"`
+	DNDEnd      string   `json:"dnd_end,omitempty"`
+	SnoozeUntil *string  `json:"snooze_until,omitempty"`
+	// EmailMentions emails unread mentions while away; EmailDigest sends a daily digest
+	EmailMentions bool `json:"email_mentions"`
+	EmailDigest   bool `json:"email_digest"`
+}
+
+type ChannelNotificationLevelRequest struct {
+	Level models.NotificationLevel `json:"level" binding:"required,oneof=all mentions none muted"`
+}
+
+func newNotificationSettingsResponse(settings *models.NotificationSettings) NotificationSettingsResponse {
+	response := NotificationSettingsResponse{
+		Keywords:   settings.Keywords,
+		Timezone:   settings.Timezone,
+		DNDEnabled: settings.DNDEnabled,
+		DNDStart:   settings.DNDStart,
+		DNDEnd:     settings.DNDEnd,
+
+		EmailMentions: !settings.MentionEmailsDisabled,
+		EmailDigest:   settings.DigestEnabled,
+	}
+	if response.Keywords == nil {
+		response.Keywords = []string{}
+	}
+	if settings.SnoozeUntil != nil {
+		snoozeUntil := settings.SnoozeUntil.UTC().Format("2006-01-02T15:04:05Z")
+		response.SnoozeUntil = &snoozeUntil
+	}
+	return response
+}
+
+func newNotificationResponse(notification models.Notification) NotificationResponse {
+	response := NotificationResponse{
+		ID:        notification.ID.String(),
+		Kind:      string(notification.Kind),
+		Title:     notification.Title,
+		Body:      notification.Body,
+		Read:      notification.ReadAt != nil,
+		Quiet:     notification.Quiet,
+		CreatedAt: notification.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if notification.ChannelID != nil {
+		channelID := notification.ChannelID.String()
+		response.ChannelID = &channelID
+	}
+	if notification.MessageID != nil {
+		messageID := notification.MessageID.String()
+		response.MessageID = &messageID
+	}
+	return response
+}
+
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	notifications, err := h.notifications.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch notifications")
+		return
+	}
+
+	unread, err := h.notifications.UnreadCount(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch notifications")
+		return
+	}
+
+	notificationResponses := []NotificationResponse{}
+	for _, notification := range notifications {
+		notificationResponses = append(notificationResponses, newNotificationResponse(notification))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notificationResponses, "unread_count": unread})
+}
+
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.notifications.MarkRead(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to update notification")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.notifications.MarkAllRead(c.Request.Context(), actor); err != nil {
+		respondError(c, err, "Failed to update notifications")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read"})
+}
+
+func (h *NotificationHandler) GetNotificationSettings(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	settings, err := h.notifications.Settings(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch notification settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": newNotificationSettingsResponse(settings)})
+}
+
+func (h *NotificationHandler) UpdateNotificationSettings(c *gin.Context) {
+	var req UpdateNotificationSettingsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	update := service.NotificationSettingsUpdate{
+		Keywords:   req.Keywords,
+		Timezone:   req.Timezone,
+		DNDEnabled: req.DNDEnabled,
+		DNDStart:   req.DNDStart,
+		DNDEnd:     req.DNDEnd,
+
+		MentionEmails: req.EmailMentions,
+		Digest:        req.EmailDigest,
+	}
+	if req.SnoozeMinutes != nil {
+		snooze := time.Duration(*req.SnoozeMinutes) * time.Minute
+		update.Snooze = &snooze
+	}
+
+	settings, err := h.notifications.UpdateSettings(c.Request.Context(), actor, update, time.Now())
+	if err != nil {
+		respondError(c, err, "Failed to update notification settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": newNotificationSettingsResponse(settings)})
+}
+
+func (h *NotificationHandler) GetChannelNotificationLevel(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	level, err := h.notifications.ChannelLevel(c.Request.Context(), actor, parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch notification level")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"level": level})
+}
+
+func (h *NotificationHandler) SetChannelNotificationLevel(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	var req ChannelNotificationLevelRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.notifications.SetChannelLevel(c.Request.Context(), actor, parseID(uri.ID), req.Level); err != nil {
+		respondError(c, err, "Failed to update notification level")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"level": req.Level})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type PushHandler struct {
+	push *service.PushService
+}
+
+func NewPushHandler(push *service.PushService) *PushHandler {
+	return &PushHandler{push: push}
+}
+
+// CreatePushSubscriptionRequest matches the JSON form of a browser PushSubscription
+type CreatePushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" binding:"required,url,max=2048"`
+	Keys     struct {
+		P256dh string `json:"p256dh" binding:"required,max=128"`
+		Auth   string `json:"auth" binding:"required,max=64"`
+	} `json:"keys" binding:"required"`
+}
+
+type PushSubscriptionResponse struct {
+	ID        string `json:"id"`
+	Endpoint  string `json:"endpoint"`
+	UserAgent string `json:"user_agent,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newPushSubscriptionResponse(subscription models.PushSubscription) PushSubscriptionResponse {
+	return PushSubscriptionResponse{
+		ID:        subscription.ID.String(),
+		Endpoint:  subscription.Endpoint,
+		UserAgent: subscription.UserAgent,
+		CreatedAt: subscription.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func (h *PushHandler) GetPushKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"public_key": h.push.PublicKey()})
+}
+
+func (h *PushHandler) GetPushSubscriptions(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := h.push.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch push subscriptions")
+		return
+	}
+
+	subscriptionResponses := []PushSubscriptionResponse{}
+	for _, subscription := range subscriptions {
+		subscriptionResponses = append(subscriptionResponses, newPushSubscriptionResponse(subscription))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptionResponses})
+}
+
+func (h *PushHandler) CreatePushSubscription(c *gin.Context) {
+	var req CreatePushSubscriptionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := h.push.Subscribe(c.Request.Context(), actor, c.GetString("session_id"), service.PushSubscriptionInput{
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		respondError(c, err, "Failed to register push subscription")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"subscription": newPushSubscriptionResponse(*subscription)})
+}
+
+func (h *PushHandler) DeletePushSubscription(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.push.Unsubscribe(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to remove push subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Push subscription removed"})
+}
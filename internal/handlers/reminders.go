@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/middleware"
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type ReminderHandler struct {
+	reminders *service.ReminderService
+}
+
+func NewReminderHandler(reminders *service.ReminderService) *ReminderHandler {
+	return &ReminderHandler{reminders: reminders}
+}
+
+// CreateReminderRequest takes a message, free text or both. At is an RFC 3339
+// timestamp or a natural form such as "in 2 hours" or "tomorrow at 9am" in the
+// user's timezone.
+type CreateReminderRequest struct {
+	MessageID *string `json:"message_id,omitempty" binding:"omitempty,uuid"`
+	Text      string  `json:"text,omitempty" binding:"omitempty,max=500"`
+	At        string  `json:"at" binding:"required,max=64"`
+}
+
+type ReminderResponse struct {
+	ID        string  `json:"id"`
+	MessageID *string `json:"message_id,omitempty"`
+	Text      string  `json:"text,omitempty"`
+	RemindAt  string  `json:"remind_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+func newReminderResponse(reminder models.Reminder) ReminderResponse {
+	response := ReminderResponse{
+		ID:        reminder.ID.String(),
+		Text:      reminder.Text,
+		RemindAt:  reminder.RemindAt.UTC().Format("2006-01-02T15:04:05Z"),
+		CreatedAt: reminder.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if reminder.MessageID != nil {
+		messageID := reminder.MessageID.String()
+		response.MessageID = &messageID
+	}
+	return response
+}
+
+func (h *ReminderHandler) GetReminders(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	reminders, err := h.reminders.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch reminders")
+		return
+	}
+
+	reminderResponses := []ReminderResponse{}
+	for _, reminder := range reminders {
+		reminderResponses = append(reminderResponses, newReminderResponse(reminder))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reminders": reminderResponses})
+}
+
+func (h *ReminderHandler) CreateReminder(c *gin.Context) {
+	var req CreateReminderRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	var messageID *models.UUIDv7
+	if req.MessageID != nil && *req.MessageID != "" {
+		id := parseID(*req.MessageID)
+		messageID = &id
+	}
+
+	reminder, err := h.reminders.Create(c.Request.Context(), actor, messageID,
+		middleware.SanitizeString(req.Text), req.At, time.Now().UTC())
+	if err != nil {
+		respondError(c, err, "Failed to create reminder")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"reminder": newReminderResponse(*reminder), "message": "Reminder set! ⏰"})
+}
+
+func (h *ReminderHandler) CancelReminder(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.reminders.Cancel(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to cancel reminder")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reminder cancelled"})
+}
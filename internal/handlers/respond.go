@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+// actorFromContext builds the service actor from the values set by AuthMiddleware
+func actorFromContext(c *gin.Context) (service.Actor, bool) {
+	userID, err := models.ParseUUIDv7(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return service.Actor{}, false
+	}
+	return service.Actor{UserID: userID, Role: models.UserRole(c.GetString("role"))}, true
+}
+
+// parseID converts an ID already validated by the URI schema
+func parseID(id string) models.UUIDv7 {
+	parsed, _ := models.ParseUUIDv7(id)
+	return parsed
+}
+
+// respondError maps service errors onto HTTP responses. Anything else is
+// reported as an internal error with the fallback message.
+func respondError(c *gin.Context, err error, fallback string) {
+	status, message, ok := errorStatus(err)
+	if !ok {
+		message = fallback
+	}
+	c.JSON(status, gin.H{"error": message})
+}
+
+// errorStatus returns the HTTP status and user-facing message of a service
+// error. For any other error it reports false with an internal error status.
+func errorStatus(err error) (int, string, bool) {
+	var svcErr *service.Error
+	if !errors.As(err, &svcErr) {
+		return http.StatusInternalServerError, "", false
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		status = http.StatusConflict
+	}
+	return status, svcErr.Message, true
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/models"
+	"turnate/internal/retention"
+	"turnate/internal/service"
+)
+
+type RetentionHandler struct {
+	retention *service.RetentionService
+	purger    *retention.Purger
+}
+
+func NewRetentionHandler(retention *service.RetentionService, purger *retention.Purger) *RetentionHandler {
+	return &RetentionHandler{retention: retention, purger: purger}
+}
+
+// ChannelRetentionRequest sets a channel's retention period in days, null
+// for the workspace default and 0 to keep messages forever, and legal hold,
+// which is left alone when omitted
+type ChannelRetentionRequest struct {
+	RetentionDays *int  `json:"retention_days" binding:"omitempty,min=0,max=36500"`
+	LegalHold     *bool `json:"legal_hold"`
+}
+
+// LegalHoldRequest puts a user on legal hold or releases them
+type LegalHoldRequest struct {
+	LegalHold bool `json:"legal_hold"`
+}
+
+type ChannelRetentionResponse struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	RetentionDays *int   `json:"retention_days"`
+	LegalHold     bool   `json:"legal_hold"`
+}
+
+type LegalHoldResponse struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	LegalHold bool   `json:"legal_hold"`
+}
+
+type PurgeResponse struct {
+	Messages   int64  `json:"messages"`
+	Related    int64  `json:"related"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+}
+
+func newChannelRetentionResponse(channel models.Channel) ChannelRetentionResponse {
+	return ChannelRetentionResponse{
+		ID:            channel.ID.String(),
+		Name:          channel.Name,
+		RetentionDays: channel.RetentionDays,
+		LegalHold:     channel.LegalHold,
+	}
+}
+
+func newLegalHoldResponse(user models.User) LegalHoldResponse {
+	return LegalHoldResponse{ID: user.ID.String(), Username: user.Username, LegalHold: user.LegalHold}
+}
+
+// GetRetention returns the workspace default, the channels that differ from
+// it, the users on legal hold and the last purge since the server started
+func (h *RetentionHandler) GetRetention(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	exceptions, err := h.retention.Exceptions(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch retention policies")
+		return
+	}
+
+	channelResponses := []ChannelRetentionResponse{}
+	for _, channel := range exceptions.Channels {
+		channelResponses = append(channelResponses, newChannelRetentionResponse(channel))
+	}
+	userResponses := []LegalHoldResponse{}
+	for _, user := range exceptions.Users {
+		userResponses = append(userResponses, newLegalHoldResponse(user))
+	}
+	response := gin.H{
+		"retention_days": h.purger.Policy().Days,
+		"channels":       channelResponses,
+		"users":          userResponses,
+	}
+	if last := h.purger.Last(); last != nil {
+		response["last_purge"] = PurgeResponse{
+			Messages:   last.Messages,
+			Related:    last.Related,
+			StartedAt:  last.StartedAt.UTC().Format("2006-01-02T15:04:05Z"),
+			FinishedAt: last.FinishedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *RetentionHandler) SetChannelRetention(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+	var req ChannelRetentionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	channel, err := h.retention.SetChannel(c.Request.Context(), actor, parseID(uri.ID), req.RetentionDays, req.LegalHold)
+	if err != nil {
+		respondError(c, err, "Failed to update channel retention")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channel": newChannelRetentionResponse(*channel)})
+}
+
+func (h *RetentionHandler) SetLegalHold(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+	var req LegalHoldRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.retention.SetUserHold(c.Request.Context(), actor, parseID(uri.ID), req.LegalHold)
+	if err != nil {
+		respondError(c, err, "Failed to update legal hold")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": newLegalHoldResponse(*user)})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type SavedHandler struct {
+	saved *service.SavedService
+}
+
+func NewSavedHandler(saved *service.SavedService) *SavedHandler {
+	return &SavedHandler{saved: saved}
+}
+
+type SaveMessageRequest struct {
+	MessageID string `json:"message_id" binding:"required,uuid"`
+}
+
+type SavedItemResponse struct {
+	Message models.MessageResponse `json:"message"`
+	SavedAt string                 `json:"saved_at"`
+}
+
+func (h *SavedHandler) GetSaved(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.saved.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch saved items")
+		return
+	}
+
+	itemResponses := []SavedItemResponse{}
+	for _, item := range items {
+		itemResponses = append(itemResponses, SavedItemResponse{
+			Message: newMessageResponse(item.Message),
+			SavedAt: item.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved": itemResponses})
+}
+
+func (h *SavedHandler) SaveMessage(c *gin.Context) {
+	var req SaveMessageRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.saved.Save(c.Request.Context(), actor, parseID(req.MessageID)); err != nil {
+		respondError(c, err, "Failed to save message")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Message saved! 🔖"})
+}
+
+func (h *SavedHandler) UnsaveMessage(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.saved.Unsave(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to remove saved message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message removed from saved items"})
+}
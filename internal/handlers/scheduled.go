@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/middleware"
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type UpdateScheduledMessageRequest struct {
+	Content *string `json:"content,omitempty" binding:"omitempty,min=1,max=2000"`
+	SendAt  *string `json:"send_at,omitempty" binding:"omitempty,min=1,max=64"`
+}
+
+type ScheduledMessageResponse struct {
+	ID        string  `json:"id"`
+	ChannelID string  `json:"channel_id"`
+	ThreadID  *string `json:"thread_id,omitempty"`
+	Content   string  `json:"content"`
+	SendAt    string  `json:"send_at"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+
+	AlsoSendToChannel bool `json:"also_send_to_channel,omitempty"`
+}
+
+func newScheduledMessageResponse(scheduled models.ScheduledMessage) ScheduledMessageResponse {
+	response := ScheduledMessageResponse{
+		ID:        scheduled.ID.String(),
+		ChannelID: scheduled.ChannelID.String(),
+		Content:   scheduled.Content,
+		SendAt:    scheduled.SendAt.UTC().Format("2006-01-02T15:04:05Z"),
+		CreatedAt: scheduled.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt: scheduled.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+
+		AlsoSendToChannel: scheduled.AlsoSendToChannel,
+	}
+	if scheduled.ThreadID != nil {
+		threadID := scheduled.ThreadID.String()
+		response.ThreadID = &threadID
+	}
+	return response
+}
+
+func (h *MessageHandler) GetScheduledMessages(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	scheduled, err := h.scheduled.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch scheduled messages")
+		return
+	}
+
+	scheduledResponses := []ScheduledMessageResponse{}
+	for _, message := range scheduled {
+		scheduledResponses = append(scheduledResponses, newScheduledMessageResponse(message))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_messages": scheduledResponses})
+}
+
+func (h *MessageHandler) UpdateScheduledMessage(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	var req UpdateScheduledMessageRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	update := service.ScheduledMessageUpdate{SendAt: req.SendAt}
+	if req.Content != nil {
+		content := middleware.SanitizeString(*req.Content)
+		update.Content = &content
+	}
+
+	scheduled, err := h.scheduled.Update(c.Request.Context(), actor, parseID(uri.ID), update, time.Now().UTC())
+	if err != nil {
+		respondError(c, err, "Failed to update scheduled message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_message": newScheduledMessageResponse(*scheduled), "message": "Scheduled message updated! ✅"})
+}
+
+func (h *MessageHandler) CancelScheduledMessage(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduled.Cancel(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to cancel scheduled message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled message cancelled"})
+}
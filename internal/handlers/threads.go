@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/models"
+	"turnate/internal/service"
+)
+
+type ThreadHandler struct {
+	threads *service.ThreadService
+}
+
+func NewThreadHandler(threads *service.ThreadService) *ThreadHandler {
+	return &ThreadHandler{threads: threads}
+}
+
+type FollowedThreadResponse struct {
+	Thread      models.MessageResponse `json:"thread"`
+	UnreadCount int64                  `json:"unread_count"`
+}
+
+func (h *ThreadHandler) GetThreads(c *gin.Context) {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	threads, err := h.threads.List(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err, "Failed to fetch threads")
+		return
+	}
+
+	threadResponses := []FollowedThreadResponse{}
+	for _, thread := range threads {
+		threadResponses = append(threadResponses, FollowedThreadResponse{
+			Thread:      newMessageResponse(thread.Root),
+			UnreadCount: thread.Unread,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"threads": threadResponses})
+}
+
+func (h *ThreadHandler) FollowThread(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.threads.Follow(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to follow thread")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Following thread 🧵"})
+}
+
+func (h *ThreadHandler) UnfollowThread(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.threads.Unfollow(c.Request.Context(), actor, parseID(uri.ID)); err != nil {
+		respondError(c, err, "Failed to unfollow thread")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed thread"})
+}
+
+func (h *ThreadHandler) MarkThreadRead(c *gin.Context) {
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.threads.MarkRead(c.Request.Context(), actor, parseID(uri.ID), time.Now()); err != nil {
+		respondError(c, err, "Failed to mark thread read")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thread marked as read"})
+}
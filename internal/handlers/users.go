@@ -4,21 +4,24 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	
-	"turnate/internal/database"
+
+	"turnate/internal/middleware"
 	"turnate/internal/models"
+	"turnate/internal/service"
 )
 
-type UserHandler struct{}
+type UserHandler struct {
+	users *service.UserService
+}
 
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+func NewUserHandler(users *service.UserService) *UserHandler {
+	return &UserHandler{users: users}
 }
 
 func (h *UserHandler) GetUsers(c *gin.Context) {
-	var users []models.User
-	if err := database.GetDB().Select("id, username, display_name, role, is_active, last_seen_at").Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+	users, err := h.users.List(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to fetch users")
 		return
 	}
 
@@ -37,11 +40,14 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 }
 
 func (h *UserHandler) GetUserByID(c *gin.Context) {
-	userID := c.Param("id")
-	
-	var user models.User
-	if err := database.GetDB().Select("id, username, display_name, role, is_active, last_seen_at").Where("id = ?", userID).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), parseID(uri.ID))
+	if err != nil {
+		respondError(c, err, "Failed to fetch user")
 		return
 	}
 
@@ -57,58 +63,36 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 }
 
 type UpdateUserRequest struct {
-	DisplayName *string           `json:"display_name,omitempty"`
-	Role        *models.UserRole  `json:"role,omitempty"`
+	DisplayName *string           `json:"display_name,omitempty" binding:"omitempty,min=1,max=100"`
+	Role        *models.UserRole  `json:"role,omitempty" binding:"omitempty,oneof=admin normal"`
 	IsActive    *bool            `json:"is_active,omitempty"`
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
-	userID := c.Param("id")
-	currentUserID, _ := c.Get("user_id")
-	currentRole, _ := c.Get("role")
-	
-	var req UpdateUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+	var uri ResourceURI
+	if !bindURI(c, &uri) {
 		return
 	}
 
-	var user models.User
-	if err := database.GetDB().Where("id = ?", userID).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	var req UpdateUserRequest
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	// Only admins can update role and is_active, users can update their own display_name
-	if currentRole != "admin" && userID != currentUserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+	actor, ok := actorFromContext(c)
+	if !ok {
 		return
 	}
 
-	// Non-admins can only update display_name
-	if currentRole != "admin" {
-		if req.Role != nil || req.IsActive != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can update role and status"})
-			return
-		}
-	}
-
-	// Update fields
+	update := service.UserUpdate{Role: req.Role, IsActive: req.IsActive}
 	if req.DisplayName != nil {
-		user.DisplayName = *req.DisplayName
-	}
-	
-	if currentRole == "admin" {
-		if req.Role != nil {
-			user.Role = *req.Role
-		}
-		if req.IsActive != nil {
-			user.IsActive = *req.IsActive
-		}
+		displayName := middleware.SanitizeString(*req.DisplayName)
+		update.DisplayName = &displayName
 	}
 
-	if err := database.GetDB().Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	user, err := h.users.Update(c.Request.Context(), actor, parseID(uri.ID), update)
+	if err != nil {
+		respondError(c, err, "Failed to update user")
 		return
 	}
 
@@ -121,4 +105,4 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"user": profile, "message": "User updated successfully! ✅"})
-}
\ No newline at end of file
+}
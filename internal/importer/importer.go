@@ -0,0 +1,365 @@
+// Package importer brings users, channels and messages over from other chat
+// systems. Every imported record is remembered in an ImportMapping, so an
+// import can be run again to pick up what changed without duplicating what
+// it already created.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"turnate/internal/models"
+)
+
+// Kinds of mapped records
+const (
+	kindUser    = "user"
+	kindChannel = "channel"
+	kindMessage = "message"
+)
+
+// batchSize bounds the rows written, and the IDs looked up, per statement
+const batchSize = 500
+
+// maxSkipped bounds the skipped records listed in a report; all are counted
+const maxSkipped = 1000
+
+// maxMessageLength is the longest message users can post or edit through the
+// API. Longer imported messages are skipped rather than cut off.
+const maxMessageLength = 2000
+
+// lockedPassword is not a bcrypt hash, so no password matches it. Imported
+// users sign in once an admin sets a password for them.
+const lockedPassword = "!imported"
+
+// Report describes what an import did
+type Report struct {
+	Source  string `json:"source"`
+	Created Counts `json:"created"`
+	// Existing counts records imported by an earlier run, or matched to
+	// records already in Turnate, which are left unchanged
+	Existing Counts `json:"existing"`
+	// Unmapped counts parts of the source data that have no equivalent in
+	// Turnate, such as reactions
+	Unmapped map[string]int `json:"unmapped"`
+	// Skipped lists the records that were not imported and why
+	Skipped      []Skipped `json:"skipped"`
+	SkippedCount int       `json:"skipped_count"`
+}
+
+type Counts struct {
+	Users       int `json:"users"`
+	Channels    int `json:"channels"`
+	Memberships int `json:"memberships"`
+	Messages    int `json:"messages"`
+}
+
+// Skipped is a record that was not imported
+type Skipped struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func newReport(source string) *Report {
+	return &Report{Source: source, Unmapped: map[string]int{}, Skipped: []Skipped{}}
+}
+
+func (r *Report) skip(kind, id, reason string) {
+	r.SkippedCount++
+	if len(r.Skipped) < maxSkipped {
+		r.Skipped = append(r.Skipped, Skipped{Kind: kind, ID: id, Reason: reason})
+	}
+}
+
+func (r *Report) unmapped(what string, n int) {
+	if n > 0 {
+		r.Unmapped[what] += n
+	}
+}
+
+// mappings reads and records the ImportMappings of one source
+type mappings struct {
+	source string
+}
+
+func (m mappings) get(tx *gorm.DB, kind, externalID string) (models.UUIDv7, bool, error) {
+	found, err := m.getMany(tx, kind, []string{externalID})
+	if err != nil {
+		return models.UUIDv7{}, false, err
+	}
+	id, ok := found[externalID]
+	return id, ok, nil
+}
+
+func (m mappings) getMany(tx *gorm.DB, kind string, externalIDs []string) (map[string]models.UUIDv7, error) {
+	found := make(map[string]models.UUIDv7, len(externalIDs))
+	for start := 0; start < len(externalIDs); start += batchSize {
+		end := min(start+batchSize, len(externalIDs))
+		var rows []models.ImportMapping
+		err := tx.Where("source = ? AND kind = ? AND external_id IN ?", m.source, kind, externalIDs[start:end]).Find(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to read import mappings: %w", err)
+		}
+		for _, row := range rows {
+			found[row.ExternalID] = row.TargetID
+		}
+	}
+	return found, nil
+}
+
+func (m mappings) add(tx *gorm.DB, kind, externalID string, target models.UUIDv7) error {
+	mapping := &models.ImportMapping{Source: m.source, Kind: kind, ExternalID: externalID, TargetID: target}
+	if err := tx.Create(mapping).Error; err != nil {
+		return fmt.Errorf("failed to record import mapping: %w", err)
+	}
+	return nil
+}
+
+// userRecord is a person to import
+type userRecord struct {
+	ExternalID string
+	Username   string
+	// FallbackUsername is used when too little of Username is valid
+	FallbackUsername string
+	// Email may be empty; the user then gets an address that cannot receive
+	// mail
+	Email       string
+	DisplayName string
+	Role        models.UserRole
+	Active      bool
+}
+
+// channelRecord is a conversation to import, with its creator resolved
+type channelRecord struct {
+	ExternalID  string
+	Name        string
+	Description string
+	Type        models.ChannelType
+	CreatedBy   models.UUIDv7
+	CreatedAt   time.Time
+}
+
+// writer writes imported records within one transaction
+type writer struct {
+	tx     *gorm.DB
+	maps   mappings
+	report *Report
+}
+
+// user returns the user a person was imported as before, else the user with
+// the same email address, else a new user
+func (w *writer) user(rec userRecord) (*models.User, error) {
+	var user models.User
+	if id, ok, err := w.maps.get(w.tx, kindUser, rec.ExternalID); err != nil {
+		return nil, err
+	} else if ok {
+		if err := w.tx.Unscoped().First(&user, "id = ?", id).Error; err != nil {
+			return nil, fmt.Errorf("failed to read imported user: %w", err)
+		}
+		w.report.Existing.Users++
+		return &user, nil
+	}
+
+	email := strings.TrimSpace(rec.Email)
+	if email != "" {
+		err := w.tx.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+		if err == nil {
+			w.report.Existing.Users++
+			return &user, w.maps.add(w.tx, kindUser, rec.ExternalID, user.ID)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to match user: %w", err)
+		}
+	} else {
+		email = strings.ToLower(usernameInvalid.ReplaceAllString(rec.ExternalID, "_")) + "@" + w.maps.source + ".invalid"
+		w.report.unmapped("missing_emails", 1)
+	}
+
+	username, err := uniqueUsername(w.tx, rec.Username, rec.FallbackUsername)
+	if err != nil {
+		return nil, err
+	}
+	role := rec.Role
+	if role == "" {
+		role = models.UserRoleNormal
+	}
+	user = models.User{
+		Username:    username,
+		Email:       email,
+		Password:    lockedPassword,
+		DisplayName: truncate(rec.DisplayName, 100),
+		Role:        role,
+		IsActive:    true,
+	}
+	if err := w.tx.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user %s: %w", username, err)
+	}
+	// IsActive has a column default, so false is only stored by an update
+	if !rec.Active {
+		if err := w.tx.Model(&user).Update("is_active", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to deactivate user %s: %w", username, err)
+		}
+	}
+	w.report.Created.Users++
+	return &user, w.maps.add(w.tx, kindUser, rec.ExternalID, user.ID)
+}
+
+// channel returns the channel a conversation was imported into before, else
+// an existing channel of the same name and type, else a new channel. A name
+// taken by a channel of the other type gets a numbered suffix.
+func (w *writer) channel(rec channelRecord) (models.UUIDv7, error) {
+	if id, ok, err := w.maps.get(w.tx, kindChannel, rec.ExternalID); err != nil || ok {
+		if ok {
+			w.report.Existing.Channels++
+		}
+		return id, err
+	}
+
+	name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(rec.Name)), " ", "-")
+	var existing models.Channel
+	err := w.tx.Where("name = ?", name).First(&existing).Error
+	if err == nil && existing.Type == rec.Type {
+		w.report.Existing.Channels++
+		return existing.ID, w.maps.add(w.tx, kindChannel, rec.ExternalID, existing.ID)
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.UUIDv7{}, fmt.Errorf("failed to match channel: %w", err)
+	}
+
+	name, err = uniqueChannelName(w.tx, name)
+	if err != nil {
+		return models.UUIDv7{}, err
+	}
+	channel := &models.Channel{
+		Name:        name,
+		Description: truncate(rec.Description, 500),
+		Type:        rec.Type,
+		CreatedBy:   rec.CreatedBy,
+	}
+	channel.ID = models.NewUUIDv7At(rec.CreatedAt)
+	channel.CreatedAt = rec.CreatedAt
+	if err := w.tx.Omit(clause.Associations).Create(channel).Error; err != nil {
+		return models.UUIDv7{}, fmt.Errorf("failed to create channel %s: %w", name, err)
+	}
+	w.report.Created.Channels++
+	return channel.ID, w.maps.add(w.tx, kindChannel, rec.ExternalID, channel.ID)
+}
+
+var usernameInvalid = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// uniqueUsername turns name into a valid username that no user or group
+// handle has yet, ignoring case as mentions do, falling back to fallback when
+// too little of name is usable
+func uniqueUsername(tx *gorm.DB, name, fallback string) (string, error) {
+	base := strings.Trim(usernameInvalid.ReplaceAllString(name, "_"), "_")
+	if len(base) < 3 {
+		base = usernameInvalid.ReplaceAllString(fallback, "_")
+	}
+	base = base[:min(len(base), 45)]
+
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Unscoped().Where("LOWER(username) = LOWER(?)", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		var groups int64
+		if err := tx.Model(&models.UserGroup{}).Where("handle = LOWER(?)", candidate).Count(&groups).Error; err != nil {
+			return "", fmt.Errorf("failed to check group handles: %w", err)
+		}
+		if count == 0 && groups == 0 {
+			return candidate, nil
+		}
+		candidate = base + "_" + strconv.Itoa(i)
+	}
+}
+
+// uniqueChannelName returns name, or name with a numbered suffix if a channel
+// already has it
+func uniqueChannelName(tx *gorm.DB, name string) (string, error) {
+	name = name[:min(len(name), 95)]
+	candidate := name
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&models.Channel{}).Where("name = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check channel name: %w", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = name + "-" + strconv.Itoa(i)
+	}
+}
+
+// addMembers adds users to a channel, counting new and existing memberships
+func addMembers(tx *gorm.DB, report *Report, channelID models.UUIDv7, userIDs []models.UUIDv7, joinedAt time.Time) error {
+	for _, userID := range userIDs {
+		member := &models.ChannelMember{ChannelID: channelID, UserID: userID}
+		member.CreatedAt = joinedAt
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+		if result.Error != nil {
+			return fmt.Errorf("failed to add channel member: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			report.Created.Memberships++
+		} else {
+			report.Existing.Memberships++
+		}
+	}
+	return nil
+}
+
+// finishThreads recomputes the reply statistics of a channel's threads and
+// makes their participants follow them, with everything imported marked read
+func finishThreads(tx *gorm.DB, channelID models.UUIDv7, now time.Time) error {
+	err := tx.Exec(`UPDATE messages SET
+		reply_count = (SELECT COUNT(*) FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL),
+		last_reply_at = (SELECT MAX(created_at) FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL)
+		WHERE channel_id = ? AND thread_id IS NULL
+		AND EXISTS (SELECT 1 FROM messages AS replies WHERE replies.thread_id = messages.id AND replies.deleted_at IS NULL)`, channelID).Error
+	if err != nil {
+		return fmt.Errorf("failed to update thread statistics: %w", err)
+	}
+
+	var participants []struct {
+		ThreadID models.UUIDv7
+		UserID   models.UUIDv7
+	}
+	err = tx.Raw(`SELECT thread_id, user_id FROM messages WHERE channel_id = ? AND thread_id IS NOT NULL AND deleted_at IS NULL
+		UNION
+		SELECT id, user_id FROM messages WHERE channel_id = ? AND thread_id IS NULL AND reply_count > 0 AND deleted_at IS NULL`, channelID, channelID).
+		Scan(&participants).Error
+	if err != nil {
+		return fmt.Errorf("failed to read thread participants: %w", err)
+	}
+	if len(participants) == 0 {
+		return nil
+	}
+	follows := make([]models.ThreadFollow, len(participants))
+	for i, p := range participants {
+		follows[i] = models.ThreadFollow{ThreadID: p.ThreadID, UserID: p.UserID, Following: true, LastReadAt: &now}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(follows, batchSize).Error; err != nil {
+		return fmt.Errorf("failed to follow threads: %w", err)
+	}
+	return nil
+}
+
+// tooLong reports whether content is longer than users may post
+func tooLong(content string) bool {
+	return utf8.RuneCountInString(content) > maxMessageLength
+}
+
+func truncate(s string, maxRunes int) string {
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	return string([]rune(s)[:maxRunes])
+}
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/logging"
+)
+
+// maxJobs is how many finished imports are remembered
+const maxJobs = 20
+
+var (
+	// ErrNotFound is returned for an ID that matches no import
+	ErrNotFound = errors.New("import not found")
+	// ErrRunning is returned when an import is started while another runs
+	ErrRunning = errors.New("an import is already running")
+	// ErrUnknownSource is returned for a source there is no importer for
+	ErrUnknownSource = errors.New("unknown import source")
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Job is an import started through the API
+type Job struct {
+	ID         string
+	Source     string
+	Status     Status
+	Error      string
+	Report     *Report
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// Imports runs one uploaded import at a time in the background and remembers
+// the most recent ones, with their reports, until the server stops
+type Imports struct {
+	db *gorm.DB
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running bool
+	jobs    []*Job
+}
+
+func NewImports(db *gorm.DB) *Imports {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Imports{db: db, ctx: ctx, cancel: cancel}
+}
+
+// Start saves the uploaded export to a temporary file and imports it in the
+// background, returning the job as running
+func (i *Imports) Start(source string, upload io.Reader, now time.Time) (*Job, error) {
+	switch source {
+	case SourceSlack, SourceMattermost, SourceJSONL:
+	default:
+		return nil, ErrUnknownSource
+	}
+
+	i.mu.Lock()
+	if i.running {
+		i.mu.Unlock()
+		return nil, ErrRunning
+	}
+	i.running = true
+	i.mu.Unlock()
+
+	path, err := saveUpload(upload)
+	if err != nil {
+		i.mu.Lock()
+		i.running = false
+		i.mu.Unlock()
+		return nil, err
+	}
+
+	job := &Job{
+		ID:        source + "-" + now.UTC().Format("20060102T150405.000Z"),
+		Source:    source,
+		Status:    StatusRunning,
+		StartedAt: now.UTC(),
+	}
+	i.mu.Lock()
+	i.jobs = append([]*Job{job}, i.jobs...)
+	if len(i.jobs) > maxJobs {
+		i.jobs = i.jobs[:maxJobs]
+	}
+	started := *job
+	i.mu.Unlock()
+
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		defer os.Remove(path)
+		report, err := i.run(source, path, now)
+
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		i.running = false
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		job.Report = report
+		if err != nil {
+			logging.Component(logging.ComponentServer).Error("import failed", "import", job.ID, "error", err)
+			job.Status = StatusFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = StatusCompleted
+		logging.Component(logging.ComponentServer).Info("import completed", "import", job.ID,
+			"users", report.Created.Users, "channels", report.Created.Channels,
+			"messages", report.Created.Messages, "skipped", report.SkippedCount)
+	}()
+
+	return &started, nil
+}
+
+func (i *Imports) run(source, path string, now time.Time) (*Report, error) {
+	if source == SourceSlack {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer archive.Close()
+		return Slack(i.ctx, i.db, &archive.Reader, now)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+	if source == SourceMattermost {
+		return Mattermost(i.ctx, i.db, file, JSONLOptions{}, now)
+	}
+	return JSONL(i.ctx, i.db, file, JSONLOptions{}, now)
+}
+
+func saveUpload(upload io.Reader) (string, error) {
+	file, err := os.CreateTemp("", "turnate-import-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+	_, err = io.Copy(file, upload)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// List returns the recent imports, newest first
+func (i *Imports) List() []Job {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	jobs := make([]Job, len(i.jobs))
+	for n, job := range i.jobs {
+		jobs[n] = *job
+	}
+	return jobs
+}
+
+func (i *Imports) Get(id string) (*Job, error) {
+	for _, job := range i.List() {
+		if job.ID == id {
+			return &job, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Close cancels a running import and waits for it to stop. Imports write in
+// transactions of whole conversation days or batches, so an import can be
+// run again to finish.
+func (i *Imports) Close() {
+	i.cancel()
+	i.wg.Wait()
+}
@@ -0,0 +1,517 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"turnate/internal/logging"
+	"turnate/internal/middleware"
+	"turnate/internal/models"
+)
+
+// JSONLOptions control an import of a line-by-line export
+type JSONLOptions struct {
+	// DryRun validates every line and writes nothing
+	DryRun bool
+}
+
+// jsonlFormat parses the lines of one JSONL export format into userRecord,
+// jsonlChannel, jsonlMembership and jsonlMessage records
+type jsonlFormat interface {
+	// parse decodes and validates a line of the given type. Lines before a
+	// checkpoint are parsed again, against a report that is thrown away, so
+	// that formats rebuild the state they keep across lines.
+	parse(typ string, data []byte, report *Report) ([]any, error)
+	// finish reports on state left over at the end of the file
+	finish(report *Report)
+}
+
+// jsonlChannel is a conversation whose creator and members are external IDs
+type jsonlChannel struct {
+	channelRecord
+	Creator string
+	Members []string
+}
+
+type jsonlMembership struct {
+	Channel  string
+	User     string
+	JoinedAt time.Time
+	// Define, if set, creates the channel with the user as creator when it
+	// does not exist yet
+	Define *jsonlChannel
+}
+
+type jsonlMessage struct {
+	ExternalID        string
+	Channel           string
+	User              string
+	Thread            string
+	Content           string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	AlsoSentToChannel bool
+	// Define, if set, creates the channel with the author as creator when it
+	// does not exist yet
+	Define *jsonlChannel
+}
+
+type jsonlItem struct {
+	line   int
+	record any
+}
+
+// jsonlImport reads a file line by line and writes its records in batches,
+// each in a transaction that also moves the checkpoint forward
+type jsonlImport struct {
+	db         *gorm.DB
+	format     jsonlFormat
+	opts       JSONLOptions
+	report     *Report
+	maps       mappings
+	now        time.Time
+	checkpoint models.ImportCheckpoint
+	// resolved caches external IDs looked up or created by this run, by kind
+	resolved map[string]models.UUIDv7
+}
+
+func importJSONL(ctx context.Context, db *gorm.DB, r io.ReadSeeker, source string, format jsonlFormat, opts JSONLOptions, now time.Time) (*Report, error) {
+	digest, err := fileDigest(r)
+	if err != nil {
+		return nil, err
+	}
+	im := &jsonlImport{
+		db:         db.WithContext(ctx),
+		format:     format,
+		opts:       opts,
+		report:     newReport(source),
+		maps:       mappings{source: source},
+		now:        now,
+		checkpoint: models.ImportCheckpoint{Source: source, Digest: digest},
+		resolved:   map[string]models.UUIDv7{},
+	}
+	if !opts.DryRun {
+		if err := im.loadCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+	resumeAfter := im.checkpoint.Line
+	scratch := newReport(source)
+
+	lines := bufio.NewReaderSize(r, 64<<10)
+	var batch []jsonlItem
+	lineNo := 0
+	for {
+		data, readErr := lines.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("failed to read line %d: %w", lineNo+1, readErr)
+		}
+		if len(data) > 0 {
+			lineNo++
+			report := im.report
+			if lineNo <= resumeAfter {
+				report = scratch
+			}
+			records, err := im.parseLine(lineNo, data, report)
+			if err != nil {
+				return nil, err
+			}
+			if lineNo > resumeAfter && !opts.DryRun {
+				for _, record := range records {
+					batch = append(batch, jsonlItem{line: lineNo, record: record})
+				}
+			}
+			if len(batch) >= batchSize {
+				if err := im.write(batch, lineNo, false); err != nil {
+					return nil, err
+				}
+				batch = batch[:0]
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if lineNo == 0 {
+		return nil, errors.New("the file is empty")
+	}
+
+	format.finish(im.report)
+	if opts.DryRun {
+		return im.report, nil
+	}
+	if err := im.write(batch, lineNo, true); err != nil {
+		return nil, err
+	}
+	return im.report, nil
+}
+
+func fileDigest(r io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("failed to read import: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read import: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadCheckpoint picks up the report and position of an earlier, unfinished
+// import of the same file
+func (im *jsonlImport) loadCheckpoint() error {
+	err := im.db.Where("source = ? AND digest = ?", im.checkpoint.Source, im.checkpoint.Digest).First(&im.checkpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read import checkpoint: %w", err)
+	}
+	if err := json.Unmarshal([]byte(im.checkpoint.Report), im.report); err != nil {
+		return fmt.Errorf("failed to read import checkpoint: %w", err)
+	}
+	logging.Component(logging.ComponentServer).Info("resuming import", "source", im.checkpoint.Source, "after_line", im.checkpoint.Line)
+	return nil
+}
+
+// parseLine decodes one line, reporting invalid lines as skipped. Only a
+// missing or unsupported version line fails the import, since the rest of
+// the file cannot be read without it.
+func (im *jsonlImport) parseLine(lineNo int, data []byte, report *Report) ([]any, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	id := "line " + strconv.Itoa(lineNo)
+
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		if lineNo == 1 {
+			return nil, fmt.Errorf("line 1 is not valid JSON: %w", err)
+		}
+		report.skip("line", id, "not valid JSON")
+		return nil, nil
+	}
+	if (lineNo == 1) != (envelope.Type == "version") {
+		return nil, fmt.Errorf("line %d: the file must start with its only version record", lineNo)
+	}
+
+	records, err := im.format.parse(envelope.Type, data, report)
+	if err != nil {
+		if envelope.Type == "version" {
+			return nil, fmt.Errorf("line 1: %w", err)
+		}
+		report.skip(envelope.Type, id, err.Error())
+		return nil, nil
+	}
+	return records, nil
+}
+
+// write writes a batch and moves the checkpoint to line in one transaction.
+// The last batch removes the checkpoint instead.
+func (im *jsonlImport) write(batch []jsonlItem, line int, last bool) error {
+	return im.db.Transaction(func(tx *gorm.DB) error {
+		w := &jsonlWriter{writer: writer{tx: tx, maps: im.maps, report: im.report}, im: im}
+		for _, item := range batch {
+			if err := w.write(item); err != nil {
+				return err
+			}
+		}
+
+		if last {
+			if im.checkpoint.ID.IsZero() {
+				return nil
+			}
+			if err := tx.Unscoped().Delete(&im.checkpoint).Error; err != nil {
+				return fmt.Errorf("failed to remove import checkpoint: %w", err)
+			}
+			return nil
+		}
+		report, err := json.Marshal(im.report)
+		if err != nil {
+			return err
+		}
+		im.checkpoint.Line = line
+		im.checkpoint.Report = string(report)
+		if err := tx.Save(&im.checkpoint).Error; err != nil {
+			return fmt.Errorf("failed to save import checkpoint: %w", err)
+		}
+		return nil
+	})
+}
+
+// validate checks a decoded record against its binding rules, the same
+// rules the API applies to requests
+func validate(record any) error {
+	err := binding.Validator.ValidateStruct(record)
+	if err == nil {
+		return nil
+	}
+	var problems []string
+	for _, field := range middleware.FieldErrors(err) {
+		problems = append(problems, field.Field+" "+field.Message)
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+type jsonlWriter struct {
+	writer
+	im *jsonlImport
+}
+
+func (w *jsonlWriter) write(item jsonlItem) error {
+	id := "line " + strconv.Itoa(item.line)
+	switch record := item.record.(type) {
+	case userRecord:
+		user, err := w.user(record)
+		if err != nil {
+			return err
+		}
+		w.im.resolved[kindUser+"/"+record.ExternalID] = user.ID
+		return nil
+	case jsonlChannel:
+		return w.writeChannel(id, record)
+	case jsonlMembership:
+		return w.writeMembership(id, record)
+	case jsonlMessage:
+		return w.writeMessage(id, record)
+	default:
+		return fmt.Errorf("unexpected record %T", record)
+	}
+}
+
+// resolve returns what an external ID was imported as
+func (w *jsonlWriter) resolve(kind, externalID string) (models.UUIDv7, bool, error) {
+	key := kind + "/" + externalID
+	if id, ok := w.im.resolved[key]; ok {
+		return id, true, nil
+	}
+	id, ok, err := w.maps.get(w.tx, kind, externalID)
+	if ok {
+		w.im.resolved[key] = id
+	}
+	return id, ok, err
+}
+
+func (w *jsonlWriter) writeChannel(id string, record jsonlChannel) error {
+	var members []models.UUIDv7
+	for _, member := range record.Members {
+		userID, ok, err := w.resolve(kindUser, member)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			w.report.skip("membership", id, fmt.Sprintf("unknown user %q", member))
+			continue
+		}
+		members = append(members, userID)
+	}
+
+	creator, ok, err := w.resolve(kindUser, record.Creator)
+	if err != nil {
+		return err
+	}
+	if !ok && len(members) > 0 {
+		creator, ok = members[0], true
+	}
+	if !ok {
+		w.report.skip(kindChannel, id, fmt.Sprintf("unknown creator %q", record.Creator))
+		return nil
+	}
+
+	channelID, err := w.createChannel(record, creator)
+	if err != nil {
+		return err
+	}
+	return addMembers(w.tx, w.report, channelID, members, record.CreatedAt)
+}
+
+func (w *jsonlWriter) createChannel(record jsonlChannel, creator models.UUIDv7) (models.UUIDv7, error) {
+	record.CreatedBy = creator
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = w.im.now
+	}
+	channelID, err := w.channel(record.channelRecord)
+	if err != nil {
+		return models.UUIDv7{}, err
+	}
+	w.im.resolved[kindChannel+"/"+record.ExternalID] = channelID
+	return channelID, nil
+}
+
+// resolveChannel returns the channel an external ID was imported as. A
+// channel with a definition that this run has not seen yet is created from
+// it with creator, or counted as existing.
+func (w *jsonlWriter) resolveChannel(externalID string, define *jsonlChannel, creator models.UUIDv7) (models.UUIDv7, bool, error) {
+	if _, seen := w.im.resolved[kindChannel+"/"+externalID]; seen || define == nil {
+		return w.resolve(kindChannel, externalID)
+	}
+	channelID, err := w.createChannel(*define, creator)
+	return channelID, err == nil, err
+}
+
+func (w *jsonlWriter) writeMembership(id string, record jsonlMembership) error {
+	userID, ok, err := w.resolve(kindUser, record.User)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.report.skip("membership", id, fmt.Sprintf("unknown user %q", record.User))
+		return nil
+	}
+	channelID, ok, err := w.resolveChannel(record.Channel, record.Define, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.report.skip("membership", id, fmt.Sprintf("unknown channel %q", record.Channel))
+		return nil
+	}
+
+	joinedAt := record.JoinedAt
+	if joinedAt.IsZero() {
+		joinedAt = w.im.now
+	}
+	return addMembers(w.tx, w.report, channelID, []models.UUIDv7{userID}, joinedAt)
+}
+
+func (w *jsonlWriter) writeMessage(id string, record jsonlMessage) error {
+	if _, ok, err := w.resolve(kindMessage, record.ExternalID); err != nil || ok {
+		if ok {
+			w.report.Existing.Messages++
+		}
+		return err
+	}
+
+	userID, ok, err := w.resolve(kindUser, record.User)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.report.skip(kindMessage, id, fmt.Sprintf("unknown user %q", record.User))
+		return nil
+	}
+	channelID, ok, err := w.resolveChannel(record.Channel, record.Define, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.report.skip(kindMessage, id, fmt.Sprintf("unknown channel %q", record.Channel))
+		return nil
+	}
+
+	var root *models.Message
+	if record.Thread != "" {
+		if root, err = w.thread(record.Thread); err != nil {
+			return err
+		}
+		if root == nil {
+			// The thread was not imported, so the reply stands on its own
+			w.report.unmapped("orphan_replies", 1)
+		}
+	}
+
+	message := &models.Message{
+		Content:   record.Content,
+		UserID:    userID,
+		ChannelID: channelID,
+		Type:      models.MessageTypeUser,
+	}
+	message.ID = models.NewUUIDv7At(record.CreatedAt)
+	message.CreatedAt = record.CreatedAt
+	message.UpdatedAt = record.UpdatedAt
+	if message.UpdatedAt.Before(message.CreatedAt) {
+		message.UpdatedAt = message.CreatedAt
+	}
+	if root != nil {
+		message.ThreadID = &root.ID
+		message.AlsoSentToChannel = record.AlsoSentToChannel
+	}
+	if err := w.tx.Omit(clause.Associations).Create(message).Error; err != nil {
+		return fmt.Errorf("failed to import message on %s: %w", id, err)
+	}
+	if err := w.maps.add(w.tx, kindMessage, record.ExternalID, message.ID); err != nil {
+		return err
+	}
+	w.im.resolved[kindMessage+"/"+record.ExternalID] = message.ID
+	w.report.Created.Messages++
+
+	if root != nil {
+		return w.addReply(root, message)
+	}
+	return nil
+}
+
+// thread returns the root of the thread an external message ID was imported
+// as, or nil if it was not imported or has been deleted since
+func (w *jsonlWriter) thread(externalID string) (*models.Message, error) {
+	rootID, ok, err := w.resolve(kindMessage, externalID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var root models.Message
+	err = w.tx.Select("id", "user_id", "last_reply_at").First(&root, "id = ? AND thread_id IS NULL", rootID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read thread: %w", err)
+	}
+	return &root, nil
+}
+
+// addReply updates the thread statistics of the root and makes the root's
+// author and the replier follow the thread, with everything imported read
+func (w *jsonlWriter) addReply(root, reply *models.Message) error {
+	lastReplyAt := reply.CreatedAt
+	if root.LastReplyAt != nil && root.LastReplyAt.After(lastReplyAt) {
+		lastReplyAt = *root.LastReplyAt
+	}
+	root.LastReplyAt = &lastReplyAt
+	err := w.tx.Model(&models.Message{}).Where("id = ?", root.ID).UpdateColumns(map[string]any{
+		"reply_count":   gorm.Expr("reply_count + 1"),
+		"last_reply_at": lastReplyAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update thread statistics: %w", err)
+	}
+
+	now := w.im.now
+	follows := []models.ThreadFollow{
+		{ThreadID: root.ID, UserID: root.UserID, Following: true, LastReadAt: &now},
+		{ThreadID: root.ID, UserID: reply.UserID, Following: true, LastReadAt: &now},
+	}
+	if err := w.tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follows).Error; err != nil {
+		return fmt.Errorf("failed to follow thread: %w", err)
+	}
+	return nil
+}
+
+// parseTime parses an optional RFC 3339 time
+func parseTime(field, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", field)
+	}
+	return t.UTC(), nil
+}
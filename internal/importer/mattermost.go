@@ -0,0 +1,323 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/models"
+)
+
+// SourceMattermost identifies records imported from a Mattermost bulk export
+const SourceMattermost = "mattermost"
+
+type mattermostLine struct {
+	Version       *int                     `json:"version"`
+	User          *mattermostUser          `json:"user"`
+	Channel       *mattermostChannel       `json:"channel"`
+	Post          *mattermostPost          `json:"post"`
+	DirectChannel *mattermostDirectChannel `json:"direct_channel"`
+	DirectPost    *mattermostDirectPost    `json:"direct_post"`
+}
+
+type mattermostUser struct {
+	Username  string `json:"username" binding:"required,max=64"`
+	Email     string `json:"email" binding:"omitempty,email,max=100"`
+	Nickname  string `json:"nickname"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	DeleteAt  int64  `json:"delete_at"`
+	Teams     []struct {
+		Name     string `json:"name"`
+		Channels []struct {
+			Name string `json:"name"`
+		} `json:"channels"`
+	} `json:"teams"`
+}
+
+type mattermostChannel struct {
+	Team        string `json:"team" binding:"required,max=64"`
+	Name        string `json:"name" binding:"required,max=64"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type" binding:"required,oneof=O P"`
+	Header      string `json:"header"`
+	Purpose     string `json:"purpose"`
+}
+
+// mattermostReply is a reply within a post, and the part of a post the two
+// share
+type mattermostReply struct {
+	User        string `json:"user" binding:"required,max=64"`
+	Type        string `json:"type"`
+	Message     string `json:"message"`
+	CreateAt    int64  `json:"create_at" binding:"required,gt=0"`
+	EditAt      int64  `json:"edit_at"`
+	Reactions   []any  `json:"reactions"`
+	Attachments []struct {
+		Path string `json:"path"`
+	} `json:"attachments"`
+	IsPinned bool `json:"is_pinned"`
+}
+
+type mattermostPost struct {
+	mattermostReply
+	Team    string            `json:"team" binding:"required,max=64"`
+	Channel string            `json:"channel" binding:"required,max=64"`
+	Replies []mattermostReply `json:"replies" binding:"dive"`
+}
+
+type mattermostDirectChannel struct {
+	Members      []string `json:"members"`
+	Participants []struct {
+		Username string `json:"username"`
+	} `json:"participants"`
+	Header string `json:"header"`
+}
+
+type mattermostDirectPost struct {
+	mattermostReply
+	ChannelMembers []string          `json:"channel_members" binding:"min=2"`
+	Replies        []mattermostReply `json:"replies" binding:"dive"`
+}
+
+// mattermostFormat reads Mattermost's bulk export. Channels are written when
+// a member or post first needs them, since the export lists channels before
+// the users who could create them.
+type mattermostFormat struct {
+	channels map[string]*jsonlChannel
+	used     map[string]bool
+}
+
+// Mattermost imports a Mattermost bulk export: users, their team channel
+// memberships, channels, posts with replies, and direct and group messages.
+// Teams are flattened; Turnate has one channel namespace. Records imported
+// by an earlier run are left alone, and an interrupted import of the same
+// file resumes where it stopped.
+func Mattermost(ctx context.Context, db *gorm.DB, r io.ReadSeeker, opts JSONLOptions, now time.Time) (*Report, error) {
+	format := &mattermostFormat{channels: map[string]*jsonlChannel{}, used: map[string]bool{}}
+	return importJSONL(ctx, db, r, SourceMattermost, format, opts, now)
+}
+
+func (f *mattermostFormat) parse(typ string, data []byte, report *Report) ([]any, error) {
+	var line mattermostLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, errors.New("not a valid record")
+	}
+
+	switch typ {
+	case "version":
+		if line.Version == nil || *line.Version != 1 {
+			return nil, errors.New("only version 1 of the Mattermost bulk format is supported")
+		}
+		return nil, nil
+	case "channel":
+		if line.Channel == nil {
+			return nil, errors.New("channel is missing")
+		}
+		return nil, f.parseChannel(*line.Channel)
+	case "user":
+		if line.User == nil {
+			return nil, errors.New("user is missing")
+		}
+		return f.parseUser(*line.User, report)
+	case "post":
+		if line.Post == nil {
+			return nil, errors.New("post is missing")
+		}
+		if err := validate(line.Post); err != nil {
+			return nil, err
+		}
+		channel := line.Post.Team + "/" + line.Post.Channel
+		define, ok := f.channels[channel]
+		if !ok {
+			return nil, fmt.Errorf("unknown channel %q", channel)
+		}
+		f.used[channel] = true
+		return f.parsePost(channel, define, line.Post.mattermostReply, line.Post.Replies, report), nil
+	case "direct_channel":
+		if line.DirectChannel == nil {
+			return nil, errors.New("direct_channel is missing")
+		}
+		members := line.DirectChannel.Members
+		for _, participant := range line.DirectChannel.Participants {
+			members = append(members, participant.Username)
+		}
+		if len(members) < 2 {
+			return nil, errors.New("members must contain at least 2 items")
+		}
+		channel := f.directChannel(members)
+		channel.Description = line.DirectChannel.Header
+		return []any{*channel}, nil
+	case "direct_post":
+		if line.DirectPost == nil {
+			return nil, errors.New("direct_post is missing")
+		}
+		if err := validate(line.DirectPost); err != nil {
+			return nil, err
+		}
+		define := f.directChannel(line.DirectPost.ChannelMembers)
+		return f.parsePost(define.ExternalID, define, line.DirectPost.mattermostReply, line.DirectPost.Replies, report), nil
+	default:
+		// Teams, schemes, roles, emoji and the like have no equivalent
+		report.unmapped(typ, 1)
+		return nil, nil
+	}
+}
+
+func (f *mattermostFormat) parseChannel(channel mattermostChannel) error {
+	if err := validate(channel); err != nil {
+		return err
+	}
+	channelType := models.ChannelTypePublic
+	if channel.Type == "P" {
+		channelType = models.ChannelTypePrivate
+	}
+	description := channel.Purpose
+	if description == "" {
+		description = channel.Header
+	}
+	externalID := channel.Team + "/" + channel.Name
+	f.channels[externalID] = &jsonlChannel{channelRecord: channelRecord{
+		ExternalID:  externalID,
+		Name:        channel.Name,
+		Description: description,
+		Type:        channelType,
+	}}
+	return nil
+}
+
+func (f *mattermostFormat) parseUser(user mattermostUser, report *Report) ([]any, error) {
+	if err := validate(user); err != nil {
+		return nil, err
+	}
+	username := strings.ToLower(user.Username)
+	displayName := user.Nickname
+	if displayName == "" {
+		displayName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	records := []any{userRecord{
+		ExternalID:       username,
+		Username:         user.Username,
+		FallbackUsername: "user_" + username,
+		Email:            user.Email,
+		DisplayName:      displayName,
+		Active:           user.DeleteAt == 0,
+	}}
+
+	for _, team := range user.Teams {
+		for _, channel := range team.Channels {
+			externalID := team.Name + "/" + channel.Name
+			define, ok := f.channels[externalID]
+			if !ok {
+				report.skip("membership", username+" in "+externalID, "unknown channel")
+				continue
+			}
+			f.used[externalID] = true
+			records = append(records, jsonlMembership{Channel: externalID, User: username, Define: define})
+		}
+	}
+	return records, nil
+}
+
+// directChannel returns the private channel of a direct or group message,
+// named after its members
+func (f *mattermostFormat) directChannel(members []string) *jsonlChannel {
+	usernames := make([]string, len(members))
+	for i, member := range members {
+		usernames[i] = strings.ToLower(member)
+	}
+	slices.Sort(usernames)
+	usernames = slices.Compact(usernames)
+	return &jsonlChannel{
+		channelRecord: channelRecord{
+			ExternalID: "dm/" + strings.Join(usernames, ","),
+			Name:       "dm-" + strings.Join(usernames, "-"),
+			Type:       models.ChannelTypePrivate,
+		},
+		Creator: usernames[0],
+		Members: usernames,
+	}
+}
+
+// parsePost returns a post and its replies as messages
+func (f *mattermostFormat) parsePost(channel string, define *jsonlChannel, post mattermostReply, replies []mattermostReply, report *Report) []any {
+	root, ok := f.message(channel, channel, "", define, post, report)
+	if !ok {
+		return nil
+	}
+	records := []any{root}
+	for _, reply := range replies {
+		if message, ok := f.message(channel, root.ExternalID, root.ExternalID, define, reply, report); ok {
+			records = append(records, message)
+		}
+	}
+	return records
+}
+
+func (f *mattermostFormat) message(channel, parent, thread string, define *jsonlChannel, post mattermostReply, report *Report) (jsonlMessage, bool) {
+	user := strings.ToLower(post.User)
+	externalID := parent + "/" + user + "/" + strconv.FormatInt(post.CreateAt, 10)
+	if strings.HasPrefix(post.Type, "system_") {
+		report.unmapped("channel_events", 1)
+		return jsonlMessage{}, false
+	}
+
+	content := strings.TrimSpace(post.Message)
+	for _, attachment := range post.Attachments {
+		// Attachments are files beside the export, which is not imported
+		content = strings.TrimSpace(content + "\n📎 " + path.Base(attachment.Path))
+		report.unmapped("files", 1)
+	}
+	if content == "" {
+		report.skip(kindMessage, externalID, "message is empty")
+		return jsonlMessage{}, false
+	}
+	if tooLong(content) {
+		report.skip(kindMessage, externalID, fmt.Sprintf("message is longer than %d characters", maxMessageLength))
+		return jsonlMessage{}, false
+	}
+	report.unmapped("reactions", len(post.Reactions))
+	if post.IsPinned {
+		report.unmapped("pins", 1)
+	}
+
+	createdAt := time.UnixMilli(post.CreateAt).UTC()
+	updatedAt := createdAt
+	if post.EditAt > post.CreateAt {
+		updatedAt = time.UnixMilli(post.EditAt).UTC()
+	}
+	return jsonlMessage{
+		ExternalID: externalID,
+		Channel:    channel,
+		User:       user,
+		Thread:     thread,
+		Content:    content,
+		CreatedAt:  createdAt,
+		UpdatedAt:  updatedAt,
+		Define:     define,
+	}, true
+}
+
+// finish reports the channels nobody joined or posted in, which are not
+// created
+func (f *mattermostFormat) finish(report *Report) {
+	var unused []string
+	for externalID := range f.channels {
+		if !f.used[externalID] {
+			unused = append(unused, externalID)
+		}
+	}
+	slices.Sort(unused)
+	for _, externalID := range unused {
+		report.skip(kindChannel, externalID, "channel has no members or posts")
+	}
+}
@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/models"
+)
+
+// SourceJSONL identifies records imported from Turnate's own JSONL format,
+// described in docs/IMPORT_FORMAT.md
+const SourceJSONL = "jsonl"
+
+// JSONLVersion is the version of Turnate's JSONL format
+const JSONLVersion = 1
+
+type nativeLine struct {
+	Version    *int              `json:"version"`
+	User       *nativeUser       `json:"user"`
+	Channel    *nativeChannel    `json:"channel"`
+	Membership *nativeMembership `json:"membership"`
+	Message    *nativeMessage    `json:"message"`
+}
+
+// The records carry the fields of the export format's records of the same
+// name; other fields are ignored
+type nativeUser struct {
+	ID          string `json:"id" binding:"required,max=255"`
+	Username    string `json:"username" binding:"required,min=3,max=50,username"`
+	Email       string `json:"email" binding:"required,email,max=100"`
+	DisplayName string `json:"display_name" binding:"max=100"`
+	Role        string `json:"role" binding:"omitempty,oneof=normal admin"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+type nativeChannel struct {
+	ID          string `json:"id" binding:"required,max=255"`
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=500"`
+	Type        string `json:"type" binding:"required,oneof=public private"`
+	CreatedBy   string `json:"created_by" binding:"required,max=255"`
+	CreatedAt   string `json:"created_at" binding:"max=64"`
+}
+
+type nativeMembership struct {
+	ChannelID string `json:"channel_id" binding:"required,max=255"`
+	UserID    string `json:"user_id" binding:"required,max=255"`
+	JoinedAt  string `json:"joined_at" binding:"max=64"`
+}
+
+type nativeMessage struct {
+	ID                string `json:"id" binding:"required,max=255"`
+	ChannelID         string `json:"channel_id" binding:"required,max=255"`
+	UserID            string `json:"user_id" binding:"required,max=255"`
+	ThreadID          string `json:"thread_id" binding:"max=255"`
+	Content           string `json:"content" binding:"required,max=2000"`
+	CreatedAt         string `json:"created_at" binding:"required,max=64"`
+	UpdatedAt         string `json:"updated_at" binding:"max=64"`
+	AlsoSentToChannel bool   `json:"also_sent_to_channel"`
+}
+
+type nativeFormat struct{}
+
+// JSONL imports Turnate's own JSONL format. Records refer to each other by
+// the IDs in the file, so anything can be converted into it. Records
+// imported by an earlier run are left alone, and an interrupted import of the
+// same file resumes where it stopped.
+func JSONL(ctx context.Context, db *gorm.DB, r io.ReadSeeker, opts JSONLOptions, now time.Time) (*Report, error) {
+	return importJSONL(ctx, db, r, SourceJSONL, nativeFormat{}, opts, now)
+}
+
+func (nativeFormat) parse(typ string, data []byte, report *Report) ([]any, error) {
+	var line nativeLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, errors.New("not a valid record")
+	}
+
+	switch typ {
+	case "version":
+		if line.Version == nil || *line.Version != JSONLVersion {
+			return nil, errors.New("only version 1 of the Turnate JSONL format is supported")
+		}
+		return nil, nil
+	case "user":
+		if line.User == nil {
+			return nil, errors.New("user is missing")
+		}
+		return parseNativeUser(*line.User)
+	case "channel":
+		if line.Channel == nil {
+			return nil, errors.New("channel is missing")
+		}
+		return parseNativeChannel(*line.Channel)
+	case "membership":
+		if line.Membership == nil {
+			return nil, errors.New("membership is missing")
+		}
+		return parseNativeMembership(*line.Membership)
+	case "message":
+		if line.Message == nil {
+			return nil, errors.New("message is missing")
+		}
+		return parseNativeMessage(*line.Message)
+	default:
+		return nil, errors.New("unknown record type")
+	}
+}
+
+func (nativeFormat) finish(*Report) {}
+
+func parseNativeUser(user nativeUser) ([]any, error) {
+	if err := validate(user); err != nil {
+		return nil, err
+	}
+	return []any{userRecord{
+		ExternalID:  user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Role:        models.UserRole(user.Role),
+		Active:      user.IsActive == nil || *user.IsActive,
+	}}, nil
+}
+
+func parseNativeChannel(channel nativeChannel) ([]any, error) {
+	if err := validate(channel); err != nil {
+		return nil, err
+	}
+	createdAt, err := parseTime("created_at", channel.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return []any{jsonlChannel{
+		channelRecord: channelRecord{
+			ExternalID:  channel.ID,
+			Name:        channel.Name,
+			Description: channel.Description,
+			Type:        models.ChannelType(channel.Type),
+			CreatedAt:   createdAt,
+		},
+		Creator: channel.CreatedBy,
+	}}, nil
+}
+
+func parseNativeMembership(membership nativeMembership) ([]any, error) {
+	if err := validate(membership); err != nil {
+		return nil, err
+	}
+	joinedAt, err := parseTime("joined_at", membership.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return []any{jsonlMembership{Channel: membership.ChannelID, User: membership.UserID, JoinedAt: joinedAt}}, nil
+}
+
+func parseNativeMessage(message nativeMessage) ([]any, error) {
+	if err := validate(message); err != nil {
+		return nil, err
+	}
+	createdAt, err := parseTime("created_at", message.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	updatedAt, err := parseTime("updated_at", message.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return []any{jsonlMessage{
+		ExternalID:        message.ID,
+		Channel:           message.ChannelID,
+		User:              message.UserID,
+		Thread:            message.ThreadID,
+		Content:           message.Content,
+		CreatedAt:         createdAt,
+		UpdatedAt:         updatedAt,
+		AlsoSentToChannel: message.AlsoSentToChannel,
+	}}, nil
+}
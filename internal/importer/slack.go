@@ -0,0 +1,530 @@
+package importer
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"turnate/internal/models"
+)
+
+// SourceSlack identifies records imported from a Slack export
+const SourceSlack = "slack"
+
+type slackUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Deleted  bool   `json:"deleted"`
+	IsBot    bool   `json:"is_bot"`
+	Profile  struct {
+		Email       string `json:"email"`
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+	} `json:"profile"`
+}
+
+// slackConversation is an entry of channels.json, groups.json, mpims.json or
+// dms.json
+type slackConversation struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Created    int64    `json:"created"`
+	Creator    string   `json:"creator"`
+	IsArchived bool     `json:"is_archived"`
+	Members    []string `json:"members"`
+	Purpose    struct {
+		Value string `json:"value"`
+	} `json:"purpose"`
+}
+
+type slackMessage struct {
+	Type     string `json:"type"`
+	Subtype  string `json:"subtype"`
+	User     string `json:"user"`
+	Text     string `json:"text"`
+	Ts       string `json:"ts"`
+	ThreadTs string `json:"thread_ts"`
+	Edited   *struct {
+		Ts string `json:"ts"`
+	} `json:"edited"`
+	Reactions []struct {
+		Count int `json:"count"`
+	} `json:"reactions"`
+	Files []slackFile `json:"files"`
+}
+
+type slackFile struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	Mode       string `json:"mode"`
+	Permalink  string `json:"permalink"`
+	URLPrivate string `json:"url_private"`
+}
+
+// slackConversationFiles lists the conversation lists of an export. Messages
+// of direct messages are in a directory named by ID, all others by name.
+var slackConversationFiles = []struct {
+	file        string
+	channelType models.ChannelType
+	direct      bool
+}{
+	{"channels.json", models.ChannelTypePublic, false},
+	{"groups.json", models.ChannelTypePrivate, false},
+	{"mpims.json", models.ChannelTypePrivate, false},
+	{"dms.json", models.ChannelTypePrivate, true},
+}
+
+// slackChannelEvents are message subtypes that record channel changes rather
+// than something a person wrote
+var slackChannelEvents = []string{
+	"channel_join", "channel_leave", "channel_topic", "channel_purpose", "channel_name",
+	"channel_archive", "channel_unarchive", "group_join", "group_leave", "group_topic",
+	"group_purpose", "group_name", "group_archive", "group_unarchive", "pinned_item", "unpinned_item",
+}
+
+var slackLink = regexp.MustCompile(`<([^<>]+)>`)
+
+type slackImport struct {
+	ctx    context.Context
+	db     *gorm.DB
+	files  map[string]*zip.File
+	report *Report
+	maps   mappings
+	now    time.Time
+
+	// Slack user and channel IDs to what they became
+	users        map[string]models.UUIDv7
+	usernames    map[string]string
+	channelNames map[string]string
+}
+
+// Slack imports a standard Slack workspace export: users, public and private
+// channels, group and direct messages with their members, and every
+// conversation's messages and threads with their original timestamps.
+// Records imported by an earlier run are left alone.
+func Slack(ctx context.Context, db *gorm.DB, archive *zip.Reader, now time.Time) (*Report, error) {
+	files, err := indexSlackArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	im := &slackImport{
+		ctx:          ctx,
+		db:           db.WithContext(ctx),
+		files:        files,
+		report:       newReport(SourceSlack),
+		maps:         mappings{source: SourceSlack},
+		now:          now,
+		users:        map[string]models.UUIDv7{},
+		usernames:    map[string]string{},
+		channelNames: map[string]string{},
+	}
+
+	var users []slackUser
+	if _, err := im.readJSON("users.json", &users); err != nil {
+		return nil, err
+	}
+	if err := im.importUsers(users); err != nil {
+		return nil, err
+	}
+
+	conversations := make([][]slackConversation, len(slackConversationFiles))
+	for i, spec := range slackConversationFiles {
+		if _, err := im.readJSON(spec.file, &conversations[i]); err != nil {
+			return nil, err
+		}
+		for _, conversation := range conversations[i] {
+			im.channelNames[conversation.ID] = conversation.Name
+		}
+	}
+	for i, spec := range slackConversationFiles {
+		for _, conversation := range conversations[i] {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := im.importConversation(conversation, spec.channelType, spec.direct); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return im.report, nil
+}
+
+// indexSlackArchive returns the files of the export by path. Exports that
+// were unpacked and zipped again keep everything in one top directory.
+func indexSlackArchive(archive *zip.Reader) (map[string]*zip.File, error) {
+	root, found := "", false
+	for _, file := range archive.File {
+		if path.Base(file.Name) != "users.json" {
+			continue
+		}
+		dir := strings.TrimSuffix(file.Name, "users.json")
+		if !found || len(dir) < len(root) {
+			root, found = dir, true
+		}
+	}
+	if !found {
+		return nil, errors.New("not a Slack export: users.json is missing")
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		if name, ok := strings.CutPrefix(file.Name, root); ok && !file.FileInfo().IsDir() {
+			files[name] = file
+		}
+	}
+	return files, nil
+}
+
+// readJSON decodes a file of the export, reporting false if it is missing
+func (im *slackImport) readJSON(name string, v any) (bool, error) {
+	file, ok := im.files[name]
+	if !ok {
+		return false, nil
+	}
+	r, err := file.Open()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// importUsers maps each person to a user imported before, else to the user
+// with the same email address, else to a new user
+func (im *slackImport) importUsers(users []slackUser) error {
+	return im.db.Transaction(func(tx *gorm.DB) error {
+		w := &writer{tx: tx, maps: im.maps, report: im.report}
+		for _, su := range users {
+			if su.IsBot || su.ID == "USLACKBOT" {
+				im.report.skip(kindUser, su.ID, "bots are not imported")
+				continue
+			}
+
+			displayName := su.Profile.DisplayName
+			if displayName == "" {
+				displayName = su.Profile.RealName
+			}
+			if displayName == "" {
+				displayName = su.RealName
+			}
+			user, err := w.user(userRecord{
+				ExternalID:       su.ID,
+				Username:         su.Name,
+				FallbackUsername: "user_" + su.ID,
+				Email:            su.Profile.Email,
+				DisplayName:      displayName,
+				Active:           !su.Deleted,
+			})
+			if err != nil {
+				return err
+			}
+			im.users[su.ID] = user.ID
+			im.usernames[su.ID] = user.Username
+		}
+		return nil
+	})
+}
+
+func (im *slackImport) importConversation(conversation slackConversation, channelType models.ChannelType, direct bool) error {
+	var members []models.UUIDv7
+	for _, member := range conversation.Members {
+		if id, ok := im.users[member]; ok {
+			members = append(members, id)
+		}
+	}
+	createdBy, ok := im.users[conversation.Creator]
+	if !ok && len(members) > 0 {
+		createdBy = members[0]
+	}
+	if createdBy.IsZero() {
+		im.report.skip(kindChannel, conversation.ID, "none of its members were imported")
+		return nil
+	}
+
+	name := conversation.Name
+	dir := conversation.Name
+	if direct {
+		name = im.directName(conversation.Members)
+		dir = conversation.ID
+	}
+	createdAt := time.Unix(conversation.Created, 0).UTC()
+
+	var channelID models.UUIDv7
+	err := im.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		w := &writer{tx: tx, maps: im.maps, report: im.report}
+		channelID, err = w.channel(channelRecord{
+			ExternalID:  conversation.ID,
+			Name:        name,
+			Description: conversation.Purpose.Value,
+			Type:        channelType,
+			CreatedBy:   createdBy,
+			CreatedAt:   createdAt,
+		})
+		if err != nil {
+			return err
+		}
+		return addMembers(tx, im.report, channelID, members, createdAt)
+	})
+	if err != nil {
+		return err
+	}
+	if conversation.IsArchived {
+		im.report.unmapped("archived_channels", 1)
+	}
+
+	var days []string
+	for name := range im.files {
+		if path.Dir(name) == dir && strings.HasSuffix(name, ".json") {
+			days = append(days, name)
+		}
+	}
+	sort.Strings(days)
+
+	threads := make(map[string]models.UUIDv7)
+	for _, day := range days {
+		if err := im.ctx.Err(); err != nil {
+			return err
+		}
+		if err := im.importMessages(conversation, channelID, day, threads); err != nil {
+			return err
+		}
+	}
+	if len(days) == 0 {
+		return nil
+	}
+	return im.db.Transaction(func(tx *gorm.DB) error {
+		return finishThreads(tx, channelID, im.now)
+	})
+}
+
+// directName names a direct message after its members
+func (im *slackImport) directName(members []string) string {
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		name, ok := im.usernames[member]
+		if !ok {
+			name = member
+		}
+		names = append(names, strings.ToLower(name))
+	}
+	slices.Sort(names)
+	return "dm-" + strings.Join(names, "-")
+}
+
+// importMessages imports one day of a conversation. threads holds the IDs of
+// the conversation's messages by Slack timestamp, so replies find their
+// thread.
+func (im *slackImport) importMessages(conversation slackConversation, channelID models.UUIDv7, day string, threads map[string]models.UUIDv7) error {
+	var messages []slackMessage
+	if _, err := im.readJSON(day, &messages); err != nil {
+		return err
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		a, _ := slackTime(messages[i].Ts)
+		b, _ := slackTime(messages[j].Ts)
+		return a.Before(b)
+	})
+
+	externalIDs := make([]string, len(messages))
+	for i, message := range messages {
+		externalIDs[i] = conversation.ID + "/" + message.Ts
+	}
+
+	return im.db.Transaction(func(tx *gorm.DB) error {
+		imported, err := im.maps.getMany(tx, kindMessage, externalIDs)
+		if err != nil {
+			return err
+		}
+
+		var created []models.Message
+		var mapped []models.ImportMapping
+		for i, sm := range messages {
+			externalID := externalIDs[i]
+			if id, ok := imported[externalID]; ok {
+				threads[sm.Ts] = id
+				im.report.Existing.Messages++
+				continue
+			}
+			message, ok := im.convertMessage(sm, externalID, channelID, threads)
+			if !ok {
+				continue
+			}
+			threads[sm.Ts] = message.ID
+			created = append(created, *message)
+			mapped = append(mapped, models.ImportMapping{Source: SourceSlack, Kind: kindMessage, ExternalID: externalID, TargetID: message.ID})
+		}
+		if len(created) == 0 {
+			return nil
+		}
+
+		if err := tx.Omit(clause.Associations).CreateInBatches(created, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to import messages of %s: %w", day, err)
+		}
+		if err := tx.CreateInBatches(mapped, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to record import mappings: %w", err)
+		}
+		im.report.Created.Messages += len(created)
+		return nil
+	})
+}
+
+// convertMessage turns a Slack message into a Turnate one, reporting false
+// for messages that are not imported
+func (im *slackImport) convertMessage(sm slackMessage, externalID string, channelID models.UUIDv7, threads map[string]models.UUIDv7) (*models.Message, bool) {
+	switch {
+	case sm.Type != "message":
+		im.report.skip(kindMessage, externalID, fmt.Sprintf("unsupported type %q", sm.Type))
+		return nil, false
+	case slices.Contains(slackChannelEvents, sm.Subtype):
+		im.report.unmapped("channel_events", 1)
+		return nil, false
+	case sm.Subtype == "bot_message":
+		im.report.skip(kindMessage, externalID, "bot messages are not imported")
+		return nil, false
+	case sm.Subtype != "" && sm.Subtype != "thread_broadcast" && sm.Subtype != "me_message" && sm.Subtype != "file_share":
+		im.report.skip(kindMessage, externalID, fmt.Sprintf("unsupported subtype %q", sm.Subtype))
+		return nil, false
+	}
+
+	userID, ok := im.users[sm.User]
+	if !ok {
+		im.report.skip(kindMessage, externalID, "its author was not imported")
+		return nil, false
+	}
+	createdAt, err := slackTime(sm.Ts)
+	if err != nil {
+		im.report.skip(kindMessage, externalID, "invalid timestamp")
+		return nil, false
+	}
+	updatedAt := createdAt
+	if sm.Edited != nil {
+		if edited, err := slackTime(sm.Edited.Ts); err == nil {
+			updatedAt = edited
+		}
+	}
+
+	content := im.convertText(sm.Text)
+	for _, file := range sm.Files {
+		url := file.Permalink
+		if url == "" {
+			url = file.URLPrivate
+		}
+		if url == "" || file.Mode == "tombstone" || file.Mode == "hidden_by_limit" {
+			im.report.skip("file", file.ID, "file is not available in the export")
+			continue
+		}
+		title := file.Title
+		if title == "" {
+			title = file.Name
+		}
+		content = strings.TrimSpace(content + "\n📎 " + title + ": " + url)
+		im.report.unmapped("files", 1)
+	}
+	if strings.TrimSpace(content) == "" {
+		im.report.skip(kindMessage, externalID, "message is empty")
+		return nil, false
+	}
+	if tooLong(content) {
+		im.report.skip(kindMessage, externalID, fmt.Sprintf("message is longer than %d characters", maxMessageLength))
+		return nil, false
+	}
+	for _, reaction := range sm.Reactions {
+		im.report.unmapped("reactions", reaction.Count)
+	}
+
+	message := &models.Message{
+		Content:   content,
+		UserID:    userID,
+		ChannelID: channelID,
+		Type:      models.MessageTypeUser,
+	}
+	message.ID = models.NewUUIDv7At(createdAt)
+	message.CreatedAt = createdAt
+	message.UpdatedAt = updatedAt
+	if sm.ThreadTs != "" && sm.ThreadTs != sm.Ts {
+		if threadID, ok := threads[sm.ThreadTs]; ok {
+			message.ThreadID = &threadID
+			message.AlsoSentToChannel = sm.Subtype == "thread_broadcast"
+		} else {
+			// The thread was not imported, so the reply stands on its own
+			im.report.unmapped("orphan_replies", 1)
+		}
+	}
+	return message, true
+}
+
+// convertText rewrites Slack's markup of mentions, channel references and
+// links as plain text
+func (im *slackImport) convertText(text string) string {
+	text = slackLink.ReplaceAllStringFunc(text, func(match string) string {
+		target, label, _ := strings.Cut(match[1:len(match)-1], "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if username, ok := im.usernames[target[1:]]; ok {
+				return "@" + username
+			}
+			if label != "" {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return target
+		case strings.HasPrefix(target, "#"):
+			if name, ok := im.channelNames[target[1:]]; ok && name != "" {
+				return "#" + name
+			}
+			if label != "" {
+				return "#" + label
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			// Special mentions such as <!here> and user groups
+			if label != "" {
+				return label
+			}
+			command, _, _ := strings.Cut(target[1:], "^")
+			return "@" + command
+		default:
+			if label == "" || label == strings.TrimPrefix(target, "mailto:") {
+				return strings.TrimPrefix(target, "mailto:")
+			}
+			return label + " (" + target + ")"
+		}
+	})
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// slackTime parses a Slack message timestamp, seconds and microseconds since
+// the epoch such as "1503435956.000247"
+func slackTime(ts string) (time.Time, error) {
+	seconds, fraction, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var usec int64
+	if fraction != "" {
+		usec, err = strconv.ParseInt((fraction + "000000")[:6], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(sec, usec*1000).UTC(), nil
+}
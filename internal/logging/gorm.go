@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"turnate/internal/config"
+)
+
+// GORMLogger logs failed statements and, when SQL logging is enabled, those
+// slower than the threshold. Statements are logged with placeholders instead
+// of their values, so password hashes and message content never reach the logs.
+type GORMLogger struct {
+	cfg config.SQLLogConfig
+}
+
+func NewGORMLogger(cfg config.SQLLogConfig) *GORMLogger {
+	return &GORMLogger{cfg: cfg}
+}
+
+// LogMode is ignored; levels come from the sql component's configuration
+func (l *GORMLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *GORMLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	Component(ComponentSQL).InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *GORMLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	Component(ComponentSQL).WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *GORMLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	Component(ComponentSQL).ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *GORMLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.cfg.Enabled && elapsed >= l.cfg.SlowThreshold.Std()
+	if !failed && !slow {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if failed {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		Component(ComponentSQL).LogAttrs(ctx, slog.LevelError, "query failed", attrs...)
+		return
+	}
+	Component(ComponentSQL).LogAttrs(ctx, slog.LevelWarn, "slow query", attrs...)
+}
+
+// ParamsFilter drops the statement's values before GORM renders it for logging
+func (l *GORMLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
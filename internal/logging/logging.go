@@ -0,0 +1,136 @@
+// Package logging configures structured logging with log/slog. Every record
+// names the component that wrote it, which can have its own level, carries the
+// request and trace IDs from its context, and has sensitive fields redacted.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"turnate/internal/config"
+	"turnate/internal/tracing"
+)
+
+// Components that log. Their levels can be set individually.
+const (
+	ComponentServer        = "server"
+	ComponentHTTP          = "http"
+	ComponentSQL           = "sql"
+	ComponentScheduler     = "scheduler"
+	ComponentNotifications = "notifications"
+)
+
+// Redacted replaces the value of sensitive attributes
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys, or fragments of them, whose values are never logged
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "private_key", "p256dh"}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log records carry the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored in ctx, or ""
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Setup makes a handler built from cfg the default for slog and for the
+// standard log package
+func Setup(cfg config.LogConfig, w io.Writer) {
+	slog.SetDefault(slog.New(NewHandler(cfg, w)))
+}
+
+// Component returns the default logger tagged with a component name
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// NewHandler returns a JSON or text handler writing to w that applies the
+// configured levels and redaction
+func NewHandler(cfg config.LogConfig, w io.Writer) slog.Handler {
+	options := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redact}
+
+	var next slog.Handler
+	if cfg.Format == config.LogFormatText {
+		next = slog.NewTextHandler(w, options)
+	} else {
+		next = slog.NewJSONHandler(w, options)
+	}
+
+	levels := make(map[string]slog.Level, len(cfg.Components))
+	for component, level := range cfg.Components {
+		levels[component] = parseLevel(level)
+	}
+	return &handler{next: next, level: parseLevel(cfg.Level), levels: levels}
+}
+
+// handler filters records by their component's level and adds request context
+type handler struct {
+	next      slog.Handler
+	level     slog.Level
+	levels    map[string]slog.Level
+	component string
+}
+
+func (h *handler) minLevel() slog.Level {
+	if level, ok := h.levels[h.component]; ok && h.component != "" {
+		return level
+	}
+	return h.level
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.minLevel()
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		record.AddAttrs(slog.String("trace_id", traceID))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	for _, attr := range attrs {
+		if attr.Key == "component" {
+			clone.component = attr.Value.String()
+		}
+	}
+	clone.next = h.next.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attr.Key, Redacted)
+		}
+	}
+	return attr
+}
+
+func parseLevel(level string) slog.Level {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return parsed
+}
@@ -0,0 +1,147 @@
+// Package mail renders and sends notification emails.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt.tmpl"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html.tmpl"))
+)
+
+// Message is an email with plain text and HTML alternatives
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Unsubscribe is the unsubscribe URL advertised in the List-Unsubscribe header
+	Unsubscribe string
+}
+
+// Sender delivers email
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Render builds the text and HTML bodies from the named template pair, such
+// as "mentions" for templates/mentions.txt.tmpl and templates/mentions.html.tmpl
+func Render(name string, data interface{}) (text, html string, err error) {
+	var textBody, htmlBody bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&textBody, name+".txt.tmpl", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&htmlBody, name+".html.tmpl", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s html: %w", name, err)
+	}
+	return textBody.String(), htmlBody.String(), nil
+}
+
+// SMTPSender sends email through an SMTP server, authenticating when a
+// username is configured
+type SMTPSender struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPSender(host string, port int, username, password, from string) *SMTPSender {
+	sender := &SMTPSender{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		host: host,
+		from: from,
+	}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender
+}
+
+func (s *SMTPSender) Send(ctx context.Context, message Message) error {
+	data, err := s.build(message, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{message.To}, data); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", message.To, err)
+	}
+	return nil
+}
+
+// build encodes the message as multipart/alternative MIME
+func (s *SMTPSender) build(message Message, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, alternative := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {alternative.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(part)
+		if _, err := encoder.Write([]byte(alternative.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", s.from)
+	header("To", message.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", randomID(), s.host))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	if message.Unsubscribe != "" {
+		// One-click unsubscribe (RFC 8058) lets mail clients post to the link
+		header("List-Unsubscribe", "<"+message.Unsubscribe+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,211 @@
+// Package mailtest provides a local SMTP server that records the messages it
+// receives, for tests of code that sends email.
+package mailtest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Received is a message accepted by the server
+type Received struct {
+	From   string
+	To     []string
+	Header mail.Header
+	// Subject is the decoded subject line
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Server is a minimal SMTP server listening on a local port
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Received
+}
+
+// NewServer starts a server on a random local port. Close it when done.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Host returns the address the server listens on
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received(nil), s.messages...)
+}
+
+// Reset forgets the messages received so far
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		io.WriteString(conn, line+"\r\n")
+	}
+
+	reply("220 mailtest ready")
+	var from string
+	var to []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-mailtest")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(command, "HELO"):
+			reply("250 mailtest")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			from, to = address(line), nil
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			to = append(to, address(line))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := readData(reader)
+			if err != nil {
+				return
+			}
+			s.record(from, to, data)
+			reply("250 OK")
+		case command == "RSET":
+			from, to = "", nil
+			reply("250 OK")
+		case command == "NOOP":
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func address(line string) string {
+	_, value, _ := strings.Cut(line, ":")
+	return strings.Trim(strings.TrimSpace(value), "<>")
+}
+
+// readData reads a message up to the terminating dot line, undoing dot stuffing
+func readData(reader *bufio.Reader) ([]byte, error) {
+	var data bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return data.Bytes(), nil
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func (s *Server) record(from string, to []string, data []byte) {
+	received := Received{From: from, To: to}
+	if message, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		received.Header = message.Header
+		received.Subject, _ = new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+		received.Text, received.HTML = bodies(message)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, received)
+}
+
+// bodies extracts the text and HTML alternatives of a message
+func bodies(message *mail.Message) (text, html string) {
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		body, _ := io.ReadAll(message.Body)
+		return string(body), ""
+	}
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextRawPart()
+		if err != nil {
+			return text, html
+		}
+		var body []byte
+		if part.Header.Get("Content-Transfer-Encoding") == "quoted-printable" {
+			body, _ = io.ReadAll(quotedprintable.NewReader(part))
+		} else {
+			body, _ = io.ReadAll(part)
+		}
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(body)
+		}
+	}
+}
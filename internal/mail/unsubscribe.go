@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// Mailing lists a user can unsubscribe from
+const (
+	ListMentions = "mentions"
+	ListDigest   = "digest"
+)
+
+// UnsubscribeToken signs a user and list so that unsubscribe links work
+// without signing in
+func UnsubscribeToken(secret, userID, list string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(userID + ":" + list))
+	return payload + "." + sign(secret, payload)
+}
+
+// ParseUnsubscribeToken verifies a token from UnsubscribeToken and returns
+// the user and list it names
+func ParseUnsubscribeToken(secret, token string) (userID, list string, ok bool) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(secret, payload))) {
+		return "", "", false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", false
+	}
+	userID, list, found = strings.Cut(string(decoded), ":")
+	if !found || (list != ListMentions && list != ListDigest) {
+		return "", "", false
+	}
+	return userID, list, true
+}
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte("unsubscribe:"+secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,100 @@
+// Package metrics exposes Prometheus metrics for the server. Collectors are
+// package level so any layer can record without threading a registry through.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "turnate"
+
+// Registry holds every turnate collector plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequestDuration is labelled by route template, such as /api/v1/channels/:id,
+	// so that IDs in paths do not create a series per resource
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// RateLimitRejections counts requests refused by each rate limiter
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by a rate limiter.",
+	}, []string{"limiter"})
+
+	// Logins counts login attempts by result, success or failure
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	// MessagesCreated counts user messages by kind, message or reply
+	MessagesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_created_total",
+		Help:      "Messages posted by users.",
+	}, []string{"kind"})
+
+	// DBQueryDuration is labelled by GORM operation: create, query, update,
+	// delete, row or raw
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database statement latency by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation"})
+)
+
+// Rate limiter labels
+const (
+	LimiterGlobal = "global"
+	LimiterAuth   = "auth"
+	LimiterAPI    = "api"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		RateLimitRejections,
+		Logins,
+		MessagesCreated,
+		DBQueryDuration,
+	)
+}
+
+// Middleware records the latency of every request. Requests that match no
+// route are grouped under "unmatched".
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
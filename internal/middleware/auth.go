@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"net/http"
 	"strings"
 	"time"
@@ -9,8 +12,19 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	
 	"turnate/internal/config"
-	"turnate/internal/database"
 	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+const (
+	// SessionCookieName holds the JWT for cookie-authenticated browser sessions
+	SessionCookieName = "turnate_session"
+	// CSRFCookieName holds the double-submit CSRF token readable by the web client
+	CSRFCookieName = "turnate_csrf"
+	// CSRFHeaderName must echo the CSRF cookie on state-changing cookie requests
+	CSRFHeaderName = "X-CSRF-Token"
+
+	tokenTTL = 24 * time.Hour
 )
 
 type Claims struct {
@@ -21,13 +35,15 @@ type Claims struct {
 }
 
 func GenerateJWT(user *models.User, config *config.Config) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(tokenTTL)
 	
 	claims := &Claims{
 		UserID:   user.ID.String(),
 		Username: user.Username,
 		Role:     string(user.Role),
 		RegisteredClaims: jwt.RegisteredClaims{
+			// The token ID identifies the login session
+			ID:        models.NewUUIDv7().String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "turnate",
@@ -38,23 +54,46 @@ func GenerateJWT(user *models.User, config *config.Config) (string, error) {
 	return token.SignedString([]byte(config.JWTSecret))
 }
 
-func AuthMiddleware(config *config.Config) gin.HandlerFunc {
+// SetSessionCookies issues an HttpOnly session cookie carrying the JWT together
+// with a fresh CSRF cookie, and returns the CSRF token for the client to echo.
+func SetSessionCookies(c *gin.Context, token string, config *config.Config) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	maxAge := int(tokenTTL / time.Second)
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookieName, token, maxAge, "/", "", config.CookieSecure, true)
+	c.SetCookie(CSRFCookieName, csrfToken, maxAge, "/", "", config.CookieSecure, false)
+
+	return csrfToken, nil
+}
+
+// ClearSessionCookies expires the session and CSRF cookies
+func ClearSessionCookies(c *gin.Context, config *config.Config) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookieName, "", -1, "/", "", config.CookieSecure, true)
+	c.SetCookie(CSRFCookieName, "", -1, "/", "", config.CookieSecure, false)
+}
+
+// AuthMiddleware accepts either a bearer token or a session cookie. Cookie
+// authenticated requests that change state must pass double-submit CSRF checks.
+func AuthMiddleware(config *config.Config, users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+		tokenString, fromCookie, ok := extractToken(c)
+		if !ok {
 			return
 		}
 
-		bearerToken := strings.Split(authHeader, " ")
-		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		if fromCookie && !isSafeMethod(c.Request.Method) && !validCSRFToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing CSRF token"})
 			c.Abort()
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(bearerToken[1], &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 			return []byte(config.JWTSecret), nil
 		})
 
@@ -66,8 +105,15 @@ func AuthMiddleware(config *config.Config) gin.HandlerFunc {
 
 		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
 			// Verify user still exists and is active
-			var user models.User
-			if err := database.GetDB().Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+			userID, err := models.ParseUUIDv7(claims.UserID)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				c.Abort()
+				return
+			}
+
+			user, err := users.GetByID(c.Request.Context(), userID)
+			if err != nil || !user.IsActive {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or inactive"})
 				c.Abort()
 				return
@@ -76,12 +122,13 @@ func AuthMiddleware(config *config.Config) gin.HandlerFunc {
 			// Update last seen
 			now := time.Now()
 			user.LastSeenAt = &now
-			database.GetDB().Save(&user)
+			users.TouchLastSeen(c.Request.Context(), user.ID, now)
 
 			c.Set("user_id", claims.UserID)
 			c.Set("username", claims.Username)
 			c.Set("role", claims.Role)
-			c.Set("user", &user)
+			c.Set("session_id", claims.ID)
+			c.Set("user", user)
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
@@ -91,6 +138,59 @@ func AuthMiddleware(config *config.Config) gin.HandlerFunc {
 	}
 }
 
+// CSRFMiddleware applies the double-submit check to routes that act on the
+// session cookie outside AuthMiddleware. Logout uses it, since it must also
+// clear cookies whose session has already expired.
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && !isSafeMethod(c.Request.Method) {
+			if cookie, err := c.Cookie(SessionCookieName); err == nil && cookie != "" && !validCSRFToken(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing CSRF token"})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// extractToken reads the JWT from the Authorization header, falling back to the
+// session cookie. It aborts the request and reports false when neither is usable.
+func extractToken(c *gin.Context) (string, bool, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		if cookie, err := c.Cookie(SessionCookieName); err == nil && cookie != "" {
+			return cookie, true, true
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		c.Abort()
+		return "", false, false
+	}
+
+	bearerToken := strings.Split(authHeader, " ")
+	if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		c.Abort()
+		return "", false, false
+	}
+
+	return bearerToken[1], false, true
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// validCSRFToken compares the CSRF header against the CSRF cookie
+func validCSRFToken(c *gin.Context) bool {
+	cookie, err := c.Cookie(CSRFCookieName)
+	header := c.GetHeader(CSRFHeaderName)
+	if err != nil || cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"turnate/internal/config"
+)
+
+// MetricsAccessMiddleware guards the metrics endpoint with the configured
+// basic auth credentials and IP allowlist. With neither configured it lets
+// every request through.
+func MetricsAccessMiddleware(cfg config.MetricsConfig) gin.HandlerFunc {
+	var networks []*net.IPNet
+	for _, allowed := range cfg.AllowedIPs {
+		if !strings.Contains(allowed, "/") {
+			if ip := net.ParseIP(allowed); ip.To4() != nil {
+				allowed += "/32"
+			} else {
+				allowed += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	return func(c *gin.Context) {
+		if len(networks) > 0 && !ipAllowed(net.ParseIP(c.ClientIP()), networks) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+
+		if cfg.Username != "" {
+			username, password, ok := c.Request.BasicAuth()
+			if !ok ||
+				subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password)) != 1 {
+				c.Header("WWW-Authenticate", `Basic realm="metrics"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func ipAllowed(ip net.IP, networks []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
+
+	"turnate/internal/config"
+	"turnate/internal/metrics"
 )
 
 type IPRateLimiter struct {
@@ -68,20 +71,21 @@ func (i *IPRateLimiter) cleanupLimiters() {
 	}
 }
 
-var (
-	// Global rate limiters
-	globalLimiter = NewIPRateLimiter(rate.Every(time.Second/10), 20)  // 10 requests per second, burst of 20
-	authLimiter   = NewIPRateLimiter(rate.Every(time.Minute/5), 5)    // 5 login attempts per minute
-	apiLimiter    = NewIPRateLimiter(rate.Every(time.Second/5), 10)   // 5 API calls per second, burst of 10
-)
+// NewIPRateLimiterFromConfig builds a per-IP limiter from a configured rate limit
+func NewIPRateLimiterFromConfig(limit config.RateLimit) *IPRateLimiter {
+	return NewIPRateLimiter(rate.Every(limit.Per.Std()/time.Duration(limit.Requests)), limit.Burst)
+}
 
 // RateLimitMiddleware provides general rate limiting
-func RateLimitMiddleware() gin.HandlerFunc {
+func RateLimitMiddleware(limit config.RateLimit) gin.HandlerFunc {
+	globalLimiter := NewIPRateLimiterFromConfig(limit)
+
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 		limiter := globalLimiter.GetLimiter(ip)
 
 		if !limiter.Allow() {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimiterGlobal).Inc()
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":   "Rate limit exceeded",
 				"message": "Too many requests. Please slow down.",
@@ -95,12 +99,15 @@ func RateLimitMiddleware() gin.HandlerFunc {
 }
 
 // AuthRateLimitMiddleware provides strict rate limiting for auth endpoints
-func AuthRateLimitMiddleware() gin.HandlerFunc {
+func AuthRateLimitMiddleware(limit config.RateLimit) gin.HandlerFunc {
+	authLimiter := NewIPRateLimiterFromConfig(limit)
+
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 		limiter := authLimiter.GetLimiter(ip)
 
 		if !limiter.Allow() {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimiterAuth).Inc()
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":   "Authentication rate limit exceeded",
 				"message": "Too many authentication attempts. Please wait before trying again.",
@@ -114,12 +121,15 @@ func AuthRateLimitMiddleware() gin.HandlerFunc {
 }
 
 // APIRateLimitMiddleware provides rate limiting for API endpoints
-func APIRateLimitMiddleware() gin.HandlerFunc {
+func APIRateLimitMiddleware(limit config.RateLimit) gin.HandlerFunc {
+	apiLimiter := NewIPRateLimiterFromConfig(limit)
+
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 		limiter := apiLimiter.GetLimiter(ip)
 
 		if !limiter.Allow() {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimiterAPI).Inc()
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":   "API rate limit exceeded",
 				"message": "Too many API requests. Please slow down.",
@@ -7,9 +7,11 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// TimeoutMiddleware adds request timeout handling
-func TimeoutMiddleware(duration time.Duration) gin.HandlerFunc {
-	return timeout.New(
+// TimeoutMiddleware adds request timeout handling. The timeout buffers the
+// whole response, so routes that stream files are listed in exempt, by their
+// route path, and run without it.
+func TimeoutMiddleware(duration time.Duration, exempt ...string) gin.HandlerFunc {
+	limited := timeout.New(
 		timeout.WithTimeout(duration),
 		timeout.WithResponse(func(c *gin.Context) {
 			c.JSON(408, gin.H{
@@ -18,4 +20,16 @@ func TimeoutMiddleware(duration time.Duration) gin.HandlerFunc {
 			})
 		}),
 	)
-}
\ No newline at end of file
+
+	skip := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+		limited(c)
+	}
+}
@@ -1,35 +1,66 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// maxInputLength bounds any single query, form or path value
+	maxInputLength = 2048
 )
 
 var (
-	// Security patterns for input validation
-	sqlInjectionPattern     = regexp.MustCompile(`(?i)(union|select|insert|update|delete|drop|create|alter|exec|script|javascript|onload|onerror|eval|alert|confirm|prompt)`)
-	xssPattern             = regexp.MustCompile(`(?i)(<script|javascript:|onload=|onerror=|onclick=|onmouseover=|<iframe|<object|<embed|<link)`)
-	commandInjectionPattern = regexp.MustCompile(`(;\s*rm\s+|;\s*cat\s+|;\s*ls\s+|;\s*wget\s+|;\s*curl\s+|&&|&|\|\||;)`)
-	pathTraversalPattern   = regexp.MustCompile(`(\.\.\/|\.\.\\|%2e%2e%2f|%2e%2e%5c)`)
+	usernamePattern      = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	pathTraversalPattern = regexp.MustCompile(`(?i)(\.\./|\.\.\\|%2e%2e%2f|%2e%2e%5c)`)
 )
 
-// InputValidationMiddleware validates and sanitizes input data
+// FieldError describes a single invalid field in a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		// Report fields by the name clients send rather than the Go field name
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "uri", "form"} {
+				name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+				if name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+
+		v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+			return usernamePattern.MatchString(fl.Field().String())
+		})
+	}
+}
+
+// InputValidationMiddleware rejects query, form and path values that are unsafe
+// to handle regardless of endpoint. Endpoint-specific rules live in the typed
+// request schemas bound by each handler.
 func InputValidationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check query parameters
+		var fields []FieldError
+
 		for key, values := range c.Request.URL.Query() {
 			for _, value := range values {
-				if !isValidInput(value) {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error":   "Invalid input detected",
-						"message": "Request contains potentially malicious content",
-						"field":   key,
-					})
-					c.Abort()
-					return
+				if msg := checkInput(value); msg != "" {
+					fields = append(fields, FieldError{Field: key, Message: msg})
 				}
 			}
 		}
@@ -39,37 +70,110 @@ func InputValidationMiddleware() gin.HandlerFunc {
 			if err := c.Request.ParseForm(); err == nil {
 				for key, values := range c.Request.PostForm {
 					for _, value := range values {
-						if !isValidInput(value) {
-							c.JSON(http.StatusBadRequest, gin.H{
-								"error":   "Invalid input detected",
-								"message": "Request contains potentially malicious content",
-								"field":   key,
-							})
-							c.Abort()
-							return
+						if msg := checkInput(value); msg != "" {
+							fields = append(fields, FieldError{Field: key, Message: msg})
 						}
 					}
 				}
 			}
 		}
 
-		// Check path parameters
+		// Path parameters must never be able to escape the resource they address
 		for _, param := range c.Params {
-			if !isValidInput(param.Value) {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error":   "Invalid path parameter",
-					"message": "Path contains potentially malicious content",
-					"field":   param.Key,
-				})
-				c.Abort()
-				return
+			if msg := checkInput(param.Value); msg != "" {
+				fields = append(fields, FieldError{Field: param.Key, Message: msg})
+			} else if pathTraversalPattern.MatchString(param.Value) {
+				fields = append(fields, FieldError{Field: param.Key, Message: "must not contain path traversal sequences"})
 			}
 		}
 
+		if len(fields) > 0 {
+			AbortWithValidationErrors(c, fields)
+			return
+		}
+
 		c.Next()
 	}
 }
 
+// AbortWithValidationErrors responds with a structured field-level error
+func AbortWithValidationErrors(c *gin.Context, fields []FieldError) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid request data",
+		"message": "One or more fields are invalid",
+		"fields":  fields,
+	})
+}
+
+// FieldErrors converts a binding error into field-level errors
+func FieldErrors(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{Field: fe.Field(), Message: fieldErrorMessage(fe)})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}
+	}
+
+	return []FieldError{{Field: "body", Message: "must be a valid JSON object"}}
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "email":
+		return "must be a valid email address"
+	case "uuid":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "username":
+		return "must contain only letters, numbers, and underscores"
+	case "excluded_with":
+		return "cannot be combined with " + strings.ToLower(strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return "is invalid"
+	}
+}
+
+// checkInput returns a reason the value is unsafe, or an empty string
+func checkInput(input string) string {
+	if len(input) > maxInputLength {
+		return fmt.Sprintf("must be at most %d bytes", maxInputLength)
+	}
+
+	if !utf8.ValidString(input) {
+		return "must be valid UTF-8"
+	}
+
+	for _, r := range input {
+		if r < 32 && r != '\t' && r != '\n' && r != '\r' {
+			return "must not contain control characters"
+		}
+	}
+
+	return ""
+}
+
 // ContentSecurityMiddleware adds content security headers
 func ContentSecurityMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -95,33 +199,6 @@ func ContentSecurityMiddleware() gin.HandlerFunc {
 	}
 }
 
-// isValidInput checks if input contains potentially malicious patterns
-func isValidInput(input string) bool {
-	input = strings.ToLower(input)
-	
-	// Check for SQL injection patterns
-	if sqlInjectionPattern.MatchString(input) {
-		return false
-	}
-	
-	// Check for XSS patterns
-	if xssPattern.MatchString(input) {
-		return false
-	}
-	
-	// Check for command injection patterns
-	if commandInjectionPattern.MatchString(input) {
-		return false
-	}
-	
-	// Check for path traversal patterns
-	if pathTraversalPattern.MatchString(input) {
-		return false
-	}
-	
-	return true
-}
-
 // SanitizeString removes potentially harmful characters from strings
 func SanitizeString(input string) string {
 	// Remove null bytes
@@ -138,11 +215,20 @@ func SanitizeString(input string) string {
 	return strings.TrimSpace(result.String())
 }
 
-// ValidateContentType ensures the request has the correct content type for JSON APIs
-func ValidateContentType() gin.HandlerFunc {
+// ValidateContentType ensures the request has the correct content type for
+// JSON APIs. The formRoutes, by route path, also accept URL-encoded forms.
+func ValidateContentType(formRoutes ...string) gin.HandlerFunc {
+	forms := make(map[string]bool, len(formRoutes))
+	for _, route := range formRoutes {
+		forms[route] = true
+	}
 	return func(c *gin.Context) {
 		if c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH" {
 			contentType := c.GetHeader("Content-Type")
+			if forms[c.FullPath()] && strings.Contains(contentType, "application/x-www-form-urlencoded") {
+				c.Next()
+				return
+			}
 			if !strings.Contains(contentType, "application/json") && !strings.Contains(contentType, "multipart/form-data") {
 				c.JSON(http.StatusUnsupportedMediaType, gin.H{
 					"error":   "Unsupported content type",
@@ -154,4 +240,20 @@ func ValidateContentType() gin.HandlerFunc {
 		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+// BodyLimitMiddleware caps request bodies, including uploads, at maxBytes
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Request body too large",
+				"message": fmt.Sprintf("Request bodies are limited to %d bytes", maxBytes),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
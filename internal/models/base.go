@@ -45,6 +45,31 @@ func NewUUIDv7() UUIDv7 {
 	return UUIDv7(uuid.Must(uuid.NewV7()))
 }
 
+// NewUUIDv7At returns an ID that sorts as if it had been created at t, for
+// records imported with their original timestamps
+func NewUUIDv7At(t time.Time) UUIDv7 {
+	id := uuid.Must(uuid.NewV7())
+	ms := uint64(t.UnixMilli())
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	return UUIDv7(id)
+}
+
+// ParseUUIDv7 parses the canonical string form of an ID
+func ParseUUIDv7(s string) (UUIDv7, error) {
+	parsed, err := uuid.Parse(s)
+	if err != nil {
+		return UUIDv7(uuid.Nil), err
+	}
+	return UUIDv7(parsed), nil
+}
+
+// IsZero reports whether the ID is unset
+func (u UUIDv7) IsZero() bool {
+	return u == UUIDv7(uuid.Nil)
+}
+
 type BaseModel struct {
 	ID        UUIDv7         `json:"id" gorm:"type:text;primaryKey;default:(uuid())"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -14,6 +14,11 @@ type Channel struct {
 	Type        ChannelType `json:"type" gorm:"default:'public'"`
 	CreatedBy   UUIDv7      `json:"created_by" gorm:"type:text;not null"`
 	
+	// Retention: RetentionDays overrides the workspace default, with 0 keeping
+	// messages forever; LegalHold keeps every message regardless
+	RetentionDays *int `json:"retention_days,omitempty"`
+	LegalHold     bool `json:"legal_hold" gorm:"not null;default:false"`
+	
 	// Relationships
 	Creator     User            `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
 	Members     []ChannelMember `json:"members,omitempty" gorm:"foreignKey:ChannelID"`
@@ -33,4 +38,21 @@ type ChannelMember struct {
 // Ensure unique channel membership
 func (ChannelMember) TableName() string {
 	return "channel_members"
-}
\ No newline at end of file
+}
+
+type BookmarkKind string
+
+const (
+	BookmarkKindLink BookmarkKind = "link"
+	BookmarkKindFile BookmarkKind = "file"
+)
+
+// ChannelBookmark is a titled link or file shown in the channel header
+type ChannelBookmark struct {
+	BaseModel
+	ChannelID UUIDv7       `json:"channel_id" gorm:"type:text;not null;index"`
+	Title     string       `json:"title" gorm:"not null;size:100"`
+	URL       string       `json:"url" gorm:"not null;size:2048"`
+	Kind      BookmarkKind `json:"kind" gorm:"not null;default:'link'"`
+	CreatedBy UUIDv7       `json:"created_by" gorm:"type:text;not null"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type ErasureStatus string
+
+const (
+	// ErasureStatusPending requests wait for an admin
+	ErasureStatusPending ErasureStatus = "pending"
+	// ErasureStatusApproved requests are the erasure job's queue
+	ErasureStatusApproved  ErasureStatus = "approved"
+	ErasureStatusRejected  ErasureStatus = "rejected"
+	ErasureStatusCancelled ErasureStatus = "cancelled"
+	ErasureStatusCompleted ErasureStatus = "completed"
+)
+
+// ErasureRequest is a user's request to have their account erased. A user
+// has at most one open (pending or approved) request; requests are kept after
+// the account is erased as a record of the erasure.
+type ErasureRequest struct {
+	BaseModel
+	UserID UUIDv7        `json:"user_id" gorm:"type:text;not null;index"`
+	Status ErasureStatus `json:"status" gorm:"not null;size:20;default:'pending'"`
+	Reason string        `json:"reason" gorm:"size:500"`
+
+	ReviewedBy  *UUIDv7    `json:"reviewed_by,omitempty" gorm:"type:text"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote  string     `json:"review_note,omitempty" gorm:"size:500"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
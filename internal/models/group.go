@@ -0,0 +1,31 @@
+package models
+
+// UserGroup is a named team that can be mentioned by its handle, like a
+// username, to notify every member at once
+type UserGroup struct {
+	BaseModel
+	Handle      string `json:"handle" gorm:"not null;size:50"`
+	Name        string `json:"name" gorm:"not null;size:100"`
+	Description string `json:"description" gorm:"size:500"`
+	CreatedBy   UUIDv7 `json:"created_by" gorm:"type:text;not null"`
+}
+
+// UserGroupMember is a user's membership of a group. Owners may manage the
+// group's members and settings alongside admins.
+type UserGroupMember struct {
+	BaseModel
+	GroupID UUIDv7 `json:"group_id" gorm:"type:text;not null;index"`
+	UserID  UUIDv7 `json:"user_id" gorm:"type:text;not null;index"`
+	Owner   bool   `json:"owner" gorm:"not null;default:false"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// UserGroupChannel is a default channel of a group, which its members join
+// automatically
+type UserGroupChannel struct {
+	BaseModel
+	GroupID   UUIDv7 `json:"group_id" gorm:"type:text;not null"`
+	ChannelID UUIDv7 `json:"channel_id" gorm:"type:text;not null"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// ImportMapping links a record imported from another chat system to the
+// record it became, so that running the import again leaves it alone
+type ImportMapping struct {
+	BaseModel
+	// Source is the system imported from, such as "slack"
+	Source string `json:"source" gorm:"not null;size:20"`
+	// Kind is the type of record: user, channel or message
+	Kind       string `json:"kind" gorm:"not null;size:20"`
+	ExternalID string `json:"external_id" gorm:"not null;size:255"`
+	TargetID   UUIDv7 `json:"target_id" gorm:"type:text;not null"`
+}
+
+// ImportCheckpoint records how far an unfinished line-by-line import got, so
+// that importing the same file again resumes after the last batch written.
+// It is removed when the import finishes.
+type ImportCheckpoint struct {
+	BaseModel
+	Source string `json:"source" gorm:"not null;size:20"`
+	// Digest is the SHA-256 of the imported file
+	Digest string `json:"digest" gorm:"not null;size:64"`
+	// Line is the last line whose records are written
+	Line int `json:"line" gorm:"not null"`
+	// Report is the import's report so far, as JSON
+	Report string `json:"report" gorm:"type:text"`
+}
@@ -1,28 +1,56 @@
 package models
 
+import "time"
+
+type MessageType string
+
+const (
+	MessageTypeUser MessageType = "user"
+	// MessageTypeSystem messages announce channel events such as pin changes
+	MessageTypeSystem MessageType = "system"
+)
+
 type Message struct {
 	BaseModel
-	Content   string  `json:"content" gorm:"not null;type:text"`
-	UserID    UUIDv7  `json:"user_id" gorm:"type:text;not null"`
-	ChannelID UUIDv7  `json:"channel_id" gorm:"type:text;not null"`
-	ThreadID  *UUIDv7 `json:"thread_id,omitempty" gorm:"type:text;index"`
-	
+	Content   string      `json:"content" gorm:"not null;type:text"`
+	UserID    UUIDv7      `json:"user_id" gorm:"type:text;not null"`
+	ChannelID UUIDv7      `json:"channel_id" gorm:"type:text;not null"`
+	ThreadID  *UUIDv7     `json:"thread_id,omitempty" gorm:"type:text;index"`
+	Type      MessageType `json:"type" gorm:"not null;default:'user'"`
+
+	// AlsoSentToChannel shows a thread reply in the channel timeline as well
+	AlsoSentToChannel bool `json:"also_sent_to_channel" gorm:"not null;default:false"`
+
+	// Pin state
+	PinnedAt *time.Time `json:"pinned_at,omitempty"`
+	PinnedBy *UUIDv7    `json:"pinned_by,omitempty" gorm:"type:text"`
+
+	// Thread statistics, denormalized onto the thread root when a reply is written
+	ReplyCount  int        `json:"reply_count" gorm:"not null;default:0"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+
 	// Relationships
-	User     User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Channel  Channel   `json:"channel,omitempty" gorm:"foreignKey:ChannelID"`
-	Thread   *Message  `json:"thread,omitempty" gorm:"foreignKey:ThreadID"`
-	Replies  []Message `json:"replies,omitempty" gorm:"foreignKey:ThreadID"`
+	User    User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Channel Channel   `json:"channel,omitempty" gorm:"foreignKey:ChannelID"`
+	Thread  *Message  `json:"thread,omitempty" gorm:"foreignKey:ThreadID"`
+	Replies []Message `json:"replies,omitempty" gorm:"foreignKey:ThreadID"`
 }
 
 type MessageResponse struct {
-	ID        string `json:"id"`
-	Content   string `json:"content"`
-	UserID    string `json:"user_id"`
-	Username  string `json:"username"`
-	DisplayName string `json:"display_name"`
-	ChannelID string `json:"channel_id"`
-	ThreadID  *string `json:"thread_id,omitempty"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
-	ReplyCount int   `json:"reply_count,omitempty"`
-}
\ No newline at end of file
+	ID          string  `json:"id"`
+	Content     string  `json:"content"`
+	UserID      string  `json:"user_id"`
+	Username    string  `json:"username"`
+	DisplayName string  `json:"display_name"`
+	ChannelID   string  `json:"channel_id"`
+	ThreadID    *string `json:"thread_id,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	ReplyCount  int     `json:"reply_count,omitempty"`
+	LastReplyAt *string `json:"last_reply_at,omitempty"`
+	Type        string  `json:"type"`
+	PinnedAt    *string `json:"pinned_at,omitempty"`
+	PinnedBy    *string `json:"pinned_by,omitempty"`
+
+	AlsoSentToChannel bool `json:"also_sent_to_channel,omitempty"`
+}
@@ -4,13 +4,34 @@ import (
 	"gorm.io/gorm"
 )
 
-func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+// All returns every model stored in the database, in migration order
+func All() []interface{} {
+	return []interface{}{
 		&User{},
 		&Channel{},
 		&ChannelMember{},
 		&Message{},
-	)
+		&ChannelBookmark{},
+		&SavedItem{},
+		&Reminder{},
+		&Notification{},
+		&ScheduledMessage{},
+		&ThreadFollow{},
+		&ChannelNotificationPreference{},
+		&NotificationSettings{},
+		&PushSubscription{},
+		&PushServerKey{},
+		&ImportMapping{},
+		&ImportCheckpoint{},
+		&ErasureRequest{},
+		&UserGroup{},
+		&UserGroupMember{},
+		&UserGroupChannel{},
+	}
+}
+
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(All()...)
 }
 
 func CreateIndexes(db *gorm.DB) error {
@@ -24,9 +45,94 @@ func CreateIndexes(db *gorm.DB) error {
 		return err
 	}
 	
+	// Cursor pagination walks the channel timeline by time-ordered ID. The
+	// timeline holds top-level messages and replies also sent to the channel.
+	if err := db.Exec("DROP INDEX IF EXISTS idx_messages_channel_top_level").Error; err != nil {
+		return err
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_channel_timeline ON messages (channel_id, id) WHERE deleted_at IS NULL AND (thread_id IS NULL OR also_sent_to_channel)").Error; err != nil {
+		return err
+	}
+	
 	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_thread_created ON messages (thread_id, created_at) WHERE deleted_at IS NULL AND thread_id IS NOT NULL").Error; err != nil {
 		return err
 	}
 	
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_channel_pinned ON messages (channel_id, pinned_at) WHERE deleted_at IS NULL AND pinned_at IS NOT NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_items_unique ON saved_items (user_id, message_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	// The reminder scheduler polls for due, undelivered reminders
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_reminders_due ON reminders (remind_at) WHERE deleted_at IS NULL AND delivered_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	// The message scheduler polls for due, pending scheduled messages
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages (send_at) WHERE deleted_at IS NULL AND status = 'pending'").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_thread_follows_unique ON thread_follows (user_id, thread_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	// The email job polls for unread notifications it has not handled yet
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_notifications_email_due ON notifications (created_at) WHERE deleted_at IS NULL AND emailed_at IS NULL AND read_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	// The push job polls for recent notifications it has not handled yet
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_notifications_push_due ON notifications (created_at) WHERE deleted_at IS NULL AND pushed_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_push_subscriptions_endpoint ON push_subscriptions (endpoint) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_channel_notification_preferences_unique ON channel_notification_preferences (channel_id, user_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	// The retention purger looks for old thread roots, deleted ones included
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_retention ON messages (channel_id, created_at) WHERE thread_id IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_import_mappings_unique ON import_mappings (source, kind, external_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_import_checkpoints_unique ON import_checkpoints (source, digest) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	// A user has at most one open erasure request
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_erasure_requests_open ON erasure_requests (user_id) WHERE deleted_at IS NULL AND status IN ('pending', 'approved')").Error; err != nil {
+		return err
+	}
+	
+	// Group handles share the mention namespace with usernames, which are
+	// compared case-insensitively, so handles are stored lowercase
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_groups_handle ON user_groups (handle) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_group_members_unique ON user_group_members (group_id, user_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_group_channels_unique ON user_group_channels (group_id, channel_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+	
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+type NotificationKind string
+
+const (
+	NotificationKindReminder         NotificationKind = "reminder"
+	NotificationKindScheduledMessage NotificationKind = "scheduled_message"
+	NotificationKindMention          NotificationKind = "mention"
+	NotificationKindKeyword          NotificationKind = "keyword"
+	NotificationKindThreadReply      NotificationKind = "thread_reply"
+	NotificationKindMessage          NotificationKind = "message"
+)
+
+// Notification is an entry in a user's notification inbox
+type Notification struct {
+	BaseModel
+	UserID    UUIDv7           `json:"user_id" gorm:"type:text;not null"`
+	Kind      NotificationKind `json:"kind" gorm:"not null;size:50"`
+	Title     string           `json:"title" gorm:"not null;size:200"`
+	Body      string           `json:"body" gorm:"type:text"`
+	ChannelID *UUIDv7          `json:"channel_id,omitempty" gorm:"type:text"`
+	MessageID *UUIDv7          `json:"message_id,omitempty" gorm:"type:text"`
+	ReadAt    *time.Time       `json:"read_at,omitempty"`
+	// Quiet notifications arrived during Do Not Disturb. They are listed in
+	// the inbox but not pushed to the user.
+	Quiet bool `json:"quiet" gorm:"not null;default:false"`
+	// EmailedAt is when the notification was handled by the email job, whether
+	// or not an email went out
+	EmailedAt *time.Time `json:"-"`
+	// PushedAt is when the notification was handled by the push job
+	PushedAt *time.Time `json:"-"`
+}
+
+// NotificationLevel is how much of a channel's activity notifies a member
+type NotificationLevel string
+
+const (
+	// NotificationLevelAll notifies about every message
+	NotificationLevelAll NotificationLevel = "all"
+	// NotificationLevelMentions notifies about mentions, keywords and followed threads
+	NotificationLevelMentions NotificationLevel = "mentions"
+	// NotificationLevelNone never notifies
+	NotificationLevelNone NotificationLevel = "none"
+	// NotificationLevelMuted never notifies, hides the channel from recent
+	// activity and counts no unread replies in its followed threads
+	NotificationLevelMuted NotificationLevel = "muted"
+)
+
+// DefaultNotificationLevel applies to channels without a preference
+const DefaultNotificationLevel = NotificationLevelMentions
+
+// ChannelNotificationPreference is a member's notification level for one channel
+type ChannelNotificationPreference struct {
+	BaseModel
+	UserID    UUIDv7            `json:"user_id" gorm:"type:text;not null"`
+	ChannelID UUIDv7            `json:"channel_id" gorm:"type:text;not null"`
+	Level     NotificationLevel `json:"level" gorm:"not null;size:20"`
+}
+
+// NotificationSettings are a user's workspace-wide notification settings.
+// Do Not Disturb runs daily from DNDStart to DNDEnd ("15:04", in Timezone,
+// possibly wrapping past midnight) and additionally until SnoozeUntil.
+// Mention emails are on unless disabled; the daily digest is opt-in.
+type NotificationSettings struct {
+	BaseModel
+	UserID      UUIDv7     `json:"user_id" gorm:"type:text;not null;uniqueIndex"`
+	Keywords    []string   `json:"keywords" gorm:"serializer:json"`
+	Timezone    string     `json:"timezone" gorm:"not null;size:64;default:'UTC'"`
+	DNDEnabled  bool       `json:"dnd_enabled" gorm:"not null;default:false"`
+	DNDStart    string     `json:"dnd_start" gorm:"size:5"`
+	DNDEnd      string     `json:"dnd_end" gorm:"size:5"`
+	SnoozeUntil *time.Time `json:"snooze_until,omitempty"`
+
+	MentionEmailsDisabled bool       `json:"mention_emails_disabled" gorm:"not null;default:false"`
+	DigestEnabled         bool       `json:"digest_enabled" gorm:"not null;default:false"`
+	DigestSentAt          *time.Time `json:"digest_sent_at,omitempty"`
+}
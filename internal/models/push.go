@@ -0,0 +1,22 @@
+package models
+
+// PushSubscription is a browser registered for Web Push by one login session
+type PushSubscription struct {
+	BaseModel
+	UserID UUIDv7 `json:"user_id" gorm:"type:text;not null;index"`
+	// SessionID identifies the login that registered the browser; a session
+	// has at most one subscription
+	SessionID string `json:"-" gorm:"size:64"`
+	Endpoint  string `json:"endpoint" gorm:"not null;size:2048"`
+	P256dh    string `json:"-" gorm:"not null;size:128"`
+	Auth      string `json:"-" gorm:"not null;size:64"`
+	UserAgent string `json:"user_agent" gorm:"size:255"`
+}
+
+// PushServerKey is the server's VAPID key pair, generated on first start
+// unless one is configured
+type PushServerKey struct {
+	BaseModel
+	PublicKey  string `gorm:"not null;size:128"`
+	PrivateKey string `gorm:"not null;size:64"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// SavedItem is a message a user bookmarked for later
+type SavedItem struct {
+	BaseModel
+	UserID    UUIDv7 `json:"user_id" gorm:"type:text;not null"`
+	MessageID UUIDv7 `json:"message_id" gorm:"type:text;not null"`
+
+	// Relationships
+	Message Message `json:"message,omitempty" gorm:"foreignKey:MessageID"`
+}
+
+// Reminder is a personal reminder about a message or free text. Pending
+// reminders are the scheduler's queue, so they survive restarts.
+type Reminder struct {
+	BaseModel
+	UserID      UUIDv7     `json:"user_id" gorm:"type:text;not null;index"`
+	MessageID   *UUIDv7    `json:"message_id,omitempty" gorm:"type:text"`
+	Text        string     `json:"text" gorm:"size:500"`
+	RemindAt    time.Time  `json:"remind_at" gorm:"not null"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+
+	// Relationships
+	Message *Message `json:"message,omitempty" gorm:"foreignKey:MessageID"`
+}
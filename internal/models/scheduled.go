@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledMessagePending ScheduledMessageStatus = "pending"
+	ScheduledMessageSending ScheduledMessageStatus = "sending"
+	ScheduledMessageSent    ScheduledMessageStatus = "sent"
+	ScheduledMessageFailed  ScheduledMessageStatus = "failed"
+)
+
+// ScheduledMessage is a message to be posted at SendAt on behalf of its author.
+// Pending rows are the scheduler's queue, so they survive restarts.
+type ScheduledMessage struct {
+	BaseModel
+	UserID            UUIDv7                 `json:"user_id" gorm:"type:text;not null;index"`
+	ChannelID         UUIDv7                 `json:"channel_id" gorm:"type:text;not null"`
+	ThreadID          *UUIDv7                `json:"thread_id,omitempty" gorm:"type:text"`
+	AlsoSendToChannel bool                   `json:"also_send_to_channel" gorm:"not null;default:false"`
+	Content           string                 `json:"content" gorm:"type:text;not null"`
+	SendAt            time.Time              `json:"send_at" gorm:"not null"`
+	Status            ScheduledMessageStatus `json:"status" gorm:"not null;size:20;default:'pending'"`
+	MessageID         *UUIDv7                `json:"message_id,omitempty" gorm:"type:text"`
+	FailureReason     string                 `json:"failure_reason,omitempty" gorm:"size:200"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ThreadFollow records that a user follows a thread and how far they have read
+// it. Participants follow automatically; an unfollow is kept with Following
+// false so that replying again does not re-follow.
+type ThreadFollow struct {
+	BaseModel
+	ThreadID   UUIDv7     `json:"thread_id" gorm:"type:text;not null"`
+	UserID     UUIDv7     `json:"user_id" gorm:"type:text;not null"`
+	Following  bool       `json:"following" gorm:"not null"`
+	LastReadAt *time.Time `json:"last_read_at,omitempty"`
+
+	// Thread is loaded by the store rather than as an association, since
+	// Message has a ThreadID of its own
+	Thread Message `json:"thread,omitempty" gorm:"-"`
+}
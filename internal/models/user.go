@@ -6,6 +6,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// BcryptCost is the work factor used when hashing new passwords
+var BcryptCost = bcrypt.DefaultCost
+
 type UserRole string
 
 const (
@@ -23,13 +26,17 @@ type User struct {
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
 	LastSeenAt   *time.Time `json:"last_seen_at"`
 	
+	// LegalHold exempts the user's messages, and threads they took part in,
+	// from retention
+	LegalHold bool `json:"legal_hold" gorm:"not null;default:false"`
+	
 	// Relationships
 	Messages        []Message        `json:"messages,omitempty" gorm:"foreignKey:UserID"`
 	ChannelMembers  []ChannelMember  `json:"channel_members,omitempty" gorm:"foreignKey:UserID"`
 }
 
 func (u *User) SetPassword(password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,68 @@
+package push
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// Keys is a VAPID key pair: the uncompressed P-256 public key and the private
+// scalar, both base64url encoded without padding as browsers expect
+type Keys struct {
+	PublicKey  string
+	PrivateKey string
+}
+
+// GenerateKeys creates a new VAPID key pair
+func GenerateKeys() (Keys, error) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return Keys{}, err
+	}
+	return Keys{
+		PublicKey:  encode(private.PublicKey().Bytes()),
+		PrivateKey: encode(private.Bytes()),
+	}, nil
+}
+
+// signingKey decodes the private key and checks that it matches the public key
+func (k Keys) signingKey() (*ecdsa.PrivateKey, error) {
+	raw, err := decode(k.PrivateKey)
+	if err != nil {
+		return nil, errors.New("invalid VAPID private key")
+	}
+	private, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, errors.New("invalid VAPID private key")
+	}
+
+	public := private.PublicKey().Bytes()
+	if encode(public) != k.PublicKey {
+		return nil, errors.New("VAPID public key does not match the private key")
+	}
+
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:65]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode accepts base64url with or without padding, as browsers differ
+func decode(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
@@ -0,0 +1,232 @@
+// Package push sends Web Push messages: payloads are encrypted for the
+// subscribing browser (RFC 8291) and requests are signed with the server's
+// VAPID key (RFC 8292).
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// recordSize is the aes128gcm record size; payloads fit in one record
+	recordSize = 4096
+	// MaxPayload is the largest payload whose encrypted message, with its
+	// 86 byte header, 16 byte tag and delimiter, stays within the 4096 bytes
+	// push services accept
+	MaxPayload = 4096 - 86 - 16 - 1
+	// tokenTTL is how long a VAPID token is valid; push services allow up to a day
+	tokenTTL = 12 * time.Hour
+)
+
+// ErrGone means the push service no longer accepts messages for a
+// subscription, so it should be deleted
+var ErrGone = errors.New("push subscription is gone")
+
+// Subscription is where and how to reach one browser, as returned by
+// PushManager.subscribe
+type Subscription struct {
+	Endpoint string
+	// P256dh is the browser's public key and Auth its authentication secret, base64url encoded
+	P256dh string
+	Auth   string
+}
+
+// Client sends push messages signed with one VAPID key pair
+type Client struct {
+	keys    Keys
+	signer  *ecdsa.PrivateKey
+	subject string
+	http    *http.Client
+}
+
+// NewClient returns a client for the key pair. The subject is a mailto: or
+// https: contact for the push service operator. A nil httpClient uses a
+// default with a timeout that only connects to public addresses.
+func NewClient(keys Keys, subject string, httpClient *http.Client) (*Client, error) {
+	signer, err := keys.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second, Transport: PublicTransport()}
+	}
+	return &Client{keys: keys, signer: signer, subject: subject, http: httpClient}, nil
+}
+
+// PublicKey is the application server key browsers subscribe with
+func (c *Client) PublicKey() string {
+	return c.keys.PublicKey
+}
+
+// Send encrypts the payload for the subscription and delivers it. It returns
+// ErrGone when the push service reports the subscription expired or unknown.
+func (c *Client) Send(ctx context.Context, subscription Subscription, payload []byte, ttl time.Duration) error {
+	if len(payload) > MaxPayload {
+		return fmt.Errorf("push payload of %d bytes exceeds %d", len(payload), MaxPayload)
+	}
+
+	endpoint, err := url.Parse(subscription.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Errorf("invalid push endpoint %q", subscription.Endpoint)
+	}
+
+	body, err := Encrypt(subscription, payload)
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(tokenTTL).Unix(),
+		"sub": c.subject,
+	}).SignedString(c.signer)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+c.keys.PublicKey)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl/time.Second)))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach push service: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("push service responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Encrypt encodes the payload as a single aes128gcm record for the subscription
+func Encrypt(subscription Subscription, payload []byte) ([]byte, error) {
+	browserKeyBytes, err := decode(subscription.P256dh)
+	if err != nil {
+		return nil, errors.New("invalid subscription key")
+	}
+	browserKey, err := ecdh.P256().NewPublicKey(browserKeyBytes)
+	if err != nil {
+		return nil, errors.New("invalid subscription key")
+	}
+	authSecret, err := decode(subscription.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, errors.New("invalid subscription auth secret")
+	}
+
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(browserKey)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	serverPublic := serverKey.PublicKey().Bytes()
+	key, nonce, err := DeriveContentKeys(sharedSecret, authSecret, salt, browserKeyBytes, serverPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single, final record ends with the 0x02 delimiter
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// DeriveContentKeys derives the content encryption key and nonce from the
+// ECDH shared secret as RFC 8291 describes. Receivers use it to decrypt.
+func DeriveContentKeys(sharedSecret, authSecret, salt, browserPublic, serverPublic []byte) (key, nonce []byte, err error) {
+	keyInfo := append([]byte("WebPush: info\x00"), browserPublic...)
+	keyInfo = append(keyInfo, serverPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, authSecret, keyInfo), ikm); err != nil {
+		return nil, nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	key = make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), key); err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, err
+	}
+	return key, nonce, nil
+}
+
+// Validate checks that the subscription has an https endpoint and well-formed
+// keys. Endpoints given as a loopback, private or link-local IP are refused
+// up front; host names are checked when PublicTransport connects.
+func (s Subscription) Validate() error {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if addr, err := netip.ParseAddr(endpoint.Hostname()); err == nil && !IsPublicAddr(addr) {
+		return errors.New("endpoint must be a public address")
+	}
+	key, err := decode(s.P256dh)
+	if err != nil {
+		return errors.New("p256dh must be a base64url P-256 public key")
+	}
+	if _, err := ecdh.P256().NewPublicKey(key); err != nil {
+		return errors.New("p256dh must be a base64url P-256 public key")
+	}
+	if auth, err := decode(s.Auth); err != nil || len(auth) != 16 {
+		return errors.New("auth must be a base64url 16 byte secret")
+	}
+	return nil
+}
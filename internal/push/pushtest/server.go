@@ -0,0 +1,274 @@
+// Package pushtest provides a local stand-in for a browser push service. It
+// issues subscriptions whose keys it holds, checks VAPID signatures and
+// decrypts what it receives, for tests of code that sends Web Push.
+package pushtest
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"turnate/internal/push"
+)
+
+// Received is a push message accepted by the server, decrypted
+type Received struct {
+	Endpoint string
+	Payload  []byte
+	TTL      string
+}
+
+type browser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+	gone bool
+}
+
+// Server is a TLS push service on a local port. Its endpoints use the public
+// name example.com, which the test certificate covers, and its Client
+// connects them to the local port, so they pass Subscription.Validate.
+type Server struct {
+	server *httptest.Server
+	url    string
+
+	mu       sync.Mutex
+	browsers map[string]*browser
+	messages []Received
+	rejected []error
+}
+
+// NewServer starts a server. Close it when done.
+func NewServer() *Server {
+	s := &Server{browsers: make(map[string]*browser)}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	s.url = "https://example.com:" + s.server.URL[strings.LastIndex(s.server.URL, ":")+1:]
+	return s
+}
+
+// Client returns an HTTP client that trusts the server's certificate and
+// sends every request to it
+func (s *Server) Client() *http.Client {
+	client := s.server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	addr := s.server.Listener.Addr().String()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	}
+	client.Transport = transport
+	return client
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// NewSubscription registers a browser and returns its subscription
+func (s *Server) NewSubscription() (push.Subscription, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return push.Subscription{}, err
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		return push.Subscription{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return push.Subscription{}, err
+	}
+
+	endpoint := fmt.Sprintf("%s/push/%x", s.url, id)
+	s.mu.Lock()
+	s.browsers[endpoint] = &browser{key: key, auth: auth}
+	s.mu.Unlock()
+
+	return push.Subscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}, nil
+}
+
+// Expire makes the server answer 410 Gone for the subscription, as push
+// services do once a browser unsubscribes
+func (s *Server) Expire(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.browsers[endpoint]; ok {
+		b.gone = true
+	}
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received(nil), s.messages...)
+}
+
+// Rejected returns why requests were refused, such as bad signatures
+func (s *Server) Rejected() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.rejected...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.url + r.URL.Path
+
+	s.mu.Lock()
+	b, ok := s.browsers[endpoint]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if b.gone {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	if err := verifyVAPID(r, s.url); err != nil {
+		s.reject(w, http.StatusUnauthorized, err)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		s.reject(w, http.StatusBadRequest, errors.New("missing Content-Encoding or TTL"))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 8192))
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(body) > 4096 {
+		s.reject(w, http.StatusRequestEntityTooLarge, errors.New("payload too large"))
+		return
+	}
+	payload, err := decrypt(b, body)
+	if err != nil {
+		s.reject(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, Received{Endpoint: endpoint, Payload: payload, TTL: r.Header.Get("TTL")})
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) reject(w http.ResponseWriter, status int, err error) {
+	s.mu.Lock()
+	s.rejected = append(s.rejected, err)
+	s.mu.Unlock()
+	http.Error(w, err.Error(), status)
+}
+
+// verifyVAPID checks the request is signed by the key it names, for this audience
+func verifyVAPID(r *http.Request, audience string) error {
+	scheme, params, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if scheme != "vapid" {
+		return errors.New("missing vapid authorization")
+	}
+
+	var token, key string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(raw) != 65 || raw[0] != 4 {
+		return errors.New("invalid vapid public key")
+	}
+	public := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[1:33]),
+		Y:     new(big.Int).SetBytes(raw[33:65]),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return public, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(audience), jwt.WithExpirationRequired())
+	if err != nil {
+		return fmt.Errorf("invalid vapid token: %w", err)
+	}
+	if sub, _ := claims["sub"].(string); !strings.HasPrefix(sub, "mailto:") && !strings.HasPrefix(sub, "https:") && !strings.HasPrefix(sub, "http:") {
+		return errors.New("vapid subject must be a mailto: or https: URL")
+	}
+	return nil
+}
+
+// decrypt reverses push.Encrypt for a single-record message
+func decrypt(b *browser, body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("message too short")
+	}
+	salt := body[:16]
+	keyLength := int(body[20])
+	if binary.BigEndian.Uint32(body[16:20]) < 18 || len(body) < 21+keyLength {
+		return nil, errors.New("invalid header")
+	}
+	serverPublic := body[21 : 21+keyLength]
+
+	serverKey, err := ecdh.P256().NewPublicKey(serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := b.key.ECDH(serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, nonce, err := push.DeriveContentKeys(sharedSecret, b.auth, salt, b.key.PublicKey().Bytes(), serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, body[21+keyLength:], nil)
+	if err != nil {
+		return nil, err
+	}
+	// Strip padding back to the final record delimiter
+	end := len(plaintext) - 1
+	for end >= 0 && plaintext[end] == 0 {
+		end--
+	}
+	if end < 0 || plaintext[end] != 0x02 {
+		return nil, errors.New("missing record delimiter")
+	}
+	return plaintext[:end], nil
+}
@@ -0,0 +1,51 @@
+package push
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// PublicTransport returns a transport that only connects to public
+// addresses. Browsers choose the push endpoint, so without it a subscription
+// could point the server at itself or at services on its private network.
+// The address is checked after name resolution, right before connecting, so
+// a host name resolving to a private address is refused as well. Proxies
+// from the environment are not used, since the check would then apply to
+// the proxy rather than the endpoint.
+func PublicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   refusePrivate,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("push endpoint address %q: %w", address, err)
+	}
+	if !IsPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("push endpoint address %s is not public", addrPort.Addr())
+	}
+	return nil
+}
+
+// IsPublicAddr reports whether addr is routable on the internet, as opposed
+// to loopback, private, link-local, multicast or unspecified
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnat.Contains(addr)
+}
+
+// cgnat is the shared address space carriers and cloud providers use
+// internally (RFC 6598)
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
@@ -0,0 +1,223 @@
+// Package retention purges messages older than the workspace's or their
+// channel's retention period. Purged messages are deleted from the database
+// for good, together with the rows that refer to them, rather than soft
+// deleted. Channels and users on legal hold are never purged.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"turnate/internal/models"
+)
+
+// Policy is the workspace default: messages older than Days are purged, and
+// 0 keeps them forever. Each transaction purges up to BatchSize threads.
+type Policy struct {
+	Days      int
+	BatchSize int
+}
+
+// Result counts what one purge deleted, or would delete on a dry run
+type Result struct {
+	// Messages counts thread roots and their replies
+	Messages int64
+	// Related counts saved items, reminders, notifications, thread follows
+	// and sent scheduled messages of the purged messages
+	Related    int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Purger deletes expired messages. A thread is purged as a whole once its
+// root and every reply are past the retention period of the channel, so no
+// thread loses its start or its reply count.
+type Purger struct {
+	db     *gorm.DB
+	policy Policy
+
+	// mu serializes purges started by the scheduler and the CLI
+	mu   sync.Mutex
+	last *Result
+}
+
+func NewPurger(db *gorm.DB, policy Policy) *Purger {
+	return &Purger{db: db, policy: policy}
+}
+
+// Policy returns the workspace default the purger applies
+func (p *Purger) Policy() Policy {
+	return p.policy
+}
+
+// Last returns the result of the last purge since the server started, or nil
+func (p *Purger) Last() *Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil {
+		return nil
+	}
+	last := *p.last
+	return &last
+}
+
+// PurgeDue purges if the last purge started at least interval ago, or none
+// has run yet, and returns nil otherwise
+func (p *Purger) PurgeDue(ctx context.Context, now time.Time, interval time.Duration) (*Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && now.Sub(p.last.StartedAt) < interval {
+		return nil, nil
+	}
+	return p.purge(ctx, now)
+}
+
+// Purge deletes every expired thread now, one batch per transaction. When ctx
+// is cancelled it stops after the current batch; the rest is purged next time.
+func (p *Purger) Purge(ctx context.Context, now time.Time) (*Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.purge(ctx, now)
+}
+
+// Preview counts the messages a purge at now would delete, without deleting
+func (p *Purger) Preview(ctx context.Context, now time.Time) (*Result, error) {
+	db := p.db.WithContext(ctx)
+	result := &Result{StartedAt: now}
+	groups, err := p.cutoffs(db, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		var count int64
+		err := db.Unscoped().Model(&models.Message{}).
+			Where("id IN (?) OR thread_id IN (?)", p.expired(db, group).Select("id"), p.expired(db, group).Select("id")).
+			Count(&count).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to count expired messages: %w", err)
+		}
+		result.Messages += count
+	}
+	result.FinishedAt = time.Now()
+	return result, nil
+}
+
+func (p *Purger) purge(ctx context.Context, now time.Time) (*Result, error) {
+	db := p.db.WithContext(ctx)
+	result := &Result{StartedAt: now}
+	groups, err := p.cutoffs(db, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		for {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			var roots []models.UUIDv7
+			if err := p.expired(db, group).Order("id").Limit(p.policy.BatchSize).Pluck("id", &roots).Error; err != nil {
+				return result, fmt.Errorf("failed to find expired messages: %w", err)
+			}
+			if len(roots) == 0 {
+				break
+			}
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				return deleteThreads(tx, roots, result)
+			}); err != nil {
+				return result, err
+			}
+			if len(roots) < p.policy.BatchSize {
+				break
+			}
+		}
+	}
+
+	result.FinishedAt = time.Now()
+	p.last = result
+	return result, nil
+}
+
+// cutoffGroup is the channels sharing a retention period, and the time before
+// which their messages have expired
+type cutoffGroup struct {
+	channels []models.UUIDv7
+	cutoff   time.Time
+}
+
+// cutoffs groups the channels that are not on legal hold and do not keep
+// messages forever by retention period, deleted channels included
+func (p *Purger) cutoffs(db *gorm.DB, now time.Time) ([]cutoffGroup, error) {
+	var channels []models.Channel
+	if err := db.Unscoped().Select("id", "retention_days").Where("legal_hold = ?", false).Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to read channel retention: %w", err)
+	}
+
+	byDays := map[int]int{}
+	var groups []cutoffGroup
+	for _, channel := range channels {
+		days := p.policy.Days
+		if channel.RetentionDays != nil {
+			days = *channel.RetentionDays
+		}
+		if days <= 0 {
+			continue
+		}
+		i, ok := byDays[days]
+		if !ok {
+			i = len(groups)
+			byDays[days] = i
+			groups = append(groups, cutoffGroup{cutoff: now.AddDate(0, 0, -days).UTC()})
+		}
+		groups[i].channels = append(groups[i].channels, channel.ID)
+	}
+	return groups, nil
+}
+
+// expired selects the roots of the group's threads whose root and replies
+// all predate the cutoff, and in which no user on legal hold took part.
+// Soft-deleted messages expire like any other.
+func (p *Purger) expired(db *gorm.DB, group cutoffGroup) *gorm.DB {
+	held := db.Unscoped().Model(&models.User{}).Select("id").Where("legal_hold = ?", true)
+	return db.Unscoped().Model(&models.Message{}).
+		Where("channel_id IN ? AND thread_id IS NULL AND created_at < ?", group.channels, group.cutoff).
+		Where("user_id NOT IN (?)", held).
+		Where(`NOT EXISTS (SELECT 1 FROM messages AS replies WHERE replies.thread_id = messages.id
+			AND (replies.created_at >= ? OR replies.user_id IN (?)))`, group.cutoff, held)
+}
+
+// deleteThreads deletes thread roots, their replies and the rows that refer
+// to any of them
+func deleteThreads(tx *gorm.DB, roots []models.UUIDv7, result *Result) error {
+	messages := tx.Unscoped().Model(&models.Message{}).Select("id").Where("id IN ? OR thread_id IN ?", roots, roots)
+
+	related := []struct {
+		model  any
+		column string
+		ids    any
+	}{
+		{&models.SavedItem{}, "message_id", messages},
+		{&models.Reminder{}, "message_id", messages},
+		{&models.Notification{}, "message_id", messages},
+		{&models.ScheduledMessage{}, "message_id", messages},
+		{&models.ThreadFollow{}, "thread_id", roots},
+	}
+	for _, r := range related {
+		deleted := tx.Unscoped().Where(r.column+" IN (?)", r.ids).Delete(r.model)
+		if deleted.Error != nil {
+			return fmt.Errorf("failed to purge %T: %w", r.model, deleted.Error)
+		}
+		result.Related += deleted.RowsAffected
+	}
+
+	deleted := tx.Unscoped().Where("id IN ? OR thread_id IN ?", roots, roots).Delete(&models.Message{})
+	if deleted.Error != nil {
+		return fmt.Errorf("failed to purge messages: %w", deleted.Error)
+	}
+	result.Messages += deleted.RowsAffected
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package scheduler runs periodic background jobs such as reminder delivery.
+// Jobs keep their queues in the database, so work that is pending when the
+// server stops is picked up again on the next start.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"turnate/internal/logging"
+)
+
+// Job is one unit of periodic work. Run receives the time of the tick and
+// should process everything that is due at that time.
+type Job struct {
+	Name string
+	// Interval is how often the job runs; zero means the scheduler's poll interval
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+type Scheduler struct {
+	interval time.Duration
+	jobs     []Job
+	// started is when the jobs were first started, and lastRun when each job
+	// last finished, in Unix nanoseconds
+	started atomic.Int64
+	lastRun []atomic.Int64
+}
+
+func New(interval time.Duration, jobs ...Job) *Scheduler {
+	return &Scheduler{interval: interval, jobs: jobs, lastRun: make([]atomic.Int64, len(jobs))}
+}
+
+// Run starts every job on its own goroutine and ticker, so a long purge or
+// backup does not hold up reminders. Each job runs immediately, to catch up
+// on work that fell due while the server was down, and then on every tick of
+// its interval. Run returns once ctx is cancelled and every job has stopped.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.started.CompareAndSwap(0, time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	for i := range s.jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.loop(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, i int) {
+	ticker := time.NewTicker(s.intervalOf(s.jobs[i]))
+	defer ticker.Stop()
+
+	for {
+		s.runJob(ctx, i, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce executes every job once, one after the other. A failing job is
+// logged and retried on its next tick without affecting the others.
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) {
+	s.started.CompareAndSwap(0, time.Now().UnixNano())
+	for i := range s.jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		s.runJob(ctx, i, now)
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, i int, now time.Time) {
+	job := s.jobs[i]
+	if err := job.Run(ctx, now); err != nil && ctx.Err() == nil {
+		logging.Component(logging.ComponentScheduler).ErrorContext(ctx, "job failed", "job", job.Name, "error", err)
+	}
+	s.lastRun[i].Store(time.Now().UnixNano())
+}
+
+// Healthy reports an error naming each job that has not finished a run within
+// three of its own intervals, which means it is stuck. A job still on its
+// first run counts from when the scheduler started. Failing jobs do not make
+// the scheduler unhealthy; they are logged instead.
+func (s *Scheduler) Healthy(now time.Time) error {
+	started := s.started.Load()
+	if started == 0 {
+		return errors.New("jobs have not run yet")
+	}
+
+	var stale []string
+	for i, job := range s.jobs {
+		last := s.lastRun[i].Load()
+		if last == 0 {
+			last = started
+		}
+		if since := now.Sub(time.Unix(0, last)); since > 3*s.intervalOf(job) {
+			stale = append(stale, fmt.Sprintf("%s last completed %s ago", job.Name, since.Round(time.Second)))
+		}
+	}
+	if len(stale) > 0 {
+		return errors.New(strings.Join(stale, "; "))
+	}
+	return nil
+}
+
+func (s *Scheduler) intervalOf(job Job) time.Duration {
+	if job.Interval > 0 {
+		return job.Interval
+	}
+	return s.interval
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// maxBookmarksPerChannel keeps the channel header readable
+const maxBookmarksPerChannel = 50
+
+// Bookmarks returns the bookmarks of a channel the actor can see
+func (s *ChannelService) Bookmarks(ctx context.Context, actor Actor, channelID models.UUIDv7) ([]models.ChannelBookmark, error) {
+	if _, err := s.AuthorizeView(ctx, actor, channelID); err != nil {
+		return nil, err
+	}
+	return s.stores.Bookmarks.ListByChannel(ctx, channelID)
+}
+
+// AddBookmark adds a titled link or file to a channel the actor belongs to
+func (s *ChannelService) AddBookmark(ctx context.Context, actor Actor, channelID models.UUIDv7, title, url string, kind models.BookmarkKind) (*models.ChannelBookmark, error) {
+	channel, err := s.AuthorizePost(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.stores.Bookmarks.ListByChannel(ctx, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxBookmarksPerChannel {
+		return nil, newError(ErrInvalid, "Channel bookmark limit reached")
+	}
+
+	if kind == "" {
+		kind = models.BookmarkKindLink
+	}
+
+	bookmark := &models.ChannelBookmark{
+		ChannelID: channel.ID,
+		Title:     title,
+		URL:       url,
+		Kind:      kind,
+		CreatedBy: actor.UserID,
+	}
+	if err := s.stores.Bookmarks.Create(ctx, bookmark); err != nil {
+		return nil, err
+	}
+	return bookmark, nil
+}
+
+// RemoveBookmark deletes a bookmark. Its author, the channel owner and admins may remove it.
+func (s *ChannelService) RemoveBookmark(ctx context.Context, actor Actor, channelID, bookmarkID models.UUIDv7) error {
+	channel, err := s.AuthorizePost(ctx, actor, channelID)
+	if err != nil {
+		return err
+	}
+
+	bookmark, err := s.stores.Bookmarks.GetInChannel(ctx, bookmarkID, channel.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Bookmark not found")
+	} else if err != nil {
+		return err
+	}
+
+	if bookmark.CreatedBy != actor.UserID && !canManage(actor, channel) {
+		return newError(ErrForbidden, "Permission denied")
+	}
+
+	return s.stores.Bookmarks.Delete(ctx, bookmark)
+}
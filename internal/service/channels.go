@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// GeneralChannelName is the channel every user joins on registration and cannot leave
+const GeneralChannelName = "general"
+
+// ChannelSummary is a channel together with viewer-specific details
+type ChannelSummary struct {
+	Channel     models.Channel
+	MemberCount int64
+	IsMember    bool
+}
+
+type ChannelService struct {
+	stores *store.Stores
+	policy Policy
+}
+
+func NewChannelService(stores *store.Stores, policy Policy) *ChannelService {
+	return &ChannelService{stores: stores, policy: policy}
+}
+
+// Create normalizes the name and creates the channel with its creator as first member
+func (s *ChannelService) Create(ctx context.Context, actor Actor, name, description string, channelType models.ChannelType) (*models.Channel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.ReplaceAll(name, " ", "-")
+
+	if _, err := s.stores.Channels.GetByName(ctx, name); err == nil {
+		return nil, newError(ErrConflict, "Channel already exists")
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// Only admins can create private channels by default (can be modified)
+	if channelType == "" {
+		channelType = models.ChannelTypePublic
+	}
+	if channelType == models.ChannelTypePrivate && !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can create private channels")
+	}
+
+	channel := &models.Channel{
+		Name:        name,
+		Description: description,
+		Type:        channelType,
+		CreatedBy:   actor.UserID,
+	}
+	if err := s.stores.Channels.Create(ctx, channel); err != nil {
+		return nil, err
+	}
+
+	member := &models.ChannelMember{ChannelID: channel.ID, UserID: actor.UserID}
+	if err := s.stores.Members.Add(ctx, member); err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+// List returns the channels visible to the actor; admins see every channel
+func (s *ChannelService) List(ctx context.Context, actor Actor) ([]ChannelSummary, error) {
+	var visibleTo *models.UUIDv7
+	if !actor.IsAdmin() {
+		visibleTo = &actor.UserID
+	}
+
+	channels, err := s.stores.Channels.List(ctx, visibleTo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Member counts and the actor's memberships are fetched in one lookup each,
+	// so the cost of the listing does not grow with the number of channels
+	channelIDs := make([]models.UUIDv7, len(channels))
+	for i, channel := range channels {
+		channelIDs[i] = channel.ID
+	}
+
+	memberCounts, err := s.stores.Members.CountMembersByChannel(ctx, channelIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	joinedIDs, err := s.stores.Members.ListChannelIDs(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	joined := make(map[models.UUIDv7]bool, len(joinedIDs))
+	for _, id := range joinedIDs {
+		joined[id] = true
+	}
+
+	summaries := make([]ChannelSummary, 0, len(channels))
+	for _, channel := range channels {
+		summaries = append(summaries, ChannelSummary{
+			Channel:     channel,
+			MemberCount: memberCounts[channel.ID],
+			IsMember:    joined[channel.ID],
+		})
+	}
+	return summaries, nil
+}
+
+func (s *ChannelService) Get(ctx context.Context, actor Actor, channelID models.UUIDv7) (*ChannelSummary, error) {
+	channel, err := s.AuthorizeView(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+	return s.summarize(ctx, actor, *channel)
+}
+
+func (s *ChannelService) Join(ctx context.Context, actor Actor, channelID models.UUIDv7) error {
+	channel, err := s.find(ctx, channelID)
+	if err != nil {
+		return err
+	}
+
+	if channel.Type == models.ChannelTypePrivate && !actor.IsAdmin() {
+		return newError(ErrForbidden, "Cannot join private channel")
+	}
+
+	if isMember, err := s.IsMember(ctx, channel.ID, actor.UserID); err != nil {
+		return err
+	} else if isMember {
+		return newError(ErrConflict, "Already a member of this channel")
+	}
+
+	return s.stores.Members.Add(ctx, &models.ChannelMember{ChannelID: channel.ID, UserID: actor.UserID})
+}
+
+func (s *ChannelService) Leave(ctx context.Context, actor Actor, channelID models.UUIDv7) error {
+	membership, err := s.stores.Members.Get(ctx, channelID, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Not a member of this channel")
+	} else if err != nil {
+		return err
+	}
+
+	channel, err := s.find(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if channel.Name == GeneralChannelName {
+		return newError(ErrInvalid, "Cannot leave the general channel")
+	}
+
+	return s.stores.Members.Remove(ctx, membership)
+}
+
+func (s *ChannelService) Members(ctx context.Context, actor Actor, channelID models.UUIDv7) ([]models.User, error) {
+	if _, err := s.AuthorizeView(ctx, actor, channelID); err != nil {
+		return nil, err
+	}
+	return s.stores.Members.ListMembers(ctx, channelID)
+}
+
+// AuthorizeView loads a channel the actor is allowed to see. Private channels
+// are visible to their members and to admins.
+func (s *ChannelService) AuthorizeView(ctx context.Context, actor Actor, channelID models.UUIDv7) (*models.Channel, error) {
+	channel, err := s.find(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	if channel.Type == models.ChannelTypePrivate && !actor.IsAdmin() {
+		if isMember, err := s.IsMember(ctx, channel.ID, actor.UserID); err != nil {
+			return nil, err
+		} else if !isMember {
+			return nil, newError(ErrForbidden, "Access denied to private channel")
+		}
+	}
+
+	return channel, nil
+}
+
+// AuthorizeRead loads a channel whose messages the actor may read
+func (s *ChannelService) AuthorizeRead(ctx context.Context, actor Actor, channelID models.UUIDv7) (*models.Channel, error) {
+	return s.authorizeMessages(ctx, actor, channelID, "Must join channel to view messages")
+}
+
+// AuthorizePost loads a channel the actor may post messages to
+func (s *ChannelService) AuthorizePost(ctx context.Context, actor Actor, channelID models.UUIDv7) (*models.Channel, error) {
+	return s.authorizeMessages(ctx, actor, channelID, "Must join channel to post messages")
+}
+
+// authorizeMessages requires membership of public channels; admins may use
+// private channels without joining them
+func (s *ChannelService) authorizeMessages(ctx context.Context, actor Actor, channelID models.UUIDv7, notMemberMessage string) (*models.Channel, error) {
+	channel, err := s.AuthorizeView(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	if channel.Type == models.ChannelTypePublic {
+		if isMember, err := s.IsMember(ctx, channel.ID, actor.UserID); err != nil {
+			return nil, err
+		} else if !isMember {
+			return nil, newError(ErrForbidden, notMemberMessage)
+		}
+	}
+
+	return channel, nil
+}
+
+// AuthorizePin loads a channel in which the actor may pin and unpin messages.
+// Members may pin unless the policy restricts pinning to owners.
+func (s *ChannelService) AuthorizePin(ctx context.Context, actor Actor, channelID models.UUIDv7) (*models.Channel, error) {
+	channel, err := s.AuthorizePost(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.policy.RestrictPinsToOwners && !canManage(actor, channel) {
+		return nil, newError(ErrForbidden, "Only channel owners can pin messages")
+	}
+
+	return channel, nil
+}
+
+// canManage reports whether the actor owns the channel or is an admin
+func canManage(actor Actor, channel *models.Channel) bool {
+	return actor.IsAdmin() || channel.CreatedBy == actor.UserID
+}
+
+func (s *ChannelService) IsMember(ctx context.Context, channelID, userID models.UUIDv7) (bool, error) {
+	_, err := s.stores.Members.Get(ctx, channelID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *ChannelService) find(ctx context.Context, channelID models.UUIDv7) (*models.Channel, error) {
+	channel, err := s.stores.Channels.GetByID(ctx, channelID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Channel not found")
+	}
+	return channel, err
+}
+
+func (s *ChannelService) summarize(ctx context.Context, actor Actor, channel models.Channel) (*ChannelSummary, error) {
+	memberCount, err := s.stores.Members.CountMembers(ctx, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, err := s.IsMember(ctx, channel.ID, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChannelSummary{Channel: channel, MemberCount: memberCount, IsMember: isMember}, nil
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"turnate/internal/mail"
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+const (
+	// emailBatchLimit bounds how many notifications one email run handles
+	emailBatchLimit = 500
+	// digestWindow is the longest period a digest covers
+	digestWindow = 24 * time.Hour
+)
+
+// emailedKinds are the notifications worth an email when the user is away.
+// Direct messages would belong here once they exist.
+var emailedKinds = []models.NotificationKind{models.NotificationKindMention}
+
+// EmailOptions configures notification emails
+type EmailOptions struct {
+	// BaseURL is the public address of the server, for links
+	BaseURL string
+	// Secret signs unsubscribe links
+	Secret string
+	// MentionDelay is how long a mention stays unread before it is emailed
+	MentionDelay time.Duration
+	// DigestHour is the local hour at which daily digests go out
+	DigestHour int
+}
+
+// EmailService emails unread mentions to users who are away and sends the
+// opt-in daily digest. Both run as background jobs and keep their progress
+// in the database.
+type EmailService struct {
+	stores  *store.Stores
+	sender  mail.Sender
+	options EmailOptions
+}
+
+func NewEmailService(stores *store.Stores, sender mail.Sender, options EmailOptions) *EmailService {
+	options.BaseURL = strings.TrimRight(options.BaseURL, "/")
+	return &EmailService{stores: stores, sender: sender, options: options}
+}
+
+type mentionEmail struct {
+	Name           string
+	Notifications  []models.Notification
+	AppURL         string
+	UnsubscribeURL string
+}
+
+// SendMentionEmails emails each user their mentions that have stayed unread
+// for the mention delay, batched into one email per user. Users seen since a
+// mention arrived, and users who turned mention emails off, are skipped. It
+// returns the number of emails sent.
+func (s *EmailService) SendMentionEmails(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.stores.Notifications.ListEmailDue(ctx, emailedKinds, now.Add(-s.options.MentionDelay), emailBatchLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	var order []models.UUIDv7
+	byUser := make(map[models.UUIDv7][]models.Notification)
+	for _, notification := range due {
+		if _, ok := byUser[notification.UserID]; !ok {
+			order = append(order, notification.UserID)
+		}
+		byUser[notification.UserID] = append(byUser[notification.UserID], notification)
+	}
+
+	sent := 0
+	var errs []error
+	for _, userID := range order {
+		notifications := byUser[userID]
+		ids := make([]models.UUIDv7, len(notifications))
+		for i, notification := range notifications {
+			ids[i] = notification.ID
+		}
+
+		emailed, err := s.sendMentions(ctx, userID, notifications)
+		if err != nil {
+			// Left unhandled, so the next run retries them
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.stores.Notifications.MarkEmailed(ctx, ids, now); err != nil {
+			return sent, err
+		}
+		if emailed {
+			sent++
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// sendMentions emails one user's notifications unless they should be skipped.
+// Notifications that arrived before the user was last seen are left out. It
+// reports whether an email went out.
+func (s *EmailService) sendMentions(ctx context.Context, userID models.UUIDv7, notifications []models.Notification) (bool, error) {
+	user, err := s.stores.Users.GetByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !user.IsActive {
+		return false, nil
+	}
+	if user.LastSeenAt != nil {
+		unseen := make([]models.Notification, 0, len(notifications))
+		for _, notification := range notifications {
+			if notification.CreatedAt.After(*user.LastSeenAt) {
+				unseen = append(unseen, notification)
+			}
+		}
+		notifications = unseen
+	}
+	if len(notifications) == 0 {
+		return false, nil
+	}
+
+	settings, err := loadSettings(ctx, s.stores, userID)
+	if err != nil {
+		return false, err
+	}
+	if settings.MentionEmailsDisabled {
+		return false, nil
+	}
+
+	subject := notifications[0].Title
+	if len(notifications) > 1 {
+		subject = fmt.Sprintf("You have %d unread mentions", len(notifications))
+	}
+
+	unsubscribe := s.unsubscribeURL(userID, mail.ListMentions)
+	text, html, err := mail.Render("mentions", mentionEmail{
+		Name:           displayName(user),
+		Notifications:  notifications,
+		AppURL:         s.options.BaseURL + "/",
+		UnsubscribeURL: unsubscribe,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = s.sender.Send(ctx, mail.Message{To: user.Email, Subject: subject, Text: text, HTML: html, Unsubscribe: unsubscribe})
+	return err == nil, err
+}
+
+type digestEmail struct {
+	Name           string
+	Since          string
+	Channels       []digestChannel
+	Unread         int
+	AppURL         string
+	UnsubscribeURL string
+}
+
+type digestChannel struct {
+	Name  string
+	Count int
+}
+
+// SendDigests sends the daily digest to each subscriber whose local time has
+// reached the digest hour and who has not had one today. A digest counts the
+// new messages by others in the subscriber's channels, leaving out channels
+// set to none or muted, and is skipped when there is nothing new. It returns
+// the number of digests sent.
+func (s *EmailService) SendDigests(ctx context.Context, now time.Time) (int, error) {
+	subscribers, err := s.stores.Preferences.ListDigestSubscribers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, settings := range subscribers {
+		location, err := time.LoadLocation(settings.Timezone)
+		if err != nil {
+			location = time.UTC
+		}
+		local := now.In(location)
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+		if local.Hour() < s.options.DigestHour || (settings.DigestSentAt != nil && !settings.DigestSentAt.Before(today)) {
+			continue
+		}
+
+		since := now.Add(-digestWindow)
+		if settings.DigestSentAt != nil && settings.DigestSentAt.After(since) {
+			since = *settings.DigestSentAt
+		}
+
+		emailed, err := s.sendDigest(ctx, settings.UserID, since, location)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.stores.Preferences.MarkDigestSent(ctx, settings.UserID, now); err != nil {
+			return sent, err
+		}
+		if emailed {
+			sent++
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// sendDigest emails one user's digest when there is anything in it. It
+// reports whether an email went out.
+func (s *EmailService) sendDigest(ctx context.Context, userID models.UUIDv7, since time.Time, location *time.Location) (bool, error) {
+	user, err := s.stores.Users.GetByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !user.IsActive {
+		return false, nil
+	}
+
+	channelIDs, err := s.stores.Members.ListChannelIDs(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	preferences, err := s.stores.Preferences.ListByUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	silenced := make(map[models.UUIDv7]bool)
+	for _, preference := range preferences {
+		if preference.Level == models.NotificationLevelNone || preference.Level == models.NotificationLevelMuted {
+			silenced[preference.ChannelID] = true
+		}
+	}
+	followed := channelIDs[:0]
+	for _, id := range channelIDs {
+		if !silenced[id] {
+			followed = append(followed, id)
+		}
+	}
+
+	counts, err := s.stores.Messages.CountSince(ctx, followed, since, userID)
+	if err != nil {
+		return false, err
+	}
+
+	countedIDs := make([]models.UUIDv7, 0, len(counts))
+	for channelID := range counts {
+		countedIDs = append(countedIDs, channelID)
+	}
+	counted, err := s.stores.Channels.ListByIDs(ctx, countedIDs)
+	if err != nil {
+		return false, err
+	}
+	var channels []digestChannel
+	for _, channel := range counted {
+		channels = append(channels, digestChannel{Name: channel.Name, Count: int(counts[channel.ID])})
+	}
+	if len(channels) == 0 {
+		return false, nil
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+	unread, err := s.stores.Notifications.CountUnread(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	unsubscribe := s.unsubscribeURL(userID, mail.ListDigest)
+	text, html, err := mail.Render("digest", digestEmail{
+		Name:           displayName(user),
+		Since:          since.In(location).Format("Mon Jan 2 15:04 MST"),
+		Channels:       channels,
+		Unread:         int(unread),
+		AppURL:         s.options.BaseURL + "/",
+		UnsubscribeURL: unsubscribe,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = s.sender.Send(ctx, mail.Message{To: user.Email, Subject: "Your daily Turnate digest", Text: text, HTML: html, Unsubscribe: unsubscribe})
+	return err == nil, err
+}
+
+// CheckUnsubscribe verifies a signed unsubscribe token without acting on it
+// and returns the mailing list it names
+func (s *EmailService) CheckUnsubscribe(ctx context.Context, token string) (string, error) {
+	_, list, err := s.parseUnsubscribe(ctx, token)
+	return list, err
+}
+
+// Unsubscribe turns off the mailing list named by a signed unsubscribe token
+// and returns that list
+func (s *EmailService) Unsubscribe(ctx context.Context, token string) (string, error) {
+	userID, list, err := s.parseUnsubscribe(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := loadSettings(ctx, s.stores, userID)
+	if err != nil {
+		return "", err
+	}
+	switch list {
+	case mail.ListMentions:
+		settings.MentionEmailsDisabled = true
+	case mail.ListDigest:
+		settings.DigestEnabled = false
+	}
+	return list, s.stores.Preferences.SaveSettings(ctx, settings)
+}
+
+func (s *EmailService) parseUnsubscribe(ctx context.Context, token string) (models.UUIDv7, string, error) {
+	userID, list, ok := mail.ParseUnsubscribeToken(s.options.Secret, token)
+	if !ok {
+		return models.UUIDv7{}, "", newError(ErrInvalid, "Invalid unsubscribe link")
+	}
+
+	id, err := models.ParseUUIDv7(userID)
+	if err != nil {
+		return models.UUIDv7{}, "", newError(ErrInvalid, "Invalid unsubscribe link")
+	}
+	if _, err := s.stores.Users.GetByID(ctx, id); errors.Is(err, store.ErrNotFound) {
+		return models.UUIDv7{}, "", newError(ErrNotFound, "User not found")
+	} else if err != nil {
+		return models.UUIDv7{}, "", err
+	}
+	return id, list, nil
+}
+
+func (s *EmailService) unsubscribeURL(userID models.UUIDv7, list string) string {
+	token := mail.UnsubscribeToken(s.options.Secret, userID.String(), list)
+	return s.options.BaseURL + "/api/v1/email/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+func displayName(user *models.User) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// ErasureService manages account erasure requests: users ask for their account
+// to be erased and an admin approves or rejects the request. The erasure job
+// in the erasure package erases approved accounts.
+type ErasureService struct {
+	stores *store.Stores
+}
+
+func NewErasureService(stores *store.Stores) *ErasureService {
+	return &ErasureService{stores: stores}
+}
+
+// Request asks for the actor's account to be erased. A user has at most one
+// open request.
+func (s *ErasureService) Request(ctx context.Context, actor Actor, reason string) (*models.ErasureRequest, error) {
+	open, err := s.stores.Erasures.HasOpen(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if open {
+		return nil, newError(ErrConflict, "You already requested erasure")
+	}
+
+	request := &models.ErasureRequest{UserID: actor.UserID, Status: models.ErasureStatusPending, Reason: reason}
+	if err := s.stores.Erasures.Create(ctx, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Latest returns the actor's most recent request
+func (s *ErasureService) Latest(ctx context.Context, actor Actor) (*models.ErasureRequest, error) {
+	request, err := s.stores.Erasures.Latest(ctx, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Erasure request not found")
+	} else if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Cancel withdraws the actor's pending request. Approved requests can no
+// longer be cancelled.
+func (s *ErasureService) Cancel(ctx context.Context, actor Actor) (*models.ErasureRequest, error) {
+	request, err := s.Latest(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Status = models.ErasureStatusCancelled
+	if err := s.updatePending(ctx, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// List returns requests with their users, newest first, optionally only
+// those with the given status
+func (s *ErasureService) List(ctx context.Context, actor Actor, status models.ErasureStatus) ([]models.ErasureRequest, error) {
+	if !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can review erasure requests")
+	}
+	return s.stores.Erasures.List(ctx, status)
+}
+
+// Approve queues a pending request for the erasure job. Users on legal hold
+// and the only active admin cannot be erased.
+func (s *ErasureService) Approve(ctx context.Context, actor Actor, id models.UUIDv7, note string, now time.Time) (*models.ErasureRequest, error) {
+	request, err := s.pending(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if request.User.LegalHold {
+		return nil, newError(ErrConflict, "User is on legal hold")
+	}
+	if request.User.IsAdmin() && request.User.IsActive {
+		admins, err := s.stores.Users.CountActiveAdmins(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, newError(ErrConflict, "User is the only active admin")
+		}
+	}
+	return s.review(ctx, actor, request, models.ErasureStatusApproved, note, now)
+}
+
+// Reject declines a pending request
+func (s *ErasureService) Reject(ctx context.Context, actor Actor, id models.UUIDv7, note string, now time.Time) (*models.ErasureRequest, error) {
+	request, err := s.pending(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.review(ctx, actor, request, models.ErasureStatusRejected, note, now)
+}
+
+func (s *ErasureService) pending(ctx context.Context, actor Actor, id models.UUIDv7) (*models.ErasureRequest, error) {
+	if !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can review erasure requests")
+	}
+
+	request, err := s.stores.Erasures.GetByID(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Erasure request not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if request.Status != models.ErasureStatusPending {
+		return nil, newError(ErrConflict, "Erasure request is no longer pending")
+	}
+	return request, nil
+}
+
+func (s *ErasureService) review(ctx context.Context, actor Actor, request *models.ErasureRequest, status models.ErasureStatus, note string, now time.Time) (*models.ErasureRequest, error) {
+	reviewedBy, reviewedAt := actor.UserID, now.UTC()
+	request.Status = status
+	request.ReviewedBy = &reviewedBy
+	request.ReviewedAt = &reviewedAt
+	request.ReviewNote = note
+	if err := s.updatePending(ctx, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// updatePending saves a request that must still be pending, which also stops
+// two admins from both reviewing it
+func (s *ErasureService) updatePending(ctx context.Context, request *models.ErasureRequest) error {
+	updated, err := s.stores.Erasures.UpdatePending(ctx, request)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return newError(ErrConflict, "Erasure request is no longer pending")
+	}
+	return nil
+}
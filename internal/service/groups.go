@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// GroupSummary is a group together with its member count
+type GroupSummary struct {
+	Group       models.UserGroup
+	MemberCount int
+}
+
+// GroupDetails is a group with its members and default channels
+type GroupDetails struct {
+	Group      models.UserGroup
+	Members    []models.UserGroupMember
+	ChannelIDs []models.UUIDv7
+}
+
+// GroupUpdate holds the group settings to change; nil fields are left alone
+type GroupUpdate struct {
+	Name        *string
+	Description *string
+	// ChannelIDs replaces the default channels that members join automatically
+	ChannelIDs *[]models.UUIDv7
+}
+
+// GroupService manages user groups, which are mentioned by handle to notify
+// every member. Admins create and delete groups; admins and group owners
+// manage members and settings.
+type GroupService struct {
+	stores   *store.Stores
+	channels *ChannelService
+}
+
+func NewGroupService(stores *store.Stores, channels *ChannelService) *GroupService {
+	return &GroupService{stores: stores, channels: channels}
+}
+
+// Create normalizes the handle and creates the group. Handles share the
+// mention namespace with usernames, so neither may shadow the other.
+func (s *GroupService) Create(ctx context.Context, actor Actor, handle, name, description string) (*models.UserGroup, error) {
+	if !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can create groups")
+	}
+
+	handle = strings.ToLower(strings.TrimSpace(handle))
+	if _, err := s.stores.Groups.GetByHandle(ctx, handle); err == nil {
+		return nil, newError(ErrConflict, "Group handle already exists")
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if taken, err := s.stores.Users.ExistsByUsernameIgnoreCase(ctx, handle); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, newError(ErrConflict, "Group handle is taken by a user")
+	}
+
+	group := &models.UserGroup{
+		Handle:      handle,
+		Name:        name,
+		Description: description,
+		CreatedBy:   actor.UserID,
+	}
+	if group.Name == "" {
+		group.Name = handle
+	}
+	if err := s.stores.Groups.Create(ctx, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// List returns every group with its member count
+func (s *GroupService) List(ctx context.Context) ([]GroupSummary, error) {
+	groups, err := s.stores.Groups.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs := make([]models.UUIDv7, len(groups))
+	for i, group := range groups {
+		groupIDs[i] = group.ID
+	}
+	memberIDs, err := s.stores.Groups.ListMemberIDs(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]GroupSummary, 0, len(groups))
+	for _, group := range groups {
+		summaries = append(summaries, GroupSummary{Group: group, MemberCount: len(memberIDs[group.ID])})
+	}
+	return summaries, nil
+}
+
+// Get returns a group with its members and default channels
+func (s *GroupService) Get(ctx context.Context, groupID models.UUIDv7) (*GroupDetails, error) {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.details(ctx, *group)
+}
+
+// Update changes a group's settings. Members join any newly added default
+// channel right away.
+func (s *GroupService) Update(ctx context.Context, actor Actor, groupID models.UUIDv7, update GroupUpdate) (*GroupDetails, error) {
+	group, err := s.authorizeManage(ctx, actor, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		group.Name = *update.Name
+	}
+	if update.Description != nil {
+		group.Description = *update.Description
+	}
+	if update.Name != nil || update.Description != nil {
+		if err := s.stores.Groups.Update(ctx, group); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.ChannelIDs != nil {
+		channelIDs, err := s.authorizeChannels(ctx, actor, *update.ChannelIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.stores.Groups.SetChannels(ctx, group.ID, channelIDs); err != nil {
+			return nil, err
+		}
+
+		memberIDs, err := s.stores.Groups.ListMemberIDs(ctx, []models.UUIDv7{group.ID})
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range memberIDs[group.ID] {
+			if err := s.joinChannels(ctx, userID, channelIDs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s.details(ctx, *group)
+}
+
+// Delete removes a group. Channel memberships gained through it are kept.
+func (s *GroupService) Delete(ctx context.Context, actor Actor, groupID models.UUIDv7) error {
+	if !actor.IsAdmin() {
+		return newError(ErrForbidden, "Only admins can delete groups")
+	}
+
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	return s.stores.Groups.Delete(ctx, group)
+}
+
+// AddMember adds a user to a group, optionally as an owner, and joins them to
+// the group's default channels. Private default channels are only joined when
+// an admin adds the member, so owners cannot use the group to grant access.
+func (s *GroupService) AddMember(ctx context.Context, actor Actor, groupID, userID models.UUIDv7, owner bool) (*models.UserGroupMember, error) {
+	group, err := s.authorizeManage(ctx, actor, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.stores.Users.GetByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "User not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, newError(ErrInvalid, "User is deactivated")
+	}
+
+	if _, err := s.stores.Groups.GetMember(ctx, group.ID, user.ID); err == nil {
+		return nil, newError(ErrConflict, "Already a member of this group")
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	member := &models.UserGroupMember{GroupID: group.ID, UserID: user.ID, Owner: owner}
+	if err := s.stores.Groups.AddMember(ctx, member); err != nil {
+		return nil, err
+	}
+	member.User = *user
+
+	channelIDs, err := s.stores.Groups.ListChannelIDs(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.IsAdmin() {
+		if channelIDs, err = s.publicChannels(ctx, channelIDs); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.joinChannels(ctx, user.ID, channelIDs); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes a user from a group. Admins and owners may remove
+// anyone, and members may leave on their own. The user stays in the group's
+// default channels.
+func (s *GroupService) RemoveMember(ctx context.Context, actor Actor, groupID, userID models.UUIDv7) error {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if userID != actor.UserID {
+		if err := s.requireManager(ctx, actor, group); err != nil {
+			return err
+		}
+	}
+
+	member, err := s.stores.Groups.GetMember(ctx, group.ID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Not a member of this group")
+	} else if err != nil {
+		return err
+	}
+	return s.stores.Groups.RemoveMember(ctx, member)
+}
+
+// authorizeChannels checks the proposed default channels and drops
+// duplicates. Owners may only pick public channels, since membership of a
+// group would otherwise grant access to a private one.
+func (s *GroupService) authorizeChannels(ctx context.Context, actor Actor, channelIDs []models.UUIDv7) ([]models.UUIDv7, error) {
+	seen := make(map[models.UUIDv7]bool, len(channelIDs))
+	authorized := make([]models.UUIDv7, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		if seen[channelID] {
+			continue
+		}
+		seen[channelID] = true
+
+		channel, err := s.channels.AuthorizeView(ctx, actor, channelID)
+		if err != nil {
+			return nil, err
+		}
+		if channel.Type == models.ChannelTypePrivate && !actor.IsAdmin() {
+			return nil, newError(ErrForbidden, "Only admins can add private default channels")
+		}
+		authorized = append(authorized, channel.ID)
+	}
+	return authorized, nil
+}
+
+// publicChannels drops the private channels from the list
+func (s *GroupService) publicChannels(ctx context.Context, channelIDs []models.UUIDv7) ([]models.UUIDv7, error) {
+	public := make([]models.UUIDv7, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		channel, err := s.stores.Channels.GetByID(ctx, channelID)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if channel.Type != models.ChannelTypePrivate {
+			public = append(public, channel.ID)
+		}
+	}
+	return public, nil
+}
+
+// joinChannels adds the user to those of the channels they are not in yet
+func (s *GroupService) joinChannels(ctx context.Context, userID models.UUIDv7, channelIDs []models.UUIDv7) error {
+	for _, channelID := range channelIDs {
+		if isMember, err := s.channels.IsMember(ctx, channelID, userID); err != nil {
+			return err
+		} else if isMember {
+			continue
+		}
+		if err := s.stores.Members.Add(ctx, &models.ChannelMember{ChannelID: channelID, UserID: userID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *GroupService) authorizeManage(ctx context.Context, actor Actor, groupID models.UUIDv7) (*models.UserGroup, error) {
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireManager(ctx, actor, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// requireManager allows admins and the group's owners
+func (s *GroupService) requireManager(ctx context.Context, actor Actor, group *models.UserGroup) error {
+	if actor.IsAdmin() {
+		return nil
+	}
+	member, err := s.stores.Groups.GetMember(ctx, group.ID, actor.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if member == nil || !member.Owner {
+		return newError(ErrForbidden, "Only admins and group owners can manage this group")
+	}
+	return nil
+}
+
+func (s *GroupService) find(ctx context.Context, groupID models.UUIDv7) (*models.UserGroup, error) {
+	group, err := s.stores.Groups.GetByID(ctx, groupID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Group not found")
+	}
+	return group, err
+}
+
+func (s *GroupService) details(ctx context.Context, group models.UserGroup) (*GroupDetails, error) {
+	members, err := s.stores.Groups.ListMembers(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	channelIDs, err := s.stores.Groups.ListChannelIDs(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupDetails{Group: group, Members: members, ChannelIDs: channelIDs}, nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"turnate/internal/logging"
+	"turnate/internal/metrics"
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+const (
+	recentMessagesWindow = 24 * time.Hour
+	recentMessagesLimit  = 20
+)
+
+type MessageService struct {
+	stores        *store.Stores
+	channels      *ChannelService
+	notifications *NotificationService
+}
+
+func NewMessageService(stores *store.Stores, channels *ChannelService, notifications *NotificationService) *MessageService {
+	return &MessageService{stores: stores, channels: channels, notifications: notifications}
+}
+
+// Create posts a message, or a reply when threadID is set. The returned
+// message has its author loaded.
+func (s *MessageService) Create(ctx context.Context, actor Actor, channelID models.UUIDv7, content string, threadID *models.UUIDv7) (*models.Message, error) {
+	if threadID != nil {
+		return s.Reply(ctx, actor, channelID, *threadID, content, false)
+	}
+	message, _, err := s.create(ctx, actor, channelID, &models.Message{Content: content})
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ctx, message)
+	return message, nil
+}
+
+// Reply posts a reply to a thread, shown in the channel timeline as well when
+// alsoSendToChannel is set. The author and the thread starter follow the
+// thread unless they unfollowed it, and the author's read position moves past
+// their own reply.
+func (s *MessageService) Reply(ctx context.Context, actor Actor, channelID, threadID models.UUIDv7, content string, alsoSendToChannel bool) (*models.Message, error) {
+	message, root, err := s.create(ctx, actor, channelID, &models.Message{
+		Content:           content,
+		ThreadID:          &threadID,
+		AlsoSentToChannel: alsoSendToChannel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.stores.ThreadFollows.Participate(ctx, threadID, root.UserID, actor.UserID); err != nil {
+		return nil, err
+	}
+	if err := s.stores.ThreadFollows.MarkRead(ctx, threadID, actor.UserID, message.CreatedAt); err != nil {
+		return nil, err
+	}
+	s.notify(ctx, message)
+	return message, nil
+}
+
+// notify tells channel members about a new message. The message is already
+// stored, so failures are logged rather than returned.
+func (s *MessageService) notify(ctx context.Context, message *models.Message) {
+	if s.notifications == nil {
+		return
+	}
+	if err := s.notifications.MessagePosted(ctx, *message); err != nil {
+		logging.Component(logging.ComponentNotifications).ErrorContext(ctx, "failed to notify about message",
+			"message_id", message.ID.String(), "error", err)
+	}
+}
+
+// create checks the actor may post the message, and its thread if any, and
+// stores it. For replies it also returns the thread root.
+func (s *MessageService) create(ctx context.Context, actor Actor, channelID models.UUIDv7, message *models.Message) (*models.Message, *models.Message, error) {
+	channel, err := s.channels.AuthorizePost(ctx, actor, channelID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message.UserID = actor.UserID
+	message.ChannelID = channel.ID
+	message.Type = models.MessageTypeUser
+
+	var root *models.Message
+	if message.ThreadID != nil {
+		if root, err = s.threadRoot(ctx, channel.ID, *message.ThreadID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.stores.Messages.Create(ctx, message); err != nil {
+		return nil, nil, err
+	}
+	if root != nil {
+		metrics.MessagesCreated.WithLabelValues("reply").Inc()
+	} else {
+		metrics.MessagesCreated.WithLabelValues("message").Inc()
+	}
+
+	author, err := s.stores.Users.GetByID(ctx, actor.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	message.User = *author
+
+	return message, root, nil
+}
+
+// threadRoot loads a thread message, verifying that it belongs to the channel
+func (s *MessageService) threadRoot(ctx context.Context, channelID, threadID models.UUIDv7) (*models.Message, error) {
+	root, err := s.stores.Messages.GetInChannel(ctx, threadID, channelID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrInvalid, "Invalid thread message")
+	}
+	return root, err
+}
+
+// MessagePosition selects where a window of channel history starts. At most
+// one field is set; with none set the window ends at the latest message.
+type MessagePosition struct {
+	// Before returns messages older than this ID
+	Before *models.UUIDv7
+	// After returns messages newer than this ID
+	After *models.UUIDv7
+	// Around centres the window on this message, or on its thread root for
+	// replies that are not in the channel timeline
+	Around *models.UUIDv7
+}
+
+// MessageWindow is a run of timeline messages in chronological order
+type MessageWindow struct {
+	Messages []models.Message
+	HasOlder bool
+	HasNewer bool
+	// Anchor is the message an Around window was centred on
+	Anchor *models.UUIDv7
+}
+
+// List returns a window of the channel timeline: top-level messages and
+// replies also sent to the channel. Positions are expressed as
+// message IDs, which are UUIDv7 and therefore ordered by creation time, so
+// windows stay stable while new messages arrive. Reply counts come from the
+// denormalized thread statistics on each message.
+func (s *MessageService) List(ctx context.Context, actor Actor, channelID models.UUIDv7, position MessagePosition, limit int) (*MessageWindow, error) {
+	if _, err := s.channels.AuthorizeRead(ctx, actor, channelID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case position.Around != nil:
+		return s.around(ctx, channelID, *position.Around, limit)
+	case position.After != nil:
+		messages, err := s.stores.Messages.ListTopLevelAfter(ctx, channelID, *position.After, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		window := &MessageWindow{HasOlder: true, HasNewer: len(messages) > limit}
+		window.Messages = truncate(messages, limit)
+		return window, nil
+	default:
+		messages, err := s.stores.Messages.ListTopLevelBefore(ctx, channelID, position.Before, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		window := &MessageWindow{HasOlder: len(messages) > limit, HasNewer: position.Before != nil}
+		window.Messages = reverse(truncate(messages, limit))
+		return window, nil
+	}
+}
+
+// around loads the anchor message with up to limit-1 neighbours split evenly
+// between older and newer history
+func (s *MessageService) around(ctx context.Context, channelID, messageID models.UUIDv7, limit int) (*MessageWindow, error) {
+	anchor, err := s.stores.Messages.GetInChannel(ctx, messageID, channelID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Message not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if anchor.ThreadID != nil && !anchor.AlsoSentToChannel {
+		if anchor, err = s.stores.Messages.GetInChannel(ctx, *anchor.ThreadID, channelID); err != nil {
+			return nil, err
+		}
+	}
+
+	author, err := s.stores.Users.GetByID(ctx, anchor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	anchor.User = *author
+
+	olderLimit := (limit - 1) / 2
+	newerLimit := limit - 1 - olderLimit
+
+	older, err := s.stores.Messages.ListTopLevelBefore(ctx, channelID, &anchor.ID, olderLimit+1)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := s.stores.Messages.ListTopLevelAfter(ctx, channelID, anchor.ID, newerLimit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := reverse(truncate(older, olderLimit))
+	messages = append(messages, *anchor)
+	messages = append(messages, truncate(newer, newerLimit)...)
+
+	return &MessageWindow{
+		Messages: messages,
+		HasOlder: len(older) > olderLimit,
+		HasNewer: len(newer) > newerLimit,
+		Anchor:   &anchor.ID,
+	}, nil
+}
+
+// ListReplies returns a page of replies to a thread, oldest first
+func (s *MessageService) ListReplies(ctx context.Context, actor Actor, channelID, threadID models.UUIDv7, limit, offset int) ([]models.Message, error) {
+	channel, err := s.channels.AuthorizeRead(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.stores.Messages.GetInChannel(ctx, threadID, channel.ID); errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Thread not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.stores.Messages.ListReplies(ctx, threadID, limit, offset)
+}
+
+// Recent returns the latest timeline messages across the actor's channels,
+// leaving out the channels they muted
+func (s *MessageService) Recent(ctx context.Context, actor Actor) ([]models.Message, error) {
+	joined, err := s.stores.Members.ListChannelIDs(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	muted, err := mutedChannels(ctx, s.stores, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	channelIDs := make([]models.UUIDv7, 0, len(joined))
+	for _, id := range joined {
+		if !muted[id] {
+			channelIDs = append(channelIDs, id)
+		}
+	}
+	if len(channelIDs) == 0 {
+		return []models.Message{}, nil
+	}
+
+	return s.stores.Messages.ListRecent(ctx, channelIDs, time.Now().Add(-recentMessagesWindow), recentMessagesLimit)
+}
+
+func truncate(messages []models.Message, limit int) []models.Message {
+	if len(messages) > limit {
+		return messages[:limit]
+	}
+	return messages
+}
+
+func reverse(messages []models.Message) []models.Message {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	// Timezones must resolve on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+const (
+	// notificationListLimit caps the size of the notification inbox response
+	notificationListLimit = 100
+	// maxKeywords bounds how many keyword alerts a user may set
+	maxKeywords = 20
+	// maxSnooze bounds how long notifications may be snoozed
+	maxSnooze = 7 * 24 * time.Hour
+	// clockLayout is the format of Do Not Disturb times of day
+	clockLayout = "15:04"
+)
+
+// NotificationSettingsUpdate holds the settings to change. A zero Snooze ends
+// an active snooze.
+type NotificationSettingsUpdate struct {
+	Keywords   *[]string
+	Timezone   *string
+	DNDEnabled *bool
+	DNDStart   *string
+	DNDEnd     *string
+	Snooze     *time.Duration
+	// MentionEmails and Digest turn mention emails and the daily digest on or off
+	MentionEmails *bool
+	Digest        *bool
+}
+
+type NotificationService struct {
+	stores   *store.Stores
+	channels *ChannelService
+}
+
+func NewNotificationService(stores *store.Stores, channels *ChannelService) *NotificationService {
+	return &NotificationService{stores: stores, channels: channels}
+}
+
+// List returns the actor's most recent notifications
+func (s *NotificationService) List(ctx context.Context, actor Actor) ([]models.Notification, error) {
+	return s.stores.Notifications.List(ctx, actor.UserID, notificationListLimit)
+}
+
+// UnreadCount counts all of the actor's unread notifications
+func (s *NotificationService) UnreadCount(ctx context.Context, actor Actor) (int64, error) {
+	return s.stores.Notifications.CountUnread(ctx, actor.UserID)
+}
+
+// MarkRead marks one of the actor's notifications as read
+func (s *NotificationService) MarkRead(ctx context.Context, actor Actor, id models.UUIDv7) error {
+	err := s.stores.Notifications.MarkRead(ctx, id, actor.UserID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Notification not found")
+	}
+	return err
+}
+
+// MarkAllRead marks every notification of the actor as read
+func (s *NotificationService) MarkAllRead(ctx context.Context, actor Actor) error {
+	return s.stores.Notifications.MarkAllRead(ctx, actor.UserID, time.Now())
+}
+
+// Settings returns the actor's notification settings, or the defaults
+func (s *NotificationService) Settings(ctx context.Context, actor Actor) (*models.NotificationSettings, error) {
+	return loadSettings(ctx, s.stores, actor.UserID)
+}
+
+// loadSettings returns a user's notification settings, or unsaved defaults
+func loadSettings(ctx context.Context, stores *store.Stores, userID models.UUIDv7) (*models.NotificationSettings, error) {
+	settings, err := stores.Preferences.GetSettings(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &models.NotificationSettings{UserID: userID, Timezone: "UTC", Keywords: []string{}}, nil
+	}
+	return settings, err
+}
+
+// mutedChannels returns the channels a user has muted, which are left out of
+// their recent activity and unread counts
+func mutedChannels(ctx context.Context, stores *store.Stores, userID models.UUIDv7) (map[models.UUIDv7]bool, error) {
+	preferences, err := stores.Preferences.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	muted := make(map[models.UUIDv7]bool)
+	for _, preference := range preferences {
+		if preference.Level == models.NotificationLevelMuted {
+			muted[preference.ChannelID] = true
+		}
+	}
+	return muted, nil
+}
+
+// UpdateSettings validates and saves changes to the actor's settings
+func (s *NotificationService) UpdateSettings(ctx context.Context, actor Actor, update NotificationSettingsUpdate, now time.Time) (*models.NotificationSettings, error) {
+	settings, err := s.Settings(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Keywords != nil {
+		if settings.Keywords, err = normalizeKeywords(*update.Keywords); err != nil {
+			return nil, err
+		}
+	}
+	if update.Timezone != nil {
+		if _, err := time.LoadLocation(*update.Timezone); err != nil || *update.Timezone == "" || *update.Timezone == "Local" {
+			return nil, newError(ErrInvalid, "Unknown timezone")
+		}
+		settings.Timezone = *update.Timezone
+	}
+	if update.DNDStart != nil {
+		settings.DNDStart = *update.DNDStart
+	}
+	if update.DNDEnd != nil {
+		settings.DNDEnd = *update.DNDEnd
+	}
+	if update.DNDEnabled != nil {
+		settings.DNDEnabled = *update.DNDEnabled
+	}
+	if settings.DNDEnabled {
+		if _, err := time.Parse(clockLayout, settings.DNDStart); err != nil {
+			return nil, newError(ErrInvalid, "Do Not Disturb start must be a time such as 22:00")
+		}
+		if _, err := time.Parse(clockLayout, settings.DNDEnd); err != nil {
+			return nil, newError(ErrInvalid, "Do Not Disturb end must be a time such as 08:00")
+		}
+	}
+	if update.Snooze != nil {
+		switch {
+		case *update.Snooze == 0:
+			settings.SnoozeUntil = nil
+		case *update.Snooze < 0 || *update.Snooze > maxSnooze:
+			return nil, newError(ErrInvalid, "Snooze must be between 1 minute and 7 days")
+		default:
+			until := now.Add(*update.Snooze).UTC()
+			settings.SnoozeUntil = &until
+		}
+	}
+
+	if update.MentionEmails != nil {
+		settings.MentionEmailsDisabled = !*update.MentionEmails
+	}
+	if update.Digest != nil {
+		settings.DigestEnabled = *update.Digest
+	}
+
+	if err := s.stores.Preferences.SaveSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// ChannelLevel returns the actor's notification level for a channel they belong to
+func (s *NotificationService) ChannelLevel(ctx context.Context, actor Actor, channelID models.UUIDv7) (models.NotificationLevel, error) {
+	if _, err := s.channels.AuthorizeRead(ctx, actor, channelID); err != nil {
+		return "", err
+	}
+
+	preference, err := s.stores.Preferences.GetChannel(ctx, channelID, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.DefaultNotificationLevel, nil
+	} else if err != nil {
+		return "", err
+	}
+	return preference.Level, nil
+}
+
+// SetChannelLevel changes the actor's notification level for a channel they belong to
+func (s *NotificationService) SetChannelLevel(ctx context.Context, actor Actor, channelID models.UUIDv7, level models.NotificationLevel) error {
+	if _, err := s.channels.AuthorizeRead(ctx, actor, channelID); err != nil {
+		return err
+	}
+
+	preference, err := s.stores.Preferences.GetChannel(ctx, channelID, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		preference = &models.ChannelNotificationPreference{ChannelID: channelID, UserID: actor.UserID}
+	} else if err != nil {
+		return err
+	}
+
+	preference.Level = level
+	return s.stores.Preferences.SaveChannel(ctx, preference)
+}
+
+// normalizeKeywords lowercases, trims and de-duplicates keyword alerts
+func normalizeKeywords(keywords []string) ([]string, error) {
+	normalized := make([]string, 0, len(keywords))
+	seen := make(map[string]bool, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		normalized = append(normalized, keyword)
+	}
+	if len(normalized) > maxKeywords {
+		return nil, newError(ErrInvalid, "At most 20 keywords are allowed")
+	}
+	return normalized, nil
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"turnate/internal/models"
+)
+
+// notificationExcerptLength bounds how much of a message is quoted in a notification
+const notificationExcerptLength = 200
+
+// mentionPattern needs the @ at the start or after a non-word character, so
+// email addresses are not mentions
+var mentionPattern = regexp.MustCompile(`(?:^|\W)@([A-Za-z0-9_]+)`)
+
+// MessagePosted notifies the members of the message's channel according to
+// their preferences. In order of precedence a member is notified about
+// mentions of their username, mentions of a group they belong to, keyword alerts, replies in threads they follow
+// and, at level "all", every message in the channel timeline. Channels at
+// level "none" or "muted" never notify. Notifications that arrive during Do
+// Not Disturb are stored quietly.
+func (s *NotificationService) MessagePosted(ctx context.Context, message models.Message) error {
+	if message.Type == models.MessageTypeSystem {
+		return nil
+	}
+
+	channel, err := s.stores.Channels.GetByID(ctx, message.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	members, err := s.stores.Members.ListMembers(ctx, channel.ID)
+	if err != nil {
+		return err
+	}
+
+	preferences, err := s.stores.Preferences.ListByChannel(ctx, channel.ID)
+	if err != nil {
+		return err
+	}
+	levels := make(map[models.UUIDv7]models.NotificationLevel, len(preferences))
+	for _, preference := range preferences {
+		levels[preference.UserID] = preference.Level
+	}
+
+	followers := make(map[models.UUIDv7]bool)
+	if message.ThreadID != nil {
+		followerIDs, err := s.stores.ThreadFollows.ListFollowers(ctx, *message.ThreadID)
+		if err != nil {
+			return err
+		}
+		for _, id := range followerIDs {
+			followers[id] = true
+		}
+	}
+
+	recipients := make([]models.User, 0, len(members))
+	recipientIDs := make([]models.UUIDv7, 0, len(members))
+	for _, member := range members {
+		level, ok := levels[member.ID]
+		if !ok {
+			level = models.DefaultNotificationLevel
+		}
+		if member.ID == message.UserID || !member.IsActive || level == models.NotificationLevelNone || level == models.NotificationLevelMuted {
+			continue
+		}
+		recipients = append(recipients, member)
+		recipientIDs = append(recipientIDs, member.ID)
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	allSettings, err := s.stores.Preferences.ListSettings(ctx, recipientIDs)
+	if err != nil {
+		return err
+	}
+	settingsByUser := make(map[models.UUIDv7]models.NotificationSettings, len(allSettings))
+	for _, settings := range allSettings {
+		settingsByUser[settings.UserID] = settings
+	}
+
+	mentioned := mentionedUsernames(message.Content)
+	groupMentions, err := s.mentionedGroups(ctx, mentioned)
+	if err != nil {
+		return err
+	}
+	keywords := newKeywordMatcher(message.Content)
+	onTimeline := message.ThreadID == nil || message.AlsoSentToChannel
+	now := time.Now()
+	author := message.User.Username
+
+	var notifications []models.Notification
+	for _, recipient := range recipients {
+		settings := settingsByUser[recipient.ID]
+		level, ok := levels[recipient.ID]
+		if !ok {
+			level = models.DefaultNotificationLevel
+		}
+
+		var kind models.NotificationKind
+		var title string
+		if mentioned[strings.ToLower(recipient.Username)] {
+			kind, title = models.NotificationKindMention, fmt.Sprintf("@%s mentioned you in #%s", author, channel.Name)
+		} else if handle, ok := groupMentions[recipient.ID]; ok {
+			kind, title = models.NotificationKindMention, fmt.Sprintf("@%s mentioned @%s in #%s", author, handle, channel.Name)
+		} else if keyword := keywords.match(settings.Keywords); keyword != "" {
+			kind, title = models.NotificationKindKeyword, fmt.Sprintf("%q mentioned in #%s", keyword, channel.Name)
+		} else if followers[recipient.ID] {
+			kind, title = models.NotificationKindThreadReply, fmt.Sprintf("%s replied to a thread in #%s", author, channel.Name)
+		} else if level == models.NotificationLevelAll && onTimeline {
+			kind, title = models.NotificationKindMessage, fmt.Sprintf("New message from %s in #%s", author, channel.Name)
+		} else {
+			continue
+		}
+
+		channelID, messageID := channel.ID, message.ID
+		notifications = append(notifications, models.Notification{
+			UserID:    recipient.ID,
+			Kind:      kind,
+			Title:     title,
+			Body:      excerpt(message.Content, notificationExcerptLength),
+			ChannelID: &channelID,
+			MessageID: &messageID,
+			Quiet:     inDoNotDisturb(settings, now),
+		})
+	}
+
+	return s.stores.Notifications.CreateMany(ctx, notifications)
+}
+
+// mentionedUsernames returns the lowercased usernames @-mentioned in content
+func mentionedUsernames(content string) map[string]bool {
+	mentioned := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		mentioned[strings.ToLower(match[1])] = true
+	}
+	return mentioned
+}
+
+// mentionedGroups resolves the mentioned names that are group handles and
+// returns, per member of those groups, the handle of the first such group
+func (s *NotificationService) mentionedGroups(ctx context.Context, mentioned map[string]bool) (map[models.UUIDv7]string, error) {
+	handles := make([]string, 0, len(mentioned))
+	for name := range mentioned {
+		handles = append(handles, name)
+	}
+	groups, err := s.stores.Groups.ListByHandles(ctx, handles)
+	if err != nil || len(groups) == 0 {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Handle < groups[j].Handle })
+
+	groupIDs := make([]models.UUIDv7, len(groups))
+	for i, group := range groups {
+		groupIDs[i] = group.ID
+	}
+	memberIDs, err := s.stores.Groups.ListMemberIDs(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	handlesByUser := make(map[models.UUIDv7]string)
+	for _, group := range groups {
+		for _, userID := range memberIDs[group.ID] {
+			if _, ok := handlesByUser[userID]; !ok {
+				handlesByUser[userID] = group.Handle
+			}
+		}
+	}
+	return handlesByUser, nil
+}
+
+// keywordMatcher finds keyword alerts in one message. The content is
+// lowercased once and shared by every recipient, and keywords are found by
+// plain substring search rather than a regular expression each.
+type keywordMatcher struct {
+	content string
+}
+
+func newKeywordMatcher(content string) keywordMatcher {
+	return keywordMatcher{content: strings.ToLower(content)}
+}
+
+// match returns the first keyword that appears in the content as a whole
+// word, ignoring case
+func (m keywordMatcher) match(keywords []string) string {
+	for _, keyword := range keywords {
+		if m.containsWord(strings.ToLower(keyword)) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+func (m keywordMatcher) containsWord(word string) bool {
+	if word == "" {
+		return false
+	}
+	for offset := 0; ; {
+		i := strings.Index(m.content[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		if !isWordByte(m.content, start-1) && !isWordByte(m.content, start+len(word)) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// isWordByte reports whether s has a word character, as \w matches it, at i
+func isWordByte(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	b := s[i]
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// inDoNotDisturb reports whether now falls in the user's snooze or daily Do
+// Not Disturb window, evaluated in their timezone
+func inDoNotDisturb(settings models.NotificationSettings, now time.Time) bool {
+	if settings.SnoozeUntil != nil && now.Before(*settings.SnoozeUntil) {
+		return true
+	}
+	if !settings.DNDEnabled {
+		return false
+	}
+
+	start, err := time.Parse(clockLayout, settings.DNDStart)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(clockLayout, settings.DNDEnd)
+	if err != nil {
+		return false
+	}
+
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	// The window wraps past midnight
+	return minute >= from || minute < to
+}
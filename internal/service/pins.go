@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// pinExcerptLength bounds how much of a pinned message is quoted in the announcement
+const pinExcerptLength = 80
+
+// Pins returns the pinned messages of a channel, most recently pinned first
+func (s *MessageService) Pins(ctx context.Context, actor Actor, channelID models.UUIDv7) ([]models.Message, error) {
+	if _, err := s.channels.AuthorizeRead(ctx, actor, channelID); err != nil {
+		return nil, err
+	}
+	return s.stores.Messages.ListPinned(ctx, channelID)
+}
+
+// Pin pins a message and announces it in the channel
+func (s *MessageService) Pin(ctx context.Context, actor Actor, channelID, messageID models.UUIDv7) error {
+	message, err := s.pinTarget(ctx, actor, channelID, messageID)
+	if err != nil {
+		return err
+	}
+	if message.PinnedAt != nil {
+		return newError(ErrConflict, "Message is already pinned")
+	}
+
+	now := time.Now()
+	if err := s.stores.Messages.SetPinned(ctx, message.ID, &actor.UserID, &now); err != nil {
+		return err
+	}
+	return s.announce(ctx, actor, channelID, "pinned", message)
+}
+
+// Unpin removes a pin and announces it in the channel
+func (s *MessageService) Unpin(ctx context.Context, actor Actor, channelID, messageID models.UUIDv7) error {
+	message, err := s.pinTarget(ctx, actor, channelID, messageID)
+	if err != nil {
+		return err
+	}
+	if message.PinnedAt == nil {
+		return newError(ErrNotFound, "Message is not pinned")
+	}
+
+	if err := s.stores.Messages.SetPinned(ctx, message.ID, nil, nil); err != nil {
+		return err
+	}
+	return s.announce(ctx, actor, channelID, "unpinned", message)
+}
+
+func (s *MessageService) pinTarget(ctx context.Context, actor Actor, channelID, messageID models.UUIDv7) (*models.Message, error) {
+	channel, err := s.channels.AuthorizePin(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.stores.Messages.GetInChannel(ctx, messageID, channel.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Message not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if message.Type == models.MessageTypeSystem {
+		return nil, newError(ErrInvalid, "System messages cannot be pinned")
+	}
+	return message, nil
+}
+
+// announce posts a system message describing a pin change
+func (s *MessageService) announce(ctx context.Context, actor Actor, channelID models.UUIDv7, action string, target *models.Message) error {
+	author, err := s.stores.Users.GetByID(ctx, actor.UserID)
+	if err != nil {
+		return err
+	}
+
+	return s.stores.Messages.Create(ctx, &models.Message{
+		Content:   fmt.Sprintf("📌 %s %s a message: %s", author.DisplayName, action, excerpt(target.Content, pinExcerptLength)),
+		UserID:    actor.UserID,
+		ChannelID: channelID,
+		Type:      models.MessageTypeSystem,
+	})
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/push"
+	"turnate/internal/store"
+)
+
+const (
+	// pushBatchLimit bounds how many notifications one push run handles
+	pushBatchLimit = 500
+	// pushMaxAge is how old a notification may get before it is no longer
+	// worth pushing, for example after downtime
+	pushMaxAge = time.Hour
+	// pushTTL is how long push services hold a message for an offline browser
+	pushTTL = 24 * time.Hour
+	// pushExcerptLength keeps payloads well under the push size limit
+	pushExcerptLength = 500
+)
+
+// PushSubscriptionInput is a browser subscription as returned by PushManager.subscribe
+type PushSubscriptionInput struct {
+	Endpoint  string
+	P256dh    string
+	Auth      string
+	UserAgent string
+}
+
+// PushService registers browsers for Web Push and delivers notifications to
+// them in the background
+type PushService struct {
+	stores *store.Stores
+	client *push.Client
+}
+
+func NewPushService(stores *store.Stores, client *push.Client) *PushService {
+	return &PushService{stores: stores, client: client}
+}
+
+// LoadPushKeys returns the configured VAPID keys, or else the key pair stored
+// in the database, generating one on first use
+func LoadPushKeys(ctx context.Context, stores *store.Stores, configured push.Keys) (push.Keys, error) {
+	if configured.PublicKey != "" || configured.PrivateKey != "" {
+		return configured, nil
+	}
+
+	key, err := stores.Push.ServerKey(ctx)
+	if errors.Is(err, store.ErrNotFound) {
+		generated, err := push.GenerateKeys()
+		if err != nil {
+			return push.Keys{}, err
+		}
+		key, err = stores.Push.CreateServerKey(ctx, &models.PushServerKey{PublicKey: generated.PublicKey, PrivateKey: generated.PrivateKey})
+		if err != nil {
+			return push.Keys{}, err
+		}
+	} else if err != nil {
+		return push.Keys{}, err
+	}
+	return push.Keys{PublicKey: key.PublicKey, PrivateKey: key.PrivateKey}, nil
+}
+
+// PublicKey is the application server key browsers subscribe with
+func (s *PushService) PublicKey() string {
+	return s.client.PublicKey()
+}
+
+// Subscribe registers the actor's browser for the login session, replacing
+// the session's previous subscription
+func (s *PushService) Subscribe(ctx context.Context, actor Actor, sessionID string, input PushSubscriptionInput) (*models.PushSubscription, error) {
+	if err := (push.Subscription{Endpoint: input.Endpoint, P256dh: input.P256dh, Auth: input.Auth}).Validate(); err != nil {
+		return nil, newError(ErrInvalid, "Invalid push subscription: "+err.Error())
+	}
+
+	subscription := &models.PushSubscription{
+		UserID:    actor.UserID,
+		SessionID: sessionID,
+		Endpoint:  input.Endpoint,
+		P256dh:    input.P256dh,
+		Auth:      input.Auth,
+		UserAgent: excerpt(input.UserAgent, 250),
+	}
+	if err := s.stores.Push.Save(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// List returns the actor's registered browsers
+func (s *PushService) List(ctx context.Context, actor Actor) ([]models.PushSubscription, error) {
+	return s.stores.Push.ListByUsers(ctx, []models.UUIDv7{actor.UserID})
+}
+
+// Unsubscribe removes one of the actor's browsers
+func (s *PushService) Unsubscribe(ctx context.Context, actor Actor, id models.UUIDv7) error {
+	subscription, err := s.stores.Push.GetForUser(ctx, id, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Push subscription not found")
+	} else if err != nil {
+		return err
+	}
+	return s.stores.Push.Delete(ctx, subscription)
+}
+
+type pushPayload struct {
+	ID        string  `json:"id"`
+	Kind      string  `json:"kind"`
+	Title     string  `json:"title"`
+	Body      string  `json:"body"`
+	ChannelID *string `json:"channel_id,omitempty"`
+	MessageID *string `json:"message_id,omitempty"`
+}
+
+// DeliverPending pushes recent notifications to every browser of their user.
+// Quiet notifications are never pushed. Subscriptions the push service
+// reports gone are deleted; other failures are not retried, so a flaky
+// browser cannot hold up the queue. It returns the number of messages pushed.
+func (s *PushService) DeliverPending(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.stores.Notifications.ListPushDue(ctx, now.Add(-pushMaxAge), pushBatchLimit)
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	ids := make([]models.UUIDv7, len(due))
+	seen := make(map[models.UUIDv7]bool)
+	var userIDs []models.UUIDv7
+	for i, notification := range due {
+		ids[i] = notification.ID
+		if !seen[notification.UserID] {
+			seen[notification.UserID] = true
+			userIDs = append(userIDs, notification.UserID)
+		}
+	}
+
+	subscriptions, err := s.stores.Push.ListByUsers(ctx, userIDs)
+	if err != nil {
+		return 0, err
+	}
+	byUser := make(map[models.UUIDv7][]models.PushSubscription)
+	for _, subscription := range subscriptions {
+		byUser[subscription.UserID] = append(byUser[subscription.UserID], subscription)
+	}
+
+	pushed := 0
+	gone := make(map[string]bool)
+	var errs []error
+	for _, notification := range due {
+		payload, err := json.Marshal(newPushPayload(notification))
+		if err != nil {
+			return pushed, err
+		}
+
+		for _, subscription := range byUser[notification.UserID] {
+			if gone[subscription.Endpoint] {
+				continue
+			}
+			err := s.client.Send(ctx, push.Subscription{Endpoint: subscription.Endpoint, P256dh: subscription.P256dh, Auth: subscription.Auth}, payload, pushTTL)
+			switch {
+			case errors.Is(err, push.ErrGone):
+				gone[subscription.Endpoint] = true
+				if err := s.stores.Push.DeleteByEndpoint(ctx, subscription.Endpoint); err != nil {
+					errs = append(errs, err)
+				}
+			case err != nil:
+				errs = append(errs, err)
+			default:
+				pushed++
+			}
+		}
+	}
+
+	if err := s.stores.Notifications.MarkPushed(ctx, ids, now); err != nil {
+		return pushed, err
+	}
+	return pushed, errors.Join(errs...)
+}
+
+func newPushPayload(notification models.Notification) pushPayload {
+	payload := pushPayload{
+		ID:    notification.ID.String(),
+		Kind:  string(notification.Kind),
+		Title: notification.Title,
+		Body:  excerpt(notification.Body, pushExcerptLength),
+	}
+	if notification.ChannelID != nil {
+		channelID := notification.ChannelID.String()
+		payload.ChannelID = &channelID
+	}
+	if notification.MessageID != nil {
+		messageID := notification.MessageID.String()
+		payload.MessageID = &messageID
+	}
+	return payload
+}
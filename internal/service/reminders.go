@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+const (
+	// maxReminderHorizon bounds how far ahead a reminder may be set
+	maxReminderHorizon = 365 * 24 * time.Hour
+	// reminderBatchSize is how many due reminders are delivered per query
+	reminderBatchSize = 100
+	// reminderExcerptLength bounds how much of a message is quoted in the notification
+	reminderExcerptLength = 200
+)
+
+type ReminderService struct {
+	stores   *store.Stores
+	channels *ChannelService
+}
+
+func NewReminderService(stores *store.Stores, channels *ChannelService) *ReminderService {
+	return &ReminderService{stores: stores, channels: channels}
+}
+
+// Create schedules a reminder about a message the actor can read, free text, or both.
+// when is parsed with ParseReminderTime relative to now, in the actor's timezone.
+func (s *ReminderService) Create(ctx context.Context, actor Actor, messageID *models.UUIDv7, text, when string, now time.Time) (*models.Reminder, error) {
+	if messageID == nil && text == "" {
+		return nil, newError(ErrInvalid, "A message or text is required")
+	}
+
+	local, err := userNow(ctx, s.stores, actor.UserID, now)
+	if err != nil {
+		return nil, err
+	}
+	remindAt, err := ParseReminderTime(when, local)
+	if err != nil {
+		return nil, newError(ErrInvalid, "Could not understand the reminder time")
+	}
+	if !remindAt.After(now) {
+		return nil, newError(ErrInvalid, "Reminder time must be in the future")
+	}
+	if remindAt.Sub(now) > maxReminderHorizon {
+		return nil, newError(ErrInvalid, "Reminder time must be within a year")
+	}
+
+	if messageID != nil {
+		if _, err := readableMessage(ctx, s.stores, s.channels, actor, *messageID); err != nil {
+			return nil, err
+		}
+	}
+
+	reminder := &models.Reminder{
+		UserID:    actor.UserID,
+		MessageID: messageID,
+		Text:      text,
+		RemindAt:  remindAt.UTC(),
+	}
+	if err := s.stores.Reminders.Create(ctx, reminder); err != nil {
+		return nil, err
+	}
+	return reminder, nil
+}
+
+// List returns the actor's pending reminders, soonest first
+func (s *ReminderService) List(ctx context.Context, actor Actor) ([]models.Reminder, error) {
+	return s.stores.Reminders.ListPending(ctx, actor.UserID)
+}
+
+// Cancel deletes one of the actor's reminders
+func (s *ReminderService) Cancel(ctx context.Context, actor Actor, id models.UUIDv7) error {
+	reminder, err := s.stores.Reminders.GetForUser(ctx, id, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Reminder not found")
+	} else if err != nil {
+		return err
+	}
+	return s.stores.Reminders.Delete(ctx, reminder)
+}
+
+// DeliverDue turns every reminder due at now into a notification. It is run by
+// the scheduler and returns how many reminders were delivered. Messages are
+// only quoted if the user can still read them.
+func (s *ReminderService) DeliverDue(ctx context.Context, now time.Time) (int, error) {
+	delivered := 0
+	for {
+		due, err := s.stores.Reminders.ListDue(ctx, now, reminderBatchSize)
+		if err != nil {
+			return delivered, err
+		}
+
+		for i := range due {
+			if due[i].Message != nil {
+				if readable, err := s.canStillRead(ctx, due[i].UserID, due[i].Message.ChannelID); err != nil {
+					return delivered, err
+				} else if !readable {
+					due[i].Message = nil
+				}
+			}
+			ok, err := s.stores.Reminders.Deliver(ctx, &due[i], reminderNotification(due[i]))
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				delivered++
+			}
+		}
+
+		if len(due) < reminderBatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+// canStillRead reports whether the user may still read the channel, which
+// they may have left or been removed from since setting the reminder
+func (s *ReminderService) canStillRead(ctx context.Context, userID, channelID models.UUIDv7) (bool, error) {
+	user, err := s.stores.Users.GetByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = s.channels.AuthorizeRead(ctx, Actor{UserID: user.ID, Role: user.Role}, channelID)
+	if errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func reminderNotification(reminder models.Reminder) *models.Notification {
+	notification := &models.Notification{
+		UserID:    reminder.UserID,
+		Kind:      models.NotificationKindReminder,
+		Title:     "Reminder",
+		Body:      reminder.Text,
+		MessageID: reminder.MessageID,
+	}
+
+	if reminder.Message != nil {
+		channelID := reminder.Message.ChannelID
+		notification.ChannelID = &channelID
+		if notification.Body == "" {
+			notification.Body = excerpt(reminder.Message.Content, reminderExcerptLength)
+		}
+	} else if notification.Body == "" {
+		notification.Body = "A message you asked to be reminded about is no longer available"
+	}
+
+	return notification
+}
+
+// readableMessage loads a message from a channel whose history the actor may read
+func readableMessage(ctx context.Context, stores *store.Stores, channels *ChannelService, actor Actor, messageID models.UUIDv7) (*models.Message, error) {
+	message, err := stores.Messages.GetByID(ctx, messageID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Message not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err := channels.AuthorizeRead(ctx, actor, message.ChannelID); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// excerpt shortens text to at most limit runes, marking the cut with an ellipsis
+func excerpt(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// defaultReminderHour is used for "tomorrow" and weekdays when no time of day is given
+const defaultReminderHour = 9
+
+var (
+	relativeTimePattern = regexp.MustCompile(`^in\s+(\d+|an?)\s*(m|mins?|minutes?|h|hrs?|hours?|d|days?|w|weeks?)$`)
+	clockTimePattern    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	weekdayPattern      = regexp.MustCompile(`^(?:on\s+|next\s+)?([a-z]+)(?:\s+at\s+(.+))?$`)
+)
+
+// ParseReminderTime understands RFC 3339 timestamps and a few natural forms:
+// "in 2 hours", "in a day", "tomorrow", "tomorrow at 3pm", "at 17:30",
+// "monday" and "friday at 4pm". Times of day are interpreted in now's
+// location; "at" rolls over to the next day and a weekday to the next week
+// once the time has passed.
+func ParseReminderTime(input string, now time.Time) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	if t, err := time.Parse(time.RFC3339, input); err == nil {
+		return t, nil
+	}
+	input = strings.ToLower(input)
+
+	if match := relativeTimePattern.FindStringSubmatch(input); match != nil {
+		amount := 1
+		if match[1] != "a" && match[1] != "an" {
+			amount, _ = strconv.Atoi(match[1])
+		}
+
+		var unit time.Duration
+		switch match[2][0] {
+		case 'm':
+			unit = time.Minute
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		}
+		return now.Add(time.Duration(amount) * unit), nil
+	}
+
+	if input == "tomorrow" {
+		return atClock(now.AddDate(0, 0, 1), defaultReminderHour, 0), nil
+	}
+
+	if rest, ok := strings.CutPrefix(input, "tomorrow at "); ok {
+		hour, minute, err := parseClock(rest)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return atClock(now.AddDate(0, 0, 1), hour, minute), nil
+	}
+
+	if rest, ok := strings.CutPrefix(input, "at "); ok {
+		hour, minute, err := parseClock(rest)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t := atClock(now, hour, minute)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	if match := weekdayPattern.FindStringSubmatch(input); match != nil {
+		weekday, ok := parseWeekday(match[1])
+		if !ok {
+			return time.Time{}, fmt.Errorf("unrecognised time %q", input)
+		}
+
+		hour, minute := defaultReminderHour, 0
+		if match[2] != "" {
+			var err error
+			if hour, minute, err = parseClock(match[2]); err != nil {
+				return time.Time{}, err
+			}
+		}
+		days := (int(weekday) - int(now.Weekday()) + 7) % 7
+		t := atClock(now.AddDate(0, 0, days), hour, minute)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 7)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised time %q", input)
+}
+
+// parseWeekday accepts a weekday's full name or an abbreviation of at least
+// three letters, such as "mon" or "thurs"
+func parseWeekday(name string) (time.Weekday, bool) {
+	if len(name) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// userNow returns now in the timezone from the user's settings, so that times
+// of day typed by the user mean their local time
+func userNow(ctx context.Context, stores *store.Stores, userID models.UUIDv7, now time.Time) (time.Time, error) {
+	settings, err := loadSettings(ctx, stores, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	return now.In(location), nil
+}
+
+func parseClock(input string) (int, int, error) {
+	match := clockTimePattern.FindStringSubmatch(strings.TrimSpace(input))
+	if match == nil {
+		return 0, 0, fmt.Errorf("unrecognised time of day %q", input)
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+
+	switch match[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid hour %d", hour)
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	}
+
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time of day %q", input)
+	}
+	return hour, minute, nil
+}
+
+func atClock(day time.Time, hour, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// RetentionExceptions are the channels and users that differ from the
+// workspace retention default
+type RetentionExceptions struct {
+	// Channels have a retention period of their own or are on legal hold
+	Channels []models.Channel
+	// Users are on legal hold
+	Users []models.User
+}
+
+// RetentionService manages per-channel retention periods and legal holds,
+// which are admin-only. The purge itself lives in the retention package.
+type RetentionService struct {
+	stores *store.Stores
+}
+
+func NewRetentionService(stores *store.Stores) *RetentionService {
+	return &RetentionService{stores: stores}
+}
+
+// Exceptions returns the channels by name and the users by username
+func (s *RetentionService) Exceptions(ctx context.Context, actor Actor) (*RetentionExceptions, error) {
+	if !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can manage retention")
+	}
+
+	channels, err := s.stores.Retention.ListChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.stores.Retention.ListUserHolds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &RetentionExceptions{Channels: channels, Users: users}, nil
+}
+
+// SetChannel sets a channel's retention period, with nil for the workspace
+// default and 0 to keep its messages forever. A nil legalHold leaves the
+// channel's hold as it is.
+func (s *RetentionService) SetChannel(ctx context.Context, actor Actor, channelID models.UUIDv7, days *int, legalHold *bool) (*models.Channel, error) {
+	if !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can manage retention")
+	}
+	if days != nil && *days < 0 {
+		return nil, newError(ErrInvalid, "Retention days must not be negative")
+	}
+
+	channel, err := s.stores.Channels.GetByID(ctx, channelID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Channel not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	channel.RetentionDays = days
+	if legalHold != nil {
+		channel.LegalHold = *legalHold
+	}
+	if err := s.stores.Retention.SetChannel(ctx, channel.ID, channel.RetentionDays, channel.LegalHold); err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// SetUserHold puts a user on legal hold or releases them
+func (s *RetentionService) SetUserHold(ctx context.Context, actor Actor, userID models.UUIDv7, legalHold bool) (*models.User, error) {
+	if !actor.IsAdmin() {
+		return nil, newError(ErrForbidden, "Only admins can manage legal holds")
+	}
+
+	user, err := s.stores.Users.GetByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "User not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.stores.Retention.SetUserHold(ctx, user.ID, legalHold); err != nil {
+		return nil, err
+	}
+	user.LegalHold = legalHold
+	return user, nil
+}
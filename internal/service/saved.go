@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+type SavedService struct {
+	stores   *store.Stores
+	channels *ChannelService
+}
+
+func NewSavedService(stores *store.Stores, channels *ChannelService) *SavedService {
+	return &SavedService{stores: stores, channels: channels}
+}
+
+// Save adds a message the actor can read to their saved items
+func (s *SavedService) Save(ctx context.Context, actor Actor, messageID models.UUIDv7) (*models.SavedItem, error) {
+	message, err := readableMessage(ctx, s.stores, s.channels, actor, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.stores.SavedItems.Get(ctx, actor.UserID, message.ID); err == nil {
+		return nil, newError(ErrConflict, "Message is already saved")
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	item := &models.SavedItem{UserID: actor.UserID, MessageID: message.ID}
+	if err := s.stores.SavedItems.Create(ctx, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Unsave removes a message from the actor's saved items
+func (s *SavedService) Unsave(ctx context.Context, actor Actor, messageID models.UUIDv7) error {
+	item, err := s.stores.SavedItems.Get(ctx, actor.UserID, messageID)
+	if errors.Is(err, store.ErrNotFound) {
+		return newError(ErrNotFound, "Message is not saved")
+	} else if err != nil {
+		return err
+	}
+	return s.stores.SavedItems.Delete(ctx, item)
+}
+
+// List returns the actor's saved items, newest first. Items whose message was
+// deleted, or whose channel the actor has since left, are left out.
+func (s *SavedService) List(ctx context.Context, actor Actor) ([]models.SavedItem, error) {
+	items, err := s.stores.SavedItems.List(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	channelIDs, err := s.stores.Members.ListChannelIDs(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	joined := make(map[models.UUIDv7]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		joined[id] = true
+	}
+
+	visible := make([]models.SavedItem, 0, len(items))
+	for _, item := range items {
+		if item.Message.ID.IsZero() {
+			continue
+		}
+		if joined[item.Message.ChannelID] || actor.IsAdmin() {
+			visible = append(visible, item)
+		}
+	}
+	return visible, nil
+}
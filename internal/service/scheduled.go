@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"turnate/internal/logging"
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+const (
+	// maxScheduleHorizon bounds how far ahead a message may be scheduled
+	maxScheduleHorizon = 365 * 24 * time.Hour
+	// maxPendingScheduled bounds how many messages one user may have queued
+	maxPendingScheduled = 100
+	// scheduledBatchSize is how many due messages are sent per query
+	scheduledBatchSize = 100
+	// sendingLease is how long a claimed message may stay in sending before it
+	// is taken to belong to a sender that stopped, and is queued again
+	sendingLease = 10 * time.Minute
+)
+
+// ScheduledMessageUpdate holds the fields of a pending scheduled message to change
+type ScheduledMessageUpdate struct {
+	Content *string
+	SendAt  *string
+}
+
+type ScheduledMessageService struct {
+	stores   *store.Stores
+	channels *ChannelService
+	messages *MessageService
+}
+
+func NewScheduledMessageService(stores *store.Stores, channels *ChannelService, messages *MessageService) *ScheduledMessageService {
+	return &ScheduledMessageService{stores: stores, channels: channels, messages: messages}
+}
+
+// Schedule queues a message, or a reply when threadID is set, to be posted
+// later. when is parsed with ParseReminderTime relative to now, in the
+// actor's timezone. Permissions
+// are checked now and again when the message is sent.
+func (s *ScheduledMessageService) Schedule(ctx context.Context, actor Actor, channelID models.UUIDv7, content string, threadID *models.UUIDv7, alsoSendToChannel bool, when string, now time.Time) (*models.ScheduledMessage, error) {
+	sendAt, err := s.parseSendAt(ctx, actor, when, now)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := s.channels.AuthorizePost(ctx, actor, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if threadID != nil {
+		if _, err := s.messages.threadRoot(ctx, channel.ID, *threadID); err != nil {
+			return nil, err
+		}
+	}
+
+	pending, err := s.stores.Scheduled.ListPending(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) >= maxPendingScheduled {
+		return nil, newError(ErrInvalid, "Too many scheduled messages")
+	}
+
+	scheduled := &models.ScheduledMessage{
+		UserID:    actor.UserID,
+		ChannelID: channel.ID,
+		ThreadID:  threadID,
+		Content:   content,
+		SendAt:    sendAt,
+		Status:    models.ScheduledMessagePending,
+
+		AlsoSendToChannel: threadID != nil && alsoSendToChannel,
+	}
+	if err := s.stores.Scheduled.Create(ctx, scheduled); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// List returns the actor's pending scheduled messages, soonest first
+func (s *ScheduledMessageService) List(ctx context.Context, actor Actor) ([]models.ScheduledMessage, error) {
+	return s.stores.Scheduled.ListPending(ctx, actor.UserID)
+}
+
+// Update edits the content or send time of one of the actor's pending messages
+func (s *ScheduledMessageService) Update(ctx context.Context, actor Actor, id models.UUIDv7, update ScheduledMessageUpdate, now time.Time) (*models.ScheduledMessage, error) {
+	scheduled, err := s.findPending(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Content != nil {
+		scheduled.Content = *update.Content
+	}
+	if update.SendAt != nil {
+		if scheduled.SendAt, err = s.parseSendAt(ctx, actor, *update.SendAt, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if ok, err := s.stores.Scheduled.UpdatePending(ctx, scheduled); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, newError(ErrConflict, "Message has already been sent")
+	}
+	return scheduled, nil
+}
+
+// Cancel deletes one of the actor's pending scheduled messages
+func (s *ScheduledMessageService) Cancel(ctx context.Context, actor Actor, id models.UUIDv7) error {
+	scheduled, err := s.findPending(ctx, actor, id)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := s.stores.Scheduled.DeletePending(ctx, scheduled); err != nil {
+		return err
+	} else if !ok {
+		return newError(ErrConflict, "Message has already been sent")
+	}
+	return nil
+}
+
+// SendDue posts every scheduled message due at now through MessageService,
+// so channel membership and thread checks apply as of sending. Messages the
+// author may no longer post are marked failed and the author is notified.
+// It is run by the scheduler, which also runs it on start, and returns how
+// many messages were posted.
+func (s *ScheduledMessageService) SendDue(ctx context.Context, now time.Time) (int, error) {
+	if _, err := s.RequeueStale(ctx, now); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for {
+		due, err := s.stores.Scheduled.ListDue(ctx, now, scheduledBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		for i := range due {
+			ok, err := s.send(ctx, &due[i])
+			if err != nil {
+				return sent, err
+			}
+			if ok {
+				sent++
+			}
+		}
+
+		if len(due) < scheduledBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// RequeueStale puts messages left in sending for longer than the lease, by a
+// process that stopped between claiming and finishing them, back in the
+// queue. Such a message is posted again if the stop came after posting it.
+func (s *ScheduledMessageService) RequeueStale(ctx context.Context, now time.Time) (int, error) {
+	requeued, err := s.stores.Scheduled.Requeue(ctx, now.Add(-sendingLease))
+	if requeued > 0 {
+		logging.Component(logging.ComponentScheduler).Warn("scheduled messages requeued after an interrupted send", "count", requeued)
+	}
+	return int(requeued), err
+}
+
+// send posts one due message. It reports whether the message was posted; an
+// error means it was put back in the queue to be retried on the next run.
+func (s *ScheduledMessageService) send(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	if ok, err := s.stores.Scheduled.Claim(ctx, scheduled); err != nil || !ok {
+		return false, err
+	}
+
+	// The outcome is recorded even when ctx was cancelled mid-send, such as on
+	// shutdown, so the message does not stay claimed
+	finishCtx := context.WithoutCancel(ctx)
+
+	message, err := s.post(ctx, scheduled)
+	var failure *Error
+	switch {
+	case errors.As(err, &failure):
+		scheduled.Status = models.ScheduledMessageFailed
+		scheduled.FailureReason = failure.Message
+		return false, s.stores.Scheduled.Finish(finishCtx, scheduled, scheduledFailureNotification(*scheduled))
+	case err != nil:
+		scheduled.Status = models.ScheduledMessagePending
+		if finishErr := s.stores.Scheduled.Finish(finishCtx, scheduled, nil); finishErr != nil {
+			return false, finishErr
+		}
+		return false, err
+	}
+
+	scheduled.Status = models.ScheduledMessageSent
+	scheduled.MessageID = &message.ID
+	return true, s.stores.Scheduled.Finish(finishCtx, scheduled, nil)
+}
+
+// post creates the message as its author, whose role and account status are
+// looked up afresh
+func (s *ScheduledMessageService) post(ctx context.Context, scheduled *models.ScheduledMessage) (*models.Message, error) {
+	author, err := s.stores.Users.GetByID(ctx, scheduled.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrForbidden, "Author no longer exists")
+	} else if err != nil {
+		return nil, err
+	}
+	if !author.IsActive {
+		return nil, newError(ErrForbidden, "Author account is deactivated")
+	}
+
+	actor := Actor{UserID: author.ID, Role: author.Role}
+	if scheduled.ThreadID != nil {
+		return s.messages.Reply(ctx, actor, scheduled.ChannelID, *scheduled.ThreadID, scheduled.Content, scheduled.AlsoSendToChannel)
+	}
+	return s.messages.Create(ctx, actor, scheduled.ChannelID, scheduled.Content, nil)
+}
+
+func (s *ScheduledMessageService) findPending(ctx context.Context, actor Actor, id models.UUIDv7) (*models.ScheduledMessage, error) {
+	scheduled, err := s.stores.Scheduled.GetForUser(ctx, id, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "Scheduled message not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if scheduled.Status != models.ScheduledMessagePending {
+		return nil, newError(ErrConflict, "Message has already been sent")
+	}
+	return scheduled, nil
+}
+
+// parseSendAt parses, in the actor's timezone, and bounds the send time of a
+// scheduled message
+func (s *ScheduledMessageService) parseSendAt(ctx context.Context, actor Actor, when string, now time.Time) (time.Time, error) {
+	local, err := userNow(ctx, s.stores, actor.UserID, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sendAt, err := ParseReminderTime(when, local)
+	if err != nil {
+		return time.Time{}, newError(ErrInvalid, "Could not understand the send time")
+	}
+	if !sendAt.After(now) {
+		return time.Time{}, newError(ErrInvalid, "Send time must be in the future")
+	}
+	if sendAt.Sub(now) > maxScheduleHorizon {
+		return time.Time{}, newError(ErrInvalid, "Send time must be within a year")
+	}
+	return sendAt.UTC(), nil
+}
+
+func scheduledFailureNotification(scheduled models.ScheduledMessage) *models.Notification {
+	channelID := scheduled.ChannelID
+	return &models.Notification{
+		UserID:    scheduled.UserID,
+		Kind:      models.NotificationKindScheduledMessage,
+		Title:     "Scheduled message not sent",
+		Body:      scheduled.FailureReason + ": " + excerpt(scheduled.Content, reminderExcerptLength),
+		ChannelID: &channelID,
+	}
+}
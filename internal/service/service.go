@@ -0,0 +1,52 @@
+// Package service holds the business and permission rules shared by the HTTP
+// handlers. Services depend only on the store interfaces.
+package service
+
+import (
+	"errors"
+
+	"turnate/internal/models"
+)
+
+// Error kinds, matched with errors.Is, that handlers map onto HTTP statuses
+var (
+	ErrInvalid      = errors.New("invalid")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+)
+
+// Error is a user-facing failure of one of the kinds above
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func newError(kind error, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Actor is the authenticated user performing an operation
+type Actor struct {
+	UserID models.UUIDv7
+	Role   models.UserRole
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.Role == models.UserRoleAdmin
+}
+
+// Policy holds the workspace rules chosen by the operator
+type Policy struct {
+	// RestrictPinsToOwners limits pinning to channel owners and admins
+	RestrictPinsToOwners bool
+}
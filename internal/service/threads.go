@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// threadsInboxLimit bounds how many followed threads are listed
+const threadsInboxLimit = 100
+
+// FollowedThread is a thread in the actor's threads inbox
+type FollowedThread struct {
+	Root   models.Message
+	Unread int64
+}
+
+type ThreadService struct {
+	stores   *store.Stores
+	channels *ChannelService
+}
+
+func NewThreadService(stores *store.Stores, channels *ChannelService) *ThreadService {
+	return &ThreadService{stores: stores, channels: channels}
+}
+
+// List returns the threads the actor follows, most recently active first,
+// with the number of replies by others since the actor last read each one.
+// Threads in channels the actor has since left are left out, and threads in
+// channels they muted count no unread replies.
+func (s *ThreadService) List(ctx context.Context, actor Actor) ([]FollowedThread, error) {
+	follows, err := s.stores.ThreadFollows.ListFollowing(ctx, actor.UserID, threadsInboxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := s.stores.ThreadFollows.CountUnread(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	channelIDs, err := s.stores.Members.ListChannelIDs(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	joined := make(map[models.UUIDv7]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		joined[id] = true
+	}
+	muted, err := mutedChannels(ctx, s.stores, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make([]FollowedThread, 0, len(follows))
+	for _, follow := range follows {
+		if !joined[follow.Thread.ChannelID] && !actor.IsAdmin() {
+			continue
+		}
+		thread := FollowedThread{Root: follow.Thread, Unread: unread[follow.ThreadID]}
+		if muted[follow.Thread.ChannelID] {
+			thread.Unread = 0
+		}
+		threads = append(threads, thread)
+	}
+	return threads, nil
+}
+
+// Follow subscribes the actor to a thread they can read
+func (s *ThreadService) Follow(ctx context.Context, actor Actor, threadID models.UUIDv7) error {
+	return s.setFollowing(ctx, actor, threadID, true)
+}
+
+// Unfollow unsubscribes the actor from a thread. Replying to it later does not
+// follow it again.
+func (s *ThreadService) Unfollow(ctx context.Context, actor Actor, threadID models.UUIDv7) error {
+	return s.setFollowing(ctx, actor, threadID, false)
+}
+
+// MarkRead clears the unread replies of a followed thread
+func (s *ThreadService) MarkRead(ctx context.Context, actor Actor, threadID models.UUIDv7, now time.Time) error {
+	if _, err := s.root(ctx, actor, threadID); err != nil {
+		return err
+	}
+	return s.stores.ThreadFollows.MarkRead(ctx, threadID, actor.UserID, now)
+}
+
+func (s *ThreadService) setFollowing(ctx context.Context, actor Actor, threadID models.UUIDv7, following bool) error {
+	if _, err := s.root(ctx, actor, threadID); err != nil {
+		return err
+	}
+
+	follow, err := s.stores.ThreadFollows.Get(ctx, threadID, actor.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		follow = &models.ThreadFollow{ThreadID: threadID, UserID: actor.UserID}
+	} else if err != nil {
+		return err
+	}
+
+	follow.Following = following
+	return s.stores.ThreadFollows.Save(ctx, follow)
+}
+
+// root loads a top-level message the actor can read
+func (s *ThreadService) root(ctx context.Context, actor Actor, threadID models.UUIDv7) (*models.Message, error) {
+	root, err := readableMessage(ctx, s.stores, s.channels, actor, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadID != nil {
+		return nil, newError(ErrInvalid, "Message is a reply, not a thread")
+	}
+	return root, nil
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// UserUpdate lists the optional profile fields of an update
+type UserUpdate struct {
+	DisplayName *string
+	Role        *models.UserRole
+	IsActive    *bool
+}
+
+type UserService struct {
+	stores *store.Stores
+}
+
+func NewUserService(stores *store.Stores) *UserService {
+	return &UserService{stores: stores}
+}
+
+// Register creates a normal user and adds them to the general channel
+func (s *UserService) Register(ctx context.Context, username, email, displayName, password string) (*models.User, error) {
+	return s.Create(ctx, username, email, displayName, password, models.UserRoleNormal)
+}
+
+// Create creates a user with the given role and adds them to the general
+// channel. Operators use it to bootstrap administrators.
+func (s *UserService) Create(ctx context.Context, username, email, displayName, password string, role models.UserRole) (*models.User, error) {
+	if exists, err := s.stores.Users.ExistsByUsernameOrEmail(ctx, username, email); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, newError(ErrConflict, "Username or email already exists")
+	}
+	if _, err := s.stores.Groups.GetByHandle(ctx, strings.ToLower(username)); err == nil {
+		return nil, newError(ErrConflict, "Username is taken by a group")
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username:    username,
+		Email:       email,
+		DisplayName: displayName,
+		Role:        role,
+		IsActive:    true,
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = username
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	if err := s.stores.Users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// Add user to general channel
+	if general, err := s.stores.Channels.GetByName(ctx, GeneralChannelName); err == nil {
+		if err := s.stores.Members.Add(ctx, &models.ChannelMember{ChannelID: general.ID, UserID: user.ID}); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Authenticate checks a username or email and password pair
+func (s *UserService) Authenticate(ctx context.Context, login, password string) (*models.User, error) {
+	user, err := s.stores.Users.GetByLogin(ctx, login)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrUnauthorized, "Invalid username or password")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive {
+		return nil, newError(ErrUnauthorized, "Account is disabled")
+	}
+
+	if !user.CheckPassword(password) {
+		return nil, newError(ErrUnauthorized, "Invalid username or password")
+	}
+
+	return user, nil
+}
+
+func (s *UserService) List(ctx context.Context) ([]models.User, error) {
+	return s.stores.Users.List(ctx)
+}
+
+func (s *UserService) Get(ctx context.Context, id models.UUIDv7) (*models.User, error) {
+	user, err := s.stores.Users.GetByID(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "User not found")
+	}
+	return user, err
+}
+
+// Update applies a profile change. Users may change their own display name;
+// only admins may change other users, roles or account status.
+func (s *UserService) Update(ctx context.Context, actor Actor, id models.UUIDv7, update UserUpdate) (*models.User, error) {
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !actor.IsAdmin() && actor.UserID != id {
+		return nil, newError(ErrForbidden, "Permission denied")
+	}
+
+	if !actor.IsAdmin() && (update.Role != nil || update.IsActive != nil) {
+		return nil, newError(ErrForbidden, "Only admins can update role and status")
+	}
+
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+	if update.Role != nil {
+		user.Role = *update.Role
+	}
+	if update.IsActive != nil {
+		user.IsActive = *update.IsActive
+	}
+
+	if err := s.stores.Users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetPassword sets a new password for the user with the given username or
+// email. It is an operator action and bypasses the permission checks.
+func (s *UserService) ResetPassword(ctx context.Context, login, password string) (*models.User, error) {
+	user, err := s.getByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	if err := s.stores.Users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Deactivate disables the account of the user with the given username or
+// email. Their sessions stop working on the next request. It is an operator
+// action and bypasses the permission checks.
+func (s *UserService) Deactivate(ctx context.Context, login string) (*models.User, error) {
+	user, err := s.getByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	user.IsActive = false
+	if err := s.stores.Users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserService) getByLogin(ctx context.Context, login string) (*models.User, error) {
+	user, err := s.stores.Users.GetByLogin(ctx, login)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, newError(ErrNotFound, "User not found")
+	}
+	return user, err
+}
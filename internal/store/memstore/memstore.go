@@ -0,0 +1,1743 @@
+// Package memstore is an in-memory implementation of the store interfaces for
+// fast tests. It keeps no indexes and is not meant for production use.
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// New returns empty in-memory stores sharing one dataset
+func New() *store.Stores {
+	d := &data{
+		users:    make(map[models.UUIDv7]models.User),
+		channels: make(map[models.UUIDv7]models.Channel),
+	}
+
+	return &store.Stores{
+		Users:         &userStore{d},
+		Channels:      &channelStore{d},
+		Members:       &membershipStore{d},
+		Messages:      &messageStore{d},
+		Bookmarks:     &bookmarkStore{d},
+		SavedItems:    &savedItemStore{d},
+		Reminders:     &reminderStore{d},
+		Scheduled:     &scheduledMessageStore{d},
+		ThreadFollows: &threadFollowStore{d},
+		Notifications: &notificationStore{d},
+		Preferences:   &preferenceStore{d},
+		Push:          &pushStore{d},
+		Groups:        &groupStore{d},
+		Retention:     &retentionStore{d},
+		Erasures:      &erasureStore{d},
+	}
+}
+
+type data struct {
+	mu            sync.RWMutex
+	users         map[models.UUIDv7]models.User
+	channels      map[models.UUIDv7]models.Channel
+	members       []models.ChannelMember
+	messages      []models.Message
+	bookmarks     []models.ChannelBookmark
+	saved         []models.SavedItem
+	reminders     []models.Reminder
+	scheduled     []models.ScheduledMessage
+	follows       []models.ThreadFollow
+	notices       []models.Notification
+	settings      []models.NotificationSettings
+	levels        []models.ChannelNotificationPreference
+	pushSubs      []models.PushSubscription
+	pushKey       *models.PushServerKey
+	groups        []models.UserGroup
+	groupMembers  []models.UserGroupMember
+	groupChannels []models.UserGroupChannel
+	erasures      []models.ErasureRequest
+}
+
+// stamp fills the fields GORM would set on insert
+func stamp(base *models.BaseModel) {
+	if base.ID.IsZero() {
+		base.ID = models.NewUUIDv7()
+	}
+	now := time.Now()
+	if base.CreatedAt.IsZero() {
+		base.CreatedAt = now
+	}
+	base.UpdatedAt = now
+}
+
+func (d *data) isMember(channelID, userID models.UUIDv7) bool {
+	for _, m := range d.members {
+		if m.ChannelID == channelID && m.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *data) withUser(message models.Message) models.Message {
+	message.User = d.users[message.UserID]
+	return message
+}
+
+// onTimeline reports whether a message shows in its channel's timeline
+func onTimeline(m models.Message) bool {
+	return m.ThreadID == nil || m.AlsoSentToChannel
+}
+
+func (d *data) topLevel(channelID models.UUIDv7) []models.Message {
+	var messages []models.Message
+	for _, m := range d.messages {
+		if m.ChannelID == channelID && onTimeline(m) {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+func (d *data) message(id models.UUIDv7) (models.Message, bool) {
+	for _, m := range d.messages {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return models.Message{}, false
+}
+
+// compareIDs orders IDs the way the database orders their text form
+func compareIDs(a, b models.UUIDv7) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+type userStore struct{ *data }
+
+func (s *userStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&user.BaseModel)
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *userStore) Update(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; !ok {
+		return store.ErrNotFound
+	}
+	user.UpdatedAt = time.Now()
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *userStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == login || user.Email == login {
+			return &user, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *userStore) ExistsByUsernameOrEmail(ctx context.Context, username, email string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username || user.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *userStore) ExistsByUsernameIgnoreCase(ctx context.Context, username string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *userStore) List(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.String() < users[j].ID.String() })
+	return users, nil
+}
+
+func (s *userStore) ListByUsernames(ctx context.Context, usernames []string) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		wanted[username] = true
+	}
+
+	var users []models.User
+	for _, user := range s.users {
+		if wanted[user.Username] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *userStore) TouchLastSeen(ctx context.Context, id models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	user.LastSeenAt = &at
+	s.users[id] = user
+	return nil
+}
+
+func (s *userStore) CountActiveAdmins(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, user := range s.users {
+		if user.IsAdmin() && user.IsActive {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type channelStore struct{ *data }
+
+func (s *channelStore) Create(ctx context.Context, channel *models.Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&channel.BaseModel)
+	s.channels[channel.ID] = *channel
+	return nil
+}
+
+func (s *channelStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	channel, ok := s.channels[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &channel, nil
+}
+
+func (s *channelStore) GetByName(ctx context.Context, name string) (*models.Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, channel := range s.channels {
+		if channel.Name == name {
+			return &channel, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *channelStore) List(ctx context.Context, visibleTo *models.UUIDv7) ([]models.Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var channels []models.Channel
+	for _, channel := range s.channels {
+		if visibleTo == nil || channel.Type == models.ChannelTypePublic || s.isMember(channel.ID, *visibleTo) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].ID.String() < channels[j].ID.String() })
+	return channels, nil
+}
+
+func (s *channelStore) ListByIDs(ctx context.Context, ids []models.UUIDv7) ([]models.Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var channels []models.Channel
+	for _, id := range ids {
+		if channel, ok := s.channels[id]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels, nil
+}
+
+type membershipStore struct{ *data }
+
+func (s *membershipStore) Add(ctx context.Context, member *models.ChannelMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&member.BaseModel)
+	s.members = append(s.members, *member)
+	return nil
+}
+
+func (s *membershipStore) Get(ctx context.Context, channelID, userID models.UUIDv7) (*models.ChannelMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.members {
+		if m.ChannelID == channelID && m.UserID == userID {
+			return &m, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *membershipStore) Remove(ctx context.Context, member *models.ChannelMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, m := range s.members {
+		if m.ID == member.ID {
+			s.members = append(s.members[:i], s.members[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *membershipStore) CountMembers(ctx context.Context, channelID models.UUIDv7) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, m := range s.members {
+		if m.ChannelID == channelID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *membershipStore) CountMembersByChannel(ctx context.Context, channelIDs []models.UUIDv7) (map[models.UUIDv7]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[models.UUIDv7]int64, len(channelIDs))
+	for _, id := range channelIDs {
+		counts[id] = 0
+	}
+	for _, m := range s.members {
+		if _, ok := counts[m.ChannelID]; ok {
+			counts[m.ChannelID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *membershipStore) ListMembers(ctx context.Context, channelID models.UUIDv7) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.User
+	for _, m := range s.members {
+		if m.ChannelID == channelID {
+			if user, ok := s.users[m.UserID]; ok {
+				users = append(users, user)
+			}
+		}
+	}
+	return users, nil
+}
+
+func (s *membershipStore) ListChannelIDs(ctx context.Context, userID models.UUIDv7) ([]models.UUIDv7, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var channelIDs []models.UUIDv7
+	for _, m := range s.members {
+		if m.UserID == userID {
+			channelIDs = append(channelIDs, m.ChannelID)
+		}
+	}
+	return channelIDs, nil
+}
+
+type messageStore struct{ *data }
+
+func (s *messageStore) Create(ctx context.Context, message *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&message.BaseModel)
+	s.messages = append(s.messages, *message)
+
+	if message.ThreadID != nil {
+		for i := range s.messages {
+			if s.messages[i].ID == *message.ThreadID {
+				createdAt := message.CreatedAt
+				s.messages[i].ReplyCount++
+				s.messages[i].LastReplyAt = &createdAt
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *messageStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if m, ok := s.message(id); ok {
+		return &m, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *messageStore) GetInChannel(ctx context.Context, id, channelID models.UUIDv7) (*models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.messages {
+		if m.ID == id && m.ChannelID == channelID {
+			return &m, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *messageStore) ListTopLevelBefore(ctx context.Context, channelID models.UUIDv7, before *models.UUIDv7, limit int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, m := range s.topLevel(channelID) {
+		if before == nil || compareIDs(m.ID, *before) < 0 {
+			messages = append(messages, s.withUser(m))
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return compareIDs(messages[i].ID, messages[j].ID) > 0 })
+	return page(messages, limit, 0), nil
+}
+
+func (s *messageStore) ListTopLevelAfter(ctx context.Context, channelID, after models.UUIDv7, limit int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, m := range s.topLevel(channelID) {
+		if compareIDs(m.ID, after) > 0 {
+			messages = append(messages, s.withUser(m))
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return compareIDs(messages[i].ID, messages[j].ID) < 0 })
+	return page(messages, limit, 0), nil
+}
+
+func (s *messageStore) ListReplies(ctx context.Context, threadID models.UUIDv7, limit, offset int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var replies []models.Message
+	for _, m := range s.messages {
+		if m.ThreadID != nil && *m.ThreadID == threadID {
+			replies = append(replies, s.withUser(m))
+		}
+	}
+	return page(replies, limit, offset), nil
+}
+
+func (s *messageStore) ListRecent(ctx context.Context, channelIDs []models.UUIDv7, since time.Time, limit int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[models.UUIDv7]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		wanted[id] = true
+	}
+
+	var messages []models.Message
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if m := s.messages[i]; wanted[m.ChannelID] && onTimeline(m) && m.CreatedAt.After(since) {
+			messages = append(messages, s.withUser(m))
+		}
+	}
+	return page(messages, limit, 0), nil
+}
+
+func (s *messageStore) CountSince(ctx context.Context, channelIDs []models.UUIDv7, since time.Time, excludeUserID models.UUIDv7) (map[models.UUIDv7]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[models.UUIDv7]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		wanted[id] = true
+	}
+
+	counts := make(map[models.UUIDv7]int64, len(channelIDs))
+	for _, m := range s.messages {
+		if wanted[m.ChannelID] && onTimeline(m) && m.CreatedAt.After(since) && m.UserID != excludeUserID && m.Type == models.MessageTypeUser {
+			counts[m.ChannelID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *messageStore) SetPinned(ctx context.Context, id models.UUIDv7, pinnedBy *models.UUIDv7, at *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.messages {
+		if s.messages[i].ID == id {
+			s.messages[i].PinnedBy = pinnedBy
+			s.messages[i].PinnedAt = at
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *messageStore) ListPinned(ctx context.Context, channelID models.UUIDv7) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, m := range s.messages {
+		if m.ChannelID == channelID && m.PinnedAt != nil {
+			messages = append(messages, s.withUser(m))
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].PinnedAt.After(*messages[j].PinnedAt) })
+	return messages, nil
+}
+
+type bookmarkStore struct{ *data }
+
+func (s *bookmarkStore) Create(ctx context.Context, bookmark *models.ChannelBookmark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&bookmark.BaseModel)
+	s.bookmarks = append(s.bookmarks, *bookmark)
+	return nil
+}
+
+func (s *bookmarkStore) GetInChannel(ctx context.Context, id, channelID models.UUIDv7) (*models.ChannelBookmark, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, b := range s.bookmarks {
+		if b.ID == id && b.ChannelID == channelID {
+			return &b, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *bookmarkStore) Delete(ctx context.Context, bookmark *models.ChannelBookmark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, b := range s.bookmarks {
+		if b.ID == bookmark.ID {
+			s.bookmarks = append(s.bookmarks[:i], s.bookmarks[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *bookmarkStore) ListByChannel(ctx context.Context, channelID models.UUIDv7) ([]models.ChannelBookmark, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bookmarks []models.ChannelBookmark
+	for _, b := range s.bookmarks {
+		if b.ChannelID == channelID {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+	return bookmarks, nil
+}
+
+type savedItemStore struct{ *data }
+
+func (s *savedItemStore) Create(ctx context.Context, item *models.SavedItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&item.BaseModel)
+	s.saved = append(s.saved, *item)
+	return nil
+}
+
+func (s *savedItemStore) Get(ctx context.Context, userID, messageID models.UUIDv7) (*models.SavedItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, item := range s.saved {
+		if item.UserID == userID && item.MessageID == messageID {
+			return &item, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *savedItemStore) Delete(ctx context.Context, item *models.SavedItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, saved := range s.saved {
+		if saved.ID == item.ID {
+			s.saved = append(s.saved[:i], s.saved[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *savedItemStore) List(ctx context.Context, userID models.UUIDv7) ([]models.SavedItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.SavedItem
+	for i := len(s.saved) - 1; i >= 0; i-- {
+		if item := s.saved[i]; item.UserID == userID {
+			if m, ok := s.message(item.MessageID); ok {
+				item.Message = s.withUser(m)
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+type reminderStore struct{ *data }
+
+func (s *reminderStore) Create(ctx context.Context, reminder *models.Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&reminder.BaseModel)
+	s.reminders = append(s.reminders, *reminder)
+	return nil
+}
+
+func (s *reminderStore) GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.reminders {
+		if r.ID == id && r.UserID == userID {
+			return &r, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *reminderStore) Delete(ctx context.Context, reminder *models.Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.reminders {
+		if r.ID == reminder.ID {
+			s.reminders = append(s.reminders[:i], s.reminders[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *reminderStore) ListPending(ctx context.Context, userID models.UUIDv7) ([]models.Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reminders []models.Reminder
+	for _, r := range s.reminders {
+		if r.UserID == userID && r.DeliveredAt == nil {
+			reminders = append(reminders, r)
+		}
+	}
+	sort.SliceStable(reminders, func(i, j int) bool { return reminders[i].RemindAt.Before(reminders[j].RemindAt) })
+	return reminders, nil
+}
+
+func (s *reminderStore) ListDue(ctx context.Context, now time.Time, limit int) ([]models.Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reminders []models.Reminder
+	for _, r := range s.reminders {
+		if r.DeliveredAt == nil && !r.RemindAt.After(now) {
+			if r.MessageID != nil {
+				if m, ok := s.message(*r.MessageID); ok {
+					r.Message = &m
+				}
+			}
+			reminders = append(reminders, r)
+		}
+	}
+	sort.SliceStable(reminders, func(i, j int) bool { return reminders[i].RemindAt.Before(reminders[j].RemindAt) })
+	if limit > 0 && len(reminders) > limit {
+		reminders = reminders[:limit]
+	}
+	return reminders, nil
+}
+
+func (s *reminderStore) Deliver(ctx context.Context, reminder *models.Reminder, notification *models.Notification) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.reminders {
+		if s.reminders[i].ID == reminder.ID && s.reminders[i].DeliveredAt == nil {
+			now := time.Now()
+			s.reminders[i].DeliveredAt = &now
+			reminder.DeliveredAt = &now
+
+			stamp(&notification.BaseModel)
+			s.notices = append(s.notices, *notification)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type scheduledMessageStore struct{ *data }
+
+func (s *scheduledMessageStore) Create(ctx context.Context, scheduled *models.ScheduledMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&scheduled.BaseModel)
+	if scheduled.Status == "" {
+		scheduled.Status = models.ScheduledMessagePending
+	}
+	s.scheduled = append(s.scheduled, *scheduled)
+	return nil
+}
+
+func (s *scheduledMessageStore) GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.ScheduledMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.scheduled {
+		if m.ID == id && m.UserID == userID {
+			return &m, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *scheduledMessageStore) ListPending(ctx context.Context, userID models.UUIDv7) ([]models.ScheduledMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var scheduled []models.ScheduledMessage
+	for _, m := range s.scheduled {
+		if m.UserID == userID && m.Status == models.ScheduledMessagePending {
+			scheduled = append(scheduled, m)
+		}
+	}
+	sort.SliceStable(scheduled, func(i, j int) bool { return scheduled[i].SendAt.Before(scheduled[j].SendAt) })
+	return scheduled, nil
+}
+
+func (s *scheduledMessageStore) ListDue(ctx context.Context, now time.Time, limit int) ([]models.ScheduledMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var scheduled []models.ScheduledMessage
+	for _, m := range s.scheduled {
+		if m.Status == models.ScheduledMessagePending && !m.SendAt.After(now) {
+			scheduled = append(scheduled, m)
+		}
+	}
+	sort.SliceStable(scheduled, func(i, j int) bool { return scheduled[i].SendAt.Before(scheduled[j].SendAt) })
+	if limit > 0 && len(scheduled) > limit {
+		scheduled = scheduled[:limit]
+	}
+	return scheduled, nil
+}
+
+// pending returns the index of a scheduled message that is still pending, or -1
+func (s *scheduledMessageStore) pending(id models.UUIDv7) int {
+	for i, m := range s.scheduled {
+		if m.ID == id && m.Status == models.ScheduledMessagePending {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *scheduledMessageStore) UpdatePending(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.pending(scheduled.ID)
+	if i < 0 {
+		return false, nil
+	}
+	s.scheduled[i].Content = scheduled.Content
+	s.scheduled[i].ThreadID = scheduled.ThreadID
+	s.scheduled[i].SendAt = scheduled.SendAt
+	s.scheduled[i].UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *scheduledMessageStore) DeletePending(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.pending(scheduled.ID)
+	if i < 0 {
+		return false, nil
+	}
+	s.scheduled = append(s.scheduled[:i], s.scheduled[i+1:]...)
+	return true, nil
+}
+
+func (s *scheduledMessageStore) Claim(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.pending(scheduled.ID)
+	if i < 0 || !s.scheduled[i].UpdatedAt.Equal(scheduled.UpdatedAt) {
+		return false, nil
+	}
+	s.scheduled[i].Status = models.ScheduledMessageSending
+	s.scheduled[i].UpdatedAt = time.Now()
+	scheduled.Status = models.ScheduledMessageSending
+	return true, nil
+}
+
+func (s *scheduledMessageStore) Finish(ctx context.Context, scheduled *models.ScheduledMessage, notification *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.scheduled {
+		if s.scheduled[i].ID == scheduled.ID {
+			s.scheduled[i].Status = scheduled.Status
+			s.scheduled[i].MessageID = scheduled.MessageID
+			s.scheduled[i].FailureReason = scheduled.FailureReason
+			s.scheduled[i].UpdatedAt = time.Now()
+
+			if notification != nil {
+				stamp(&notification.BaseModel)
+				s.notices = append(s.notices, *notification)
+			}
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *scheduledMessageStore) Requeue(ctx context.Context, claimedBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requeued int64
+	for i := range s.scheduled {
+		if s.scheduled[i].Status == models.ScheduledMessageSending && s.scheduled[i].UpdatedAt.Before(claimedBefore) {
+			s.scheduled[i].Status = models.ScheduledMessagePending
+			s.scheduled[i].UpdatedAt = time.Now()
+			requeued++
+		}
+	}
+	return requeued, nil
+}
+
+type threadFollowStore struct{ *data }
+
+func (s *threadFollowStore) Get(ctx context.Context, threadID, userID models.UUIDv7) (*models.ThreadFollow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i := s.follow(threadID, userID); i >= 0 {
+		follow := s.follows[i]
+		return &follow, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+// follow returns the index of a user's follow of a thread, or -1
+func (s *threadFollowStore) follow(threadID, userID models.UUIDv7) int {
+	for i, f := range s.follows {
+		if f.ThreadID == threadID && f.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *threadFollowStore) Save(ctx context.Context, follow *models.ThreadFollow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&follow.BaseModel)
+	for i := range s.follows {
+		if s.follows[i].ID == follow.ID {
+			s.follows[i] = *follow
+			return nil
+		}
+	}
+	s.follows = append(s.follows, *follow)
+	return nil
+}
+
+func (s *threadFollowStore) Participate(ctx context.Context, threadID models.UUIDv7, userIDs ...models.UUIDv7) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, userID := range userIDs {
+		if s.follow(threadID, userID) < 0 {
+			follow := models.ThreadFollow{ThreadID: threadID, UserID: userID, Following: true}
+			stamp(&follow.BaseModel)
+			s.follows = append(s.follows, follow)
+		}
+	}
+	return nil
+}
+
+func (s *threadFollowStore) MarkRead(ctx context.Context, threadID, userID models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.follow(threadID, userID); i >= 0 {
+		if f := &s.follows[i]; f.LastReadAt == nil || f.LastReadAt.Before(at) {
+			f.LastReadAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *threadFollowStore) ListFollowing(ctx context.Context, userID models.UUIDv7, limit int) ([]models.ThreadFollow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var follows []models.ThreadFollow
+	for _, f := range s.follows {
+		if f.UserID != userID || !f.Following {
+			continue
+		}
+		if m, ok := s.message(f.ThreadID); ok {
+			f.Thread = s.withUser(m)
+			follows = append(follows, f)
+		}
+	}
+	lastReply := func(m models.Message) time.Time {
+		if m.LastReplyAt == nil {
+			return time.Time{}
+		}
+		return *m.LastReplyAt
+	}
+	sort.SliceStable(follows, func(i, j int) bool {
+		a, b := lastReply(follows[i].Thread), lastReply(follows[j].Thread)
+		if a.Equal(b) {
+			return compareIDs(follows[i].ThreadID, follows[j].ThreadID) > 0
+		}
+		return a.After(b)
+	})
+	if limit > 0 && len(follows) > limit {
+		follows = follows[:limit]
+	}
+	return follows, nil
+}
+
+func (s *threadFollowStore) ListFollowers(ctx context.Context, threadID models.UUIDv7) ([]models.UUIDv7, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userIDs []models.UUIDv7
+	for _, f := range s.follows {
+		if f.ThreadID == threadID && f.Following {
+			userIDs = append(userIDs, f.UserID)
+		}
+	}
+	return userIDs, nil
+}
+
+func (s *threadFollowStore) CountUnread(ctx context.Context, userID models.UUIDv7) (map[models.UUIDv7]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[models.UUIDv7]int64)
+	for _, f := range s.follows {
+		if f.UserID != userID || !f.Following {
+			continue
+		}
+		for _, m := range s.messages {
+			if m.ThreadID != nil && *m.ThreadID == f.ThreadID && m.UserID != userID &&
+				(f.LastReadAt == nil || m.CreatedAt.After(*f.LastReadAt)) {
+				counts[f.ThreadID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+type notificationStore struct{ *data }
+
+func (s *notificationStore) Create(ctx context.Context, notification *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&notification.BaseModel)
+	s.notices = append(s.notices, *notification)
+	return nil
+}
+
+func (s *notificationStore) CreateMany(ctx context.Context, notifications []models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range notifications {
+		stamp(&notifications[i].BaseModel)
+		s.notices = append(s.notices, notifications[i])
+	}
+	return nil
+}
+
+func (s *notificationStore) List(ctx context.Context, userID models.UUIDv7, limit int) ([]models.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []models.Notification
+	for i := len(s.notices) - 1; i >= 0; i-- {
+		if n := s.notices[i]; n.UserID == userID {
+			notifications = append(notifications, n)
+		}
+	}
+	if limit > 0 && len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (s *notificationStore) MarkRead(ctx context.Context, id, userID models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.notices {
+		if s.notices[i].ID == id && s.notices[i].UserID == userID {
+			s.notices[i].ReadAt = &at
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *notificationStore) CountUnread(ctx context.Context, userID models.UUIDv7) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, n := range s.notices {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *notificationStore) MarkAllRead(ctx context.Context, userID models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.notices {
+		if s.notices[i].UserID == userID && s.notices[i].ReadAt == nil {
+			s.notices[i].ReadAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *notificationStore) ListEmailDue(ctx context.Context, kinds []models.NotificationKind, before time.Time, limit int) ([]models.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []models.Notification
+	for _, n := range s.notices {
+		if n.EmailedAt != nil || n.ReadAt != nil || n.Quiet || n.CreatedAt.After(before) {
+			continue
+		}
+		for _, kind := range kinds {
+			if n.Kind == kind {
+				notifications = append(notifications, n)
+				break
+			}
+		}
+	}
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	if limit > 0 && len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (s *notificationStore) MarkEmailed(ctx context.Context, ids []models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		for i := range s.notices {
+			if s.notices[i].ID == id {
+				s.notices[i].EmailedAt = &at
+			}
+		}
+	}
+	return nil
+}
+
+func (s *notificationStore) ListPushDue(ctx context.Context, since time.Time, limit int) ([]models.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []models.Notification
+	for _, n := range s.notices {
+		if n.PushedAt == nil && !n.Quiet && n.CreatedAt.After(since) {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	if limit > 0 && len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (s *notificationStore) MarkPushed(ctx context.Context, ids []models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		for i := range s.notices {
+			if s.notices[i].ID == id {
+				s.notices[i].PushedAt = &at
+			}
+		}
+	}
+	return nil
+}
+
+type preferenceStore struct{ *data }
+
+func (s *preferenceStore) GetSettings(ctx context.Context, userID models.UUIDv7) (*models.NotificationSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, settings := range s.settings {
+		if settings.UserID == userID {
+			return &settings, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *preferenceStore) SaveSettings(ctx context.Context, settings *models.NotificationSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&settings.BaseModel)
+	for i := range s.settings {
+		if s.settings[i].ID == settings.ID {
+			s.settings[i] = *settings
+			return nil
+		}
+	}
+	s.settings = append(s.settings, *settings)
+	return nil
+}
+
+func (s *preferenceStore) ListSettings(ctx context.Context, userIDs []models.UUIDv7) ([]models.NotificationSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[models.UUIDv7]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+
+	var settings []models.NotificationSettings
+	for _, st := range s.settings {
+		if wanted[st.UserID] {
+			settings = append(settings, st)
+		}
+	}
+	return settings, nil
+}
+
+func (s *preferenceStore) GetChannel(ctx context.Context, channelID, userID models.UUIDv7) (*models.ChannelNotificationPreference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.levels {
+		if p.ChannelID == channelID && p.UserID == userID {
+			return &p, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *preferenceStore) SaveChannel(ctx context.Context, preference *models.ChannelNotificationPreference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&preference.BaseModel)
+	for i := range s.levels {
+		if s.levels[i].ID == preference.ID {
+			s.levels[i] = *preference
+			return nil
+		}
+	}
+	s.levels = append(s.levels, *preference)
+	return nil
+}
+
+func (s *preferenceStore) ListByChannel(ctx context.Context, channelID models.UUIDv7) ([]models.ChannelNotificationPreference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var preferences []models.ChannelNotificationPreference
+	for _, p := range s.levels {
+		if p.ChannelID == channelID {
+			preferences = append(preferences, p)
+		}
+	}
+	return preferences, nil
+}
+
+func (s *preferenceStore) ListByUser(ctx context.Context, userID models.UUIDv7) ([]models.ChannelNotificationPreference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var preferences []models.ChannelNotificationPreference
+	for _, p := range s.levels {
+		if p.UserID == userID {
+			preferences = append(preferences, p)
+		}
+	}
+	return preferences, nil
+}
+
+func (s *preferenceStore) ListDigestSubscribers(ctx context.Context) ([]models.NotificationSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var settings []models.NotificationSettings
+	for _, st := range s.settings {
+		if st.DigestEnabled {
+			settings = append(settings, st)
+		}
+	}
+	return settings, nil
+}
+
+func (s *preferenceStore) MarkDigestSent(ctx context.Context, userID models.UUIDv7, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.settings {
+		if s.settings[i].UserID == userID {
+			s.settings[i].DigestSentAt = &at
+		}
+	}
+	return nil
+}
+
+type pushStore struct{ *data }
+
+func (s *pushStore) Save(ctx context.Context, subscription *models.PushSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.pushSubs[:0]
+	for _, existing := range s.pushSubs {
+		sameSession := subscription.SessionID != "" && existing.UserID == subscription.UserID && existing.SessionID == subscription.SessionID
+		if existing.Endpoint != subscription.Endpoint && !sameSession {
+			kept = append(kept, existing)
+		}
+	}
+	stamp(&subscription.BaseModel)
+	s.pushSubs = append(kept, *subscription)
+	return nil
+}
+
+func (s *pushStore) GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.PushSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, subscription := range s.pushSubs {
+		if subscription.ID == id && subscription.UserID == userID {
+			return &subscription, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *pushStore) Delete(ctx context.Context, subscription *models.PushSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.pushSubs {
+		if s.pushSubs[i].ID == subscription.ID {
+			s.pushSubs = append(s.pushSubs[:i], s.pushSubs[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *pushStore) DeleteByEndpoint(ctx context.Context, endpoint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.pushSubs {
+		if s.pushSubs[i].Endpoint == endpoint {
+			s.pushSubs = append(s.pushSubs[:i], s.pushSubs[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *pushStore) ListByUsers(ctx context.Context, userIDs []models.UUIDv7) ([]models.PushSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[models.UUIDv7]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+
+	var subscriptions []models.PushSubscription
+	for _, subscription := range s.pushSubs {
+		if wanted[subscription.UserID] {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (s *pushStore) ServerKey(ctx context.Context) (*models.PushServerKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.pushKey == nil {
+		return nil, store.ErrNotFound
+	}
+	key := *s.pushKey
+	return &key, nil
+}
+
+func (s *pushStore) CreateServerKey(ctx context.Context, key *models.PushServerKey) (*models.PushServerKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pushKey == nil {
+		stamp(&key.BaseModel)
+		stored := *key
+		s.pushKey = &stored
+	}
+	stored := *s.pushKey
+	return &stored, nil
+}
+
+type groupStore struct{ *data }
+
+func (s *groupStore) Create(ctx context.Context, group *models.UserGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&group.BaseModel)
+	s.groups = append(s.groups, *group)
+	return nil
+}
+
+func (s *groupStore) Update(ctx context.Context, group *models.UserGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.groups {
+		if s.groups[i].ID == group.ID {
+			group.UpdatedAt = time.Now()
+			s.groups[i] = *group
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *groupStore) Delete(ctx context.Context, group *models.UserGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := s.groupMembers[:0]
+	for _, m := range s.groupMembers {
+		if m.GroupID != group.ID {
+			members = append(members, m)
+		}
+	}
+	s.groupMembers = members
+
+	channels := s.groupChannels[:0]
+	for _, c := range s.groupChannels {
+		if c.GroupID != group.ID {
+			channels = append(channels, c)
+		}
+	}
+	s.groupChannels = channels
+
+	for i := range s.groups {
+		if s.groups[i].ID == group.ID {
+			s.groups = append(s.groups[:i], s.groups[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *groupStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.UserGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, g := range s.groups {
+		if g.ID == id {
+			return &g, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *groupStore) GetByHandle(ctx context.Context, handle string) (*models.UserGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, g := range s.groups {
+		if g.Handle == handle {
+			return &g, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *groupStore) List(ctx context.Context) ([]models.UserGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := append([]models.UserGroup(nil), s.groups...)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Handle < groups[j].Handle })
+	return groups, nil
+}
+
+func (s *groupStore) ListByHandles(ctx context.Context, handles []string) ([]models.UserGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(handles))
+	for _, handle := range handles {
+		wanted[handle] = true
+	}
+
+	var groups []models.UserGroup
+	for _, g := range s.groups {
+		if wanted[g.Handle] {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+func (s *groupStore) AddMember(ctx context.Context, member *models.UserGroupMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&member.BaseModel)
+	s.groupMembers = append(s.groupMembers, *member)
+	return nil
+}
+
+func (s *groupStore) GetMember(ctx context.Context, groupID, userID models.UUIDv7) (*models.UserGroupMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.groupMembers {
+		if m.GroupID == groupID && m.UserID == userID {
+			return &m, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *groupStore) RemoveMember(ctx context.Context, member *models.UserGroupMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, m := range s.groupMembers {
+		if m.ID == member.ID {
+			s.groupMembers = append(s.groupMembers[:i], s.groupMembers[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *groupStore) ListMembers(ctx context.Context, groupID models.UUIDv7) ([]models.UserGroupMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []models.UserGroupMember
+	for _, m := range s.groupMembers {
+		if m.GroupID == groupID {
+			m.User = s.users[m.UserID]
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+func (s *groupStore) ListMemberIDs(ctx context.Context, groupIDs []models.UUIDv7) (map[models.UUIDv7][]models.UUIDv7, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[models.UUIDv7]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		wanted[id] = true
+	}
+
+	memberIDs := make(map[models.UUIDv7][]models.UUIDv7, len(groupIDs))
+	for _, m := range s.groupMembers {
+		if wanted[m.GroupID] {
+			memberIDs[m.GroupID] = append(memberIDs[m.GroupID], m.UserID)
+		}
+	}
+	return memberIDs, nil
+}
+
+func (s *groupStore) SetChannels(ctx context.Context, groupID models.UUIDv7, channelIDs []models.UUIDv7) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := s.groupChannels[:0]
+	for _, c := range s.groupChannels {
+		if c.GroupID != groupID {
+			channels = append(channels, c)
+		}
+	}
+	for _, channelID := range channelIDs {
+		channel := models.UserGroupChannel{GroupID: groupID, ChannelID: channelID}
+		stamp(&channel.BaseModel)
+		channels = append(channels, channel)
+	}
+	s.groupChannels = channels
+	return nil
+}
+
+func (s *groupStore) ListChannelIDs(ctx context.Context, groupID models.UUIDv7) ([]models.UUIDv7, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var channelIDs []models.UUIDv7
+	for _, c := range s.groupChannels {
+		if c.GroupID == groupID {
+			channelIDs = append(channelIDs, c.ChannelID)
+		}
+	}
+	return channelIDs, nil
+}
+
+func page(messages []models.Message, limit, offset int) []models.Message {
+	if offset >= len(messages) {
+		return nil
+	}
+	messages = messages[offset:]
+	if limit > 0 && limit < len(messages) {
+		messages = messages[:limit]
+	}
+	return messages
+}
+
+type retentionStore struct{ *data }
+
+func (s *retentionStore) SetChannel(ctx context.Context, channelID models.UUIDv7, days *int, legalHold bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel, ok := s.channels[channelID]
+	if !ok {
+		return nil
+	}
+	channel.RetentionDays = days
+	channel.LegalHold = legalHold
+	channel.UpdatedAt = time.Now()
+	s.channels[channelID] = channel
+	return nil
+}
+
+func (s *retentionStore) SetUserHold(ctx context.Context, userID models.UUIDv7, legalHold bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	user.LegalHold = legalHold
+	user.UpdatedAt = time.Now()
+	s.users[userID] = user
+	return nil
+}
+
+func (s *retentionStore) ListChannels(ctx context.Context) ([]models.Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var channels []models.Channel
+	for _, c := range s.channels {
+		if c.RetentionDays != nil || c.LegalHold {
+			channels = append(channels, c)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels, nil
+}
+
+func (s *retentionStore) ListUserHolds(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.User
+	for _, u := range s.users {
+		if u.LegalHold {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+type erasureStore struct{ *data }
+
+func (s *erasureStore) Create(ctx context.Context, request *models.ErasureRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp(&request.BaseModel)
+	s.erasures = append(s.erasures, *request)
+	return nil
+}
+
+func (s *erasureStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.ErasureRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.erasures {
+		if r.ID == id {
+			r.User = s.users[r.UserID]
+			return &r, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *erasureStore) Latest(ctx context.Context, userID models.UUIDv7) (*models.ErasureRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest *models.ErasureRequest
+	for i, r := range s.erasures {
+		if r.UserID == userID && (latest == nil || compareIDs(r.ID, latest.ID) > 0) {
+			latest = &s.erasures[i]
+		}
+	}
+	if latest == nil {
+		return nil, store.ErrNotFound
+	}
+	request := *latest
+	return &request, nil
+}
+
+func (s *erasureStore) HasOpen(ctx context.Context, userID models.UUIDv7) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.erasures {
+		if r.UserID == userID && (r.Status == models.ErasureStatusPending || r.Status == models.ErasureStatusApproved) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *erasureStore) List(ctx context.Context, status models.ErasureStatus) ([]models.ErasureRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var requests []models.ErasureRequest
+	for _, r := range s.erasures {
+		if status == "" || r.Status == status {
+			r.User = s.users[r.UserID]
+			requests = append(requests, r)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return compareIDs(requests[i].ID, requests[j].ID) > 0 })
+	return requests, nil
+}
+
+func (s *erasureStore) UpdatePending(ctx context.Context, request *models.ErasureRequest) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.erasures {
+		if r.ID == request.ID {
+			if r.Status != models.ErasureStatusPending {
+				return false, nil
+			}
+			s.erasures[i].Status = request.Status
+			s.erasures[i].ReviewedBy = request.ReviewedBy
+			s.erasures[i].ReviewedAt = request.ReviewedAt
+			s.erasures[i].ReviewNote = request.ReviewNote
+			s.erasures[i].UpdatedAt = time.Now()
+			return true, nil
+		}
+	}
+	return false, nil
+}
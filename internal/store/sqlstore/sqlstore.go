@@ -0,0 +1,1075 @@
+// Package sqlstore implements the store interfaces on top of GORM.
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"turnate/internal/models"
+	"turnate/internal/store"
+)
+
+// New returns GORM-backed stores sharing the given connection
+func New(db *gorm.DB) *store.Stores {
+	return &store.Stores{
+		Users:         &userStore{db: db},
+		Channels:      &channelStore{db: db},
+		Members:       &membershipStore{db: db},
+		Messages:      &messageStore{db: db},
+		Bookmarks:     &bookmarkStore{db: db},
+		SavedItems:    &savedItemStore{db: db},
+		Reminders:     &reminderStore{db: db},
+		Scheduled:     &scheduledMessageStore{db: db},
+		ThreadFollows: &threadFollowStore{db: db},
+		Notifications: &notificationStore{db: db},
+		Preferences:   &preferenceStore{db: db},
+		Push:          &pushStore{db: db},
+		Groups:        &groupStore{db: db},
+		Retention:     &retentionStore{db: db},
+		Erasures:      &erasureStore{db: db},
+	}
+}
+
+// translate maps GORM's not-found error onto store.ErrNotFound
+func translate(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+type userStore struct {
+	db *gorm.DB
+}
+
+func (s *userStore) Create(ctx context.Context, user *models.User) error {
+	return s.db.WithContext(ctx).Create(user).Error
+}
+
+func (s *userStore) Update(ctx context.Context, user *models.User) error {
+	return s.db.WithContext(ctx).Save(user).Error
+}
+
+func (s *userStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("username = ? OR email = ?", login, login).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) ExistsByUsernameOrEmail(ctx context.Context, username, email string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("username = ? OR email = ?", username, email).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *userStore) ExistsByUsernameIgnoreCase(ctx context.Context, username string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("LOWER(username) = ?", strings.ToLower(username)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *userStore) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := s.db.WithContext(ctx).Select("id, username, display_name, role, is_active, last_seen_at").Find(&users).Error
+	return users, err
+}
+
+func (s *userStore) ListByUsernames(ctx context.Context, usernames []string) ([]models.User, error) {
+	var users []models.User
+	if len(usernames) == 0 {
+		return users, nil
+	}
+	err := s.db.WithContext(ctx).Where("username IN ?", usernames).Find(&users).Error
+	return users, err
+}
+
+func (s *userStore) TouchLastSeen(ctx context.Context, id models.UUIDv7, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
+
+func (s *userStore) CountActiveAdmins(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("role = ? AND is_active = ?", models.UserRoleAdmin, true).
+		Count(&count).Error
+	return count, err
+}
+
+type channelStore struct {
+	db *gorm.DB
+}
+
+func (s *channelStore) Create(ctx context.Context, channel *models.Channel) error {
+	return s.db.WithContext(ctx).Create(channel).Error
+}
+
+func (s *channelStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.Channel, error) {
+	var channel models.Channel
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&channel).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &channel, nil
+}
+
+func (s *channelStore) GetByName(ctx context.Context, name string) (*models.Channel, error) {
+	var channel models.Channel
+	if err := s.db.WithContext(ctx).Where("name = ?", name).First(&channel).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &channel, nil
+}
+
+func (s *channelStore) List(ctx context.Context, visibleTo *models.UUIDv7) ([]models.Channel, error) {
+	query := s.db.WithContext(ctx)
+	if visibleTo != nil {
+		query = query.Where("type = ? OR id IN (SELECT channel_id FROM channel_members WHERE user_id = ? AND deleted_at IS NULL)",
+			models.ChannelTypePublic, *visibleTo)
+	}
+
+	var channels []models.Channel
+	err := query.Find(&channels).Error
+	return channels, err
+}
+
+func (s *channelStore) ListByIDs(ctx context.Context, ids []models.UUIDv7) ([]models.Channel, error) {
+	var channels []models.Channel
+	if len(ids) == 0 {
+		return channels, nil
+	}
+	err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&channels).Error
+	return channels, err
+}
+
+type membershipStore struct {
+	db *gorm.DB
+}
+
+func (s *membershipStore) Add(ctx context.Context, member *models.ChannelMember) error {
+	return s.db.WithContext(ctx).Create(member).Error
+}
+
+func (s *membershipStore) Get(ctx context.Context, channelID, userID models.UUIDv7) (*models.ChannelMember, error) {
+	var member models.ChannelMember
+	if err := s.db.WithContext(ctx).Where("channel_id = ? AND user_id = ?", channelID, userID).First(&member).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &member, nil
+}
+
+func (s *membershipStore) Remove(ctx context.Context, member *models.ChannelMember) error {
+	return s.db.WithContext(ctx).Delete(member).Error
+}
+
+func (s *membershipStore) CountMembers(ctx context.Context, channelID models.UUIDv7) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.ChannelMember{}).Where("channel_id = ?", channelID).Count(&count).Error
+	return count, err
+}
+
+func (s *membershipStore) CountMembersByChannel(ctx context.Context, channelIDs []models.UUIDv7) (map[models.UUIDv7]int64, error) {
+	counts := make(map[models.UUIDv7]int64, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ChannelID models.UUIDv7
+		Count     int64
+	}
+	err := s.db.WithContext(ctx).Model(&models.ChannelMember{}).
+		Select("channel_id, COUNT(*) AS count").
+		Where("channel_id IN ?", channelIDs).
+		Group("channel_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ChannelID] = row.Count
+	}
+	return counts, nil
+}
+
+func (s *membershipStore) ListMembers(ctx context.Context, channelID models.UUIDv7) ([]models.User, error) {
+	var members []models.User
+	err := s.db.WithContext(ctx).
+		Joins("JOIN channel_members ON users.id = channel_members.user_id").
+		Where("channel_members.channel_id = ? AND channel_members.deleted_at IS NULL", channelID).
+		Select("users.id, users.username, users.display_name, users.role, users.is_active, users.last_seen_at").
+		Find(&members).Error
+	return members, err
+}
+
+func (s *membershipStore) ListChannelIDs(ctx context.Context, userID models.UUIDv7) ([]models.UUIDv7, error) {
+	var channelIDs []models.UUIDv7
+	err := s.db.WithContext(ctx).Model(&models.ChannelMember{}).
+		Where("user_id = ?", userID).
+		Pluck("channel_id", &channelIDs).Error
+	return channelIDs, err
+}
+
+type messageStore struct {
+	db *gorm.DB
+}
+
+func (s *messageStore) Create(ctx context.Context, message *models.Message) error {
+	if message.ThreadID == nil {
+		return s.db.WithContext(ctx).Create(message).Error
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Message{}).
+			Where("id = ?", *message.ThreadID).
+			UpdateColumns(map[string]interface{}{
+				"reply_count":   gorm.Expr("reply_count + 1"),
+				"last_reply_at": message.CreatedAt,
+			}).Error
+	})
+}
+
+func (s *messageStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.Message, error) {
+	var message models.Message
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&message).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &message, nil
+}
+
+func (s *messageStore) GetInChannel(ctx context.Context, id, channelID models.UUIDv7) (*models.Message, error) {
+	var message models.Message
+	if err := s.db.WithContext(ctx).Where("id = ? AND channel_id = ?", id, channelID).First(&message).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &message, nil
+}
+
+func (s *messageStore) ListTopLevelBefore(ctx context.Context, channelID models.UUIDv7, before *models.UUIDv7, limit int) ([]models.Message, error) {
+	query := s.db.WithContext(ctx).
+		Preload("User").
+		Where("channel_id = ? AND (thread_id IS NULL OR also_sent_to_channel)", channelID)
+	if before != nil {
+		query = query.Where("id < ?", *before)
+	}
+
+	var messages []models.Message
+	err := query.Order("id DESC").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+func (s *messageStore) ListTopLevelAfter(ctx context.Context, channelID, after models.UUIDv7, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("channel_id = ? AND (thread_id IS NULL OR also_sent_to_channel) AND id > ?", channelID, after).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+func (s *messageStore) ListReplies(ctx context.Context, threadID models.UUIDv7, limit, offset int) ([]models.Message, error) {
+	var replies []models.Message
+	err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("thread_id = ?", threadID).
+		Order("created_at ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&replies).Error
+	return replies, err
+}
+
+func (s *messageStore) ListRecent(ctx context.Context, channelIDs []models.UUIDv7, since time.Time, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("channel_id IN ? AND (thread_id IS NULL OR also_sent_to_channel)", channelIDs).
+		Where("created_at > ?", since).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+func (s *messageStore) CountSince(ctx context.Context, channelIDs []models.UUIDv7, since time.Time, excludeUserID models.UUIDv7) (map[models.UUIDv7]int64, error) {
+	counts := make(map[models.UUIDv7]int64, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ChannelID models.UUIDv7
+		Count     int64
+	}
+	err := s.db.WithContext(ctx).Model(&models.Message{}).
+		Select("channel_id, COUNT(*) AS count").
+		Where("channel_id IN ? AND (thread_id IS NULL OR also_sent_to_channel)", channelIDs).
+		Where("created_at > ? AND user_id <> ? AND type = ?", since, excludeUserID, models.MessageTypeUser).
+		Group("channel_id").
+		Scan(&rows).Error
+	for _, row := range rows {
+		counts[row.ChannelID] = row.Count
+	}
+	return counts, err
+}
+
+func (s *messageStore) SetPinned(ctx context.Context, id models.UUIDv7, pinnedBy *models.UUIDv7, at *time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.Message{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"pinned_by": pinnedBy, "pinned_at": at}).Error
+}
+
+func (s *messageStore) ListPinned(ctx context.Context, channelID models.UUIDv7) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("channel_id = ? AND pinned_at IS NOT NULL", channelID).
+		Order("pinned_at DESC").
+		Find(&messages).Error
+	return messages, err
+}
+
+type bookmarkStore struct {
+	db *gorm.DB
+}
+
+func (s *bookmarkStore) Create(ctx context.Context, bookmark *models.ChannelBookmark) error {
+	return s.db.WithContext(ctx).Create(bookmark).Error
+}
+
+func (s *bookmarkStore) GetInChannel(ctx context.Context, id, channelID models.UUIDv7) (*models.ChannelBookmark, error) {
+	var bookmark models.ChannelBookmark
+	if err := s.db.WithContext(ctx).Where("id = ? AND channel_id = ?", id, channelID).First(&bookmark).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &bookmark, nil
+}
+
+func (s *bookmarkStore) Delete(ctx context.Context, bookmark *models.ChannelBookmark) error {
+	return s.db.WithContext(ctx).Delete(bookmark).Error
+}
+
+func (s *bookmarkStore) ListByChannel(ctx context.Context, channelID models.UUIDv7) ([]models.ChannelBookmark, error) {
+	var bookmarks []models.ChannelBookmark
+	err := s.db.WithContext(ctx).Where("channel_id = ?", channelID).Order("id ASC").Find(&bookmarks).Error
+	return bookmarks, err
+}
+
+type savedItemStore struct {
+	db *gorm.DB
+}
+
+func (s *savedItemStore) Create(ctx context.Context, item *models.SavedItem) error {
+	return s.db.WithContext(ctx).Create(item).Error
+}
+
+func (s *savedItemStore) Get(ctx context.Context, userID, messageID models.UUIDv7) (*models.SavedItem, error) {
+	var item models.SavedItem
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND message_id = ?", userID, messageID).First(&item).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &item, nil
+}
+
+func (s *savedItemStore) Delete(ctx context.Context, item *models.SavedItem) error {
+	return s.db.WithContext(ctx).Delete(item).Error
+}
+
+func (s *savedItemStore) List(ctx context.Context, userID models.UUIDv7) ([]models.SavedItem, error) {
+	var items []models.SavedItem
+	err := s.db.WithContext(ctx).
+		Preload("Message.User").
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Find(&items).Error
+	return items, err
+}
+
+type reminderStore struct {
+	db *gorm.DB
+}
+
+func (s *reminderStore) Create(ctx context.Context, reminder *models.Reminder) error {
+	return s.db.WithContext(ctx).Create(reminder).Error
+}
+
+func (s *reminderStore) GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.Reminder, error) {
+	var reminder models.Reminder
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&reminder).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &reminder, nil
+}
+
+func (s *reminderStore) Delete(ctx context.Context, reminder *models.Reminder) error {
+	return s.db.WithContext(ctx).Delete(reminder).Error
+}
+
+func (s *reminderStore) ListPending(ctx context.Context, userID models.UUIDv7) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND delivered_at IS NULL", userID).
+		Order("remind_at ASC").
+		Find(&reminders).Error
+	return reminders, err
+}
+
+func (s *reminderStore) ListDue(ctx context.Context, now time.Time, limit int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := s.db.WithContext(ctx).
+		Preload("Message").
+		Where("delivered_at IS NULL AND remind_at <= ?", now).
+		Order("remind_at ASC").
+		Limit(limit).
+		Find(&reminders).Error
+	return reminders, err
+}
+
+func (s *reminderStore) Deliver(ctx context.Context, reminder *models.Reminder, notification *models.Notification) (bool, error) {
+	delivered := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Reminder{}).
+			Where("id = ? AND delivered_at IS NULL", reminder.ID).
+			Update("delivered_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		if err := tx.Create(notification).Error; err != nil {
+			return err
+		}
+		reminder.DeliveredAt = &now
+		delivered = true
+		return nil
+	})
+	return delivered, err
+}
+
+type scheduledMessageStore struct {
+	db *gorm.DB
+}
+
+func (s *scheduledMessageStore) Create(ctx context.Context, scheduled *models.ScheduledMessage) error {
+	return s.db.WithContext(ctx).Create(scheduled).Error
+}
+
+func (s *scheduledMessageStore) GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.ScheduledMessage, error) {
+	var scheduled models.ScheduledMessage
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&scheduled).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &scheduled, nil
+}
+
+func (s *scheduledMessageStore) ListPending(ctx context.Context, userID models.UUIDv7) ([]models.ScheduledMessage, error) {
+	var scheduled []models.ScheduledMessage
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND status = ?", userID, models.ScheduledMessagePending).
+		Order("send_at ASC").
+		Find(&scheduled).Error
+	return scheduled, err
+}
+
+func (s *scheduledMessageStore) ListDue(ctx context.Context, now time.Time, limit int) ([]models.ScheduledMessage, error) {
+	var scheduled []models.ScheduledMessage
+	err := s.db.WithContext(ctx).
+		Where("status = ? AND send_at <= ?", models.ScheduledMessagePending, now).
+		Order("send_at ASC").
+		Limit(limit).
+		Find(&scheduled).Error
+	return scheduled, err
+}
+
+func (s *scheduledMessageStore) UpdatePending(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	result := s.db.WithContext(ctx).Model(scheduled).
+		Where("status = ?", models.ScheduledMessagePending).
+		Select("content", "thread_id", "send_at").
+		Updates(scheduled)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *scheduledMessageStore) DeletePending(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	result := s.db.WithContext(ctx).
+		Where("status = ?", models.ScheduledMessagePending).
+		Delete(scheduled)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *scheduledMessageStore) Claim(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.ScheduledMessage{}).
+		Where("id = ? AND status = ? AND updated_at = ?", scheduled.ID, models.ScheduledMessagePending, scheduled.UpdatedAt).
+		Update("status", models.ScheduledMessageSending)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	scheduled.Status = models.ScheduledMessageSending
+	return true, nil
+}
+
+func (s *scheduledMessageStore) Finish(ctx context.Context, scheduled *models.ScheduledMessage, notification *models.Notification) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(scheduled).
+			Select("status", "message_id", "failure_reason").
+			Updates(scheduled).Error; err != nil {
+			return err
+		}
+		if notification == nil {
+			return nil
+		}
+		return tx.Create(notification).Error
+	})
+}
+
+func (s *scheduledMessageStore) Requeue(ctx context.Context, claimedBefore time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Model(&models.ScheduledMessage{}).
+		Where("status = ? AND updated_at < ?", models.ScheduledMessageSending, claimedBefore).
+		Update("status", models.ScheduledMessagePending)
+	return result.RowsAffected, result.Error
+}
+
+type threadFollowStore struct {
+	db *gorm.DB
+}
+
+func (s *threadFollowStore) Get(ctx context.Context, threadID, userID models.UUIDv7) (*models.ThreadFollow, error) {
+	var follow models.ThreadFollow
+	if err := s.db.WithContext(ctx).Where("thread_id = ? AND user_id = ?", threadID, userID).First(&follow).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &follow, nil
+}
+
+func (s *threadFollowStore) Save(ctx context.Context, follow *models.ThreadFollow) error {
+	return s.db.WithContext(ctx).Save(follow).Error
+}
+
+func (s *threadFollowStore) Participate(ctx context.Context, threadID models.UUIDv7, userIDs ...models.UUIDv7) error {
+	follows := make([]models.ThreadFollow, 0, len(userIDs))
+	seen := make(map[models.UUIDv7]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if !seen[userID] {
+			seen[userID] = true
+			follows = append(follows, models.ThreadFollow{ThreadID: threadID, UserID: userID, Following: true})
+		}
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&follows).Error
+}
+
+func (s *threadFollowStore) MarkRead(ctx context.Context, threadID, userID models.UUIDv7, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.ThreadFollow{}).
+		Where("thread_id = ? AND user_id = ?", threadID, userID).
+		Where("last_read_at IS NULL OR last_read_at < ?", at).
+		Update("last_read_at", at).Error
+}
+
+func (s *threadFollowStore) ListFollowing(ctx context.Context, userID models.UUIDv7, limit int) ([]models.ThreadFollow, error) {
+	var follows []models.ThreadFollow
+	err := s.db.WithContext(ctx).
+		Joins("JOIN messages ON messages.id = thread_follows.thread_id AND messages.deleted_at IS NULL").
+		Where("thread_follows.user_id = ? AND thread_follows.following", userID).
+		Order("messages.last_reply_at DESC, messages.id DESC").
+		Limit(limit).
+		Find(&follows).Error
+	if err != nil || len(follows) == 0 {
+		return follows, err
+	}
+
+	threadIDs := make([]models.UUIDv7, len(follows))
+	for i, follow := range follows {
+		threadIDs[i] = follow.ThreadID
+	}
+	var roots []models.Message
+	if err := s.db.WithContext(ctx).Preload("User").Where("id IN ?", threadIDs).Find(&roots).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[models.UUIDv7]models.Message, len(roots))
+	for _, root := range roots {
+		byID[root.ID] = root
+	}
+	for i := range follows {
+		follows[i].Thread = byID[follows[i].ThreadID]
+	}
+	return follows, nil
+}
+
+func (s *threadFollowStore) ListFollowers(ctx context.Context, threadID models.UUIDv7) ([]models.UUIDv7, error) {
+	var userIDs []models.UUIDv7
+	err := s.db.WithContext(ctx).Model(&models.ThreadFollow{}).
+		Where("thread_id = ? AND following", threadID).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+func (s *threadFollowStore) CountUnread(ctx context.Context, userID models.UUIDv7) (map[models.UUIDv7]int64, error) {
+	var rows []struct {
+		ThreadID models.UUIDv7
+		Count    int64
+	}
+	err := s.db.WithContext(ctx).Model(&models.ThreadFollow{}).
+		Select("thread_follows.thread_id, COUNT(messages.id) AS count").
+		Joins("JOIN messages ON messages.thread_id = thread_follows.thread_id AND messages.deleted_at IS NULL").
+		Where("thread_follows.user_id = ? AND thread_follows.following", userID).
+		Where("messages.user_id <> thread_follows.user_id").
+		Where("thread_follows.last_read_at IS NULL OR messages.created_at > thread_follows.last_read_at").
+		Group("thread_follows.thread_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[models.UUIDv7]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ThreadID] = row.Count
+	}
+	return counts, nil
+}
+
+type notificationStore struct {
+	db *gorm.DB
+}
+
+func (s *notificationStore) Create(ctx context.Context, notification *models.Notification) error {
+	return s.db.WithContext(ctx).Create(notification).Error
+}
+
+func (s *notificationStore) CreateMany(ctx context.Context, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Create(&notifications).Error
+}
+
+func (s *notificationStore) List(ctx context.Context, userID models.UUIDv7, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *notificationStore) MarkRead(ctx context.Context, id, userID models.UUIDv7, at time.Time) error {
+	result := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("read_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *notificationStore) CountUnread(ctx context.Context, userID models.UUIDv7) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (s *notificationStore) MarkAllRead(ctx context.Context, userID models.UUIDv7, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", at).Error
+}
+
+func (s *notificationStore) ListEmailDue(ctx context.Context, kinds []models.NotificationKind, before time.Time, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := s.db.WithContext(ctx).
+		Where("emailed_at IS NULL AND read_at IS NULL AND NOT quiet").
+		Where("kind IN ? AND created_at <= ?", kinds, before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *notificationStore) MarkEmailed(ctx context.Context, ids []models.UUIDv7, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id IN ?", ids).
+		Update("emailed_at", at).Error
+}
+
+func (s *notificationStore) ListPushDue(ctx context.Context, since time.Time, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := s.db.WithContext(ctx).
+		Where("pushed_at IS NULL AND NOT quiet AND created_at > ?", since).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *notificationStore) MarkPushed(ctx context.Context, ids []models.UUIDv7, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id IN ?", ids).
+		Update("pushed_at", at).Error
+}
+
+type preferenceStore struct {
+	db *gorm.DB
+}
+
+func (s *preferenceStore) GetSettings(ctx context.Context, userID models.UUIDv7) (*models.NotificationSettings, error) {
+	var settings models.NotificationSettings
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&settings).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &settings, nil
+}
+
+func (s *preferenceStore) SaveSettings(ctx context.Context, settings *models.NotificationSettings) error {
+	return s.db.WithContext(ctx).Save(settings).Error
+}
+
+func (s *preferenceStore) ListSettings(ctx context.Context, userIDs []models.UUIDv7) ([]models.NotificationSettings, error) {
+	var settings []models.NotificationSettings
+	if len(userIDs) == 0 {
+		return settings, nil
+	}
+	err := s.db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&settings).Error
+	return settings, err
+}
+
+func (s *preferenceStore) GetChannel(ctx context.Context, channelID, userID models.UUIDv7) (*models.ChannelNotificationPreference, error) {
+	var preference models.ChannelNotificationPreference
+	if err := s.db.WithContext(ctx).Where("channel_id = ? AND user_id = ?", channelID, userID).First(&preference).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &preference, nil
+}
+
+func (s *preferenceStore) SaveChannel(ctx context.Context, preference *models.ChannelNotificationPreference) error {
+	return s.db.WithContext(ctx).Save(preference).Error
+}
+
+func (s *preferenceStore) ListByChannel(ctx context.Context, channelID models.UUIDv7) ([]models.ChannelNotificationPreference, error) {
+	var preferences []models.ChannelNotificationPreference
+	err := s.db.WithContext(ctx).Where("channel_id = ?", channelID).Find(&preferences).Error
+	return preferences, err
+}
+
+func (s *preferenceStore) ListByUser(ctx context.Context, userID models.UUIDv7) ([]models.ChannelNotificationPreference, error) {
+	var preferences []models.ChannelNotificationPreference
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&preferences).Error
+	return preferences, err
+}
+
+func (s *preferenceStore) ListDigestSubscribers(ctx context.Context) ([]models.NotificationSettings, error) {
+	var settings []models.NotificationSettings
+	err := s.db.WithContext(ctx).Where("digest_enabled").Find(&settings).Error
+	return settings, err
+}
+
+func (s *preferenceStore) MarkDigestSent(ctx context.Context, userID models.UUIDv7, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.NotificationSettings{}).
+		Where("user_id = ?", userID).
+		Update("digest_sent_at", at).Error
+}
+
+type pushStore struct {
+	db *gorm.DB
+}
+
+func (s *pushStore) Save(ctx context.Context, subscription *models.PushSubscription) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		replaced := tx.Where("endpoint = ?", subscription.Endpoint)
+		if subscription.SessionID != "" {
+			replaced = replaced.Or("user_id = ? AND session_id = ?", subscription.UserID, subscription.SessionID)
+		}
+		if err := replaced.Delete(&models.PushSubscription{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(subscription).Error
+	})
+}
+
+func (s *pushStore) GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.PushSubscription, error) {
+	var subscription models.PushSubscription
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&subscription).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &subscription, nil
+}
+
+func (s *pushStore) Delete(ctx context.Context, subscription *models.PushSubscription) error {
+	return s.db.WithContext(ctx).Delete(subscription).Error
+}
+
+func (s *pushStore) DeleteByEndpoint(ctx context.Context, endpoint string) error {
+	return s.db.WithContext(ctx).Where("endpoint = ?", endpoint).Delete(&models.PushSubscription{}).Error
+}
+
+func (s *pushStore) ListByUsers(ctx context.Context, userIDs []models.UUIDv7) ([]models.PushSubscription, error) {
+	var subscriptions []models.PushSubscription
+	if len(userIDs) == 0 {
+		return subscriptions, nil
+	}
+	err := s.db.WithContext(ctx).Where("user_id IN ?", userIDs).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (s *pushStore) ServerKey(ctx context.Context) (*models.PushServerKey, error) {
+	var key models.PushServerKey
+	if err := s.db.WithContext(ctx).Order("id").First(&key).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &key, nil
+}
+
+func (s *pushStore) CreateServerKey(ctx context.Context, key *models.PushServerKey) (*models.PushServerKey, error) {
+	var stored models.PushServerKey
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Order("id").First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := tx.Create(key).Error; err != nil {
+				return err
+			}
+			stored = *key
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+type groupStore struct {
+	db *gorm.DB
+}
+
+func (s *groupStore) Create(ctx context.Context, group *models.UserGroup) error {
+	return s.db.WithContext(ctx).Create(group).Error
+}
+
+func (s *groupStore) Update(ctx context.Context, group *models.UserGroup) error {
+	return s.db.WithContext(ctx).Save(group).Error
+}
+
+func (s *groupStore) Delete(ctx context.Context, group *models.UserGroup) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.UserGroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.UserGroupChannel{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
+
+func (s *groupStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.UserGroup, error) {
+	var group models.UserGroup
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &group, nil
+}
+
+func (s *groupStore) GetByHandle(ctx context.Context, handle string) (*models.UserGroup, error) {
+	var group models.UserGroup
+	if err := s.db.WithContext(ctx).Where("handle = ?", handle).First(&group).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &group, nil
+}
+
+func (s *groupStore) List(ctx context.Context) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	err := s.db.WithContext(ctx).Order("handle ASC").Find(&groups).Error
+	return groups, err
+}
+
+func (s *groupStore) ListByHandles(ctx context.Context, handles []string) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	if len(handles) == 0 {
+		return groups, nil
+	}
+	err := s.db.WithContext(ctx).Where("handle IN ?", handles).Find(&groups).Error
+	return groups, err
+}
+
+func (s *groupStore) AddMember(ctx context.Context, member *models.UserGroupMember) error {
+	return s.db.WithContext(ctx).Create(member).Error
+}
+
+func (s *groupStore) GetMember(ctx context.Context, groupID, userID models.UUIDv7) (*models.UserGroupMember, error) {
+	var member models.UserGroupMember
+	if err := s.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &member, nil
+}
+
+func (s *groupStore) RemoveMember(ctx context.Context, member *models.UserGroupMember) error {
+	return s.db.WithContext(ctx).Delete(member).Error
+}
+
+func (s *groupStore) ListMembers(ctx context.Context, groupID models.UUIDv7) ([]models.UserGroupMember, error) {
+	var members []models.UserGroupMember
+	err := s.db.WithContext(ctx).
+		Preload("User").
+		Where("group_id = ?", groupID).
+		Order("id ASC").
+		Find(&members).Error
+	return members, err
+}
+
+func (s *groupStore) ListMemberIDs(ctx context.Context, groupIDs []models.UUIDv7) (map[models.UUIDv7][]models.UUIDv7, error) {
+	memberIDs := make(map[models.UUIDv7][]models.UUIDv7, len(groupIDs))
+	if len(groupIDs) == 0 {
+		return memberIDs, nil
+	}
+
+	var members []models.UserGroupMember
+	err := s.db.WithContext(ctx).
+		Select("group_id, user_id").
+		Where("group_id IN ?", groupIDs).
+		Order("id ASC").
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		memberIDs[member.GroupID] = append(memberIDs[member.GroupID], member.UserID)
+	}
+	return memberIDs, nil
+}
+
+func (s *groupStore) SetChannels(ctx context.Context, groupID models.UUIDv7, channelIDs []models.UUIDv7) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.UserGroupChannel{}).Error; err != nil {
+			return err
+		}
+		if len(channelIDs) == 0 {
+			return nil
+		}
+
+		channels := make([]models.UserGroupChannel, len(channelIDs))
+		for i, channelID := range channelIDs {
+			channels[i] = models.UserGroupChannel{GroupID: groupID, ChannelID: channelID}
+		}
+		return tx.Create(&channels).Error
+	})
+}
+
+func (s *groupStore) ListChannelIDs(ctx context.Context, groupID models.UUIDv7) ([]models.UUIDv7, error) {
+	var channelIDs []models.UUIDv7
+	err := s.db.WithContext(ctx).Model(&models.UserGroupChannel{}).
+		Where("group_id = ?", groupID).
+		Order("id ASC").
+		Pluck("channel_id", &channelIDs).Error
+	return channelIDs, err
+}
+
+type retentionStore struct {
+	db *gorm.DB
+}
+
+func (s *retentionStore) SetChannel(ctx context.Context, channelID models.UUIDv7, days *int, legalHold bool) error {
+	// A map, so that nil and false are written too
+	return s.db.WithContext(ctx).Model(&models.Channel{}).Where("id = ?", channelID).
+		Updates(map[string]any{"retention_days": days, "legal_hold": legalHold}).Error
+}
+
+func (s *retentionStore) SetUserHold(ctx context.Context, userID models.UUIDv7, legalHold bool) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("legal_hold", legalHold).Error
+}
+
+func (s *retentionStore) ListChannels(ctx context.Context) ([]models.Channel, error) {
+	var channels []models.Channel
+	err := s.db.WithContext(ctx).Where("retention_days IS NOT NULL OR legal_hold = ?", true).Order("name").Find(&channels).Error
+	return channels, err
+}
+
+func (s *retentionStore) ListUserHolds(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := s.db.WithContext(ctx).Where("legal_hold = ?", true).Order("username").Find(&users).Error
+	return users, err
+}
+
+type erasureStore struct {
+	db *gorm.DB
+}
+
+func (s *erasureStore) Create(ctx context.Context, request *models.ErasureRequest) error {
+	return s.db.WithContext(ctx).Create(request).Error
+}
+
+func (s *erasureStore) GetByID(ctx context.Context, id models.UUIDv7) (*models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	if err := s.db.WithContext(ctx).Preload("User").Where("id = ?", id).First(&request).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &request, nil
+}
+
+func (s *erasureStore) Latest(ctx context.Context, userID models.UUIDv7) (*models.ErasureRequest, error) {
+	var request models.ErasureRequest
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").First(&request).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &request, nil
+}
+
+func (s *erasureStore) HasOpen(ctx context.Context, userID models.UUIDv7) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.ErasureRequest{}).
+		Where("user_id = ? AND status IN ?", userID, []models.ErasureStatus{models.ErasureStatusPending, models.ErasureStatusApproved}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *erasureStore) List(ctx context.Context, status models.ErasureStatus) ([]models.ErasureRequest, error) {
+	query := s.db.WithContext(ctx).Preload("User").Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var requests []models.ErasureRequest
+	err := query.Find(&requests).Error
+	return requests, err
+}
+
+func (s *erasureStore) UpdatePending(ctx context.Context, request *models.ErasureRequest) (bool, error) {
+	result := s.db.WithContext(ctx).Model(request).
+		Where("status = ?", models.ErasureStatusPending).
+		Select("status", "reviewed_by", "reviewed_at", "review_note").
+		Updates(request)
+	return result.RowsAffected > 0, result.Error
+}
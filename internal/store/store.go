@@ -0,0 +1,283 @@
+// Package store defines the persistence interfaces used by the service layer.
+// sqlstore implements them on GORM and memstore provides an in-memory fake for tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"turnate/internal/models"
+)
+
+// ErrNotFound is returned when a lookup matches no record
+var ErrNotFound = errors.New("record not found")
+
+type UserStore interface {
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id models.UUIDv7) (*models.User, error)
+	// GetByLogin finds a user by username or email
+	GetByLogin(ctx context.Context, login string) (*models.User, error)
+	ExistsByUsernameOrEmail(ctx context.Context, username, email string) (bool, error)
+	// ExistsByUsernameIgnoreCase reports whether a username matches regardless
+	// of case, as mentions do
+	ExistsByUsernameIgnoreCase(ctx context.Context, username string) (bool, error)
+	List(ctx context.Context) ([]models.User, error)
+	// ListByUsernames returns the users with the given usernames, ignoring unknown ones
+	ListByUsernames(ctx context.Context, usernames []string) ([]models.User, error)
+	TouchLastSeen(ctx context.Context, id models.UUIDv7, at time.Time) error
+	CountActiveAdmins(ctx context.Context) (int64, error)
+}
+
+type ChannelStore interface {
+	Create(ctx context.Context, channel *models.Channel) error
+	GetByID(ctx context.Context, id models.UUIDv7) (*models.Channel, error)
+	GetByName(ctx context.Context, name string) (*models.Channel, error)
+	// List returns all channels, or when visibleTo is set only public channels
+	// and the private channels that user belongs to
+	List(ctx context.Context, visibleTo *models.UUIDv7) ([]models.Channel, error)
+	// ListByIDs returns the channels with the given IDs, ignoring unknown ones
+	ListByIDs(ctx context.Context, ids []models.UUIDv7) ([]models.Channel, error)
+}
+
+type MembershipStore interface {
+	Add(ctx context.Context, member *models.ChannelMember) error
+	Get(ctx context.Context, channelID, userID models.UUIDv7) (*models.ChannelMember, error)
+	Remove(ctx context.Context, member *models.ChannelMember) error
+	CountMembers(ctx context.Context, channelID models.UUIDv7) (int64, error)
+	// CountMembersByChannel counts the members of several channels in one lookup
+	CountMembersByChannel(ctx context.Context, channelIDs []models.UUIDv7) (map[models.UUIDv7]int64, error)
+	ListMembers(ctx context.Context, channelID models.UUIDv7) ([]models.User, error)
+	ListChannelIDs(ctx context.Context, userID models.UUIDv7) ([]models.UUIDv7, error)
+}
+
+type MessageStore interface {
+	GetByID(ctx context.Context, id models.UUIDv7) (*models.Message, error)
+	// Create stores a message. Creating a reply also bumps the reply count and
+	// last reply time of its thread root in the same transaction.
+	Create(ctx context.Context, message *models.Message) error
+	GetInChannel(ctx context.Context, id, channelID models.UUIDv7) (*models.Message, error)
+	// ListTopLevelBefore returns timeline messages with an ID below before, or
+	// the latest when before is nil, newest first and with User loaded. The
+	// timeline is the top-level messages plus replies also sent to the channel.
+	// UUIDv7 IDs sort by creation time, so this walks back through channel history.
+	ListTopLevelBefore(ctx context.Context, channelID models.UUIDv7, before *models.UUIDv7, limit int) ([]models.Message, error)
+	// ListTopLevelAfter returns timeline messages with an ID above after, oldest first, with User loaded
+	ListTopLevelAfter(ctx context.Context, channelID, after models.UUIDv7, limit int) ([]models.Message, error)
+	// ListReplies returns thread replies oldest first, with User loaded
+	ListReplies(ctx context.Context, threadID models.UUIDv7, limit, offset int) ([]models.Message, error)
+	// ListRecent returns timeline messages in the given channels since a point in time, newest first
+	ListRecent(ctx context.Context, channelIDs []models.UUIDv7, since time.Time, limit int) ([]models.Message, error)
+	// CountSince counts, per channel, the timeline messages posted since a
+	// point in time by anyone but excludeUserID, in one lookup
+	CountSince(ctx context.Context, channelIDs []models.UUIDv7, since time.Time, excludeUserID models.UUIDv7) (map[models.UUIDv7]int64, error)
+	// SetPinned records who pinned a message and when; a nil pinnedBy unpins it
+	SetPinned(ctx context.Context, id models.UUIDv7, pinnedBy *models.UUIDv7, at *time.Time) error
+	// ListPinned returns the pinned messages of a channel, most recently pinned first, with User loaded
+	ListPinned(ctx context.Context, channelID models.UUIDv7) ([]models.Message, error)
+}
+
+type BookmarkStore interface {
+	Create(ctx context.Context, bookmark *models.ChannelBookmark) error
+	GetInChannel(ctx context.Context, id, channelID models.UUIDv7) (*models.ChannelBookmark, error)
+	Delete(ctx context.Context, bookmark *models.ChannelBookmark) error
+	// ListByChannel returns a channel's bookmarks in the order they were added
+	ListByChannel(ctx context.Context, channelID models.UUIDv7) ([]models.ChannelBookmark, error)
+}
+
+type SavedItemStore interface {
+	Create(ctx context.Context, item *models.SavedItem) error
+	Get(ctx context.Context, userID, messageID models.UUIDv7) (*models.SavedItem, error)
+	Delete(ctx context.Context, item *models.SavedItem) error
+	// List returns a user's saved items, most recently saved first, with Message and its User loaded
+	List(ctx context.Context, userID models.UUIDv7) ([]models.SavedItem, error)
+}
+
+type ReminderStore interface {
+	Create(ctx context.Context, reminder *models.Reminder) error
+	GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.Reminder, error)
+	Delete(ctx context.Context, reminder *models.Reminder) error
+	// ListPending returns a user's undelivered reminders, soonest first
+	ListPending(ctx context.Context, userID models.UUIDv7) ([]models.Reminder, error)
+	// ListDue returns undelivered reminders due at or before now, oldest first, with Message loaded
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.Reminder, error)
+	// Deliver marks a reminder delivered and stores its notification atomically.
+	// It reports false when the reminder was already delivered or cancelled.
+	Deliver(ctx context.Context, reminder *models.Reminder, notification *models.Notification) (bool, error)
+}
+
+type ScheduledMessageStore interface {
+	Create(ctx context.Context, scheduled *models.ScheduledMessage) error
+	GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.ScheduledMessage, error)
+	// ListPending returns a user's pending scheduled messages, soonest first
+	ListPending(ctx context.Context, userID models.UUIDv7) ([]models.ScheduledMessage, error)
+	// ListDue returns pending scheduled messages due at or before now, oldest first
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.ScheduledMessage, error)
+	// UpdatePending saves the content, thread and send time of a scheduled
+	// message. It reports false when the message is no longer pending.
+	UpdatePending(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error)
+	// DeletePending deletes a scheduled message, reporting false when it is no longer pending
+	DeletePending(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error)
+	// Claim moves a pending scheduled message to sending so that only one
+	// sender posts it. It reports false when the message was claimed,
+	// cancelled or edited since it was loaded.
+	Claim(ctx context.Context, scheduled *models.ScheduledMessage) (bool, error)
+	// Finish records the outcome of a claimed message and stores the
+	// notification about it, if any, atomically
+	Finish(ctx context.Context, scheduled *models.ScheduledMessage, notification *models.Notification) error
+	// Requeue moves messages claimed before the given time, whose sender
+	// stopped before finishing them, back to pending. It returns how many it moved.
+	Requeue(ctx context.Context, claimedBefore time.Time) (int64, error)
+}
+
+type ThreadFollowStore interface {
+	Get(ctx context.Context, threadID, userID models.UUIDv7) (*models.ThreadFollow, error)
+	// Save creates or updates a follow
+	Save(ctx context.Context, follow *models.ThreadFollow) error
+	// Participate makes the users follow a thread unless they already have a
+	// follow record, so an earlier unfollow is respected
+	Participate(ctx context.Context, threadID models.UUIDv7, userIDs ...models.UUIDv7) error
+	// MarkRead moves a follower's read position forward to at
+	MarkRead(ctx context.Context, threadID, userID models.UUIDv7, at time.Time) error
+	// ListFollowing returns the threads a user follows, most recently active
+	// first, with Thread and its User loaded
+	ListFollowing(ctx context.Context, userID models.UUIDv7, limit int) ([]models.ThreadFollow, error)
+	// ListFollowers returns the IDs of the users following a thread
+	ListFollowers(ctx context.Context, threadID models.UUIDv7) ([]models.UUIDv7, error)
+	// CountUnread counts, per followed thread, the replies by others since the
+	// user last read it, in one lookup
+	CountUnread(ctx context.Context, userID models.UUIDv7) (map[models.UUIDv7]int64, error)
+}
+
+type NotificationStore interface {
+	Create(ctx context.Context, notification *models.Notification) error
+	// CreateMany stores the notifications for one event in a single statement
+	CreateMany(ctx context.Context, notifications []models.Notification) error
+	// List returns a user's newest notifications first
+	List(ctx context.Context, userID models.UUIDv7, limit int) ([]models.Notification, error)
+	CountUnread(ctx context.Context, userID models.UUIDv7) (int64, error)
+	// MarkRead marks one of the user's notifications read, returning ErrNotFound if it is not theirs
+	MarkRead(ctx context.Context, id, userID models.UUIDv7, at time.Time) error
+	MarkAllRead(ctx context.Context, userID models.UUIDv7, at time.Time) error
+	// ListEmailDue returns unread, non-quiet notifications of the given kinds
+	// created at or before before that the email job has not handled, oldest first
+	ListEmailDue(ctx context.Context, kinds []models.NotificationKind, before time.Time, limit int) ([]models.Notification, error)
+	// MarkEmailed records that the email job handled the notifications
+	MarkEmailed(ctx context.Context, ids []models.UUIDv7, at time.Time) error
+	// ListPushDue returns non-quiet notifications created after since that the
+	// push job has not handled, oldest first
+	ListPushDue(ctx context.Context, since time.Time, limit int) ([]models.Notification, error)
+	// MarkPushed records that the push job handled the notifications
+	MarkPushed(ctx context.Context, ids []models.UUIDv7, at time.Time) error
+}
+
+type NotificationPreferenceStore interface {
+	GetSettings(ctx context.Context, userID models.UUIDv7) (*models.NotificationSettings, error)
+	// SaveSettings creates or updates a user's settings
+	SaveSettings(ctx context.Context, settings *models.NotificationSettings) error
+	// ListSettings returns the settings of those users that have any
+	ListSettings(ctx context.Context, userIDs []models.UUIDv7) ([]models.NotificationSettings, error)
+	GetChannel(ctx context.Context, channelID, userID models.UUIDv7) (*models.ChannelNotificationPreference, error)
+	// SaveChannel creates or updates a channel preference
+	SaveChannel(ctx context.Context, preference *models.ChannelNotificationPreference) error
+	// ListByChannel returns every member preference for a channel
+	ListByChannel(ctx context.Context, channelID models.UUIDv7) ([]models.ChannelNotificationPreference, error)
+	// ListByUser returns a user's preferences across channels
+	ListByUser(ctx context.Context, userID models.UUIDv7) ([]models.ChannelNotificationPreference, error)
+	// ListDigestSubscribers returns the settings of users with the daily digest on
+	ListDigestSubscribers(ctx context.Context) ([]models.NotificationSettings, error)
+	// MarkDigestSent records when a user's digest was last sent
+	MarkDigestSent(ctx context.Context, userID models.UUIDv7, at time.Time) error
+}
+
+type PushStore interface {
+	// Save registers a subscription, taking over an existing one with the same
+	// endpoint, and replaces any other subscription of the same session
+	Save(ctx context.Context, subscription *models.PushSubscription) error
+	GetForUser(ctx context.Context, id, userID models.UUIDv7) (*models.PushSubscription, error)
+	Delete(ctx context.Context, subscription *models.PushSubscription) error
+	// DeleteByEndpoint removes the subscription for an endpoint, if any
+	DeleteByEndpoint(ctx context.Context, endpoint string) error
+	// ListByUsers returns the subscriptions of several users in one lookup
+	ListByUsers(ctx context.Context, userIDs []models.UUIDv7) ([]models.PushSubscription, error)
+	// ServerKey returns the stored VAPID key pair, or ErrNotFound
+	ServerKey(ctx context.Context) (*models.PushServerKey, error)
+	// CreateServerKey stores the VAPID key pair unless one exists, and returns the stored pair
+	CreateServerKey(ctx context.Context, key *models.PushServerKey) (*models.PushServerKey, error)
+}
+
+type GroupStore interface {
+	Create(ctx context.Context, group *models.UserGroup) error
+	Update(ctx context.Context, group *models.UserGroup) error
+	// Delete removes a group together with its memberships and default channels
+	Delete(ctx context.Context, group *models.UserGroup) error
+	GetByID(ctx context.Context, id models.UUIDv7) (*models.UserGroup, error)
+	GetByHandle(ctx context.Context, handle string) (*models.UserGroup, error)
+	// List returns every group ordered by handle
+	List(ctx context.Context) ([]models.UserGroup, error)
+	// ListByHandles returns the groups with the given handles, ignoring unknown ones
+	ListByHandles(ctx context.Context, handles []string) ([]models.UserGroup, error)
+	AddMember(ctx context.Context, member *models.UserGroupMember) error
+	GetMember(ctx context.Context, groupID, userID models.UUIDv7) (*models.UserGroupMember, error)
+	RemoveMember(ctx context.Context, member *models.UserGroupMember) error
+	// ListMembers returns a group's members in the order they were added, with User loaded
+	ListMembers(ctx context.Context, groupID models.UUIDv7) ([]models.UserGroupMember, error)
+	// ListMemberIDs returns the member IDs of several groups in one lookup
+	ListMemberIDs(ctx context.Context, groupIDs []models.UUIDv7) (map[models.UUIDv7][]models.UUIDv7, error)
+	// SetChannels replaces a group's default channels
+	SetChannels(ctx context.Context, groupID models.UUIDv7, channelIDs []models.UUIDv7) error
+	// ListChannelIDs returns a group's default channels in the order they were set
+	ListChannelIDs(ctx context.Context, groupID models.UUIDv7) ([]models.UUIDv7, error)
+}
+
+// RetentionStore manages the per-channel retention settings and legal holds
+type RetentionStore interface {
+	// SetChannel saves a channel's retention period, nil for the workspace
+	// default, and its legal hold
+	SetChannel(ctx context.Context, channelID models.UUIDv7, days *int, legalHold bool) error
+	// SetUserHold puts a user on legal hold or releases them
+	SetUserHold(ctx context.Context, userID models.UUIDv7, legalHold bool) error
+	// ListChannels returns the channels with a retention period of their own
+	// or on legal hold, ordered by name
+	ListChannels(ctx context.Context) ([]models.Channel, error)
+	// ListUserHolds returns the users on legal hold, ordered by username
+	ListUserHolds(ctx context.Context) ([]models.User, error)
+}
+
+// ErasureStore manages account erasure requests. Erasing the accounts is the
+// erasure package's job.
+type ErasureStore interface {
+	Create(ctx context.Context, request *models.ErasureRequest) error
+	// GetByID returns a request with User loaded
+	GetByID(ctx context.Context, id models.UUIDv7) (*models.ErasureRequest, error)
+	// Latest returns the user's most recent request
+	Latest(ctx context.Context, userID models.UUIDv7) (*models.ErasureRequest, error)
+	// HasOpen reports whether the user has a pending or approved request
+	HasOpen(ctx context.Context, userID models.UUIDv7) (bool, error)
+	// List returns requests with User loaded, newest first, only those with
+	// the given status unless it is empty
+	List(ctx context.Context, status models.ErasureStatus) ([]models.ErasureRequest, error)
+	// UpdatePending saves the status and review of a request. It reports false
+	// when the request is no longer pending.
+	UpdatePending(ctx context.Context, request *models.ErasureRequest) (bool, error)
+}
+
+// Stores bundles every store so they can be injected together
+type Stores struct {
+	Users         UserStore
+	Channels      ChannelStore
+	Members       MembershipStore
+	Messages      MessageStore
+	Bookmarks     BookmarkStore
+	SavedItems    SavedItemStore
+	Reminders     ReminderStore
+	Scheduled     ScheduledMessageStore
+	ThreadFollows ThreadFollowStore
+	Notifications NotificationStore
+	Preferences   NotificationPreferenceStore
+	Push          PushStore
+	Groups        GroupStore
+	Retention     RetentionStore
+	Erasures      ErasureStore
+}
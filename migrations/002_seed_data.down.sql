@@ -1,6 +0,0 @@
--- Rollback seed data
-
-DELETE FROM messages WHERE id = '01234567-89ab-7def-8901-234567890125';
-DELETE FROM channel_members WHERE channel_id = '01234567-89ab-7def-8901-234567890124' AND user_id = '01234567-89ab-7def-8901-234567890123';
-DELETE FROM channels WHERE id = '01234567-89ab-7def-8901-234567890124';
-DELETE FROM users WHERE id = '01234567-89ab-7def-8901-234567890123';
\ No newline at end of file
@@ -57,13 +57,16 @@ if [ -f "./bin/turnate" ]; then
     echo ""
     echo "🎉 Setup complete! Turnate is ready to go."
     echo ""
+    echo "👤 Create an admin and the general channel:"
+    echo "   ./bin/turnate user create --username admin --email admin@example.com --admin"
+    echo "   ./bin/turnate channel create --name general --owner admin"
+    echo ""
     echo "🚀 To start Turnate:"
     echo "   make run"
     echo "   # or"
-    echo "   ./bin/turnate"
+    echo "   ./bin/turnate serve"
     echo ""
     echo "🌐 Then visit: http://localhost:8080"
-    echo "👤 Default admin: admin / admin123"
     echo ""
     echo "🛠️  Development commands:"
     echo "   make help      # Show all available commands"
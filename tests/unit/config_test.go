@@ -0,0 +1,186 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"turnate/internal/config"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *ConfigTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+
+	// Make sure the host environment does not leak into the tests
+	for _, key := range []string{"TURNATE_ENV", "PORT", "DATABASE_URL", "JWT_SECRET", "CORS_ALLOWED_ORIGINS", "BCRYPT_COST", "REQUEST_TIMEOUT"} {
+		suite.T().Setenv(key, "")
+	}
+}
+
+func (suite *ConfigTestSuite) writeFile(name, content string) string {
+	path := filepath.Join(suite.dir, name)
+	suite.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func (suite *ConfigTestSuite) TestDefaults() {
+	t := suite.T()
+
+	cfg, err := config.Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, config.EnvDevelopment, cfg.Environment)
+	assert.Equal(t, 30*time.Second, cfg.RequestTimeout.Std())
+	assert.Equal(t, 20, cfg.RateLimits.Global.Burst)
+	assert.False(t, cfg.Log.SQL.Enabled, "SQL logging is off by default")
+	assert.True(t, cfg.SQLite.WAL)
+	assert.Equal(t, 24*time.Hour, cfg.Backup.Interval.Std())
+	assert.Equal(t, 7, cfg.Backup.Keep)
+	assert.Equal(t, "exports", cfg.Export.Dir)
+	assert.Equal(t, 3, cfg.Export.Keep)
+	assert.Equal(t, 0, cfg.Retention.Days, "messages are kept forever by default")
+	assert.Equal(t, time.Hour, cfg.Retention.Interval.Std())
+	assert.Equal(t, config.ErasureMessagesKeep, cfg.Erasure.Messages)
+	assert.Empty(t, cfg.TrustedProxies, "no proxy is trusted by default")
+}
+
+func (suite *ConfigTestSuite) TestYAMLFileWithEnvOverride() {
+	t := suite.T()
+
+	path := suite.writeFile("turnate.yaml", `
+port: "9090"
+request_timeout: 15s
+allowed_origins:
+  - https://chat.example.com
+rate_limits:
+  auth:
+    requests: 10
+    per: 1m
+    burst: 3
+db_pool:
+  max_open_conns: 4
+`)
+	suite.T().Setenv("PORT", "7070")
+
+	cfg, err := config.Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "7070", cfg.Port)
+	assert.Equal(t, 15*time.Second, cfg.RequestTimeout.Std())
+	assert.Equal(t, []string{"https://chat.example.com"}, cfg.AllowedOrigins)
+	assert.Equal(t, 10, cfg.RateLimits.Auth.Requests)
+	assert.Equal(t, 3, cfg.RateLimits.Auth.Burst)
+	assert.Equal(t, 4, cfg.DBPool.MaxOpenConns)
+
+	// Sections not mentioned in the file keep their defaults
+	assert.Equal(t, 10, cfg.RateLimits.Global.Requests)
+}
+
+func (suite *ConfigTestSuite) TestTOMLFile() {
+	t := suite.T()
+
+	path := suite.writeFile("turnate.toml", `
+port = "9191"
+
+[uploads]
+max_bytes = 1024
+
+[smtp]
+host = "localhost"
+port = 2525
+from = "turnate@example.com"
+`)
+
+	cfg, err := config.Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "9191", cfg.Port)
+	assert.Equal(t, int64(1024), cfg.Uploads.MaxBytes)
+	assert.Equal(t, 2525, cfg.SMTP.Port)
+}
+
+func (suite *ConfigTestSuite) TestUnknownKeysRejected() {
+	t := suite.T()
+
+	path := suite.writeFile("turnate.yaml", "jwt_secrte: typo\n")
+
+	_, err := config.Load(path)
+	assert.Error(t, err)
+}
+
+func (suite *ConfigTestSuite) TestInvalidValuesReported() {
+	t := suite.T()
+
+	path := suite.writeFile("turnate.yaml", `
+port: "http"
+bcrypt_cost: 2
+rate_limits:
+  api:
+    requests: 0
+    per: 1s
+    burst: 1
+`)
+	suite.T().Setenv("REQUEST_TIMEOUT", "soon")
+
+	_, err := config.Load(path)
+	assert.ErrorContains(t, err, "REQUEST_TIMEOUT")
+
+	suite.T().Setenv("REQUEST_TIMEOUT", "")
+	_, err = config.Load(path)
+	assert.ErrorContains(t, err, "port")
+	assert.ErrorContains(t, err, "bcrypt_cost")
+	assert.ErrorContains(t, err, "rate_limits.api.requests")
+
+	suite.T().Setenv("METRICS_USERNAME", "prometheus")
+	suite.T().Setenv("METRICS_ALLOWED_IPS", "10.0.0.0/8,localhost")
+	_, err = config.Load(path)
+	assert.ErrorContains(t, err, "metrics.username and metrics.password")
+	assert.ErrorContains(t, err, `metrics.allowed_ips entry "localhost"`)
+	assert.NotContains(t, err.Error(), "10.0.0.0/8")
+
+	suite.T().Setenv("TRUSTED_PROXIES", "10.0.0.1,proxy.internal")
+	_, err = config.Load(path)
+	assert.ErrorContains(t, err, `trusted_proxies entry "proxy.internal"`)
+
+	suite.T().Setenv("LOG_COMPONENTS", "http=warn,database=debug")
+	_, err = config.Load(path)
+	assert.ErrorContains(t, err, `log.components has unknown component "database"`)
+
+	suite.T().Setenv("BACKUP_KEEP", "0")
+	_, err = config.Load(path)
+	assert.ErrorContains(t, err, "backup.keep must be positive")
+}
+
+func (suite *ConfigTestSuite) TestProductionRefusesDefaultSecret() {
+	t := suite.T()
+
+	suite.T().Setenv("TURNATE_ENV", "production")
+
+	_, err := config.Load("")
+	assert.ErrorContains(t, err, "jwt_secret must be changed")
+
+	suite.T().Setenv("JWT_SECRET", "a-properly-random-secret-of-sufficient-length")
+	_, err = config.Load("")
+	assert.ErrorContains(t, err, "cookie_secure must be true in production")
+
+	suite.T().Setenv("COOKIE_SECURE", "true")
+	_, err = config.Load("")
+	assert.ErrorContains(t, err, `push subject is "http://localhost:8080"`)
+
+	suite.T().Setenv("EMAIL_BASE_URL", "https://chat.example.com")
+	cfg, err := config.Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://chat.example.com", cfg.PushSubject())
+	assert.True(t, cfg.IsProduction())
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
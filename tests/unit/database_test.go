@@ -0,0 +1,150 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"turnate/internal/config"
+	"turnate/internal/database"
+	"turnate/internal/models"
+)
+
+type DatabaseTestSuite struct {
+	suite.Suite
+	ctx context.Context
+	dir string
+	cfg *config.Config
+	db  *gorm.DB
+}
+
+func (suite *DatabaseTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.dir = suite.T().TempDir()
+	suite.cfg = config.Default()
+	suite.cfg.DatabaseURL = filepath.Join(suite.dir, "turnate.db")
+	suite.cfg.Backup.Dir = filepath.Join(suite.dir, "backups")
+	suite.db = suite.connect()
+}
+
+func (suite *DatabaseTestSuite) TearDownTest() {
+	suite.close(suite.db)
+}
+
+func (suite *DatabaseTestSuite) connect() *gorm.DB {
+	db, err := database.Connect(suite.cfg)
+	suite.Require().NoError(err)
+	suite.Require().NoError(database.AutoMigrateModels(db))
+	return db
+}
+
+func (suite *DatabaseTestSuite) close(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.Close()
+}
+
+func (suite *DatabaseTestSuite) createUser(db *gorm.DB, username string) {
+	user := &models.User{Username: username, Email: username + "@example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.Require().NoError(user.SetPassword("password123"))
+	suite.Require().NoError(db.Create(user).Error)
+}
+
+func (suite *DatabaseTestSuite) TestConnectUsesWAL() {
+	var journalMode string
+	suite.Require().NoError(suite.db.Raw("PRAGMA journal_mode").Row().Scan(&journalMode))
+	suite.Equal("wal", journalMode)
+
+	var busyTimeout int
+	suite.Require().NoError(suite.db.Raw("PRAGMA busy_timeout").Row().Scan(&busyTimeout))
+	suite.Equal(5000, busyTimeout)
+}
+
+func (suite *DatabaseTestSuite) TestBackupRotation() {
+	backups := database.NewBackups(suite.db, suite.cfg.Backup.Dir, 2)
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		_, err := backups.Create(suite.ctx, start.Add(time.Duration(i)*time.Hour))
+		suite.Require().NoError(err)
+	}
+	files, err := backups.List()
+	suite.Require().NoError(err)
+	suite.Require().Len(files, 2, "the oldest backup is pruned")
+	suite.Equal(start.Add(2*time.Hour), files[0].CreatedAt)
+	suite.Equal(start.Add(time.Hour), files[1].CreatedAt)
+	suite.Positive(files[0].Size)
+
+	// Files that are not backups are never listed or pruned
+	other := filepath.Join(suite.cfg.Backup.Dir, "manual.db")
+	suite.Require().NoError(os.WriteFile(other, []byte("keep"), 0o600))
+
+	backup, err := backups.CreateDue(suite.ctx, start.Add(150*time.Minute), time.Hour)
+	suite.NoError(err)
+	suite.Nil(backup, "the newest backup is less than an interval old")
+	backup, err = backups.CreateDue(suite.ctx, start.Add(3*time.Hour), time.Hour)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(backup)
+	suite.FileExists(other)
+
+	at, err := backups.At(start.Add(150 * time.Minute))
+	suite.Require().NoError(err)
+	suite.Equal(files[0].Name, at.Name)
+	_, err = backups.At(start)
+	suite.ErrorIs(err, database.ErrBackupNotFound)
+
+	_, err = backups.Get("../turnate.db")
+	suite.ErrorIs(err, database.ErrBackupNotFound)
+	_, err = backups.Get("manual.db")
+	suite.ErrorIs(err, database.ErrBackupNotFound)
+}
+
+func (suite *DatabaseTestSuite) TestVerifyAndRestore() {
+	suite.createUser(suite.db, "alice")
+	backup, err := database.NewBackups(suite.db, suite.cfg.Backup.Dir, 7).Create(suite.ctx, time.Now())
+	suite.Require().NoError(err)
+	suite.createUser(suite.db, "bob")
+	suite.close(suite.db)
+
+	// A running server holds the database lock
+	serverLock, err := database.Share(suite.cfg.DatabaseURL)
+	suite.Require().NoError(err)
+	_, err = database.Restore(suite.ctx, backup.Path, suite.cfg.DatabaseURL, time.Now())
+	suite.ErrorIs(err, database.ErrInUse)
+	suite.FileExists(suite.cfg.DatabaseURL)
+	suite.NoFileExists(suite.cfg.DatabaseURL + ".restoring")
+	suite.Require().NoError(serverLock.Release())
+
+	garbage := filepath.Join(suite.dir, "garbage.db")
+	suite.Require().NoError(os.WriteFile(garbage, []byte("not a database"), 0o600))
+	_, err = database.Restore(suite.ctx, garbage, suite.cfg.DatabaseURL, time.Now())
+	suite.Error(err)
+	suite.NoFileExists(suite.cfg.DatabaseURL + ".restoring")
+
+	previous, err := database.Restore(suite.ctx, backup.Path, suite.cfg.DatabaseURL, time.Now())
+	suite.Require().NoError(err)
+	suite.FileExists(previous, "the replaced database is kept")
+
+	suite.db = suite.connect()
+	var usernames []string
+	suite.Require().NoError(suite.db.Model(&models.User{}).Order("username").Pluck("username", &usernames).Error)
+	suite.Equal([]string{"alice"}, usernames)
+}
+
+func (suite *DatabaseTestSuite) TestFilePath() {
+	path, err := database.FilePath("file:/data/turnate.db?cache=shared")
+	suite.NoError(err)
+	suite.Equal("/data/turnate.db", path)
+
+	_, err = database.FilePath(":memory:")
+	suite.Error(err)
+}
+
+func TestDatabaseTestSuite(t *testing.T) {
+	suite.Run(t, new(DatabaseTestSuite))
+}
@@ -0,0 +1,179 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"turnate/internal/database"
+	"turnate/internal/erasure"
+	"turnate/internal/models"
+	"turnate/internal/service"
+	"turnate/internal/store"
+	"turnate/internal/store/sqlstore"
+)
+
+type ErasureTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	db      *gorm.DB
+	stores  *store.Stores
+	now     time.Time
+	admin   *models.User
+	alice   *models.User
+	bob     *models.User
+	general *models.Channel
+}
+
+func (suite *ErasureTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+	suite.Require().NoError(database.AutoMigrateModels(db))
+	suite.db = db
+	suite.stores = sqlstore.New(db)
+	suite.now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	suite.admin = suite.user("admin", models.UserRoleAdmin)
+	suite.alice = suite.user("alice", models.UserRoleNormal)
+	suite.bob = suite.user("bob", models.UserRoleNormal)
+	suite.general = &models.Channel{Name: "general", Type: models.ChannelTypePublic, CreatedBy: suite.admin.ID}
+	suite.Require().NoError(db.Create(suite.general).Error)
+	for _, user := range []*models.User{suite.admin, suite.alice, suite.bob} {
+		suite.Require().NoError(db.Create(&models.ChannelMember{ChannelID: suite.general.ID, UserID: user.ID}).Error)
+	}
+}
+
+func (suite *ErasureTestSuite) user(username string, role models.UserRole) *models.User {
+	user := &models.User{Username: username, Email: username + "@example.com", Role: role, IsActive: true}
+	suite.Require().NoError(user.SetPassword("password123"))
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *ErasureTestSuite) message(user *models.User, content string, root *models.Message) *models.Message {
+	message := &models.Message{Content: content, UserID: user.ID, ChannelID: suite.general.ID, Type: models.MessageTypeUser}
+	if root != nil {
+		message.ThreadID = &root.ID
+	}
+	suite.Require().NoError(suite.db.Create(message).Error)
+	if root != nil {
+		suite.Require().NoError(suite.db.Model(root).Update("reply_count", gorm.Expr("reply_count + 1")).Error)
+	}
+	return message
+}
+
+// approve requests and approves the erasure of user
+func (suite *ErasureTestSuite) approve(user *models.User) *models.ErasureRequest {
+	erasures := service.NewErasureService(suite.stores)
+	request, err := erasures.Request(suite.ctx, service.Actor{UserID: user.ID, Role: user.Role}, "leaving")
+	suite.Require().NoError(err)
+	request, err = erasures.Approve(suite.ctx, service.Actor{UserID: suite.admin.ID, Role: suite.admin.Role}, request.ID, "", suite.now)
+	suite.Require().NoError(err)
+	return request
+}
+
+func (suite *ErasureTestSuite) TestEraseKeepsAnonymizedMessages() {
+	erasures := erasure.NewErasures(suite.db, erasure.Policy{}, nil)
+	message := suite.message(suite.alice, "hello", nil)
+	suite.Require().NoError(suite.db.Create(&models.SavedItem{UserID: suite.alice.ID, MessageID: message.ID}).Error)
+	suite.Require().NoError(suite.db.Create(&models.PushSubscription{UserID: suite.alice.ID, Endpoint: "https://push.example.com/1", P256dh: "key", Auth: "auth"}).Error)
+	suite.Require().NoError(suite.db.Create(&models.UserGroupMember{GroupID: models.NewUUIDv7(), UserID: suite.alice.ID}).Error)
+	request := suite.approve(suite.alice)
+
+	erased, err := erasures.EraseApproved(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(1, erased)
+
+	var user models.User
+	suite.Require().NoError(suite.db.First(&user, "id = ?", suite.alice.ID).Error)
+	suite.Regexp(`^erased_[0-9a-f]{32}$`, user.Username)
+	suite.Equal(suite.alice.ID.String()+"@erased.invalid", user.Email)
+	suite.Equal("Erased user", user.DisplayName)
+	suite.False(user.IsActive, "deactivating the account ends every session")
+	suite.False(user.CheckPassword("password123"))
+
+	var kept models.Message
+	suite.Require().NoError(suite.db.First(&kept, "id = ?", message.ID).Error)
+	suite.Equal("hello", kept.Content)
+	suite.Equal(suite.alice.ID, kept.UserID)
+
+	for _, model := range []any{&models.ChannelMember{}, &models.SavedItem{}, &models.PushSubscription{}, &models.UserGroupMember{}} {
+		var count int64
+		suite.Require().NoError(suite.db.Unscoped().Model(model).Where("user_id = ?", suite.alice.ID).Count(&count).Error)
+		suite.Zero(count, "%T", model)
+	}
+
+	completed, err := suite.stores.Erasures.Latest(suite.ctx, suite.alice.ID)
+	suite.Require().NoError(err)
+	suite.Equal(request.ID, completed.ID)
+	suite.Equal(models.ErasureStatusCompleted, completed.Status)
+
+	erased, err = erasures.EraseApproved(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Zero(erased)
+}
+
+func (suite *ErasureTestSuite) TestEraseDeletesMessages() {
+	erasures := erasure.NewErasures(suite.db, erasure.Policy{DeleteMessages: true}, nil)
+	alone := suite.message(suite.alice, "nobody answered", nil)
+	answered := suite.message(suite.alice, "question", nil)
+	suite.message(suite.bob, "answer", answered)
+	bobsThread := suite.message(suite.bob, "bob's thread", nil)
+	reply := suite.message(suite.alice, "alice's reply", bobsThread)
+	suite.message(suite.bob, "bob again", bobsThread)
+	suite.Require().NoError(suite.db.Create(&models.SavedItem{UserID: suite.bob.ID, MessageID: reply.ID}).Error)
+	suite.approve(suite.alice)
+
+	_, err := erasures.EraseApproved(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+
+	exists := func(message *models.Message) bool {
+		var count int64
+		suite.Require().NoError(suite.db.Unscoped().Model(&models.Message{}).Where("id = ?", message.ID).Count(&count).Error)
+		return count == 1
+	}
+	suite.False(exists(alone))
+	suite.False(exists(reply))
+	suite.True(exists(answered), "a thread others replied to keeps its root")
+
+	var root models.Message
+	suite.Require().NoError(suite.db.First(&root, "id = ?", answered.ID).Error)
+	suite.Equal(erasure.DeletedContent, root.Content)
+	var thread models.Message
+	suite.Require().NoError(suite.db.First(&thread, "id = ?", bobsThread.ID).Error)
+	suite.Equal(1, thread.ReplyCount)
+
+	var saved int64
+	suite.Require().NoError(suite.db.Model(&models.SavedItem{}).Where("message_id = ?", reply.ID).Count(&saved).Error)
+	suite.Zero(saved)
+}
+
+func (suite *ErasureTestSuite) TestHeldUsersWaitUntilReleased() {
+	erasures := erasure.NewErasures(suite.db, erasure.Policy{}, nil)
+	suite.approve(suite.alice)
+	err := suite.stores.Retention.SetUserHold(suite.ctx, suite.alice.ID, true)
+	suite.Require().NoError(err)
+
+	erased, err := erasures.EraseApproved(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Zero(erased)
+
+	err = suite.stores.Retention.SetUserHold(suite.ctx, suite.alice.ID, false)
+	suite.Require().NoError(err)
+	erased, err = erasures.EraseApproved(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(1, erased)
+}
+
+func TestErasureTestSuite(t *testing.T) {
+	suite.Run(t, new(ErasureTestSuite))
+}
@@ -0,0 +1,219 @@
+package unit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"turnate/internal/export"
+	"turnate/internal/models"
+	"turnate/internal/service"
+	"turnate/internal/store/sqlstore"
+)
+
+type ExportTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	db      *gorm.DB
+	general *models.Channel
+	secret  *models.Channel
+	root    *models.Message
+}
+
+func (suite *ExportTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Background exports query from another goroutine; every connection to
+	// :memory: would otherwise open a separate, empty database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+	suite.Require().NoError(models.AutoMigrate(db))
+	suite.db = db
+
+	stores := sqlstore.New(db)
+	users := service.NewUserService(stores)
+	channels := service.NewChannelService(stores, service.Policy{})
+	messages := service.NewMessageService(stores, channels, service.NewNotificationService(stores, channels))
+
+	admin, err := users.Create(suite.ctx, "admin", "admin@example.com", "", "password123", models.UserRoleAdmin)
+	suite.Require().NoError(err)
+	actor := service.Actor{UserID: admin.ID, Role: admin.Role}
+
+	suite.general, err = channels.Create(suite.ctx, actor, service.GeneralChannelName, "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	suite.secret, err = channels.Create(suite.ctx, actor, "secret", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+	_, err = channels.AddBookmark(suite.ctx, actor, suite.general.ID, "Handbook", "https://example.com/handbook", models.BookmarkKindLink)
+	suite.Require().NoError(err)
+
+	suite.root, err = messages.Create(suite.ctx, actor, suite.general.ID, "hello", nil)
+	suite.Require().NoError(err)
+	_, err = messages.Create(suite.ctx, actor, suite.general.ID, "a reply", &suite.root.ID)
+	suite.Require().NoError(err)
+	_, err = messages.Create(suite.ctx, actor, suite.secret.ID, "classified", nil)
+	suite.Require().NoError(err)
+}
+
+// read writes an export and returns its files by name
+func (suite *ExportTestSuite) read(opts export.Options) (map[string][]byte, *export.Manifest) {
+	var buf bytes.Buffer
+	manifest, err := export.Write(suite.ctx, suite.db, &buf, opts, time.Now())
+	suite.Require().NoError(err)
+	return suite.unzip(buf.Bytes()), manifest
+}
+
+func (suite *ExportTestSuite) unzip(data []byte) map[string][]byte {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	suite.Require().NoError(err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		suite.Require().NoError(err)
+		files[file.Name], err = io.ReadAll(r)
+		suite.Require().NoError(err)
+		r.Close()
+	}
+	return files
+}
+
+func (suite *ExportTestSuite) TestExportFormat() {
+	files, manifest := suite.read(export.Options{})
+
+	suite.Equal(export.Version, manifest.Version)
+	suite.Equal([]string{"general"}, manifest.Channels, "private channels are excluded by default")
+	suite.Equal(export.Counts{Users: 1, Channels: 1, Memberships: 1, Messages: 2, Bookmarks: 1}, manifest.Counts)
+
+	var written export.Manifest
+	suite.Require().NoError(json.Unmarshal(files["manifest.json"], &written))
+	suite.Equal(*manifest, written)
+
+	var users []map[string]interface{}
+	suite.Require().NoError(json.Unmarshal(files["users.json"], &users))
+	suite.Require().Len(users, 1)
+	suite.Equal("admin", users[0]["username"])
+	suite.NotContains(users[0], "password")
+	suite.NotContains(string(files["users.json"]), "$2a$")
+
+	var channels []export.Channel
+	suite.Require().NoError(json.Unmarshal(files["channels.json"], &channels))
+	suite.Require().Len(channels, 1)
+	suite.Equal("Handbook", channels[0].Bookmarks[0].Title)
+
+	var messages []export.Message
+	suite.Require().NoError(json.Unmarshal(files["messages/"+suite.general.ID.String()+".json"], &messages))
+	suite.Require().Len(messages, 2)
+	suite.Equal("hello", messages[0].Content)
+	suite.Equal(1, messages[0].ReplyCount)
+	suite.Require().NotNil(messages[1].ThreadID)
+	suite.Equal(suite.root.ID.String(), *messages[1].ThreadID)
+	suite.NotContains(files, "messages/"+suite.secret.ID.String()+".json")
+}
+
+func (suite *ExportTestSuite) TestPrivateChannelOptions() {
+	_, manifest := suite.read(export.Options{IncludePrivate: true})
+	suite.Equal([]string{"general", "secret"}, manifest.Channels)
+
+	files, manifest := suite.read(export.Options{PrivateChannels: []string{"secret"}})
+	suite.Equal([]string{"general", "secret"}, manifest.Channels)
+	suite.Contains(string(files["messages/"+suite.secret.ID.String()+".json"]), "classified")
+
+	_, manifest = suite.read(export.Options{PrivateChannels: []string{"other"}})
+	suite.Equal([]string{"general"}, manifest.Channels)
+}
+
+func (suite *ExportTestSuite) TestBackgroundExports() {
+	exports := export.NewExports(suite.db, suite.T().TempDir(), 1)
+	defer exports.Close()
+
+	first, err := exports.Start(export.Options{}, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(export.StatusRunning, first.Status)
+
+	completed := func(name string) bool {
+		file, err := exports.Get(name)
+		return err == nil && file.Status == export.StatusCompleted
+	}
+	suite.Eventually(func() bool { return completed(first.Name) }, 5*time.Second, 10*time.Millisecond)
+
+	second, err := exports.Start(export.Options{}, time.Now().Add(time.Second))
+	suite.Require().NoError(err)
+	suite.Eventually(func() bool { return completed(second.Name) }, 5*time.Second, 10*time.Millisecond)
+
+	files, err := exports.List()
+	suite.Require().NoError(err)
+	suite.Require().Len(files, 1, "only the newest export is kept")
+	suite.Equal(second.Name, files[0].Name)
+	suite.Positive(files[0].Size)
+
+	_, err = exports.Get("../turnate.db")
+	suite.ErrorIs(err, export.ErrNotFound)
+}
+
+func (suite *ExportTestSuite) TestPersonalExport() {
+	erin := &models.User{Username: "erin", Email: "erin@example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.Require().NoError(erin.SetPassword("password123"))
+	suite.Require().NoError(suite.db.Create(erin).Error)
+	suite.Require().NoError(suite.db.Create(&models.ChannelMember{ChannelID: suite.general.ID, UserID: erin.ID}).Error)
+	reply := &models.Message{Content: "erin's reply", UserID: erin.ID, ChannelID: suite.general.ID, ThreadID: &suite.root.ID, Type: models.MessageTypeUser}
+	suite.Require().NoError(suite.db.Create(reply).Error)
+	suite.Require().NoError(suite.db.Create(&models.SavedItem{UserID: erin.ID, MessageID: suite.root.ID}).Error)
+
+	var buf bytes.Buffer
+	manifest, err := export.WritePersonal(suite.ctx, suite.db, &buf, erin.ID, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(export.PersonalFormat, manifest.Format)
+	suite.Equal(export.PersonalCounts{Channels: 1, Memberships: 1, Messages: 1, SavedItems: 1}, manifest.Counts)
+
+	files := suite.unzip(buf.Bytes())
+	var profile export.Profile
+	suite.Require().NoError(json.Unmarshal(files["profile.json"], &profile))
+	suite.Equal("erin", profile.Username)
+	suite.NotContains(string(files["profile.json"]), "$2a$")
+
+	var messages []export.Message
+	suite.Require().NoError(json.Unmarshal(files["messages.json"], &messages))
+	suite.Require().Len(messages, 1, "only the user's own messages are exported")
+	suite.Equal("erin's reply", messages[0].Content)
+	suite.NotContains(string(files["messages.json"]), "classified")
+	suite.Contains(string(files["saved_items.json"]), suite.root.ID.String())
+
+	_, err = export.WritePersonal(suite.ctx, suite.db, &buf, models.NewUUIDv7(), time.Now())
+	suite.ErrorIs(err, export.ErrNotFound)
+}
+
+func (suite *ExportTestSuite) TestBackgroundPersonalExport() {
+	exports := export.NewPersonalExports(suite.db, suite.T().TempDir())
+	defer exports.Close()
+
+	var admin models.User
+	suite.Require().NoError(suite.db.First(&admin, "username = ?", "admin").Error)
+	_, err := exports.Get(admin.ID)
+	suite.ErrorIs(err, export.ErrNotFound)
+
+	started, err := exports.Start(admin.ID, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(export.StatusRunning, started.Status)
+	suite.Eventually(func() bool {
+		file, err := exports.Get(admin.ID)
+		return err == nil && file.Status == export.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	suite.Require().NoError(exports.Delete(admin.ID))
+	_, err = exports.Get(admin.ID)
+	suite.ErrorIs(err, export.ErrNotFound)
+}
+
+func TestExportTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportTestSuite))
+}
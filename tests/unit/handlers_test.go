@@ -2,10 +2,14 @@ package unit
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -16,14 +20,23 @@ import (
 
 	"turnate/internal/config"
 	"turnate/internal/database"
+	"turnate/internal/erasure"
 	"turnate/internal/handlers"
+	"turnate/internal/importer"
+	"turnate/internal/mail"
 	"turnate/internal/middleware"
 	"turnate/internal/models"
+	"turnate/internal/retention"
+	"turnate/internal/scheduler"
+	"turnate/internal/service"
+	"turnate/internal/store"
+	"turnate/internal/store/sqlstore"
 )
 
 type HandlersTestSuite struct {
 	suite.Suite
 	db         *gorm.DB
+	stores     *store.Stores
 	router     *gin.Engine
 	config     *config.Config
 	testUser   *models.User
@@ -41,7 +54,7 @@ func (suite *HandlersTestSuite) SetupSuite() {
 	suite.Require().NoError(err)
 	
 	suite.db = db
-	database.DB = db // Set global DB for handlers
+	suite.stores = sqlstore.New(db)
 	
 	// Run migrations
 	err = models.AutoMigrate(db)
@@ -67,10 +80,17 @@ func (suite *HandlersTestSuite) setupRouter() {
 	r := gin.New()
 	
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(suite.config)
-	userHandler := handlers.NewUserHandler()
-	channelHandler := handlers.NewChannelHandler()
-	messageHandler := handlers.NewMessageHandler()
+	userService := service.NewUserService(suite.stores)
+	channelService := service.NewChannelService(suite.stores, service.Policy{})
+	notificationService := service.NewNotificationService(suite.stores, channelService)
+	messageService := service.NewMessageService(suite.stores, channelService, notificationService)
+	authHandler := handlers.NewAuthHandler(suite.config, userService)
+	userHandler := handlers.NewUserHandler(userService)
+	channelHandler := handlers.NewChannelHandler(channelService)
+	messageHandler := handlers.NewMessageHandler(messageService, service.NewScheduledMessageService(suite.stores, channelService, messageService))
+	threadHandler := handlers.NewThreadHandler(service.NewThreadService(suite.stores, channelService))
+	reminderHandler := handlers.NewReminderHandler(service.NewReminderService(suite.stores, channelService))
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
 	
 	// Public routes
 	r.POST("/api/v1/auth/register", authHandler.Register)
@@ -78,7 +98,7 @@ func (suite *HandlersTestSuite) setupRouter() {
 	
 	// Protected routes
 	protected := r.Group("/api/v1")
-	protected.Use(middleware.AuthMiddleware(suite.config))
+	protected.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	{
 		protected.GET("/users/me", authHandler.Profile)
 		// User routes
@@ -99,7 +119,31 @@ func (suite *HandlersTestSuite) setupRouter() {
 			// Message routes under channels
 			channels.POST("/:id/messages", messageHandler.CreateMessage)
 			channels.GET("/:id/messages", messageHandler.GetMessages)
+			channels.GET("/:id/messages/:threadId/replies", messageHandler.GetThreadMessages)
+			
+			// Pins and bookmarks
+			channels.GET("/:id/pins", messageHandler.GetPins)
+			channels.POST("/:id/pins", messageHandler.PinMessage)
+			channels.DELETE("/:id/pins/:messageId", messageHandler.UnpinMessage)
+			channels.POST("/:id/bookmarks", channelHandler.AddBookmark)
+			channels.DELETE("/:id/bookmarks/:bookmarkId", channelHandler.RemoveBookmark)
+			channels.GET("/:id/notifications", notificationHandler.GetChannelNotificationLevel)
+			channels.PUT("/:id/notifications", notificationHandler.SetChannelNotificationLevel)
 		}
+		
+		protected.GET("/threads", threadHandler.GetThreads)
+		protected.POST("/threads/:id/follow", threadHandler.FollowThread)
+		protected.DELETE("/threads/:id/follow", threadHandler.UnfollowThread)
+		protected.POST("/threads/:id/read", threadHandler.MarkThreadRead)
+		protected.GET("/scheduled-messages", messageHandler.GetScheduledMessages)
+		protected.PATCH("/scheduled-messages/:id", messageHandler.UpdateScheduledMessage)
+		protected.DELETE("/scheduled-messages/:id", messageHandler.CancelScheduledMessage)
+		protected.GET("/reminders", reminderHandler.GetReminders)
+		protected.POST("/reminders", reminderHandler.CreateReminder)
+		protected.GET("/notifications", notificationHandler.GetNotifications)
+		protected.POST("/notifications/read-all", notificationHandler.MarkAllNotificationsRead)
+		protected.GET("/notifications/settings", notificationHandler.GetNotificationSettings)
+		protected.PUT("/notifications/settings", notificationHandler.UpdateNotificationSettings)
 	}
 	
 	suite.router = r
@@ -156,6 +200,384 @@ func (suite *HandlersTestSuite) makeRequest(method, url string, body interface{}
 	return w
 }
 
+func (suite *HandlersTestSuite) TestHealthProbes() {
+	t := suite.T()
+	
+	// A database with only some tables has pending migrations
+	stale, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	suite.Require().NoError(stale.AutoMigrate(&models.User{}))
+	err = database.PendingMigrations(stale)
+	assert.ErrorContains(t, err, "channels")
+	assert.NotContains(t, err.Error(), "users")
+	assert.NoError(t, database.PendingMigrations(suite.db))
+	
+	noop := func(ctx context.Context, now time.Time) error { return nil }
+	jobs := scheduler.New(time.Minute,
+		scheduler.Job{Name: "reminders", Run: noop},
+		scheduler.Job{Name: "retention", Interval: time.Hour, Run: noop},
+	)
+	migrationStatus := database.PendingMigrations(suite.db)
+	health := handlers.NewHealthHandler(
+		handlers.HealthCheck{Name: "migrations", Check: func(ctx context.Context) error {
+			return migrationStatus
+		}},
+		handlers.HealthCheck{Name: "scheduler", Check: func(ctx context.Context) error {
+			return jobs.Healthy(time.Now())
+		}},
+	)
+	router := gin.New()
+	router.GET("/livez", health.Livez)
+	router.GET("/readyz", health.Readyz)
+	
+	probe := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var response map[string]interface{}
+		suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+	
+	code, _ := probe("/livez")
+	assert.Equal(t, http.StatusOK, code)
+	
+	// Not ready until the background jobs have run
+	code, response := probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "jobs have not run yet", response["checks"].(map[string]interface{})["scheduler"])
+	
+	jobs.RunOnce(context.Background(), time.Now())
+	code, response = probe("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"migrations": "ok", "scheduler": "ok"}, response["checks"])
+	
+	// A stale database fails readiness
+	migrationStatus = database.PendingMigrations(stale)
+	code, _ = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	migrationStatus = nil
+	
+	// While draining, readiness fails but the process stays live
+	health.Drain()
+	code, response = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting_down", response["status"])
+	code, _ = probe("/livez")
+	assert.Equal(t, http.StatusOK, code)
+	
+	// A job that stops completing runs is reported against its own interval
+	err = jobs.Healthy(time.Now().Add(5 * time.Minute))
+	assert.ErrorContains(t, err, "reminders last completed")
+	assert.NotContains(t, err.Error(), "retention")
+	assert.ErrorContains(t, jobs.Healthy(time.Now().Add(4*time.Hour)), "retention last completed")
+}
+
+func (suite *HandlersTestSuite) TestBackups() {
+	t := suite.T()
+	
+	backups := database.NewBackups(suite.db, t.TempDir(), 7)
+	backupHandler := handlers.NewBackupHandler(backups)
+	router := gin.New()
+	router.GET("/backups", backupHandler.GetBackups)
+	router.POST("/backups", backupHandler.CreateBackup)
+	router.GET("/backups/:name", backupHandler.DownloadBackup)
+	
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/backups", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Backup handlers.BackupResponse `json:"backup"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Regexp(t, `^turnate-\d{8}T\d{6}Z\.db$`, created.Backup.Name)
+	assert.Positive(t, created.Backup.SizeBytes)
+	
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/backups", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), created.Backup.Name)
+	
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/backups/"+created.Backup.Name, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), created.Backup.Name)
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("SQLite format 3")))
+	
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/backups/..%2Fturnate.db", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func (suite *HandlersTestSuite) TestImportRequests() {
+	t := suite.T()
+	
+	imports := importer.NewImports(suite.db)
+	defer imports.Close()
+	importHandler := handlers.NewImportHandler(imports)
+	router := gin.New()
+	router.GET("/import", importHandler.GetImports)
+	router.GET("/import/:id", importHandler.GetImport)
+	router.POST("/import/:source", importHandler.CreateImport)
+	
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	suite.Require().NoError(form.WriteField("note", "no file"))
+	suite.Require().NoError(form.Close())
+	
+	req := httptest.NewRequest("POST", "/import/slack", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	req = httptest.NewRequest("POST", "/import/discord", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/import", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"imports": []}`, w.Body.String())
+	
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/import/slack-20240501T090000.000Z", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func (suite *HandlersTestSuite) TestUnsubscribeNeedsConfirmation() {
+	t := suite.T()
+	
+	emails := service.NewEmailService(suite.stores, nil, service.EmailOptions{Secret: "test-secret"})
+	emailHandler := handlers.NewEmailHandler(emails)
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/templates/*")
+	router.Use(middleware.ValidateContentType("/email/unsubscribe"))
+	router.GET("/email/unsubscribe", emailHandler.UnsubscribePage)
+	router.POST("/email/unsubscribe", emailHandler.Unsubscribe)
+	disabled := func() bool {
+		settings, err := service.NewNotificationService(suite.stores, nil).Settings(context.Background(), service.Actor{UserID: suite.testUser.ID})
+		suite.Require().NoError(err)
+		return settings.MentionEmailsDisabled
+	}
+	defer suite.db.Exec("DELETE FROM notification_settings")
+	token := mail.UnsubscribeToken("test-secret", suite.testUser.ID.String(), mail.ListMentions)
+	
+	// Following the link, as mail scanners do, only asks for confirmation
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/email/unsubscribe?token="+token, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `method="post"`)
+	assert.Contains(t, w.Body.String(), "mention emails")
+	assert.False(t, disabled())
+	
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/email/unsubscribe?token="+token+"x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid unsubscribe link")
+	
+	// The confirmation form and one-click mail clients post a URL-encoded body
+	req := httptest.NewRequest("POST", "/email/unsubscribe?token="+token, strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "You have been unsubscribed")
+	assert.True(t, disabled())
+}
+
+func (suite *HandlersTestSuite) TestRetentionRequests() {
+	t := suite.T()
+	
+	retentionHandler := handlers.NewRetentionHandler(service.NewRetentionService(suite.stores), retention.NewPurger(suite.db, retention.Policy{Days: 365, BatchSize: 100}))
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", suite.testUser.ID.String())
+		c.Set("role", string(models.UserRoleAdmin))
+	})
+	router.GET("/retention", retentionHandler.GetRetention)
+	router.PUT("/channels/:id/retention", retentionHandler.SetChannelRetention)
+	router.PUT("/users/:id/legal-hold", retentionHandler.SetLegalHold)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	
+	channel := &models.Channel{Name: "retained", Type: models.ChannelTypePublic, CreatedBy: suite.testUser.ID}
+	suite.Require().NoError(suite.db.Create(channel).Error)
+	defer suite.db.Unscoped().Delete(channel)
+	
+	w := request("PUT", "/channels/"+channel.ID.String()+"/retention", `{"retention_days": -1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("PUT", "/channels/"+models.NewUUIDv7().String()+"/retention", `{"retention_days": 30}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("PUT", "/channels/"+channel.ID.String()+"/retention", `{"retention_days": 30, "legal_hold": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"channel": {"id": "`+channel.ID.String()+`", "name": "retained", "retention_days": 30, "legal_hold": true}}`, w.Body.String())
+	w = request("PUT", "/channels/"+channel.ID.String()+"/retention", `{"retention_days": 60}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"channel": {"id": "`+channel.ID.String()+`", "name": "retained", "retention_days": 60, "legal_hold": true}}`, w.Body.String(), "an omitted hold is left alone")
+	
+	w = request("PUT", "/users/"+suite.testUser.ID.String()+"/legal-hold", `{"legal_hold": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	defer suite.stores.Retention.SetUserHold(context.Background(), suite.testUser.ID, false)
+	
+	w = request("GET", "/retention", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		RetentionDays int                                 `json:"retention_days"`
+		Channels      []handlers.ChannelRetentionResponse `json:"channels"`
+		Users         []handlers.LegalHoldResponse        `json:"users"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 365, response.RetentionDays)
+	assert.Len(t, response.Channels, 1)
+	assert.Len(t, response.Users, 1)
+}
+
+func (suite *HandlersTestSuite) TestErasureRequests() {
+	t := suite.T()
+	
+	admin := models.User{Username: "erasureadmin", Email: "erasureadmin@example.com", Role: models.UserRoleAdmin, IsActive: true}
+	suite.Require().NoError(suite.db.Create(&admin).Error)
+	defer suite.db.Exec("DELETE FROM erasure_requests")
+	
+	erasureHandler := handlers.NewErasureHandler(service.NewErasureService(suite.stores), erasure.NewErasures(suite.db, erasure.Policy{}, nil))
+	router := gin.New()
+	as := func(user models.User) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", user.ID.String())
+			c.Set("role", string(user.Role))
+		}
+	}
+	router.POST("/users/me/erasure", as(*suite.testUser), erasureHandler.RequestErasure)
+	router.GET("/users/me/erasure", as(*suite.testUser), erasureHandler.GetErasure)
+	router.DELETE("/users/me/erasure", as(*suite.testUser), erasureHandler.CancelErasure)
+	router.GET("/erasure-requests", as(admin), erasureHandler.GetErasureRequests)
+	router.POST("/erasure-requests/:id/reject", as(admin), erasureHandler.RejectErasure)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	
+	w := request("GET", "/users/me/erasure", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("POST", "/users/me/erasure", `{"reason": "leaving"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		ErasureRequest handlers.ErasureRequestResponse `json:"erasure_request"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "pending", created.ErasureRequest.Status)
+	w = request("POST", "/users/me/erasure", `{}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	
+	w = request("GET", "/erasure-requests?status=done", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("GET", "/erasure-requests?status=pending", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"testuser"`)
+	
+	w = request("POST", "/erasure-requests/"+created.ErasureRequest.ID+"/reject", `{"note": "not yet"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"review_note":"not yet"`)
+	w = request("DELETE", "/users/me/erasure", "")
+	assert.Equal(t, http.StatusConflict, w.Code, "only pending requests can be cancelled")
+}
+
+func (suite *HandlersTestSuite) TestGroupRequests() {
+	t := suite.T()
+	
+	admin := models.User{Username: "groupadmin", Email: "groupadmin@example.com", Role: models.UserRoleAdmin, IsActive: true}
+	suite.Require().NoError(suite.db.Create(&admin).Error)
+	defer suite.db.Exec("DELETE FROM user_groups")
+	defer suite.db.Exec("DELETE FROM user_group_members")
+	defer suite.db.Exec("DELETE FROM user_group_channels")
+	defer suite.db.Exec("DELETE FROM notifications")
+	
+	channelService := service.NewChannelService(suite.stores, service.Policy{})
+	notificationService := service.NewNotificationService(suite.stores, channelService)
+	messageService := service.NewMessageService(suite.stores, channelService, notificationService)
+	groupHandler := handlers.NewGroupHandler(service.NewGroupService(suite.stores, channelService))
+	router := gin.New()
+	as := func(user models.User) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", user.ID.String())
+			c.Set("role", string(user.Role))
+		}
+	}
+	router.GET("/groups", as(*suite.testUser), groupHandler.GetGroups)
+	router.POST("/groups", as(admin), groupHandler.CreateGroup)
+	router.PATCH("/groups/:id", as(admin), groupHandler.UpdateGroup)
+	router.POST("/groups/:id/members", as(admin), groupHandler.AddMember)
+	router.DELETE("/groups/:id/members/:userId", as(*suite.testUser), groupHandler.RemoveMember)
+	router.GET("/groups/:id", as(*suite.testUser), groupHandler.GetGroup)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	
+	w := request("POST", "/groups", `{"handle": "back end"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/groups", `{"handle": "Backend", "name": "Backend team"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Group handlers.GroupResponse `json:"group"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "backend", created.Group.Handle)
+	w = request("POST", "/groups", `{"handle": "backend"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	
+	// Mentions ignore case, so a handle may not match a username in any case
+	mixedCase := models.User{Username: "GroupAdmin2", Email: "groupadmin2@example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.Require().NoError(suite.db.Create(&mixedCase).Error)
+	defer suite.db.Delete(&mixedCase)
+	w = request("POST", "/groups", `{"handle": "groupadmin2"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	
+	channel := &models.Channel{Name: "backend-team", Type: models.ChannelTypePublic, CreatedBy: admin.ID}
+	suite.Require().NoError(suite.db.Create(channel).Error)
+	suite.Require().NoError(suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: admin.ID}).Error)
+	w = request("PATCH", "/groups/"+created.Group.ID, `{"channel_ids": ["`+channel.ID.String()+`"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("POST", "/groups/"+created.Group.ID+"/members", `{"user_id": "`+suite.testUser.ID.String()+`"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	
+	w = request("GET", "/groups/"+created.Group.ID, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var details struct {
+		Group handlers.GroupResponse `json:"group"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &details))
+	suite.Require().Len(details.Group.Members, 1)
+	assert.Equal(t, "testuser", details.Group.Members[0].Username)
+	assert.Equal(t, []string{channel.ID.String()}, details.Group.ChannelIDs)
+	
+	// The member joined the default channel and hears about group mentions there
+	_, err := messageService.Create(context.Background(), service.Actor{UserID: admin.ID, Role: admin.Role}, channel.ID, "@backend standup", nil)
+	suite.Require().NoError(err)
+	var notification models.Notification
+	suite.Require().NoError(suite.db.Where("user_id = ?", suite.testUser.ID).First(&notification).Error)
+	assert.Equal(t, "@groupadmin mentioned @backend in #backend-team", notification.Title)
+	
+	w = request("DELETE", "/groups/"+created.Group.ID+"/members/"+suite.testUser.ID.String(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("GET", "/groups", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"member_count":0`)
+}
+
 func (suite *HandlersTestSuite) TestUserRegistration() {
 	t := suite.T()
 	
@@ -207,6 +629,42 @@ func (suite *HandlersTestSuite) TestUserLogin() {
 	assert.Contains(t, response, "message")
 }
 
+func (suite *HandlersTestSuite) TestCookieLogin() {
+	t := suite.T()
+	
+	loginData := map[string]interface{}{
+		"username":   "testuser",
+		"password":   "password123",
+		"use_cookie": true,
+	}
+	
+	w := suite.makeRequest("POST", "/api/v1/auth/login", loginData, "")
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	
+	assert.NotContains(t, response, "token")
+	assert.Contains(t, response, "csrf_token")
+	
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	
+	session := cookies[middleware.SessionCookieName]
+	suite.Require().NotNil(session)
+	assert.True(t, session.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, session.SameSite)
+	
+	csrf := cookies[middleware.CSRFCookieName]
+	suite.Require().NotNil(csrf)
+	assert.False(t, csrf.HttpOnly)
+	assert.Equal(t, response["csrf_token"], csrf.Value)
+}
+
 func (suite *HandlersTestSuite) TestInvalidLogin() {
 	t := suite.T()
 	
@@ -379,15 +837,384 @@ func (suite *HandlersTestSuite) TestGetMessages() {
 	assert.GreaterOrEqual(t, len(messages), 1)
 }
 
+func (suite *HandlersTestSuite) TestMessageCursorPagination() {
+	t := suite.T()
+	
+	channel := models.Channel{
+		Name:      "cursor-test",
+		Type:      models.ChannelTypePublic,
+		CreatedBy: suite.testUser.ID,
+	}
+	suite.db.Create(&channel)
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: suite.testUser.ID})
+	
+	var ids []string
+	for i := 0; i < 5; i++ {
+		message := models.Message{Content: "page message", UserID: suite.testUser.ID, ChannelID: channel.ID}
+		suite.db.Create(&message)
+		ids = append(ids, message.ID.String())
+	}
+	
+	url := "/api/v1/channels/" + channel.ID.String() + "/messages"
+	page := func(query string) map[string]interface{} {
+		w := suite.makeRequest("GET", url+query, nil, suite.testToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	pageIDs := func(response map[string]interface{}) []string {
+		var out []string
+		for _, message := range response["messages"].([]interface{}) {
+			out = append(out, message.(map[string]interface{})["id"].(string))
+		}
+		return out
+	}
+	
+	latest := page("?limit=2")
+	assert.Equal(t, ids[3:], pageIDs(latest))
+	assert.NotContains(t, latest, "newer_cursor")
+	
+	older := page("?limit=2&before=" + latest["older_cursor"].(string))
+	assert.Equal(t, ids[1:3], pageIDs(older))
+	
+	newer := page("?limit=2&after=" + older["newer_cursor"].(string))
+	assert.Equal(t, ids[3:], pageIDs(newer))
+	
+	around := page("?limit=3&around=" + ids[2])
+	assert.Equal(t, ids[1:4], pageIDs(around))
+	assert.Equal(t, ids[2], around["anchor_id"])
+	
+	// Malformed and conflicting cursors are reported as field errors
+	w := suite.makeRequest("GET", url+"?before=not-a-cursor", nil, suite.testToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"before"`)
+	
+	w = suite.makeRequest("GET", url+"?before="+latest["older_cursor"].(string)+"&around="+ids[2], nil, suite.testToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot be combined with")
+}
+
+func (suite *HandlersTestSuite) TestPinsAndBookmarks() {
+	t := suite.T()
+	
+	channel := models.Channel{
+		Name:      "pins-test",
+		Type:      models.ChannelTypePublic,
+		CreatedBy: suite.testUser.ID,
+	}
+	suite.db.Create(&channel)
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: suite.testUser.ID})
+	
+	message := models.Message{Content: "Release on Friday", UserID: suite.testUser.ID, ChannelID: channel.ID}
+	suite.db.Create(&message)
+	
+	base := "/api/v1/channels/" + channel.ID.String()
+	w := suite.makeRequest("POST", base+"/pins", map[string]string{"message_id": message.ID.String()}, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	w = suite.makeRequest("POST", base+"/pins", map[string]string{"message_id": message.ID.String()}, suite.testToken)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	
+	w = suite.makeRequest("GET", base+"/pins", nil, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var pins map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pins))
+	assert.Len(t, pins["pins"], 1)
+	assert.Equal(t, message.ID.String(), pins["pins"][0]["id"])
+	assert.NotEmpty(t, pins["pins"][0]["pinned_at"])
+	
+	// The pin is announced with a system message
+	w = suite.makeRequest("GET", base+"/messages", nil, suite.testToken)
+	var history map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	last := history["messages"][len(history["messages"])-1]
+	assert.Equal(t, "system", last["type"])
+	assert.Contains(t, last["content"], "pinned a message: Release on Friday")
+	
+	w = suite.makeRequest("DELETE", base+"/pins/"+message.ID.String(), nil, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	// Bookmarks must be http(s) links and are shown with the channel
+	w = suite.makeRequest("POST", base+"/bookmarks", map[string]string{"title": "Bad", "url": "javascript:alert(1)"}, suite.testToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	w = suite.makeRequest("POST", base+"/bookmarks", map[string]string{"title": "Roadmap", "url": "https://example.com/roadmap"}, suite.testToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	
+	w = suite.makeRequest("GET", base, nil, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var detail map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	bookmarks := detail["channel"]["bookmarks"].([]interface{})
+	assert.Len(t, bookmarks, 1)
+	bookmark := bookmarks[0].(map[string]interface{})
+	assert.Equal(t, "Roadmap", bookmark["title"])
+	assert.Equal(t, "link", bookmark["kind"])
+	
+	w = suite.makeRequest("DELETE", base+"/bookmarks/"+bookmark["id"].(string), nil, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func (suite *HandlersTestSuite) TestReminderSurvivesRestart() {
+	t := suite.T()
+	
+	w := suite.makeRequest("POST", "/api/v1/reminders", map[string]string{"text": "Call back", "at": "sometime"}, suite.testToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	w = suite.makeRequest("POST", "/api/v1/reminders", map[string]string{"text": "Call back", "at": "in 2 hours"}, suite.testToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	
+	w = suite.makeRequest("GET", "/api/v1/reminders", nil, suite.testToken)
+	var pending map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pending))
+	assert.Len(t, pending["reminders"], 1)
+	
+	// A freshly constructed service, as after a restart, delivers from the persisted queue
+	restarted := service.NewReminderService(sqlstore.New(suite.db), service.NewChannelService(sqlstore.New(suite.db), service.Policy{}))
+	delivered, err := restarted.DeliverDue(context.Background(), time.Now().Add(3*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	
+	w = suite.makeRequest("GET", "/api/v1/notifications", nil, suite.testToken)
+	var inbox struct {
+		Notifications []map[string]interface{} `json:"notifications"`
+		UnreadCount   int                      `json:"unread_count"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Len(t, inbox.Notifications, 1)
+	assert.Equal(t, 1, inbox.UnreadCount)
+	assert.Equal(t, "Call back", inbox.Notifications[0]["body"])
+	assert.Equal(t, false, inbox.Notifications[0]["read"])
+}
+
+func (suite *HandlersTestSuite) TestNotificationPreferences() {
+	t := suite.T()
+	
+	channel := models.Channel{Name: "alerts-test", Type: models.ChannelTypePublic, CreatedBy: suite.testUser.ID}
+	suite.db.Create(&channel)
+	other := models.User{Username: "watcher", Email: "watcher@example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.db.Create(&other)
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: suite.testUser.ID})
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: other.ID})
+	otherToken, err := middleware.GenerateJWT(&other, suite.config)
+	suite.Require().NoError(err)
+	
+	w := suite.makeRequest("PUT", "/api/v1/notifications/settings", map[string]interface{}{"timezone": "Nowhere/Special"}, otherToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = suite.makeRequest("PUT", "/api/v1/notifications/settings", map[string]interface{}{"keywords": []string{"Outage"}, "timezone": "Europe/Berlin"}, otherToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	w = suite.makeRequest("GET", "/api/v1/notifications/settings", nil, otherToken)
+	var settings map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+	assert.Equal(t, "Europe/Berlin", settings["settings"]["timezone"])
+	assert.Equal(t, []interface{}{"outage"}, settings["settings"]["keywords"])
+	
+	levelURL := "/api/v1/channels/" + channel.ID.String() + "/notifications"
+	w = suite.makeRequest("PUT", levelURL, map[string]string{"level": "loud"}, otherToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = suite.makeRequest("PUT", levelURL, map[string]string{"level": "all"}, otherToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = suite.makeRequest("GET", levelURL, nil, otherToken)
+	assert.Contains(t, w.Body.String(), `"level":"all"`)
+	
+	url := "/api/v1/channels/" + channel.ID.String() + "/messages"
+	w = suite.makeRequest("POST", url, map[string]string{"content": "Small outage in eu-west"}, suite.testToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = suite.makeRequest("POST", url, map[string]string{"content": "All clear"}, suite.testToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	
+	var inbox struct {
+		Notifications []map[string]interface{} `json:"notifications"`
+		UnreadCount   int                      `json:"unread_count"`
+	}
+	w = suite.makeRequest("GET", "/api/v1/notifications", nil, otherToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Len(t, inbox.Notifications, 2)
+	assert.Equal(t, 2, inbox.UnreadCount)
+	assert.Equal(t, "message", inbox.Notifications[0]["kind"])
+	assert.Equal(t, "keyword", inbox.Notifications[1]["kind"])
+	
+	w = suite.makeRequest("POST", "/api/v1/notifications/read-all", nil, otherToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = suite.makeRequest("GET", "/api/v1/notifications", nil, otherToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Equal(t, 0, inbox.UnreadCount)
+	assert.Equal(t, true, inbox.Notifications[0]["read"])
+}
+
+func (suite *HandlersTestSuite) TestThreadsInbox() {
+	t := suite.T()
+	
+	channel := models.Channel{Name: "threads-test", Type: models.ChannelTypePublic, CreatedBy: suite.testUser.ID}
+	suite.db.Create(&channel)
+	other := models.User{Username: "replier", Email: "replier@example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.db.Create(&other)
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: suite.testUser.ID})
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: other.ID})
+	otherToken, err := middleware.GenerateJWT(&other, suite.config)
+	suite.Require().NoError(err)
+	
+	url := "/api/v1/channels/" + channel.ID.String() + "/messages"
+	w := suite.makeRequest("POST", url, map[string]interface{}{"content": "Standalone", "also_send_to_channel": true}, suite.testToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "requires thread_id")
+	
+	w = suite.makeRequest("POST", url, map[string]string{"content": "Lunch plans?"}, suite.testToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	rootID := created["message"]["id"].(string)
+	
+	// A thread without replies lists an empty array rather than null
+	w = suite.makeRequest("GET", url+"/"+rootID+"/replies", nil, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"replies": []}`, w.Body.String())
+	
+	w = suite.makeRequest("POST", url, map[string]interface{}{"content": "Tacos", "thread_id": rootID}, otherToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = suite.makeRequest("POST", url, map[string]interface{}{"content": "Noon works", "thread_id": rootID, "also_send_to_channel": true}, otherToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	
+	// Only the reply sent to the channel joins the timeline
+	w = suite.makeRequest("GET", url, nil, suite.testToken)
+	var history map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history["messages"], 2)
+	assert.Equal(t, "Noon works", history["messages"][1]["content"])
+	assert.Equal(t, true, history["messages"][1]["also_sent_to_channel"])
+	
+	// The thread starter follows it and has two unread replies; the replier has none
+	var inbox map[string][]map[string]interface{}
+	w = suite.makeRequest("GET", "/api/v1/threads", nil, suite.testToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Len(t, inbox["threads"], 1)
+	assert.Equal(t, float64(2), inbox["threads"][0]["unread_count"])
+	
+	w = suite.makeRequest("GET", "/api/v1/threads", nil, otherToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Len(t, inbox["threads"], 1)
+	assert.Equal(t, float64(0), inbox["threads"][0]["unread_count"])
+	
+	w = suite.makeRequest("POST", "/api/v1/threads/"+rootID+"/read", nil, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = suite.makeRequest("GET", "/api/v1/threads", nil, suite.testToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Equal(t, float64(0), inbox["threads"][0]["unread_count"])
+	
+	w = suite.makeRequest("DELETE", "/api/v1/threads/"+rootID+"/follow", nil, otherToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = suite.makeRequest("GET", "/api/v1/threads", nil, otherToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Empty(t, inbox["threads"])
+}
+
+func (suite *HandlersTestSuite) TestScheduledMessages() {
+	t := suite.T()
+	
+	channel := models.Channel{Name: "announcements", Type: models.ChannelTypePublic, CreatedBy: suite.testUser.ID}
+	suite.db.Create(&channel)
+	suite.db.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: suite.testUser.ID})
+	url := "/api/v1/channels/" + channel.ID.String() + "/messages"
+	
+	w := suite.makeRequest("POST", url, map[string]string{"content": "Too late", "send_at": "2000-01-01T09:00:00Z"}, suite.testToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	w = suite.makeRequest("POST", url, map[string]string{"content": "Draft announcement", "send_at": "in 1 day"}, suite.testToken)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var created struct {
+		ScheduledMessage map[string]interface{} `json:"scheduled_message"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	id := created.ScheduledMessage["id"].(string)
+	
+	// Nothing is posted until the send time
+	w = suite.makeRequest("GET", url, nil, suite.testToken)
+	assert.NotContains(t, w.Body.String(), "announcement")
+	
+	w = suite.makeRequest("PATCH", "/api/v1/scheduled-messages/"+id, map[string]string{"content": "Launch is on Monday"}, suite.testToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	w = suite.makeRequest("GET", "/api/v1/scheduled-messages", nil, suite.testToken)
+	var pending map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pending))
+	assert.Len(t, pending["scheduled_messages"], 1)
+	assert.Equal(t, "Launch is on Monday", pending["scheduled_messages"][0]["content"])
+	
+	// The previous process stopped after claiming the message; a freshly
+	// constructed service, as after a restart, requeues it and sends from the
+	// persisted queue
+	suite.Require().NoError(suite.db.Model(&models.ScheduledMessage{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"status":     models.ScheduledMessageSending,
+		"updated_at": time.Now().Add(-time.Hour),
+	}).Error)
+	stores := sqlstore.New(suite.db)
+	channels := service.NewChannelService(stores, service.Policy{})
+	restarted := service.NewScheduledMessageService(stores, channels, service.NewMessageService(stores, channels, nil))
+	sent, err := restarted.SendDue(context.Background(), time.Now().Add(25*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	
+	w = suite.makeRequest("GET", url, nil, suite.testToken)
+	assert.Contains(t, w.Body.String(), "Launch is on Monday")
+	
+	w = suite.makeRequest("GET", "/api/v1/scheduled-messages", nil, suite.testToken)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pending))
+	assert.Empty(t, pending["scheduled_messages"])
+	
+	w = suite.makeRequest("DELETE", "/api/v1/scheduled-messages/"+id, nil, suite.testToken)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
 func (suite *HandlersTestSuite) TestInvalidChannelAccess() {
 	t := suite.T()
 	
-	// Try to access non-existent channel
+	// Malformed channel IDs are rejected before reaching the database
 	w := suite.makeRequest("GET", "/api/v1/channels/invalid-id/messages", nil, suite.testToken)
 	
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	
+	fields := response["fields"].([]interface{})
+	assert.Equal(t, "id", fields[0].(map[string]interface{})["field"])
+	
+	// Try to access non-existent channel
+	w = suite.makeRequest("GET", "/api/v1/channels/"+models.NewUUIDv7().String()+"/messages", nil, suite.testToken)
+	
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func (suite *HandlersTestSuite) TestRegistrationFieldErrors() {
+	t := suite.T()
+	
+	registerData := map[string]interface{}{
+		"username": "bad-name",
+		"email":    "not-an-email",
+		"password": "password123",
+	}
+	
+	w := suite.makeRequest("POST", "/api/v1/auth/register", registerData, "")
+	
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	
+	var response struct {
+		Error  string                  `json:"error"`
+		Fields []middleware.FieldError `json:"fields"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	
+	assert.Equal(t, "Invalid request data", response.Error)
+	assert.ElementsMatch(t, []middleware.FieldError{
+		{Field: "username", Message: "must contain only letters, numbers, and underscores"},
+		{Field: "email", Message: "must be a valid email address"},
+	}, response.Fields)
+}
+
 func (suite *HandlersTestSuite) TestMessageWithoutMembership() {
 	t := suite.T()
 	
@@ -0,0 +1,374 @@
+package unit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"turnate/internal/database"
+	"turnate/internal/importer"
+	"turnate/internal/models"
+)
+
+type ImportTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	db      *gorm.DB
+	general *models.Channel
+}
+
+func (suite *ImportTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+	suite.Require().NoError(database.AutoMigrateModels(db))
+	suite.db = db
+
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true}
+	suite.Require().NoError(admin.SetPassword("password123"))
+	suite.Require().NoError(db.Create(admin).Error)
+	// Alice already has an account, under her email address in another case
+	alice := &models.User{Username: "alice_w", Email: "Alice@Example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.Require().NoError(alice.SetPassword("password123"))
+	suite.Require().NoError(db.Create(alice).Error)
+	suite.general = &models.Channel{Name: "general", Type: models.ChannelTypePublic, CreatedBy: admin.ID}
+	suite.Require().NoError(db.Create(suite.general).Error)
+	suite.Require().NoError(db.Create(&models.Channel{Name: "leadership", Type: models.ChannelTypePublic, CreatedBy: admin.ID}).Error)
+}
+
+// slackExport builds a Slack export zip from file contents
+func (suite *ImportTestSuite) slackExport(files map[string]any) *zip.Reader {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		suite.Require().NoError(err)
+		suite.Require().NoError(json.NewEncoder(w).Encode(content))
+	}
+	suite.Require().NoError(archive.Close())
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	suite.Require().NoError(err)
+	return r
+}
+
+func (suite *ImportTestSuite) sampleExport() *zip.Reader {
+	type m = map[string]any
+	return suite.slackExport(map[string]any{
+		"users.json": []m{
+			{"id": "U1", "name": "alice", "profile": m{"email": "alice@example.com"}},
+			{"id": "U2", "name": "bob.smith", "real_name": "Bob Smith", "profile": m{"display_name": "Bob"}},
+			{"id": "U3", "name": "carol", "deleted": true, "profile": m{"email": "carol@example.com"}},
+			{"id": "B1", "name": "deploybot", "is_bot": true},
+		},
+		"channels.json": []m{
+			{"id": "C1", "name": "general", "created": 1714550400, "creator": "U1", "members": []string{"U1", "U2"}},
+			{"id": "C2", "name": "random", "created": 1714550400, "creator": "U2", "is_archived": true, "members": []string{"U2"},
+				"purpose": m{"value": "Off topic"}},
+		},
+		"groups.json": []m{
+			{"id": "G1", "name": "leadership", "created": 1714550400, "creator": "U1", "members": []string{"U1", "U3"}},
+		},
+		"dms.json": []m{
+			{"id": "D1", "created": 1714550400, "members": []string{"U1", "U2"}},
+		},
+		"general/2024-05-01.json": []m{
+			{"type": "message", "subtype": "channel_join", "user": "U2", "text": "<@U2> has joined the channel", "ts": "1714557600.000100"},
+			{"type": "message", "user": "U1", "text": "Hi <@U2>, see <#C2|random> and <https://example.com|the docs> &amp; more", "ts": "1714557700.000100",
+				"thread_ts": "1714557700.000100", "reactions": []m{{"name": "wave", "count": 2, "users": []string{"U2", "U3"}}}},
+			{"type": "message", "user": "U2", "text": "Thanks!", "ts": "1714557800.000200", "thread_ts": "1714557700.000100"},
+			{"type": "message", "subtype": "bot_message", "bot_id": "B1", "text": "Deployed", "ts": "1714557900.000300"},
+			{"type": "message", "user": "U9", "text": "Who am I?", "ts": "1714558000.000400"},
+		},
+		"general/2024-05-02.json": []m{
+			{"type": "message", "subtype": "thread_broadcast", "user": "U1", "text": "Wrapping up", "ts": "1714640000.000100", "thread_ts": "1714557700.000100"},
+			{"type": "message", "subtype": "file_share", "user": "U2", "text": "", "ts": "1714640100.000200",
+				"files": []m{{"id": "F1", "name": "plan.pdf", "title": "Plan", "permalink": "https://slack.example/files/F1"}}},
+		},
+		"D1/2024-05-01.json": []m{
+			{"type": "message", "user": "U2", "text": "psst", "ts": "1714557650.000100"},
+		},
+	})
+}
+
+func (suite *ImportTestSuite) TestSlackImport() {
+	report, err := importer.Slack(suite.ctx, suite.db, suite.sampleExport(), time.Now())
+	suite.Require().NoError(err)
+
+	suite.Equal(importer.Counts{Users: 2, Channels: 3, Memberships: 7, Messages: 5}, report.Created)
+	suite.Equal(importer.Counts{Users: 1, Channels: 1}, report.Existing, "alice and #general already exist")
+	suite.Equal(map[string]int{"reactions": 2, "files": 1, "channel_events": 1, "archived_channels": 1, "missing_emails": 1}, report.Unmapped)
+	suite.Equal(3, report.SkippedCount, "the bot, its message and the message of an unknown user")
+
+	var users []models.User
+	suite.Require().NoError(suite.db.Order("username").Find(&users).Error)
+	usernames := []string{}
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	suite.Equal([]string{"admin", "alice_w", "bob_smith", "carol"}, usernames)
+	suite.Equal("Bob", users[2].DisplayName)
+	suite.Equal("u2@slack.invalid", users[2].Email)
+	suite.False(users[2].CheckPassword(""), "imported users cannot sign in until given a password")
+	suite.False(users[3].IsActive, "deleted Slack users are deactivated")
+
+	var private models.Channel
+	suite.Require().NoError(suite.db.Where("name = ?", "leadership-2").First(&private).Error)
+	suite.Equal(models.ChannelTypePrivate, private.Type, "a private channel never merges into a public one")
+	var direct models.Channel
+	suite.Require().NoError(suite.db.Where("name = ?", "dm-alice_w-bob_smith").First(&direct).Error)
+	suite.Equal(models.ChannelTypePrivate, direct.Type)
+
+	var messages []models.Message
+	suite.Require().NoError(suite.db.Where("channel_id = ?", suite.general.ID).Order("id").Find(&messages).Error)
+	suite.Require().Len(messages, 4)
+	root := messages[0]
+	suite.Equal("Hi @bob_smith, see #random and the docs (https://example.com) & more", root.Content)
+	suite.Equal(time.Unix(1714557700, 100000).UTC(), root.CreatedAt.UTC())
+	suite.Equal(2, root.ReplyCount)
+	suite.Require().NotNil(messages[1].ThreadID)
+	suite.Equal(root.ID, *messages[1].ThreadID)
+	suite.True(messages[2].AlsoSentToChannel)
+	suite.Equal("📎 Plan: https://slack.example/files/F1", messages[3].Content)
+	suite.Equal(users[2].ID, messages[3].UserID)
+
+	var follows int64
+	suite.Require().NoError(suite.db.Model(&models.ThreadFollow{}).Where("thread_id = ?", root.ID).Count(&follows).Error)
+	suite.Equal(int64(2), follows)
+}
+
+func (suite *ImportTestSuite) TestImportedUsernamesAvoidGroupHandles() {
+	var admin models.User
+	suite.Require().NoError(suite.db.Where("username = ?", "admin").First(&admin).Error)
+	suite.Require().NoError(suite.db.Create(&models.UserGroup{Handle: "carol", Name: "Carol's team", CreatedBy: admin.ID}).Error)
+
+	_, err := importer.Slack(suite.ctx, suite.db, suite.sampleExport(), time.Now())
+	suite.Require().NoError(err)
+
+	var carol models.User
+	suite.Require().NoError(suite.db.Where("email = ?", "carol@example.com").First(&carol).Error)
+	suite.Equal("carol_2", carol.Username, "@carol already mentions the group")
+}
+
+func (suite *ImportTestSuite) TestSlackImportIsIdempotent() {
+	_, err := importer.Slack(suite.ctx, suite.db, suite.sampleExport(), time.Now())
+	suite.Require().NoError(err)
+
+	report, err := importer.Slack(suite.ctx, suite.db, suite.sampleExport(), time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(importer.Counts{}, report.Created)
+	suite.Equal(importer.Counts{Users: 3, Channels: 4, Memberships: 7, Messages: 5}, report.Existing)
+
+	var messages int64
+	suite.Require().NoError(suite.db.Model(&models.Message{}).Count(&messages).Error)
+	suite.Equal(int64(5), messages)
+	var root models.Message
+	suite.Require().NoError(suite.db.Where("thread_id IS NULL AND reply_count > 0").First(&root).Error)
+	suite.Equal(2, root.ReplyCount)
+}
+
+func (suite *ImportTestSuite) TestSlackImportRejectsOtherArchives() {
+	_, err := importer.Slack(suite.ctx, suite.db, suite.slackExport(map[string]any{"manifest.json": map[string]any{}}), time.Now())
+	suite.ErrorContains(err, "users.json is missing")
+}
+
+// jsonl joins lines into a file
+func jsonl(lines ...string) *bytes.Reader {
+	return bytes.NewReader([]byte(strings.Join(lines, "\n") + "\n"))
+}
+
+func mattermostExport() *bytes.Reader {
+	return jsonl(
+		`{"type":"version","version":1}`,
+		`{"type":"team","team":{"name":"acme","display_name":"Acme"}}`,
+		`{"type":"channel","channel":{"team":"acme","name":"town-square","display_name":"Town Square","type":"O","purpose":"Everyone"}}`,
+		`{"type":"channel","channel":{"team":"acme","name":"general","type":"O"}}`,
+		`{"type":"channel","channel":{"team":"acme","name":"empty","type":"P"}}`,
+		`{"type":"channel","channel":{"team":"acme","name":"odd","type":"X"}}`,
+		`{"type":"user","user":{"username":"dave","email":"dave@example.com","nickname":"Dave","teams":[{"name":"acme","channels":[{"name":"town-square"},{"name":"general"},{"name":"nope"}]}]}}`,
+		`{"type":"user","user":{"username":"alice","email":"alice@example.com","teams":[{"name":"acme","channels":[{"name":"general"}]}]}}`,
+		`{"type":"user","user":{"email":"nobody@example.com"}}`,
+		`{"type":"post","post":{"team":"acme","channel":"town-square","user":"dave","message":"Hello","create_at":1714557600000,`+
+			`"reactions":[{"user":"alice","emoji_name":"wave"}],"replies":[{"user":"alice","message":"Hi Dave","create_at":1714557660000},`+
+			`{"user":"dave","message":"","create_at":1714557720000,"attachments":[{"path":"data/plan.pdf"}]}]}}`,
+		`{"type":"post","post":{"team":"acme","channel":"general","user":"dave","type":"system_join_channel","message":"dave joined","create_at":1714557500000}}`,
+		`{"type":"direct_channel","direct_channel":{"members":["dave","alice"]}}`,
+		`{"type":"direct_post","direct_post":{"channel_members":["alice","dave"],"user":"alice","message":"psst","create_at":1714557800000}}`,
+		`not json`,
+	)
+}
+
+func (suite *ImportTestSuite) TestMattermostImport() {
+	report, err := importer.Mattermost(suite.ctx, suite.db, mattermostExport(), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+
+	suite.Equal(importer.Counts{Users: 1, Channels: 2, Memberships: 5, Messages: 4}, report.Created)
+	suite.Equal(importer.Counts{Users: 1, Channels: 1}, report.Existing, "alice and #general already exist")
+	suite.Equal(map[string]int{"team": 1, "channel_events": 1, "reactions": 1, "files": 1}, report.Unmapped)
+	suite.Equal(5, report.SkippedCount, "the invalid channel and user, the unknown channel, the empty channel and the line that is not JSON")
+
+	var townSquare models.Channel
+	suite.Require().NoError(suite.db.Where("name = ?", "town-square").First(&townSquare).Error)
+	suite.Equal("Everyone", townSquare.Description)
+	suite.Equal(models.ChannelTypePublic, townSquare.Type)
+	suite.False(suite.db.Where("name = ?", "empty").First(&models.Channel{}).Error == nil, "channels nobody uses are not created")
+	var direct models.Channel
+	suite.Require().NoError(suite.db.Where("name = ?", "dm-alice-dave").First(&direct).Error)
+	suite.Equal(models.ChannelTypePrivate, direct.Type)
+
+	var messages []models.Message
+	suite.Require().NoError(suite.db.Where("channel_id = ?", townSquare.ID).Order("id").Find(&messages).Error)
+	suite.Require().Len(messages, 3)
+	suite.Equal(time.UnixMilli(1714557600000).UTC(), messages[0].CreatedAt.UTC())
+	suite.Equal(2, messages[0].ReplyCount)
+	suite.Require().NotNil(messages[2].ThreadID)
+	suite.Equal(messages[0].ID, *messages[2].ThreadID)
+	suite.Equal("📎 plan.pdf", messages[2].Content)
+}
+
+func (suite *ImportTestSuite) TestMattermostImportIsIdempotent() {
+	_, err := importer.Mattermost(suite.ctx, suite.db, mattermostExport(), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+
+	report, err := importer.Mattermost(suite.ctx, suite.db, mattermostExport(), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(importer.Counts{}, report.Created)
+	suite.Equal(importer.Counts{Users: 2, Channels: 3, Memberships: 5, Messages: 4}, report.Existing)
+	var root models.Message
+	suite.Require().NoError(suite.db.Where("thread_id IS NULL AND reply_count > 0").First(&root).Error)
+	suite.Equal(2, root.ReplyCount)
+}
+
+var nativeLines = []string{
+	`{"type":"version","version":1}`,
+	`{"type":"user","user":{"id":"u1","username":"erin","email":"erin@example.com","display_name":"Erin","role":"admin"}}`,
+	`{"type":"user","user":{"id":"u2","username":"frank","email":"frank@example.com","is_active":false}}`,
+	`{"type":"user","user":{"id":"u3","username":"x","email":"not-an-email"}}`,
+	`{"type":"channel","channel":{"id":"c1","name":"design","description":"Design work","type":"private","created_by":"u1","created_at":"2024-05-01T10:00:00Z"}}`,
+	`{"type":"membership","membership":{"channel_id":"c1","user_id":"u1","joined_at":"2024-05-01T10:00:00Z"}}`,
+	`{"type":"membership","membership":{"channel_id":"c1","user_id":"u2"}}`,
+	`{"type":"membership","membership":{"channel_id":"c9","user_id":"u2"}}`,
+	`{"type":"message","message":{"id":"m1","channel_id":"c1","user_id":"u1","content":"Kickoff","created_at":"2024-05-01T10:05:00Z"}}`,
+	`{"type":"message","message":{"id":"m2","channel_id":"c1","user_id":"u2","thread_id":"m1","content":"Joining","created_at":"2024-05-01T10:06:00Z","also_sent_to_channel":true}}`,
+	`{"type":"message","message":{"id":"m3","channel_id":"c1","user_id":"u2","content":"When?","created_at":"yesterday"}}`,
+	`{"type":"reaction","reaction":{"message_id":"m1","user_id":"u2","emoji":"tada"}}`,
+}
+
+func (suite *ImportTestSuite) TestJSONLImport() {
+	report, err := importer.JSONL(suite.ctx, suite.db, jsonl(nativeLines...), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+
+	suite.Equal(importer.Counts{Users: 2, Channels: 1, Memberships: 2, Messages: 2}, report.Created)
+	suite.Equal(4, report.SkippedCount, "the invalid user, the unknown channel, the bad time and the unknown record")
+	suite.Equal(importer.Skipped{Kind: "message", ID: "line 11", Reason: "created_at must be an RFC 3339 time"}, report.Skipped[1])
+
+	var erin, frank models.User
+	suite.Require().NoError(suite.db.Where("username = ?", "erin").First(&erin).Error)
+	suite.Equal(models.UserRoleAdmin, erin.Role)
+	suite.Equal("Erin", erin.DisplayName)
+	suite.Require().NoError(suite.db.Where("username = ?", "frank").First(&frank).Error)
+	suite.False(frank.IsActive)
+
+	var design models.Channel
+	suite.Require().NoError(suite.db.Where("name = ?", "design").First(&design).Error)
+	suite.Equal(erin.ID, design.CreatedBy)
+	var messages []models.Message
+	suite.Require().NoError(suite.db.Where("channel_id = ?", design.ID).Order("id").Find(&messages).Error)
+	suite.Require().Len(messages, 2)
+	suite.Equal(1, messages[0].ReplyCount)
+	suite.Equal(messages[0].ID, *messages[1].ThreadID)
+	suite.True(messages[1].AlsoSentToChannel)
+}
+
+func (suite *ImportTestSuite) TestImportsSkipMessagesLongerThanUsersCanPost() {
+	long := strings.Repeat("a", 2001)
+	type m = map[string]any
+
+	report, err := importer.Slack(suite.ctx, suite.db, suite.slackExport(map[string]any{
+		"users.json":    []m{{"id": "U1", "name": "alice", "profile": m{"email": "alice@example.com"}}},
+		"channels.json": []m{{"id": "C1", "name": "general", "created": 1714550400, "creator": "U1", "members": []string{"U1"}}},
+		"general/2024-05-01.json": []m{
+			{"type": "message", "user": "U1", "text": long, "ts": "1714557600.000100"},
+			{"type": "message", "user": "U1", "text": long[:2000], "ts": "1714557700.000100"},
+		},
+	}), time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(1, report.Created.Messages)
+	suite.Equal(importer.Skipped{Kind: "message", ID: "C1/1714557600.000100", Reason: "message is longer than 2000 characters"}, report.Skipped[0])
+
+	report, err = importer.Mattermost(suite.ctx, suite.db, jsonl(
+		`{"type":"version","version":1}`,
+		`{"type":"channel","channel":{"team":"acme","name":"general","type":"O"}}`,
+		`{"type":"user","user":{"username":"dave","email":"dave@example.com","teams":[{"name":"acme","channels":[{"name":"general"}]}]}}`,
+		`{"type":"post","post":{"team":"acme","channel":"general","user":"dave","message":"`+long+`","create_at":1714557600000}}`,
+	), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+	suite.Zero(report.Created.Messages)
+	suite.Equal(1, report.SkippedCount)
+
+	report, err = importer.JSONL(suite.ctx, suite.db, jsonl(
+		nativeLines[0], nativeLines[1], nativeLines[4],
+		`{"type":"message","message":{"id":"m1","channel_id":"c1","user_id":"u1","content":"`+long+`","created_at":"2024-05-01T10:05:00Z"}}`,
+	), importer.JSONLOptions{DryRun: true}, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(importer.Skipped{Kind: "message", ID: "line 4", Reason: "content must be at most 2000 characters"}, report.Skipped[0])
+}
+
+func (suite *ImportTestSuite) TestJSONLImportResumesFromCheckpoint() {
+	// An earlier run wrote the users and the channel, then stopped after line 5
+	_, err := importer.JSONL(suite.ctx, suite.db, jsonl(nativeLines[:5]...), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+	file := []byte(strings.Join(nativeLines, "\n") + "\n")
+	digest := sha256.Sum256(file)
+	suite.Require().NoError(suite.db.Create(&models.ImportCheckpoint{
+		Source: importer.SourceJSONL,
+		Digest: hex.EncodeToString(digest[:]),
+		Line:   5,
+		Report: `{"source":"jsonl","created":{"users":2,"channels":1},"existing":{},"unmapped":{},"skipped":[],"skipped_count":0}`,
+	}).Error)
+
+	report, err := importer.JSONL(suite.ctx, suite.db, bytes.NewReader(file), importer.JSONLOptions{}, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(importer.Counts{Users: 2, Channels: 1, Memberships: 2, Messages: 2}, report.Created)
+	suite.Equal(importer.Counts{}, report.Existing, "lines before the checkpoint are not imported again")
+	suite.Equal(3, report.SkippedCount)
+
+	var checkpoints int64
+	suite.Require().NoError(suite.db.Model(&models.ImportCheckpoint{}).Count(&checkpoints).Error)
+	suite.Equal(int64(0), checkpoints, "a finished import removes its checkpoint")
+}
+
+func (suite *ImportTestSuite) TestJSONLDryRun() {
+	report, err := importer.JSONL(suite.ctx, suite.db, jsonl(nativeLines...), importer.JSONLOptions{DryRun: true}, time.Now())
+	suite.Require().NoError(err)
+	suite.Equal(importer.Counts{}, report.Created)
+	suite.Equal(3, report.SkippedCount, "references to unknown records are only found by writing")
+
+	var users int64
+	suite.Require().NoError(suite.db.Model(&models.User{}).Count(&users).Error)
+	suite.Equal(int64(2), users)
+}
+
+func (suite *ImportTestSuite) TestJSONLRejectsOtherVersions() {
+	_, err := importer.JSONL(suite.ctx, suite.db, jsonl(`{"type":"version","version":2}`), importer.JSONLOptions{}, time.Now())
+	suite.ErrorContains(err, "only version 1")
+	_, err = importer.JSONL(suite.ctx, suite.db, jsonl(nativeLines[1]), importer.JSONLOptions{}, time.Now())
+	suite.ErrorContains(err, "must start with its only version record")
+}
+
+func TestImportTestSuite(t *testing.T) {
+	suite.Run(t, new(ImportTestSuite))
+}
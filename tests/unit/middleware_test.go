@@ -1,8 +1,13 @@
 package unit
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -10,19 +15,27 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
 	"turnate/internal/config"
-	"turnate/internal/database"
+	"turnate/internal/logging"
+	"turnate/internal/metrics"
 	"turnate/internal/middleware"
 	"turnate/internal/models"
+	"turnate/internal/store"
+	"turnate/internal/store/sqlstore"
+	"turnate/internal/tracing"
 )
 
 type MiddlewareTestSuite struct {
 	suite.Suite
 	db     *gorm.DB
+	stores *store.Stores
 	config *config.Config
 	user   *models.User
 }
@@ -37,7 +50,7 @@ func (suite *MiddlewareTestSuite) SetupSuite() {
 	suite.Require().NoError(err)
 	
 	suite.db = db
-	database.DB = db
+	suite.stores = sqlstore.New(db)
 	
 	// Run migrations
 	err = models.AutoMigrate(db)
@@ -96,7 +109,7 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareValid() {
 	
 	// Create test router
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.GET("/protected", func(c *gin.Context) {
 		userID, _ := c.Get("user_id")
 		username, _ := c.Get("username")
@@ -123,7 +136,7 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareNoToken() {
 	t := suite.T()
 	
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -140,7 +153,7 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareInvalidToken() {
 	t := suite.T()
 	
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -175,7 +188,7 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareExpiredToken() {
 	assert.NoError(t, err)
 	
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -212,7 +225,7 @@ func (suite *MiddlewareTestSuite) TestAuthMiddlewareInactiveUser() {
 	assert.NoError(t, err)
 	
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -249,7 +262,7 @@ func (suite *MiddlewareTestSuite) TestAdminMiddleware() {
 	assert.NoError(t, err)
 	
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.Use(middleware.AdminMiddleware())
 	r.GET("/admin", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "admin access granted"})
@@ -278,28 +291,389 @@ func (suite *MiddlewareTestSuite) TestCORSMiddleware() {
 	t := suite.T()
 	
 	r := gin.New()
-	r.Use(middleware.CORSMiddleware())
+	r.Use(middleware.CORSMiddleware([]string{"https://chat.example.com"}))
 	r.GET("/test", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "test"})
 	})
 	
-	// Test preflight request
+	// Test preflight request from an allowed origin
 	req := httptest.NewRequest("OPTIONS", "/test", nil)
+	req.Header.Set("Origin", "https://chat.example.com")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	
 	assert.Equal(t, http.StatusNoContent, w.Code)
-	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "https://chat.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
 	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST")
 	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "X-CSRF-Token")
 	
 	// Test actual request
 	req = httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Origin", "https://chat.example.com")
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "https://chat.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	
+	// Test origin outside the allowlist
+	req = httptest.NewRequest("OPTIONS", "/test", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func (suite *MiddlewareTestSuite) TestMetricsEndpoint() {
+	t := suite.T()
+	
+	r := gin.New()
+	r.Use(metrics.Middleware())
+	r.GET("/items/:id", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+	})
+	r.GET("/metrics", middleware.MetricsAccessMiddleware(config.MetricsConfig{
+		Enabled:    true,
+		Username:   "prometheus",
+		Password:   "scrape-secret",
+		AllowedIPs: []string{"10.0.0.0/8", "192.168.1.5"},
+	}), gin.WrapH(metrics.Handler()))
+	
+	scrape := func(remoteAddr string, withAuth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		if withAuth {
+			req.SetBasicAuth("prometheus", "scrape-secret")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	
+	// Addresses outside the allowlist are refused even with credentials
+	assert.Equal(t, http.StatusForbidden, scrape("203.0.113.7:4000", true).Code)
+	
+	// Allowed addresses still need the credentials
+	w := scrape("10.1.2.3:4000", false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+	
+	w = scrape("192.168.1.5:4000", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	// Latencies are recorded by route template rather than by path
+	body := w.Body.String()
+	assert.Contains(t, body, `turnate_http_request_duration_seconds_count{method="GET",route="/items/:id",status="200"}`)
+	assert.NotContains(t, body, "/items/42")
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func (suite *MiddlewareTestSuite) TestMetricsIgnoresSpoofedForwardedFor() {
+	t := suite.T()
+	
+	newRouter := func(trustedProxies []string) *gin.Engine {
+		r := gin.New()
+		suite.Require().NoError(r.SetTrustedProxies(trustedProxies))
+		r.GET("/metrics", middleware.MetricsAccessMiddleware(config.MetricsConfig{
+			Enabled:    true,
+			AllowedIPs: []string{"127.0.0.1"},
+		}), gin.WrapH(metrics.Handler()))
+		return r
+	}
+	scrape := func(r *gin.Engine, remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "127.0.0.1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	
+	// Without trusted proxies the header is ignored
+	assert.Equal(t, http.StatusForbidden, scrape(newRouter(nil), "203.0.113.7:4000"))
+	
+	// A configured proxy may vouch for the client, others still may not
+	trusting := newRouter([]string{"10.0.0.1"})
+	assert.Equal(t, http.StatusOK, scrape(trusting, "10.0.0.1:4000"))
+	assert.Equal(t, http.StatusForbidden, scrape(trusting, "203.0.113.7:4000"))
+}
+
+func (suite *MiddlewareTestSuite) TestTracing() {
+	t := suite.T()
+	
+	// Without an exporter requests still get a trace ID
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: config.TracingExporterNone, ServiceName: "turnate"})
+	suite.Require().NoError(err)
+	defer shutdown(context.Background())
+	
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.Use(tracing.GORMPlugin{}))
+	suite.Require().NoError(db.AutoMigrate(&models.User{}))
+	
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.GET("/users/:id", func(c *gin.Context) {
+		var users []models.User
+		db.WithContext(c.Request.Context()).Where("id = ?", c.Param("id")).Find(&users)
+		c.JSON(http.StatusOK, gin.H{"users": len(users)})
+	})
+	
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/42", nil))
+	assert.Len(t, w.Header().Get(tracing.TraceHeader), 32)
+	
+	// With an exporter the request and its queries are recorded in one trace
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+	
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get(tracing.TraceHeader))
+	
+	spans := exporter.GetSpans()
+	suite.Require().Len(spans, 2)
+	query, server := spans[0], spans[1]
+	assert.Equal(t, "GET /users/:id", server.Name)
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Equal(t, "gorm.query", query.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+	assert.Equal(t, server.SpanContext.TraceID(), query.SpanContext.TraceID())
+	
+	var statement string
+	for _, attr := range query.Attributes {
+		if attr.Key == "db.query.text" {
+			statement = attr.Value.AsString()
+		}
+	}
+	assert.Contains(t, statement, "FROM `users`")
+	assert.NotContains(t, statement, "42", "values are not recorded")
+}
+
+func (suite *MiddlewareTestSuite) TestRequestIDAndStructuredLogs() {
+	t := suite.T()
+	
+	var logs bytes.Buffer
+	previous := slog.Default()
+	logging.Setup(config.LogConfig{
+		Level:      "info",
+		Format:     config.LogFormatJSON,
+		Components: map[string]string{"http": "warn"},
+		SQL:        config.SQLLogConfig{Enabled: true},
+	}, &logs)
+	defer slog.SetDefault(previous)
+	
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logging.NewGORMLogger(config.SQLLogConfig{Enabled: true})})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&models.User{}))
+	logs.Reset()
+	
+	r := gin.New()
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.RequestLogger())
+	r.Use(middleware.RecoveryMiddleware())
+	r.GET("/users/:id", func(c *gin.Context) {
+		var user models.User
+		err := db.WithContext(c.Request.Context()).Where("password = ?", "hunter2").First(&user).Error
+		logging.Component(logging.ComponentServer).InfoContext(c.Request.Context(), "looked up user", "password", "hunter2")
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": user.ID})
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	
+	records := func() []map[string]interface{} {
+		var parsed []map[string]interface{}
+		for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+			var record map[string]interface{}
+			suite.Require().NoError(json.Unmarshal(line, &record), string(line))
+			parsed = append(parsed, record)
+		}
+		logs.Reset()
+		return parsed
+	}
+	
+	// A well-formed incoming request ID is kept and attached to every record
+	req := httptest.NewRequest("GET", "/users/42?token=abc", nil)
+	req.Header.Set(middleware.RequestIDHeader, "edge-1234")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "edge-1234", w.Header().Get(middleware.RequestIDHeader))
+	
+	lines := records()
+	suite.Require().Len(lines, 3)
+	sql, lookup, request := lines[0], lines[1], lines[2]
+	
+	assert.Equal(t, "slow query", sql["msg"])
+	assert.Equal(t, "sql", sql["component"])
+	assert.Contains(t, sql["sql"], "password = ?")
+	assert.NotContains(t, sql["sql"], "hunter2")
+	
+	assert.Equal(t, "looked up user", lookup["msg"])
+	assert.Equal(t, logging.Redacted, lookup["password"])
+	assert.Equal(t, "edge-1234", lookup["request_id"])
+	
+	assert.Equal(t, "WARN", request["level"])
+	assert.Equal(t, "http", request["component"])
+	assert.Equal(t, "/users/:id", request["route"])
+	assert.Equal(t, "/users/42", request["path"])
+	assert.Equal(t, float64(http.StatusNotFound), request["status"])
+	assert.Equal(t, "edge-1234", request["request_id"])
+	
+	// Malformed IDs are replaced, and panics are logged as errors
+	req = httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set(middleware.RequestIDHeader, "not a valid id")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	requestID := w.Header().Get(middleware.RequestIDHeader)
+	assert.Len(t, requestID, 36)
+	
+	lines = records()
+	suite.Require().Len(lines, 2)
+	assert.Equal(t, "panic while handling request", lines[0]["msg"])
+	assert.Equal(t, "boom", lines[0]["error"])
+	assert.Equal(t, "ERROR", lines[1]["level"])
+	assert.Equal(t, requestID, lines[1]["request_id"])
+}
+
+func (suite *MiddlewareTestSuite) TestLogoutRequiresCSRFToken() {
+	t := suite.T()
+	
+	r := gin.New()
+	r.POST("/logout", middleware.CSRFMiddleware(), func(c *gin.Context) {
+		middleware.ClearSessionCookies(c, suite.config)
+		c.JSON(http.StatusOK, gin.H{"message": "test"})
+	})
+	
+	// The session does not have to be valid any more, only present
+	sessionCookie := &http.Cookie{Name: middleware.SessionCookieName, Value: "expired-session"}
+	csrfCookie := &http.Cookie{Name: middleware.CSRFCookieName, Value: "csrf-token-value"}
+	
+	// A cross-site form post carries the cookies but not the header
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(sessionCookie)
+	req.AddCookie(csrfCookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+	
+	req = httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(sessionCookie)
+	req.AddCookie(csrfCookie)
+	req.Header.Set(middleware.CSRFHeaderName, "csrf-token-value")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Result().Cookies())
+	
+	// Without a session cookie there is nothing to forge
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/logout", nil))
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestCookieAuthRequiresCSRFToken() {
+	t := suite.T()
+	
+	token, err := middleware.GenerateJWT(suite.user, suite.config)
+	assert.NoError(t, err)
+	
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "test"})
+	})
+	r.POST("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "test"})
+	})
+	
+	sessionCookie := &http.Cookie{Name: middleware.SessionCookieName, Value: token}
+	csrfCookie := &http.Cookie{Name: middleware.CSRFCookieName, Value: "csrf-token-value"}
+	
+	// Safe methods only need the session cookie
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.AddCookie(sessionCookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	// State-changing requests without the CSRF header are rejected
+	req = httptest.NewRequest("POST", "/test", nil)
+	req.AddCookie(sessionCookie)
+	req.AddCookie(csrfCookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	
+	// Mismatched CSRF header is rejected
+	req = httptest.NewRequest("POST", "/test", nil)
+	req.AddCookie(sessionCookie)
+	req.AddCookie(csrfCookie)
+	req.Header.Set(middleware.CSRFHeaderName, "something-else")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	
+	// Matching CSRF header passes
+	req = httptest.NewRequest("POST", "/test", nil)
+	req.AddCookie(sessionCookie)
+	req.AddCookie(csrfCookie)
+	req.Header.Set(middleware.CSRFHeaderName, "csrf-token-value")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	// Bearer tokens are not subject to CSRF checks
+	req = httptest.NewRequest("POST", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestTimeoutExemptsDownloads() {
+	t := suite.T()
+	
+	router := gin.New()
+	router.Use(middleware.TimeoutMiddleware(20*time.Millisecond, "/download/:name"))
+	slow := func(c *gin.Context) {
+		time.Sleep(60 * time.Millisecond)
+		c.String(http.StatusOK, "all of it")
+	}
+	router.GET("/download/:name", slow)
+	
+	// Exempt routes write straight to the client and are not cut off
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/download/backup.db", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "all of it", w.Body.String())
 }
 
 func (suite *MiddlewareTestSuite) TestSecurityHeaders() {
@@ -332,7 +706,7 @@ func (suite *MiddlewareTestSuite) TestLastSeenUpdate() {
 	assert.NoError(t, err)
 	
 	r := gin.New()
-	r.Use(middleware.AuthMiddleware(suite.config))
+	r.Use(middleware.AuthMiddleware(suite.config, suite.stores.Users))
 	r.GET("/test", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "test"})
 	})
@@ -356,6 +730,49 @@ func (suite *MiddlewareTestSuite) TestLastSeenUpdate() {
 	}
 }
 
+func (suite *MiddlewareTestSuite) TestInputValidationAllowsPlainText() {
+	t := suite.T()
+	
+	r := gin.New()
+	r.Use(middleware.InputValidationMiddleware())
+	r.GET("/search", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"q": c.Query("q")})
+	})
+	
+	// Ordinary prose that happens to contain SQL keywords and punctuation
+	req := httptest.NewRequest("GET", "/search?q="+url.QueryEscape("update the release notes; select & create"), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestInputValidationRejectsDangerousInput() {
+	t := suite.T()
+	
+	r := gin.New()
+	r.Use(middleware.InputValidationMiddleware())
+	r.GET("/files/:name", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "test"})
+	})
+	
+	// Control characters in query values
+	req := httptest.NewRequest("GET", "/files/report?q=abc%00def", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"q"`)
+	
+	// Path traversal in path parameters
+	req = httptest.NewRequest("GET", "/files/..%5C..%5Cboot.ini", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"name"`)
+}
+
 func TestMiddlewareTestSuite(t *testing.T) {
 	suite.Run(t, new(MiddlewareTestSuite))
 }
\ No newline at end of file
@@ -1,6 +1,8 @@
 package unit
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,6 +11,7 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"turnate/internal/database"
 	"turnate/internal/models"
 )
 
@@ -281,6 +284,30 @@ func (suite *ModelsTestSuite) TestSoftDelete() {
 	assert.NotNil(t, foundUser.DeletedAt)
 }
 
+func (suite *ModelsTestSuite) TestBackupAndVacuum() {
+	t := suite.T()
+	ctx := context.Background()
+
+	user := models.User{Username: "backuptest", Email: "backup@example.com", Role: models.UserRoleNormal}
+	user.SetPassword("password")
+	assert.NoError(t, suite.db.Create(&user).Error)
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	assert.NoError(t, database.Backup(ctx, suite.db, path))
+	assert.Error(t, database.Backup(ctx, suite.db, path), "an existing file is never overwritten")
+
+	backup, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	var restored models.User
+	assert.NoError(t, backup.Where("username = ?", "backuptest").First(&restored).Error)
+	assert.Equal(t, user.ID, restored.ID)
+	sqlDB, err := backup.DB()
+	suite.Require().NoError(err)
+	sqlDB.Close()
+
+	assert.NoError(t, database.Vacuum(ctx, suite.db))
+}
+
 func TestModelsTestSuite(t *testing.T) {
 	suite.Run(t, new(ModelsTestSuite))
 }
\ No newline at end of file
@@ -0,0 +1,177 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"turnate/internal/models"
+	"turnate/internal/service"
+	"turnate/internal/store/sqlstore"
+)
+
+// queryCounter counts the statements GORM sends to the database
+type queryCounter struct {
+	count atomic.Int64
+}
+
+func (q *queryCounter) register(db *gorm.DB) error {
+	callback := func(*gorm.DB) { q.count.Add(1) }
+	processors := map[string]interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}{
+		"gorm:query":  db.Callback().Query().After("gorm:query"),
+		"gorm:create": db.Callback().Create().After("gorm:create"),
+		"gorm:update": db.Callback().Update().After("gorm:update"),
+		"gorm:delete": db.Callback().Delete().After("gorm:delete"),
+		"gorm:row":    db.Callback().Row().After("gorm:row"),
+		"gorm:raw":    db.Callback().Raw().After("gorm:raw"),
+	}
+	for name, processor := range processors {
+		if err := processor.Register("test:count_"+name, callback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// measure returns the number of statements issued by fn
+func (q *queryCounter) measure(fn func() error) (int64, error) {
+	before := q.count.Load()
+	err := fn()
+	return q.count.Load() - before, err
+}
+
+// listingFixture is a workspace on SQLite that can grow between measurements
+type listingFixture struct {
+	ctx      context.Context
+	counter  *queryCounter
+	users    *service.UserService
+	channels *service.ChannelService
+	messages *service.MessageService
+	actor    service.Actor
+	channel  *models.Channel
+	seeded   int
+}
+
+func newListingFixture(tb testing.TB) *listingFixture {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(tb, err)
+
+	// Every connection to :memory: is a separate database
+	sqlDB, err := db.DB()
+	require.NoError(tb, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(tb, models.AutoMigrate(db))
+	require.NoError(tb, models.CreateIndexes(db))
+
+	stores := sqlstore.New(db)
+	channels := service.NewChannelService(stores, service.Policy{})
+	f := &listingFixture{
+		ctx:      context.Background(),
+		counter:  &queryCounter{},
+		users:    service.NewUserService(stores),
+		channels: channels,
+		messages: service.NewMessageService(stores, channels, nil),
+	}
+	user, err := f.users.Register(f.ctx, "reader", "reader@example.com", "", "password123")
+	require.NoError(tb, err)
+	f.actor = service.Actor{UserID: user.ID, Role: user.Role}
+
+	f.channel, err = channels.Create(f.ctx, f.actor, "busy", "", models.ChannelTypePublic)
+	require.NoError(tb, err)
+
+	require.NoError(tb, f.counter.register(db))
+	return f
+}
+
+// grow adds n channels, each with a member, and n threads with replies to the busy channel
+func (f *listingFixture) grow(tb testing.TB, n int) {
+	for i := 0; i < n; i++ {
+		f.seeded++
+		user, err := f.users.Register(f.ctx, fmt.Sprintf("user%d", f.seeded), fmt.Sprintf("user%d@example.com", f.seeded), "", "password123")
+		require.NoError(tb, err)
+		member := service.Actor{UserID: user.ID, Role: user.Role}
+
+		channel, err := f.channels.Create(f.ctx, member, fmt.Sprintf("channel-%d", f.seeded), "", models.ChannelTypePublic)
+		require.NoError(tb, err)
+		require.NoError(tb, f.channels.Join(f.ctx, f.actor, channel.ID))
+
+		root, err := f.messages.Create(f.ctx, f.actor, f.channel.ID, fmt.Sprintf("thread %d", f.seeded), nil)
+		require.NoError(tb, err)
+		for r := 0; r < 3; r++ {
+			_, err := f.messages.Create(f.ctx, f.actor, f.channel.ID, "reply", &root.ID)
+			require.NoError(tb, err)
+		}
+	}
+}
+
+func (f *listingFixture) listingQueries(tb testing.TB) map[string]int64 {
+	listings := map[string]func() error{
+		"channels": func() error {
+			_, err := f.channels.List(f.ctx, f.actor)
+			return err
+		},
+		"messages": func() error {
+			window, err := f.messages.List(f.ctx, f.actor, f.channel.ID, service.MessagePosition{}, 50)
+			if err == nil && len(window.Messages) > 0 && window.Messages[len(window.Messages)-1].ReplyCount != 3 {
+				err = fmt.Errorf("expected 3 replies, got %d", window.Messages[len(window.Messages)-1].ReplyCount)
+			}
+			return err
+		},
+		"recent": func() error {
+			_, err := f.messages.Recent(f.ctx, f.actor)
+			return err
+		},
+	}
+
+	counts := make(map[string]int64, len(listings))
+	for name, listing := range listings {
+		count, err := f.counter.measure(listing)
+		require.NoError(tb, err, name)
+		counts[name] = count
+	}
+	return counts
+}
+
+func TestListingQueryCountsStayConstant(t *testing.T) {
+	f := newListingFixture(t)
+
+	f.grow(t, 2)
+	small := f.listingQueries(t)
+
+	f.grow(t, 30)
+	large := f.listingQueries(t)
+
+	require.Equal(t, small, large)
+	for name, count := range large {
+		require.Positive(t, count, name)
+	}
+}
+
+func BenchmarkListingQueries(b *testing.B) {
+	for _, size := range []int{10, 100} {
+		b.Run(fmt.Sprintf("channels=%d", size), func(b *testing.B) {
+			f := newListingFixture(b)
+			f.grow(b, size)
+			b.ResetTimer()
+
+			var queries int64
+			for i := 0; i < b.N; i++ {
+				for _, count := range f.listingQueries(b) {
+					queries += count
+				}
+			}
+			b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"turnate/internal/database"
+	"turnate/internal/models"
+	"turnate/internal/retention"
+	"turnate/internal/service"
+	"turnate/internal/store"
+	"turnate/internal/store/sqlstore"
+)
+
+type RetentionTestSuite struct {
+	suite.Suite
+	ctx    context.Context
+	db     *gorm.DB
+	stores *store.Stores
+	now    time.Time
+	alice  *models.User
+	bob    *models.User
+	carol  *models.User
+	purger *retention.Purger
+}
+
+func (suite *RetentionTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+	suite.Require().NoError(database.AutoMigrateModels(db))
+	suite.db = db
+	suite.stores = sqlstore.New(db)
+	suite.now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	suite.alice = suite.user("alice")
+	suite.bob = suite.user("bob")
+	suite.carol = suite.user("carol")
+	err = suite.stores.Retention.SetUserHold(suite.ctx, suite.carol.ID, true)
+	suite.Require().NoError(err)
+
+	// A small batch size makes the purger go through several transactions
+	suite.purger = retention.NewPurger(db, retention.Policy{Days: 30, BatchSize: 2})
+}
+
+func (suite *RetentionTestSuite) user(username string) *models.User {
+	user := &models.User{Username: username, Email: username + "@example.com", Role: models.UserRoleNormal, IsActive: true}
+	suite.Require().NoError(user.SetPassword("password123"))
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *RetentionTestSuite) channel(name string) *models.Channel {
+	channel := &models.Channel{Name: name, Type: models.ChannelTypePublic, CreatedBy: suite.alice.ID}
+	suite.Require().NoError(suite.db.Create(channel).Error)
+	return channel
+}
+
+// message posts a message daysAgo days before now, as a reply when root is set
+func (suite *RetentionTestSuite) message(channel *models.Channel, user *models.User, daysAgo int, root *models.Message) *models.Message {
+	createdAt := suite.now.AddDate(0, 0, -daysAgo)
+	message := &models.Message{Content: "hello", UserID: user.ID, ChannelID: channel.ID, Type: models.MessageTypeUser}
+	message.ID = models.NewUUIDv7At(createdAt)
+	message.CreatedAt = createdAt
+	if root != nil {
+		message.ThreadID = &root.ID
+	}
+	suite.Require().NoError(suite.db.Create(message).Error)
+	return message
+}
+
+func (suite *RetentionTestSuite) exists(message *models.Message) bool {
+	var count int64
+	suite.Require().NoError(suite.db.Unscoped().Model(&models.Message{}).Where("id = ?", message.ID).Count(&count).Error)
+	return count == 1
+}
+
+func (suite *RetentionTestSuite) TestPurge() {
+	general := suite.channel("general")
+	held := suite.channel("held")
+	err := suite.stores.Retention.SetChannel(suite.ctx, held.ID, nil, true)
+	suite.Require().NoError(err)
+	short := suite.channel("short")
+	week := 7
+	err = suite.stores.Retention.SetChannel(suite.ctx, short.ID, &week, false)
+	suite.Require().NoError(err)
+	forever := suite.channel("forever")
+	zero := 0
+	err = suite.stores.Retention.SetChannel(suite.ctx, forever.ID, &zero, false)
+	suite.Require().NoError(err)
+
+	oldThread := suite.message(general, suite.alice, 60, nil)
+	oldReply := suite.message(general, suite.bob, 50, oldThread)
+	suite.Require().NoError(suite.db.Create(&models.SavedItem{UserID: suite.bob.ID, MessageID: oldThread.ID}).Error)
+	suite.Require().NoError(suite.db.Create(&models.Notification{UserID: suite.alice.ID, Kind: models.NotificationKindThreadReply, Title: "Reply", MessageID: &oldReply.ID}).Error)
+	suite.Require().NoError(suite.db.Create(&models.ThreadFollow{ThreadID: oldThread.ID, UserID: suite.alice.ID, Following: true}).Error)
+	deleted := suite.message(general, suite.alice, 60, nil)
+	suite.Require().NoError(suite.db.Delete(deleted).Error)
+	old2 := suite.message(general, suite.bob, 40, nil)
+	old3 := suite.message(general, suite.bob, 40, nil)
+	shortOld := suite.message(short, suite.bob, 10, nil)
+
+	liveThread := suite.message(general, suite.alice, 60, nil)
+	suite.message(general, suite.bob, 5, liveThread)
+	heldUserRoot := suite.message(general, suite.carol, 60, nil)
+	heldUserThread := suite.message(general, suite.alice, 60, nil)
+	suite.message(general, suite.carol, 40, heldUserThread)
+	recent := suite.message(general, suite.alice, 10, nil)
+	heldChannel := suite.message(held, suite.alice, 60, nil)
+	ancient := suite.message(forever, suite.alice, 400, nil)
+
+	preview, err := suite.purger.Preview(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(int64(6), preview.Messages)
+	suite.True(suite.exists(oldThread), "a preview deletes nothing")
+
+	result, err := suite.purger.Purge(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(int64(6), result.Messages)
+	suite.Equal(int64(3), result.Related, "the saved item, notification and thread follow")
+	for _, message := range []*models.Message{oldThread, oldReply, deleted, old2, old3, shortOld} {
+		suite.False(suite.exists(message))
+	}
+	for _, message := range []*models.Message{liveThread, heldUserRoot, heldUserThread, recent, heldChannel, ancient} {
+		suite.True(suite.exists(message))
+	}
+	var saved int64
+	suite.Require().NoError(suite.db.Unscoped().Model(&models.SavedItem{}).Count(&saved).Error)
+	suite.Equal(int64(0), saved)
+}
+
+func (suite *RetentionTestSuite) TestReleasingHoldAllowsPurge() {
+	general := suite.channel("general")
+	message := suite.message(general, suite.carol, 60, nil)
+
+	result, err := suite.purger.Purge(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(int64(0), result.Messages)
+
+	err = suite.stores.Retention.SetUserHold(suite.ctx, suite.carol.ID, false)
+	suite.Require().NoError(err)
+	result, err = suite.purger.Purge(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(int64(1), result.Messages)
+	suite.False(suite.exists(message))
+}
+
+func (suite *RetentionTestSuite) TestPurgeDue() {
+	result, err := suite.purger.PurgeDue(suite.ctx, suite.now, time.Hour)
+	suite.Require().NoError(err)
+	suite.NotNil(result, "the first purge runs at once")
+
+	result, err = suite.purger.PurgeDue(suite.ctx, suite.now.Add(30*time.Minute), time.Hour)
+	suite.Require().NoError(err)
+	suite.Nil(result)
+	result, err = suite.purger.PurgeDue(suite.ctx, suite.now.Add(time.Hour), time.Hour)
+	suite.Require().NoError(err)
+	suite.NotNil(result)
+	suite.Equal(suite.now.Add(time.Hour), suite.purger.Last().StartedAt)
+}
+
+func (suite *RetentionTestSuite) TestKeepForeverByDefault() {
+	general := suite.channel("general")
+	message := suite.message(general, suite.alice, 4000, nil)
+
+	result, err := retention.NewPurger(suite.db, retention.Policy{BatchSize: 10}).Purge(suite.ctx, suite.now)
+	suite.Require().NoError(err)
+	suite.Equal(int64(0), result.Messages)
+	suite.True(suite.exists(message))
+}
+
+func (suite *RetentionTestSuite) TestExceptions() {
+	retentions := service.NewRetentionService(suite.stores)
+	admin := service.Actor{UserID: suite.alice.ID, Role: models.UserRoleAdmin}
+	general := suite.channel("general")
+	suite.channel("random")
+	days := 90
+	hold := true
+	_, err := retentions.SetChannel(suite.ctx, admin, general.ID, &days, &hold)
+	suite.Require().NoError(err)
+	_, err = retentions.SetChannel(suite.ctx, admin, models.NewUUIDv7(), nil, nil)
+	suite.ErrorIs(err, service.ErrNotFound)
+
+	exceptions, err := retentions.Exceptions(suite.ctx, admin)
+	suite.Require().NoError(err)
+	suite.Require().Len(exceptions.Channels, 1)
+	suite.Equal(90, *exceptions.Channels[0].RetentionDays)
+	suite.True(exceptions.Channels[0].LegalHold)
+	suite.Require().Len(exceptions.Users, 1)
+	suite.Equal("carol", exceptions.Users[0].Username)
+
+	// Omitting the hold leaves it in place
+	channel, err := retentions.SetChannel(suite.ctx, admin, general.ID, nil, nil)
+	suite.Require().NoError(err)
+	suite.True(channel.LegalHold)
+	hold = false
+	_, err = retentions.SetChannel(suite.ctx, admin, general.ID, nil, &hold)
+	suite.Require().NoError(err)
+	exceptions, err = retentions.Exceptions(suite.ctx, admin)
+	suite.Require().NoError(err)
+	suite.Empty(exceptions.Channels, "back on the workspace default")
+}
+
+func TestRetentionTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionTestSuite))
+}
@@ -0,0 +1,1311 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"turnate/internal/mail"
+	"turnate/internal/mail/mailtest"
+	"turnate/internal/models"
+	"turnate/internal/push"
+	"turnate/internal/push/pushtest"
+	"turnate/internal/scheduler"
+	"turnate/internal/service"
+	"turnate/internal/store"
+	"turnate/internal/store/memstore"
+)
+
+type ServiceTestSuite struct {
+	suite.Suite
+	ctx           context.Context
+	stores        *store.Stores
+	users         *service.UserService
+	channels      *service.ChannelService
+	messages      *service.MessageService
+	notifications *service.NotificationService
+	groups        *service.GroupService
+	admin         service.Actor
+	alice         service.Actor
+	bob           service.Actor
+	general       *models.Channel
+}
+
+func (suite *ServiceTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.stores = memstore.New()
+	suite.users = service.NewUserService(suite.stores)
+	suite.channels = service.NewChannelService(suite.stores, service.Policy{})
+	suite.notifications = service.NewNotificationService(suite.stores, suite.channels)
+	suite.messages = service.NewMessageService(suite.stores, suite.channels, suite.notifications)
+	suite.groups = service.NewGroupService(suite.stores, suite.channels)
+
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: models.UserRoleAdmin, IsActive: true}
+	suite.Require().NoError(suite.stores.Users.Create(suite.ctx, admin))
+	suite.admin = service.Actor{UserID: admin.ID, Role: admin.Role}
+
+	general, err := suite.channels.Create(suite.ctx, suite.admin, service.GeneralChannelName, "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	suite.general = general
+
+	suite.alice = suite.register("alice")
+	suite.bob = suite.register("bob")
+}
+
+func (suite *ServiceTestSuite) register(username string) service.Actor {
+	user, err := suite.users.Register(suite.ctx, username, username+"@example.com", "", "password123")
+	suite.Require().NoError(err)
+	return service.Actor{UserID: user.ID, Role: user.Role}
+}
+
+func (suite *ServiceTestSuite) TestRegisterJoinsGeneral() {
+	isMember, err := suite.channels.IsMember(suite.ctx, suite.general.ID, suite.alice.UserID)
+	suite.NoError(err)
+	suite.True(isMember)
+
+	_, err = suite.users.Register(suite.ctx, "alice", "other@example.com", "", "password123")
+	suite.ErrorIs(err, service.ErrConflict)
+}
+
+func (suite *ServiceTestSuite) TestPrivateChannelAccess() {
+	_, err := suite.channels.Create(suite.ctx, suite.alice, "secret", "", models.ChannelTypePrivate)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "secret", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+
+	_, err = suite.channels.Get(suite.ctx, suite.alice, private.ID)
+	suite.ErrorIs(err, service.ErrForbidden)
+	suite.ErrorIs(suite.channels.Join(suite.ctx, suite.alice, private.ID), service.ErrForbidden)
+
+	_, err = suite.messages.List(suite.ctx, suite.alice, private.ID, service.MessagePosition{}, 50)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	summaries, err := suite.channels.List(suite.ctx, suite.alice)
+	suite.NoError(err)
+	for _, summary := range summaries {
+		suite.NotEqual(private.ID, summary.Channel.ID)
+	}
+}
+
+func (suite *ServiceTestSuite) TestAdminBypassesPrivateMembership() {
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "ops", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+
+	otherAdmin := &models.User{Username: "root", Email: "root@example.com", Role: models.UserRoleAdmin, IsActive: true}
+	suite.Require().NoError(suite.stores.Users.Create(suite.ctx, otherAdmin))
+	actor := service.Actor{UserID: otherAdmin.ID, Role: otherAdmin.Role}
+
+	_, err = suite.messages.Create(suite.ctx, actor, private.ID, "hello ops", nil)
+	suite.NoError(err)
+
+	_, err = suite.messages.List(suite.ctx, actor, private.ID, service.MessagePosition{}, 50)
+	suite.NoError(err)
+}
+
+func (suite *ServiceTestSuite) TestMustJoinPublicChannelToPost() {
+	channel, err := suite.channels.Create(suite.ctx, suite.alice, "Random Talk", "", "")
+	suite.Require().NoError(err)
+	suite.Equal("random-talk", channel.Name)
+
+	_, err = suite.messages.Create(suite.ctx, suite.bob, channel.ID, "hi", nil)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, channel.ID))
+	suite.ErrorIs(suite.channels.Join(suite.ctx, suite.bob, channel.ID), service.ErrConflict)
+
+	parent, err := suite.messages.Create(suite.ctx, suite.bob, channel.ID, "hi", nil)
+	suite.Require().NoError(err)
+
+	_, err = suite.messages.Create(suite.ctx, suite.alice, channel.ID, "hello back", &parent.ID)
+	suite.Require().NoError(err)
+
+	window, err := suite.messages.List(suite.ctx, suite.alice, channel.ID, service.MessagePosition{}, 50)
+	suite.Require().NoError(err)
+	suite.Require().Len(window.Messages, 1)
+	suite.Equal(1, window.Messages[0].ReplyCount)
+	suite.NotNil(window.Messages[0].LastReplyAt)
+}
+
+func (suite *ServiceTestSuite) TestMessageWindows() {
+	var posted []models.Message
+	for i := 0; i < 7; i++ {
+		message, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, fmt.Sprintf("message %d", i), nil)
+		suite.Require().NoError(err)
+		posted = append(posted, *message)
+	}
+	reply, err := suite.messages.Create(suite.ctx, suite.bob, suite.general.ID, "reply", &posted[3].ID)
+	suite.Require().NoError(err)
+
+	contents := func(window *service.MessageWindow) []string {
+		var out []string
+		for _, message := range window.Messages {
+			out = append(out, message.Content)
+		}
+		return out
+	}
+
+	latest, err := suite.messages.List(suite.ctx, suite.alice, suite.general.ID, service.MessagePosition{}, 3)
+	suite.Require().NoError(err)
+	suite.Equal([]string{"message 4", "message 5", "message 6"}, contents(latest))
+	suite.True(latest.HasOlder)
+	suite.False(latest.HasNewer)
+
+	older, err := suite.messages.List(suite.ctx, suite.alice, suite.general.ID, service.MessagePosition{Before: &posted[4].ID}, 3)
+	suite.Require().NoError(err)
+	suite.Equal([]string{"message 1", "message 2", "message 3"}, contents(older))
+	suite.True(older.HasOlder)
+
+	newer, err := suite.messages.List(suite.ctx, suite.alice, suite.general.ID, service.MessagePosition{After: &posted[4].ID}, 3)
+	suite.Require().NoError(err)
+	suite.Equal([]string{"message 5", "message 6"}, contents(newer))
+	suite.False(newer.HasNewer)
+
+	// Jumping to a reply centres the window on its thread root
+	around, err := suite.messages.List(suite.ctx, suite.alice, suite.general.ID, service.MessagePosition{Around: &reply.ID}, 3)
+	suite.Require().NoError(err)
+	suite.Equal([]string{"message 2", "message 3", "message 4"}, contents(around))
+	suite.Equal(posted[3].ID, *around.Anchor)
+	suite.Equal("alice", around.Messages[1].User.Username)
+	suite.True(around.HasOlder)
+	suite.True(around.HasNewer)
+
+	missing := models.NewUUIDv7()
+	_, err = suite.messages.List(suite.ctx, suite.alice, suite.general.ID, service.MessagePosition{Around: &missing}, 3)
+	suite.ErrorIs(err, service.ErrNotFound)
+}
+
+func (suite *ServiceTestSuite) TestPinPermissions() {
+	channel, err := suite.channels.Create(suite.ctx, suite.alice, "announcements", "", "")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, channel.ID))
+
+	message, err := suite.messages.Create(suite.ctx, suite.bob, channel.ID, "ship it", nil)
+	suite.Require().NoError(err)
+
+	// Any member may pin by default
+	suite.NoError(suite.messages.Pin(suite.ctx, suite.bob, channel.ID, message.ID))
+	suite.NoError(suite.messages.Unpin(suite.ctx, suite.bob, channel.ID, message.ID))
+	suite.ErrorIs(suite.messages.Unpin(suite.ctx, suite.bob, channel.ID, message.ID), service.ErrNotFound)
+
+	// With the owner restriction only the creator and admins may pin
+	restricted := service.NewMessageService(suite.stores, service.NewChannelService(suite.stores, service.Policy{RestrictPinsToOwners: true}), nil)
+	suite.ErrorIs(restricted.Pin(suite.ctx, suite.bob, channel.ID, message.ID), service.ErrForbidden)
+	suite.NoError(restricted.Pin(suite.ctx, suite.alice, channel.ID, message.ID))
+
+	pins, err := suite.messages.Pins(suite.ctx, suite.bob, channel.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(pins, 1)
+	suite.Equal(suite.alice.UserID, *pins[0].PinnedBy)
+
+	// Announcements cannot themselves be pinned
+	window, err := suite.messages.List(suite.ctx, suite.bob, channel.ID, service.MessagePosition{}, 50)
+	suite.Require().NoError(err)
+	announcement := window.Messages[len(window.Messages)-1]
+	suite.Equal(models.MessageTypeSystem, announcement.Type)
+	suite.ErrorIs(suite.messages.Pin(suite.ctx, suite.bob, channel.ID, announcement.ID), service.ErrInvalid)
+}
+
+func (suite *ServiceTestSuite) TestBookmarkPermissions() {
+	channel, err := suite.channels.Create(suite.ctx, suite.alice, "design", "", "")
+	suite.Require().NoError(err)
+
+	_, err = suite.channels.AddBookmark(suite.ctx, suite.bob, channel.ID, "Specs", "https://example.com/specs", "")
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, channel.ID))
+	bookmark, err := suite.channels.AddBookmark(suite.ctx, suite.alice, channel.ID, "Specs", "https://example.com/specs", "")
+	suite.Require().NoError(err)
+	suite.Equal(models.BookmarkKindLink, bookmark.Kind)
+
+	suite.ErrorIs(suite.channels.RemoveBookmark(suite.ctx, suite.bob, channel.ID, bookmark.ID), service.ErrForbidden)
+	suite.NoError(suite.channels.RemoveBookmark(suite.ctx, suite.alice, channel.ID, bookmark.ID))
+
+	bookmarks, err := suite.channels.Bookmarks(suite.ctx, suite.bob, channel.ID)
+	suite.NoError(err)
+	suite.Empty(bookmarks)
+}
+
+func (suite *ServiceTestSuite) TestParseReminderTime() {
+	now := time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"2024-03-02T08:00:00Z": time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC),
+		"in 2 hours":           now.Add(2 * time.Hour),
+		"in 45 mins":           now.Add(45 * time.Minute),
+		"In a day":             now.Add(24 * time.Hour),
+		"in 1 week":            now.Add(7 * 24 * time.Hour),
+		"tomorrow":             time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC),
+		"tomorrow at 3pm":      time.Date(2024, 3, 2, 15, 0, 0, 0, time.UTC),
+		"at 17:45":             time.Date(2024, 3, 1, 17, 45, 0, 0, time.UTC),
+		"at 9am":               time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC),
+		"at 12am":              time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		"Monday at 9am":        time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC),
+		"on tue":               time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC),
+		"friday at 15:00":      time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC),
+		"next friday at 2pm":   time.Date(2024, 3, 8, 14, 0, 0, 0, time.UTC),
+	}
+	for input, expected := range cases {
+		parsed, err := service.ParseReminderTime(input, now)
+		suite.NoError(err, input)
+		suite.True(expected.Equal(parsed), "%s: expected %s, got %s", input, expected, parsed)
+	}
+
+	for _, input := range []string{"", "soon", "in -2 hours", "at 25:00", "tomorrow at 13pm", "mo", "funday", "monday at noon"} {
+		_, err := service.ParseReminderTime(input, now)
+		suite.Error(err, input)
+	}
+}
+
+func (suite *ServiceTestSuite) TestTimesOfDayUseTheUserTimezone() {
+	reminders := service.NewReminderService(suite.stores, suite.channels)
+	scheduled := service.NewScheduledMessageService(suite.stores, suite.channels, suite.messages)
+	// Friday 1 March 2024, 22:00 in New York
+	now := time.Date(2024, 3, 2, 3, 0, 0, 0, time.UTC)
+	newYork := "America/New_York"
+	_, err := suite.notifications.UpdateSettings(suite.ctx, suite.bob, service.NotificationSettingsUpdate{Timezone: &newYork}, now)
+	suite.Require().NoError(err)
+
+	reminder, err := reminders.Create(suite.ctx, suite.bob, nil, "Standup", "tomorrow at 9am", now)
+	suite.Require().NoError(err)
+	suite.Equal(time.Date(2024, 3, 2, 14, 0, 0, 0, time.UTC), reminder.RemindAt)
+
+	message, err := scheduled.Schedule(suite.ctx, suite.bob, suite.general.ID, "Launch", nil, false, "Monday at 9am", now)
+	suite.Require().NoError(err)
+	suite.Equal(time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC), message.SendAt)
+
+	// Without a timezone setting times of day are UTC
+	reminder, err = reminders.Create(suite.ctx, suite.alice, nil, "Standup", "tomorrow at 9am", now)
+	suite.Require().NoError(err)
+	suite.Equal(time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC), reminder.RemindAt)
+}
+
+func (suite *ServiceTestSuite) TestRemindersAreDeliveredAsNotifications() {
+	reminders := service.NewReminderService(suite.stores, suite.channels)
+	notifications := service.NewNotificationService(suite.stores, suite.channels)
+	now := time.Now().UTC()
+
+	message, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "Submit the report", nil)
+	suite.Require().NoError(err)
+
+	_, err = reminders.Create(suite.ctx, suite.bob, nil, "", "in 1 hour", now)
+	suite.ErrorIs(err, service.ErrInvalid)
+	_, err = reminders.Create(suite.ctx, suite.bob, nil, "stretch", "2000-01-01T00:00:00Z", now)
+	suite.ErrorIs(err, service.ErrInvalid)
+
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "board", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+	secret, err := suite.messages.Create(suite.ctx, suite.admin, private.ID, "secret", nil)
+	suite.Require().NoError(err)
+	_, err = reminders.Create(suite.ctx, suite.bob, &secret.ID, "", "in 1 hour", now)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	_, err = reminders.Create(suite.ctx, suite.bob, &message.ID, "", "in 1 hour", now)
+	suite.Require().NoError(err)
+	later, err := reminders.Create(suite.ctx, suite.bob, nil, "Water the plants", "in 3 hours", now)
+	suite.Require().NoError(err)
+
+	jobs := scheduler.New(time.Minute, scheduler.Job{Name: "reminders", Run: func(ctx context.Context, at time.Time) error {
+		_, err := reminders.DeliverDue(ctx, at)
+		return err
+	}})
+
+	jobs.RunOnce(suite.ctx, now.Add(30*time.Minute))
+	inbox, err := notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Empty(inbox)
+
+	jobs.RunOnce(suite.ctx, now.Add(90*time.Minute))
+	jobs.RunOnce(suite.ctx, now.Add(90*time.Minute))
+	inbox, err = notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+	suite.Equal(models.NotificationKindReminder, inbox[0].Kind)
+	suite.Equal("Submit the report", inbox[0].Body)
+	suite.Equal(suite.general.ID, *inbox[0].ChannelID)
+
+	pending, err := reminders.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(pending, 1)
+	suite.Equal(later.ID, pending[0].ID)
+
+	suite.NoError(reminders.Cancel(suite.ctx, suite.bob, later.ID))
+	suite.ErrorIs(reminders.Cancel(suite.ctx, suite.alice, later.ID), service.ErrNotFound)
+
+	suite.NoError(notifications.MarkRead(suite.ctx, suite.bob, inbox[0].ID))
+	suite.ErrorIs(notifications.MarkRead(suite.ctx, suite.alice, inbox[0].ID), service.ErrNotFound)
+}
+
+func (suite *ServiceTestSuite) TestRemindersDoNotQuoteChannelsTheUserLeft() {
+	reminders := service.NewReminderService(suite.stores, suite.channels)
+	notifications := service.NewNotificationService(suite.stores, suite.channels)
+	now := time.Now().UTC()
+
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "board", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.stores.Members.Add(suite.ctx, &models.ChannelMember{ChannelID: private.ID, UserID: suite.bob.UserID}))
+	secret, err := suite.messages.Create(suite.ctx, suite.admin, private.ID, "Layoffs are planned for May", nil)
+	suite.Require().NoError(err)
+	_, err = reminders.Create(suite.ctx, suite.bob, &secret.ID, "", "in 1 hour", now)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.channels.Leave(suite.ctx, suite.bob, private.ID))
+	delivered, err := reminders.DeliverDue(suite.ctx, now.Add(2*time.Hour))
+	suite.Require().NoError(err)
+	suite.Equal(1, delivered)
+
+	inbox, err := notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+	suite.Equal("A message you asked to be reminded about is no longer available", inbox[0].Body)
+	suite.Nil(inbox[0].ChannelID)
+}
+
+func (suite *ServiceTestSuite) TestSlowJobsDoNotHoldUpOthers() {
+	var runs atomic.Int32
+	jobs := scheduler.New(10*time.Millisecond,
+		scheduler.Job{Name: "backup", Interval: time.Hour, Run: func(ctx context.Context, at time.Time) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		scheduler.Job{Name: "reminders", Run: func(ctx context.Context, at time.Time) error {
+			runs.Add(1)
+			return nil
+		}},
+	)
+
+	ctx, cancel := context.WithCancel(suite.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		jobs.Run(ctx)
+	}()
+	suite.Eventually(func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	suite.NoError(jobs.Healthy(time.Now()), "the backup is still within its first interval")
+
+	cancel()
+	<-done
+}
+
+func (suite *ServiceTestSuite) TestScheduledMessagesRecheckMembership() {
+	scheduled := service.NewScheduledMessageService(suite.stores, suite.channels, suite.messages)
+	notifications := service.NewNotificationService(suite.stores, suite.channels)
+	now := time.Now().UTC()
+
+	channel, err := suite.channels.Create(suite.ctx, suite.alice, "launch", "", "")
+	suite.Require().NoError(err)
+
+	_, err = scheduled.Schedule(suite.ctx, suite.bob, channel.ID, "Hi", nil, false, "in 1 hour", now)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, channel.ID))
+	_, err = scheduled.Schedule(suite.ctx, suite.bob, channel.ID, "Hi", nil, false, "yesterday", now)
+	suite.ErrorIs(err, service.ErrInvalid)
+
+	leaving, err := scheduled.Schedule(suite.ctx, suite.bob, channel.ID, "See you Monday", nil, false, "in 1 hour", now)
+	suite.Require().NoError(err)
+	cancelled, err := scheduled.Schedule(suite.ctx, suite.bob, suite.general.ID, "Never mind", nil, false, "in 1 hour", now)
+	suite.Require().NoError(err)
+	staying, err := scheduled.Schedule(suite.ctx, suite.bob, suite.general.ID, "Morning all", nil, false, "in 1 hour", now)
+	suite.Require().NoError(err)
+
+	_, err = scheduled.Update(suite.ctx, suite.alice, staying.ID, service.ScheduledMessageUpdate{}, now)
+	suite.ErrorIs(err, service.ErrNotFound)
+	later := "in 2 hours"
+	_, err = scheduled.Update(suite.ctx, suite.bob, staying.ID, service.ScheduledMessageUpdate{SendAt: &later}, now)
+	suite.Require().NoError(err)
+	suite.NoError(scheduled.Cancel(suite.ctx, suite.bob, cancelled.ID))
+
+	// Bob leaves before the message is due, so it is not posted
+	suite.Require().NoError(suite.channels.Leave(suite.ctx, suite.bob, channel.ID))
+
+	sent, err := scheduled.SendDue(suite.ctx, now.Add(90*time.Minute))
+	suite.Require().NoError(err)
+	suite.Equal(0, sent)
+
+	inbox, err := notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+	suite.Equal(models.NotificationKindScheduledMessage, inbox[0].Kind)
+	suite.Contains(inbox[0].Body, "See you Monday")
+	suite.Equal(channel.ID, *inbox[0].ChannelID)
+
+	_, err = scheduled.Update(suite.ctx, suite.bob, leaving.ID, service.ScheduledMessageUpdate{SendAt: &later}, now)
+	suite.ErrorIs(err, service.ErrConflict)
+
+	sent, err = scheduled.SendDue(suite.ctx, now.Add(3*time.Hour))
+	suite.Require().NoError(err)
+	suite.Equal(1, sent)
+
+	recent, err := suite.messages.Recent(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(recent, 1)
+	suite.Equal("Morning all", recent[0].Content)
+	suite.Equal(suite.bob.UserID, recent[0].UserID)
+
+	pending, err := scheduled.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Empty(pending)
+}
+
+func (suite *ServiceTestSuite) TestInterruptedScheduledMessagesAreRequeued() {
+	scheduled := service.NewScheduledMessageService(suite.stores, suite.channels, suite.messages)
+	now := time.Now().UTC()
+
+	_, err := scheduled.Schedule(suite.ctx, suite.bob, suite.general.ID, "Deploy done", nil, false, "in 1 hour", now)
+	suite.Require().NoError(err)
+
+	// A sender claims the message and stops before finishing it
+	due, err := suite.stores.Scheduled.ListDue(suite.ctx, now.Add(2*time.Hour), 10)
+	suite.Require().NoError(err)
+	suite.Require().Len(due, 1)
+	claimed, err := suite.stores.Scheduled.Claim(suite.ctx, &due[0])
+	suite.Require().NoError(err)
+	suite.Require().True(claimed)
+
+	// A recent claim may belong to a sender that is still running
+	requeued, err := scheduled.RequeueStale(suite.ctx, time.Now())
+	suite.Require().NoError(err)
+	suite.Zero(requeued)
+	pending, err := scheduled.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Empty(pending)
+
+	// Once the lease has run out the next run sends it
+	sent, err := scheduled.SendDue(suite.ctx, now.Add(2*time.Hour))
+	suite.Require().NoError(err)
+	suite.Equal(1, sent)
+	recent, err := suite.messages.Recent(suite.ctx, suite.alice)
+	suite.Require().NoError(err)
+	suite.Require().Len(recent, 1)
+	suite.Equal("Deploy done", recent[0].Content)
+}
+
+func (suite *ServiceTestSuite) TestMutedChannelsAreHiddenFromActivity() {
+	threads := service.NewThreadService(suite.stores, suite.channels)
+	quiet, err := suite.channels.Create(suite.ctx, suite.alice, "quiet", "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	noisy, err := suite.channels.Create(suite.ctx, suite.alice, "noisy", "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	for _, channel := range []*models.Channel{quiet, noisy} {
+		suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, channel.ID))
+		root, err := suite.messages.Create(suite.ctx, suite.bob, channel.ID, "In "+channel.Name, nil)
+		suite.Require().NoError(err)
+		_, err = suite.messages.Reply(suite.ctx, suite.alice, channel.ID, root.ID, "Reply in "+channel.Name, false)
+		suite.Require().NoError(err)
+	}
+	suite.Require().NoError(suite.notifications.SetChannelLevel(suite.ctx, suite.bob, quiet.ID, models.NotificationLevelNone))
+	suite.Require().NoError(suite.notifications.SetChannelLevel(suite.ctx, suite.bob, noisy.ID, models.NotificationLevelMuted))
+
+	// None only stops notifications; muted also hides the channel's activity
+	recent, err := suite.messages.Recent(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(recent, 1)
+	suite.Equal("In quiet", recent[0].Content)
+
+	inbox, err := threads.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 2)
+	unread := map[string]int64{}
+	for _, thread := range inbox {
+		unread[thread.Root.Content] = thread.Unread
+	}
+	suite.Equal(map[string]int64{"In quiet": 1, "In noisy": 0}, unread)
+}
+
+func (suite *ServiceTestSuite) TestThreadFollows() {
+	threads := service.NewThreadService(suite.stores, suite.channels)
+	carol := suite.register("carol")
+
+	root, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "Offsite ideas?", nil)
+	suite.Require().NoError(err)
+	reply, err := suite.messages.Reply(suite.ctx, suite.bob, suite.general.ID, root.ID, "The lake", true)
+	suite.Require().NoError(err)
+	suite.True(reply.AlsoSentToChannel)
+
+	// A reply sent to the channel is its own anchor in the timeline
+	window, err := suite.messages.List(suite.ctx, suite.alice, suite.general.ID, service.MessagePosition{Around: &reply.ID}, 10)
+	suite.Require().NoError(err)
+	suite.Equal(reply.ID, *window.Anchor)
+	suite.Len(window.Messages, 2)
+
+	inbox, err := threads.List(suite.ctx, suite.alice)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+	suite.Equal(root.ID, inbox[0].Root.ID)
+	suite.Equal(int64(1), inbox[0].Unread)
+
+	inbox, err = threads.List(suite.ctx, carol)
+	suite.Require().NoError(err)
+	suite.Empty(inbox)
+	suite.Require().NoError(threads.Follow(suite.ctx, carol, root.ID))
+	suite.ErrorIs(threads.Follow(suite.ctx, carol, reply.ID), service.ErrInvalid)
+	inbox, err = threads.List(suite.ctx, carol)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+	suite.Equal(int64(1), inbox[0].Unread)
+
+	// Replying again after unfollowing does not re-follow
+	suite.Require().NoError(threads.Unfollow(suite.ctx, suite.bob, root.ID))
+	_, err = suite.messages.Create(suite.ctx, suite.bob, suite.general.ID, "Or the mountains", &root.ID)
+	suite.Require().NoError(err)
+	inbox, err = threads.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Empty(inbox)
+
+	inbox, err = threads.List(suite.ctx, suite.alice)
+	suite.Require().NoError(err)
+	suite.Equal(int64(2), inbox[0].Unread)
+	suite.Require().NoError(threads.MarkRead(suite.ctx, suite.alice, root.ID, time.Now()))
+	inbox, err = threads.List(suite.ctx, suite.alice)
+	suite.Require().NoError(err)
+	suite.Equal(int64(0), inbox[0].Unread)
+
+	// Private threads cannot be followed without access
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "staff", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+	secret, err := suite.messages.Create(suite.ctx, suite.admin, private.ID, "Budget", nil)
+	suite.Require().NoError(err)
+	suite.ErrorIs(threads.Follow(suite.ctx, carol, secret.ID), service.ErrForbidden)
+}
+
+func (suite *ServiceTestSuite) TestNotificationPreferences() {
+	carol := suite.register("carol")
+	inbox := func(actor service.Actor) []models.Notification {
+		notifications, err := suite.notifications.List(suite.ctx, actor)
+		suite.Require().NoError(err)
+		return notifications
+	}
+
+	// The default level notifies about mentions only
+	_, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "Morning everyone", nil)
+	suite.Require().NoError(err)
+	suite.Empty(inbox(suite.bob))
+
+	root, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "Lunch plans, @Bob?", nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox(suite.bob), 1)
+	suite.Equal(models.NotificationKindMention, inbox(suite.bob)[0].Kind)
+	suite.Equal("@alice mentioned you in #general", inbox(suite.bob)[0].Title)
+	suite.Empty(inbox(suite.alice))
+
+	// Email addresses are not mentions
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "Mail bob@example.com or (@nobody)", nil)
+	suite.Require().NoError(err)
+	suite.Len(inbox(suite.bob), 1)
+
+	// Thread followers hear about replies; authors never hear about their own
+	_, err = suite.messages.Reply(suite.ctx, suite.bob, suite.general.ID, root.ID, "Tacos", false)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox(suite.alice), 1)
+	suite.Equal(models.NotificationKindThreadReply, inbox(suite.alice)[0].Kind)
+	suite.Len(inbox(suite.bob), 1)
+
+	// Keywords match whole words regardless of case
+	_, err = suite.notifications.UpdateSettings(suite.ctx, carol, service.NotificationSettingsUpdate{Keywords: &[]string{" Deploy ", "deploy"}}, time.Now())
+	suite.Require().NoError(err)
+	for _, content := range []string{"Redeployment tomorrow", "deployed", "predeploy checks"} {
+		_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, content, nil)
+		suite.Require().NoError(err)
+	}
+	suite.Empty(inbox(carol))
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "deployed, then DEPLOY again", nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox(carol), 1)
+	suite.Equal(models.NotificationKindKeyword, inbox(carol)[0].Kind)
+
+	// Muted channels stay silent even for mentions; "all" hears everything
+	suite.Require().NoError(suite.notifications.SetChannelLevel(suite.ctx, carol, suite.general.ID, models.NotificationLevelMuted))
+	suite.Require().NoError(suite.notifications.SetChannelLevel(suite.ctx, suite.bob, suite.general.ID, models.NotificationLevelAll))
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@carol deploy again", nil)
+	suite.Require().NoError(err)
+	suite.Len(inbox(carol), 1)
+	suite.Require().Len(inbox(suite.bob), 2)
+	suite.Equal(models.NotificationKindMessage, inbox(suite.bob)[0].Kind)
+	level, err := suite.notifications.ChannelLevel(suite.ctx, suite.bob, suite.general.ID)
+	suite.NoError(err)
+	suite.Equal(models.NotificationLevelAll, level)
+
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "board", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+	suite.ErrorIs(suite.notifications.SetChannelLevel(suite.ctx, suite.bob, private.ID, models.NotificationLevelAll), service.ErrForbidden)
+
+	unread, err := suite.notifications.UnreadCount(suite.ctx, suite.bob)
+	suite.NoError(err)
+	suite.Equal(int64(2), unread)
+	suite.NoError(suite.notifications.MarkAllRead(suite.ctx, suite.bob))
+	unread, err = suite.notifications.UnreadCount(suite.ctx, suite.bob)
+	suite.NoError(err)
+	suite.Zero(unread)
+}
+
+func (suite *ServiceTestSuite) TestDoNotDisturb() {
+	update := func(update service.NotificationSettingsUpdate) error {
+		_, err := suite.notifications.UpdateSettings(suite.ctx, suite.bob, update, time.Now())
+		return err
+	}
+	ptr := func(value string) *string { return &value }
+	enabled := true
+
+	suite.ErrorIs(update(service.NotificationSettingsUpdate{Timezone: ptr("Mars/Olympus")}), service.ErrInvalid)
+	suite.ErrorIs(update(service.NotificationSettingsUpdate{DNDEnabled: &enabled, DNDStart: ptr("25:00"), DNDEnd: ptr("08:00")}), service.ErrInvalid)
+
+	// The window is evaluated in the user's timezone, around the current time there
+	location, err := time.LoadLocation("Asia/Tokyo")
+	suite.Require().NoError(err)
+	local := time.Now().In(location)
+	start := local.Add(-time.Hour).Format("15:04")
+	end := local.Add(time.Hour).Format("15:04")
+	suite.Require().NoError(update(service.NotificationSettingsUpdate{Timezone: ptr("Asia/Tokyo"), DNDEnabled: &enabled, DNDStart: &start, DNDEnd: &end}))
+
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob ping", nil)
+	suite.Require().NoError(err)
+	inbox, err := suite.notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+	suite.True(inbox[0].Quiet)
+
+	// Outside the window notifications are delivered normally
+	start, end = local.Add(2*time.Hour).Format("15:04"), local.Add(3*time.Hour).Format("15:04")
+	suite.Require().NoError(update(service.NotificationSettingsUpdate{DNDStart: &start, DNDEnd: &end}))
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob ping", nil)
+	suite.Require().NoError(err)
+	inbox, err = suite.notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 2)
+	suite.False(inbox[0].Quiet)
+
+	// Snoozing silences notifications until it ends
+	snooze := time.Hour
+	suite.Require().NoError(update(service.NotificationSettingsUpdate{Snooze: &snooze}))
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob ping", nil)
+	suite.Require().NoError(err)
+	inbox, err = suite.notifications.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 3)
+	suite.True(inbox[0].Quiet)
+}
+
+func (suite *ServiceTestSuite) newEmailService() (*service.EmailService, *mailtest.Server) {
+	server, err := mailtest.NewServer()
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { server.Close() })
+
+	sender := mail.NewSMTPSender(server.Host(), server.Port(), "", "", "turnate@example.com")
+	emails := service.NewEmailService(suite.stores, sender, service.EmailOptions{
+		BaseURL:      "https://chat.example.com/",
+		Secret:       "test-secret",
+		MentionDelay: 15 * time.Minute,
+		DigestHour:   8,
+	})
+	return emails, server
+}
+
+func (suite *ServiceTestSuite) TestMentionEmails() {
+	emails, server := suite.newEmailService()
+	carol := suite.register("carol")
+	now := time.Now()
+
+	for _, content := range []string{"@bob can you review?", "@bob and @carol: standup", "@carol ping"} {
+		_, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, content, nil)
+		suite.Require().NoError(err)
+	}
+
+	// Nothing is emailed before the delay
+	sent, err := emails.SendMentionEmails(suite.ctx, now)
+	suite.NoError(err)
+	suite.Zero(sent)
+
+	// Carol was seen after her mentions arrived, so they are not emailed
+	suite.Require().NoError(suite.stores.Users.TouchLastSeen(suite.ctx, carol.UserID, now.Add(time.Minute)))
+
+	sent, err = emails.SendMentionEmails(suite.ctx, now.Add(20*time.Minute))
+	suite.NoError(err)
+	suite.Equal(1, sent)
+
+	messages := server.Messages()
+	suite.Require().Len(messages, 1)
+	suite.Equal([]string{"bob@example.com"}, messages[0].To)
+	suite.Equal("You have 2 unread mentions", messages[0].Subject)
+	suite.Contains(messages[0].Text, "can you review?")
+	suite.Contains(messages[0].HTML, "standup")
+	suite.Contains(messages[0].Text, "https://chat.example.com/api/v1/email/unsubscribe?token=")
+
+	// Handled mentions are not emailed twice
+	sent, err = emails.SendMentionEmails(suite.ctx, now.Add(40*time.Minute))
+	suite.NoError(err)
+	suite.Zero(sent)
+
+	// The unsubscribe link turns mention emails off, in one click if the
+	// mail client supports it
+	suite.Equal("List-Unsubscribe=One-Click", messages[0].Header.Get("List-Unsubscribe-Post"))
+	link, err := url.Parse(strings.Trim(messages[0].Header.Get("List-Unsubscribe"), "<>"))
+	suite.Require().NoError(err)
+	_, err = emails.Unsubscribe(suite.ctx, link.Query().Get("token")+"x")
+	suite.ErrorIs(err, service.ErrInvalid)
+	list, err := emails.CheckUnsubscribe(suite.ctx, link.Query().Get("token"))
+	suite.Require().NoError(err)
+	suite.Equal(mail.ListMentions, list)
+	settings, err := suite.notifications.Settings(suite.ctx, suite.bob)
+	suite.NoError(err)
+	suite.False(settings.MentionEmailsDisabled, "checking a link changes nothing")
+	list, err = emails.Unsubscribe(suite.ctx, link.Query().Get("token"))
+	suite.Require().NoError(err)
+	suite.Equal(mail.ListMentions, list)
+
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob one more", nil)
+	suite.Require().NoError(err)
+	sent, err = emails.SendMentionEmails(suite.ctx, now.Add(time.Hour))
+	suite.NoError(err)
+	suite.Zero(sent)
+	settings, err = suite.notifications.Settings(suite.ctx, suite.bob)
+	suite.NoError(err)
+	suite.True(settings.MentionEmailsDisabled)
+}
+
+func (suite *ServiceTestSuite) TestMentionEmailsLeaveOutSeenMentions() {
+	emails, server := suite.newEmailService()
+	carol := suite.register("carol")
+
+	_, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@carol first question", nil)
+	suite.Require().NoError(err)
+	inbox, err := suite.notifications.List(suite.ctx, carol)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox, 1)
+
+	// Carol is seen after the first mention but before the second
+	suite.Require().NoError(suite.stores.Users.TouchLastSeen(suite.ctx, carol.UserID, inbox[0].CreatedAt))
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@carol second question", nil)
+	suite.Require().NoError(err)
+
+	sent, err := emails.SendMentionEmails(suite.ctx, time.Now().Add(20*time.Minute))
+	suite.NoError(err)
+	suite.Equal(1, sent)
+	messages := server.Messages()
+	suite.Require().Len(messages, 1)
+	suite.Equal("@alice mentioned you in #general", messages[0].Subject)
+	suite.Contains(messages[0].Text, "second question")
+	suite.NotContains(messages[0].Text, "first question")
+}
+
+func (suite *ServiceTestSuite) TestDailyDigest() {
+	emails, server := suite.newEmailService()
+	on := true
+	_, err := suite.notifications.UpdateSettings(suite.ctx, suite.bob, service.NotificationSettingsUpdate{Digest: &on}, time.Now())
+	suite.Require().NoError(err)
+
+	muted, err := suite.channels.Create(suite.ctx, suite.alice, "random", "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, muted.ID))
+	suite.Require().NoError(suite.notifications.SetChannelLevel(suite.ctx, suite.bob, muted.ID, models.NotificationLevelMuted))
+
+	for _, content := range []string{"First", "Second"} {
+		_, err := suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, content, nil)
+		suite.Require().NoError(err)
+	}
+	_, err = suite.messages.Create(suite.ctx, suite.alice, muted.ID, "Noise", nil)
+	suite.Require().NoError(err)
+	_, err = suite.messages.Create(suite.ctx, suite.bob, suite.general.ID, "My own", nil)
+	suite.Require().NoError(err)
+
+	// Digests go out once the digest hour is reached in the user's timezone
+	now := time.Now().UTC()
+	morning := time.Date(now.Year(), now.Month(), now.Day(), 9, 0, 0, 0, time.UTC)
+	if !morning.After(now) {
+		morning = morning.Add(24 * time.Hour)
+	}
+	sent, err := emails.SendDigests(suite.ctx, morning.Add(-2*time.Hour))
+	suite.NoError(err)
+	suite.Zero(sent)
+
+	sent, err = emails.SendDigests(suite.ctx, morning)
+	suite.NoError(err)
+	suite.Equal(1, sent)
+
+	messages := server.Messages()
+	suite.Require().Len(messages, 1)
+	suite.Equal("Your daily Turnate digest", messages[0].Subject)
+	suite.Contains(messages[0].Text, "#general: 2 new messages")
+	suite.NotContains(messages[0].Text, "#random")
+
+	// Only one digest a day
+	sent, err = emails.SendDigests(suite.ctx, morning.Add(time.Hour))
+	suite.NoError(err)
+	suite.Zero(sent)
+}
+
+func (suite *ServiceTestSuite) TestWebPush() {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	keys, err := service.LoadPushKeys(suite.ctx, suite.stores, push.Keys{})
+	suite.Require().NoError(err)
+	stored, err := service.LoadPushKeys(suite.ctx, suite.stores, push.Keys{})
+	suite.Require().NoError(err)
+	suite.Equal(keys, stored, "generated keys are kept for the next start")
+
+	client, err := push.NewClient(keys, "mailto:ops@example.com", server.Client())
+	suite.Require().NoError(err)
+	pushes := service.NewPushService(suite.stores, client)
+
+	subscribe := func(actor service.Actor, session string, sub push.Subscription) *models.PushSubscription {
+		subscription, err := pushes.Subscribe(suite.ctx, actor, session, service.PushSubscriptionInput{Endpoint: sub.Endpoint, P256dh: sub.P256dh, Auth: sub.Auth})
+		suite.Require().NoError(err)
+		return subscription
+	}
+
+	laptop, err := server.NewSubscription()
+	suite.Require().NoError(err)
+	phone, err := server.NewSubscription()
+	suite.Require().NoError(err)
+	subscribe(suite.bob, "session-1", laptop)
+	subscribe(suite.bob, "session-2", phone)
+
+	_, err = pushes.Subscribe(suite.ctx, suite.bob, "session-3", service.PushSubscriptionInput{Endpoint: "http://push.example.com/x", P256dh: phone.P256dh, Auth: phone.Auth})
+	suite.ErrorIs(err, service.ErrInvalid)
+	_, err = pushes.Subscribe(suite.ctx, suite.bob, "session-3", service.PushSubscriptionInput{Endpoint: phone.Endpoint, P256dh: "bm90IGEga2V5", Auth: phone.Auth})
+	suite.ErrorIs(err, service.ErrInvalid)
+
+	// A session that subscribes again replaces its earlier browser subscription
+	renewed, err := server.NewSubscription()
+	suite.Require().NoError(err)
+	subscribe(suite.bob, "session-2", renewed)
+	subscriptions, err := pushes.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Len(subscriptions, 2)
+
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob lunch?", nil)
+	suite.Require().NoError(err)
+	now := time.Now()
+	sent, err := pushes.DeliverPending(suite.ctx, now)
+	suite.Require().NoError(err)
+	suite.Equal(2, sent)
+	suite.Empty(server.Rejected())
+
+	received := server.Messages()
+	suite.Require().Len(received, 2)
+	var payload struct {
+		Kind  string `json:"kind"`
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	}
+	suite.Require().NoError(json.Unmarshal(received[0].Payload, &payload))
+	suite.Equal("mention", payload.Kind)
+	suite.Equal("@alice mentioned you in #general", payload.Title)
+	suite.Equal("@bob lunch?", payload.Body)
+
+	// Delivered notifications are not pushed again
+	sent, err = pushes.DeliverPending(suite.ctx, now)
+	suite.NoError(err)
+	suite.Zero(sent)
+
+	// Quiet notifications stay in the inbox only
+	snooze := time.Hour
+	_, err = suite.notifications.UpdateSettings(suite.ctx, suite.bob, service.NotificationSettingsUpdate{Snooze: &snooze}, now)
+	suite.Require().NoError(err)
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob still there?", nil)
+	suite.Require().NoError(err)
+	sent, err = pushes.DeliverPending(suite.ctx, now)
+	suite.NoError(err)
+	suite.Zero(sent)
+
+	// Subscriptions the push service reports gone are pruned
+	snooze = 0
+	_, err = suite.notifications.UpdateSettings(suite.ctx, suite.bob, service.NotificationSettingsUpdate{Snooze: &snooze}, now)
+	suite.Require().NoError(err)
+	server.Expire(laptop.Endpoint)
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@bob ping", nil)
+	suite.Require().NoError(err)
+	sent, err = pushes.DeliverPending(suite.ctx, now)
+	suite.NoError(err)
+	suite.Equal(1, sent)
+	subscriptions, err = pushes.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(subscriptions, 1)
+	suite.Equal(renewed.Endpoint, subscriptions[0].Endpoint)
+
+	// Users can only remove their own browsers
+	suite.ErrorIs(pushes.Unsubscribe(suite.ctx, suite.alice, subscriptions[0].ID), service.ErrNotFound)
+	suite.NoError(pushes.Unsubscribe(suite.ctx, suite.bob, subscriptions[0].ID))
+}
+
+func (suite *ServiceTestSuite) TestPushOnlyReachesPublicAddresses() {
+	server := pushtest.NewServer()
+	defer server.Close()
+
+	sub, err := server.NewSubscription()
+	suite.Require().NoError(err)
+	for _, endpoint := range []string{
+		"https://127.0.0.1/push/x",
+		"https://[::1]:8443/push/x",
+		"https://10.1.2.3/push/x",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::ffff:192.168.0.1]/push/x",
+		"https://0.0.0.0/push/x",
+	} {
+		invalid := push.Subscription{Endpoint: endpoint, P256dh: sub.P256dh, Auth: sub.Auth}
+		suite.Error(invalid.Validate(), endpoint)
+	}
+	suite.NoError(sub.Validate())
+
+	// Host names are checked once resolved, when connecting. The test server
+	// listens on loopback, so the public-only transport refuses to reach it.
+	keys, err := service.LoadPushKeys(suite.ctx, suite.stores, push.Keys{})
+	suite.Require().NoError(err)
+	client, err := push.NewClient(keys, "mailto:ops@example.com", &http.Client{Transport: push.PublicTransport()})
+	suite.Require().NoError(err)
+	sub.Endpoint = strings.Replace(sub.Endpoint, "example.com", "localhost", 1)
+	err = client.Send(suite.ctx, sub, []byte("hello"), time.Minute)
+	suite.ErrorContains(err, "is not public")
+	suite.Empty(server.Messages())
+}
+
+func (suite *ServiceTestSuite) TestSavedItems() {
+	saved := service.NewSavedService(suite.stores, suite.channels)
+
+	channel, err := suite.channels.Create(suite.ctx, suite.alice, "reading", "", "")
+	suite.Require().NoError(err)
+	message, err := suite.messages.Create(suite.ctx, suite.alice, channel.ID, "Great article", nil)
+	suite.Require().NoError(err)
+
+	_, err = saved.Save(suite.ctx, suite.bob, message.ID)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, channel.ID))
+	_, err = saved.Save(suite.ctx, suite.bob, message.ID)
+	suite.Require().NoError(err)
+	_, err = saved.Save(suite.ctx, suite.bob, message.ID)
+	suite.ErrorIs(err, service.ErrConflict)
+
+	items, err := saved.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Require().Len(items, 1)
+	suite.Equal("Great article", items[0].Message.Content)
+	suite.Equal("alice", items[0].Message.User.Username)
+
+	// Leaving the channel hides its saved messages
+	suite.Require().NoError(suite.channels.Leave(suite.ctx, suite.bob, channel.ID))
+	items, err = saved.List(suite.ctx, suite.bob)
+	suite.Require().NoError(err)
+	suite.Empty(items)
+
+	suite.NoError(saved.Unsave(suite.ctx, suite.bob, message.ID))
+	suite.ErrorIs(saved.Unsave(suite.ctx, suite.bob, message.ID), service.ErrNotFound)
+}
+
+func (suite *ServiceTestSuite) TestGroupPermissions() {
+	_, err := suite.groups.Create(suite.ctx, suite.alice, "backend", "Backend", "")
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	group, err := suite.groups.Create(suite.ctx, suite.admin, " Backend ", "", "")
+	suite.Require().NoError(err)
+	suite.Equal("backend", group.Handle)
+	suite.Equal("backend", group.Name)
+
+	// Handles and usernames share the mention namespace
+	_, err = suite.groups.Create(suite.ctx, suite.admin, "BACKEND", "", "")
+	suite.ErrorIs(err, service.ErrConflict)
+	_, err = suite.groups.Create(suite.ctx, suite.admin, "bob", "", "")
+	suite.ErrorIs(err, service.ErrConflict)
+	_, err = suite.users.Register(suite.ctx, "Frontend", "frontend@example.com", "", "password123")
+	suite.Require().NoError(err)
+	_, err = suite.groups.Create(suite.ctx, suite.admin, "frontend", "", "")
+	suite.ErrorIs(err, service.ErrConflict, "mentions ignore case, so @frontend would reach the user too")
+	_, err = suite.users.Register(suite.ctx, "Backend", "backend@example.com", "", "password123")
+	suite.ErrorIs(err, service.ErrConflict)
+
+	// Owners manage members; plain members may only leave
+	_, err = suite.groups.AddMember(suite.ctx, suite.alice, group.ID, suite.alice.UserID, true)
+	suite.ErrorIs(err, service.ErrForbidden)
+	_, err = suite.groups.AddMember(suite.ctx, suite.admin, group.ID, suite.alice.UserID, true)
+	suite.Require().NoError(err)
+	_, err = suite.groups.AddMember(suite.ctx, suite.alice, group.ID, suite.bob.UserID, false)
+	suite.Require().NoError(err)
+	_, err = suite.groups.AddMember(suite.ctx, suite.alice, group.ID, suite.bob.UserID, false)
+	suite.ErrorIs(err, service.ErrConflict)
+	suite.ErrorIs(suite.groups.RemoveMember(suite.ctx, suite.bob, group.ID, suite.alice.UserID), service.ErrForbidden)
+
+	name := "Backend team"
+	_, err = suite.groups.Update(suite.ctx, suite.bob, group.ID, service.GroupUpdate{Name: &name})
+	suite.ErrorIs(err, service.ErrForbidden)
+	details, err := suite.groups.Update(suite.ctx, suite.alice, group.ID, service.GroupUpdate{Name: &name})
+	suite.Require().NoError(err)
+	suite.Equal("Backend team", details.Group.Name)
+	suite.Require().Len(details.Members, 2)
+	suite.Equal("alice", details.Members[0].User.Username)
+	suite.True(details.Members[0].Owner)
+
+	suite.NoError(suite.groups.RemoveMember(suite.ctx, suite.bob, group.ID, suite.bob.UserID))
+	suite.ErrorIs(suite.groups.RemoveMember(suite.ctx, suite.bob, group.ID, suite.bob.UserID), service.ErrNotFound)
+
+	summaries, err := suite.groups.List(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(summaries, 1)
+	suite.Equal(1, summaries[0].MemberCount)
+
+	suite.ErrorIs(suite.groups.Delete(suite.ctx, suite.alice, group.ID), service.ErrForbidden)
+	suite.NoError(suite.groups.Delete(suite.ctx, suite.admin, group.ID))
+	_, err = suite.groups.Get(suite.ctx, group.ID)
+	suite.ErrorIs(err, service.ErrNotFound)
+}
+
+func (suite *ServiceTestSuite) TestGroupMentions() {
+	carol := suite.register("carol")
+	inbox := func(actor service.Actor) []models.Notification {
+		notifications, err := suite.notifications.List(suite.ctx, actor)
+		suite.Require().NoError(err)
+		return notifications
+	}
+
+	group, err := suite.groups.Create(suite.ctx, suite.admin, "backend", "", "")
+	suite.Require().NoError(err)
+	for _, member := range []service.Actor{suite.alice, suite.bob, carol} {
+		_, err = suite.groups.AddMember(suite.ctx, suite.admin, group.ID, member.UserID, false)
+		suite.Require().NoError(err)
+	}
+
+	// Only members of the channel hear about the mention, and never the author
+	ops, err := suite.channels.Create(suite.ctx, suite.alice, "ops", "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, ops.ID))
+	_, err = suite.messages.Create(suite.ctx, suite.alice, ops.ID, "@Backend please review", nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox(suite.bob), 1)
+	suite.Equal(models.NotificationKindMention, inbox(suite.bob)[0].Kind)
+	suite.Equal("@alice mentioned @backend in #ops", inbox(suite.bob)[0].Title)
+	suite.Empty(inbox(carol))
+	suite.Empty(inbox(suite.alice))
+
+	// A personal mention wins, and each member is notified once
+	_, err = suite.messages.Create(suite.ctx, suite.alice, suite.general.ID, "@backend @bob deploy", nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(inbox(suite.bob), 2)
+	suite.Equal("@alice mentioned you in #general", inbox(suite.bob)[0].Title)
+	suite.Require().Len(inbox(carol), 1)
+	suite.Equal("@alice mentioned @backend in #general", inbox(carol)[0].Title)
+}
+
+func (suite *ServiceTestSuite) TestGroupDefaultChannels() {
+	group, err := suite.groups.Create(suite.ctx, suite.admin, "backend", "", "")
+	suite.Require().NoError(err)
+	_, err = suite.groups.AddMember(suite.ctx, suite.admin, group.ID, suite.alice.UserID, true)
+	suite.Require().NoError(err)
+
+	team, err := suite.channels.Create(suite.ctx, suite.admin, "backend-team", "", models.ChannelTypePublic)
+	suite.Require().NoError(err)
+	private, err := suite.channels.Create(suite.ctx, suite.admin, "backend-oncall", "", models.ChannelTypePrivate)
+	suite.Require().NoError(err)
+
+	// Owners may only pick public channels
+	_, err = suite.groups.Update(suite.ctx, suite.alice, group.ID, service.GroupUpdate{ChannelIDs: &[]models.UUIDv7{private.ID}})
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	// Existing members join a new default channel right away
+	details, err := suite.groups.Update(suite.ctx, suite.alice, group.ID, service.GroupUpdate{ChannelIDs: &[]models.UUIDv7{team.ID, team.ID}})
+	suite.Require().NoError(err)
+	suite.Equal([]models.UUIDv7{team.ID}, details.ChannelIDs)
+	isMember, err := suite.channels.IsMember(suite.ctx, team.ID, suite.alice.UserID)
+	suite.NoError(err)
+	suite.True(isMember)
+
+	// Admins may add private default channels
+	_, err = suite.groups.Update(suite.ctx, suite.admin, group.ID, service.GroupUpdate{ChannelIDs: &[]models.UUIDv7{team.ID, private.ID}})
+	suite.Require().NoError(err)
+
+	// Members added by an owner only join the public default channels
+	suite.Require().NoError(suite.channels.Join(suite.ctx, suite.bob, team.ID))
+	_, err = suite.groups.AddMember(suite.ctx, suite.alice, group.ID, suite.bob.UserID, false)
+	suite.Require().NoError(err)
+	isMember, err = suite.channels.IsMember(suite.ctx, team.ID, suite.bob.UserID)
+	suite.NoError(err)
+	suite.True(isMember)
+	isMember, err = suite.channels.IsMember(suite.ctx, private.ID, suite.bob.UserID)
+	suite.NoError(err)
+	suite.False(isMember, "an owner must not grant access to a private channel")
+	count, err := suite.stores.Members.CountMembers(suite.ctx, team.ID)
+	suite.NoError(err)
+	suite.Equal(int64(3), count, "joining twice would duplicate the membership")
+
+	// Members added by an admin join every default channel
+	carol := suite.register("carol")
+	_, err = suite.groups.AddMember(suite.ctx, suite.admin, group.ID, carol.UserID, false)
+	suite.Require().NoError(err)
+	for _, channel := range []*models.Channel{team, private} {
+		isMember, err := suite.channels.IsMember(suite.ctx, channel.ID, carol.UserID)
+		suite.NoError(err)
+		suite.True(isMember, channel.Name)
+	}
+
+	// Leaving the group keeps the channels
+	suite.Require().NoError(suite.groups.RemoveMember(suite.ctx, carol, group.ID, carol.UserID))
+	isMember, err = suite.channels.IsMember(suite.ctx, private.ID, carol.UserID)
+	suite.NoError(err)
+	suite.True(isMember)
+}
+
+func (suite *ServiceTestSuite) TestRetentionSettings() {
+	retentions := service.NewRetentionService(suite.stores)
+	days := 30
+	hold := true
+
+	_, err := retentions.SetChannel(suite.ctx, suite.alice, suite.general.ID, &days, &hold)
+	suite.ErrorIs(err, service.ErrForbidden)
+	_, err = retentions.SetUserHold(suite.ctx, suite.alice, suite.bob.UserID, true)
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	_, err = retentions.SetChannel(suite.ctx, suite.admin, suite.general.ID, &days, &hold)
+	suite.Require().NoError(err)
+	_, err = retentions.SetUserHold(suite.ctx, suite.admin, suite.bob.UserID, true)
+	suite.Require().NoError(err)
+	_, err = retentions.SetUserHold(suite.ctx, suite.admin, models.NewUUIDv7(), true)
+	suite.ErrorIs(err, service.ErrNotFound)
+
+	// An omitted hold is left alone while the period goes back to the default
+	channel, err := retentions.SetChannel(suite.ctx, suite.admin, suite.general.ID, nil, nil)
+	suite.Require().NoError(err)
+	suite.Nil(channel.RetentionDays)
+	suite.True(channel.LegalHold)
+
+	exceptions, err := retentions.Exceptions(suite.ctx, suite.admin)
+	suite.Require().NoError(err)
+	suite.Require().Len(exceptions.Channels, 1)
+	suite.True(exceptions.Channels[0].LegalHold)
+	suite.Nil(exceptions.Channels[0].RetentionDays)
+	suite.Require().Len(exceptions.Users, 1)
+	suite.Equal(suite.bob.UserID, exceptions.Users[0].ID)
+}
+
+func (suite *ServiceTestSuite) TestErasureRequests() {
+	erasures := service.NewErasureService(suite.stores)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	request, err := erasures.Request(suite.ctx, suite.alice, "leaving")
+	suite.Require().NoError(err)
+	suite.Equal(models.ErasureStatusPending, request.Status)
+	_, err = erasures.Request(suite.ctx, suite.alice, "again")
+	suite.ErrorIs(err, service.ErrConflict)
+
+	_, err = erasures.Approve(suite.ctx, suite.bob, request.ID, "", now)
+	suite.ErrorIs(err, service.ErrForbidden)
+	_, err = erasures.List(suite.ctx, suite.bob, "")
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	cancelled, err := erasures.Cancel(suite.ctx, suite.alice)
+	suite.Require().NoError(err)
+	suite.Equal(models.ErasureStatusCancelled, cancelled.Status)
+	_, err = erasures.Approve(suite.ctx, suite.admin, request.ID, "", now)
+	suite.ErrorIs(err, service.ErrConflict)
+	_, err = erasures.Cancel(suite.ctx, suite.alice)
+	suite.ErrorIs(err, service.ErrConflict)
+
+	request, err = erasures.Request(suite.ctx, suite.alice, "leaving after all")
+	suite.Require().NoError(err)
+	rejected, err := erasures.Reject(suite.ctx, suite.admin, request.ID, "unpaid invoices", now)
+	suite.Require().NoError(err)
+	suite.Equal(models.ErasureStatusRejected, rejected.Status)
+	suite.Equal(suite.admin.UserID, *rejected.ReviewedBy)
+	suite.Equal("unpaid invoices", rejected.ReviewNote)
+	_, err = erasures.Reject(suite.ctx, suite.admin, models.NewUUIDv7(), "", now)
+	suite.ErrorIs(err, service.ErrNotFound)
+
+	latest, err := erasures.Latest(suite.ctx, suite.alice)
+	suite.Require().NoError(err)
+	suite.Equal(request.ID, latest.ID)
+	_, err = erasures.Latest(suite.ctx, suite.bob)
+	suite.ErrorIs(err, service.ErrNotFound)
+
+	pending, err := erasures.List(suite.ctx, suite.admin, models.ErasureStatusPending)
+	suite.Require().NoError(err)
+	suite.Empty(pending)
+	all, err := erasures.List(suite.ctx, suite.admin, "")
+	suite.Require().NoError(err)
+	suite.Require().Len(all, 2)
+	suite.Equal(request.ID, all[0].ID)
+	suite.Equal("alice", all[0].User.Username)
+}
+
+func (suite *ServiceTestSuite) TestErasureApprovalIsRefusedForHeldUsersAndTheLastAdmin() {
+	erasures := service.NewErasureService(suite.stores)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	suite.Require().NoError(suite.stores.Retention.SetUserHold(suite.ctx, suite.alice.UserID, true))
+	request, err := erasures.Request(suite.ctx, suite.alice, "")
+	suite.Require().NoError(err)
+	_, err = erasures.Approve(suite.ctx, suite.admin, request.ID, "", now)
+	suite.ErrorIs(err, service.ErrConflict)
+
+	request, err = erasures.Request(suite.ctx, suite.admin, "")
+	suite.Require().NoError(err)
+	_, err = erasures.Approve(suite.ctx, suite.admin, request.ID, "", now)
+	suite.ErrorIs(err, service.ErrConflict)
+
+	request, err = erasures.Request(suite.ctx, suite.bob, "")
+	suite.Require().NoError(err)
+	approved, err := erasures.Approve(suite.ctx, suite.admin, request.ID, "", now)
+	suite.Require().NoError(err)
+	suite.Equal(models.ErasureStatusApproved, approved.Status)
+}
+
+func (suite *ServiceTestSuite) TestCannotLeaveGeneral() {
+	suite.ErrorIs(suite.channels.Leave(suite.ctx, suite.alice, suite.general.ID), service.ErrInvalid)
+
+	channel, err := suite.channels.Create(suite.ctx, suite.alice, "music", "", "")
+	suite.Require().NoError(err)
+	suite.NoError(suite.channels.Leave(suite.ctx, suite.alice, channel.ID))
+	suite.ErrorIs(suite.channels.Leave(suite.ctx, suite.alice, channel.ID), service.ErrNotFound)
+}
+
+func (suite *ServiceTestSuite) TestUpdateUserPermissions() {
+	name := "Alice"
+	_, err := suite.users.Update(suite.ctx, suite.alice, suite.alice.UserID, service.UserUpdate{DisplayName: &name})
+	suite.NoError(err)
+
+	_, err = suite.users.Update(suite.ctx, suite.bob, suite.alice.UserID, service.UserUpdate{DisplayName: &name})
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	role := models.UserRoleAdmin
+	_, err = suite.users.Update(suite.ctx, suite.alice, suite.alice.UserID, service.UserUpdate{Role: &role})
+	suite.ErrorIs(err, service.ErrForbidden)
+
+	user, err := suite.users.Update(suite.ctx, suite.admin, suite.alice.UserID, service.UserUpdate{Role: &role})
+	suite.NoError(err)
+	suite.Equal(models.UserRoleAdmin, user.Role)
+}
+
+func (suite *ServiceTestSuite) TestOperatorUserCommands() {
+	user, err := suite.users.Create(suite.ctx, "root", "root@example.com", "", "password123", models.UserRoleAdmin)
+	suite.Require().NoError(err)
+	suite.Equal(models.UserRoleAdmin, user.Role)
+	isMember, err := suite.channels.IsMember(suite.ctx, suite.general.ID, user.ID)
+	suite.NoError(err)
+	suite.True(isMember)
+
+	_, err = suite.users.ResetPassword(suite.ctx, "alice@example.com", "new-password")
+	suite.NoError(err)
+	_, err = suite.users.Authenticate(suite.ctx, "alice", "password123")
+	suite.ErrorIs(err, service.ErrUnauthorized)
+	_, err = suite.users.Authenticate(suite.ctx, "alice", "new-password")
+	suite.NoError(err)
+
+	_, err = suite.users.Deactivate(suite.ctx, "alice")
+	suite.NoError(err)
+	_, err = suite.users.Authenticate(suite.ctx, "alice", "new-password")
+	suite.ErrorIs(err, service.ErrUnauthorized)
+
+	_, err = suite.users.ResetPassword(suite.ctx, "nobody", "new-password")
+	suite.ErrorIs(err, service.ErrNotFound)
+	_, err = suite.users.Deactivate(suite.ctx, "nobody")
+	suite.ErrorIs(err, service.ErrNotFound)
+}
+
+func TestServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ServiceTestSuite))
+}
@@ -119,13 +119,13 @@ class AdminManager {
                 <td>
                     <div class="d-flex align-items-center">
                         <div>
-                            <strong>${user.display_name || user.username}</strong>
+                            <strong>${escapeHTML(user.display_name || user.username)}</strong>
                             <br>
-                            <small class="text-muted">@${user.username}</small>
+                            <small class="text-muted">@${escapeHTML(user.username)}</small>
                         </div>
                     </div>
                 </td>
-                <td>${user.email}</td>
+                <td>${escapeHTML(user.email)}</td>
                 <td>
                     <span class="badge bg-${user.role === 'admin' ? 'danger' : 'primary'}">
                         ${user.role}
@@ -177,8 +177,8 @@ class AdminManager {
                     <div class="d-flex align-items-center">
                         <span class="me-2">${channel.type === 'private' ? '🔒' : '🌍'}</span>
                         <div>
-                            <strong>#${channel.name}</strong>
-                            ${channel.description ? `<br><small class="text-muted">${channel.description}</small>` : ''}
+                            <strong>#${escapeHTML(channel.name)}</strong>
+                            ${channel.description ? `<br><small class="text-muted">${escapeHTML(channel.description)}</small>` : ''}
                         </div>
                     </div>
                 </td>
@@ -366,11 +366,11 @@ class AdminManager {
                                 <form id="editUserForm">
                                     <div class="mb-3">
                                         <label class="form-label">Username</label>
-                                        <input type="text" class="form-control" value="${user.username}" readonly>
+                                        <input type="text" class="form-control" value="${escapeHTML(user.username)}" readonly>
                                     </div>
                                     <div class="mb-3">
                                         <label class="form-label">Display Name</label>
-                                        <input type="text" class="form-control" id="editUserDisplayName" value="${user.display_name || ''}">
+                                        <input type="text" class="form-control" id="editUserDisplayName" value="${escapeHTML(user.display_name)}">
                                     </div>
                                     <div class="mb-3">
                                         <label class="form-label">Role</label>
@@ -1,9 +1,32 @@
 // Main application JavaScript for Turnate
+
+// Encode user-supplied text before interpolating it into HTML
+function escapeHTML(value) {
+    return String(value ?? '')
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// Read a cookie value set by the server (used for the CSRF token)
+function readCookie(name) {
+    const match = document.cookie.split('; ').find(row => row.startsWith(name + '='));
+    return match ? decodeURIComponent(match.split('=')[1]) : null;
+}
+
+// Decode a base64url VAPID key for PushManager.subscribe
+function base64UrlToBytes(value) {
+    const base64 = (value + '='.repeat((4 - value.length % 4) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0));
+}
+
 class TurnateApp {
     constructor() {
         this.currentUser = null;
         this.currentChannel = null;
-        this.currentToken = localStorage.getItem('turnate_token');
+        this.csrfToken = readCookie('turnate_csrf');
         this.replyingTo = null;
         this.pollingInterval = null;
         
@@ -14,7 +37,7 @@ class TurnateApp {
         console.log('🚀 Initializing Turnate...');
         
         // Check if user is already logged in
-        if (this.currentToken) {
+        if (this.csrfToken) {
             this.loadUserProfile();
         } else {
             this.showAuthModal();
@@ -39,6 +62,12 @@ class TurnateApp {
         // Profile button
         $('#profileBtn').on('click', () => this.showProfile());
         
+        // Desktop notifications
+        $('#desktopNotificationsBtn').on('click', (e) => {
+            e.preventDefault();
+            this.enableDesktopNotifications();
+        });
+        
         // Join channel
         $('#joinChannelBtn').on('click', () => this.joinCurrentChannel());
         
@@ -104,12 +133,12 @@ class TurnateApp {
                 <button class="channel-item" data-channel-id="${channel.id}">
                     <div class="channel-name">
                         <span>
-                            ${channel.type === 'private' ? '🔒' : '#'} ${channel.name}
+                            ${channel.type === 'private' ? '🔒' : '#'} ${escapeHTML(channel.name)}
                             ${channel.is_member ? '' : ' <i class="bi bi-plus-circle text-muted"></i>'}
                         </span>
                         <small class="member-count">${channel.member_count}</small>
                     </div>
-                    ${channel.description ? `<div class="channel-type">${channel.description}</div>` : ''}
+                    ${channel.description ? `<div class="channel-type">${escapeHTML(channel.description)}</div>` : ''}
                 </button>
             `);
             
@@ -154,13 +183,15 @@ class TurnateApp {
         $('#currentChannelDescription').text(channel.description || 'No description');
     }
     
-    async loadMessages(channelId, offset = 0) {
+    async loadMessages(channelId) {
         try {
             $('#loadingMessages').removeClass('d-none');
-            const response = await this.makeRequest(`/api/v1/channels/${channelId}/messages?limit=50&offset=${offset}`);
+            const response = await this.makeRequest(`/api/v1/channels/${channelId}/messages?limit=50`);
             
+            // Cursor for loading earlier history with ?before=
+            this.olderCursor = response.older_cursor || null;
             if (response.messages) {
-                this.displayMessages(response.messages, offset === 0);
+                this.displayMessages(response.messages, true);
             }
         } catch (error) {
             console.error('Failed to load messages:', error);
@@ -205,11 +236,22 @@ class TurnateApp {
         const messageTime = new Date(message.created_at).toLocaleString();
         const isCurrentUser = message.user_id === this.currentUser.id;
         
+        if (message.type === 'system') {
+            return $(`
+                <div class="message message-system" data-message-id="${message.id}">
+                    <div class="message-content">${escapeHTML(message.content)}</div>
+                    <span class="message-time">${messageTime}</span>
+                </div>
+            `);
+        }
+        
         const messageEl = $(`
-            <div class="message" data-message-id="${message.id}">
+            <div class="message${message.pinned_at ? ' message-pinned' : ''}" data-message-id="${message.id}">
                 <div class="message-header">
-                    <span class="message-author">${message.display_name || message.username}</span>
+                    <span class="message-author">${escapeHTML(message.display_name || message.username)}</span>
                     <span class="message-time">${messageTime}</span>
+                    ${message.pinned_at ? '<span class="message-pin" title="Pinned">📌</span>' : ''}
+                    ${message.also_sent_to_channel ? '<span class="message-thread-note">replied to a thread</span>' : ''}
                 </div>
                 <div class="message-content">${this.formatMessageContent(message.content)}</div>
                 <div class="message-actions">
@@ -239,12 +281,12 @@ class TurnateApp {
     
     formatMessageContent(content) {
         // Simple emoji conversion and link detection
-        return content
+        return escapeHTML(content)
             .replace(/:\)/g, '😊')
             .replace(/:\(/g, '😞')
             .replace(/:D/g, '😃')
             .replace(/;\)/g, '😉')
-            .replace(/<3/g, '❤️')
+            .replace(/&lt;3/g, '❤️')
             .replace(/\n/g, '<br>');
     }
     
@@ -345,7 +387,7 @@ class TurnateApp {
             if (response.members) {
                 const membersList = response.members.map(member => 
                     `<li class="list-group-item d-flex justify-content-between align-items-center">
-                        ${member.display_name || member.username}
+                        ${escapeHTML(member.display_name || member.username)}
                         <span class="badge bg-${member.role === 'admin' ? 'danger' : 'primary'} rounded-pill">
                             ${member.role}
                         </span>
@@ -456,9 +498,51 @@ class TurnateApp {
         }, 5000);
     }
     
+    async enableDesktopNotifications() {
+        if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+            this.showError('This browser does not support desktop notifications');
+            return;
+        }
+        
+        try {
+            if (await Notification.requestPermission() !== 'granted') {
+                this.showError('Desktop notifications were not allowed');
+                return;
+            }
+            
+            const registration = await navigator.serviceWorker.register('/sw.js');
+            await navigator.serviceWorker.ready;
+            
+            const { public_key: publicKey } = await this.makeRequest('/api/v1/push/key');
+            let subscription = await registration.pushManager.getSubscription();
+            if (!subscription) {
+                subscription = await registration.pushManager.subscribe({
+                    userVisibleOnly: true,
+                    applicationServerKey: base64UrlToBytes(publicKey)
+                });
+            }
+            
+            await this.makeRequest('/api/v1/push/subscriptions', 'POST', subscription.toJSON());
+            this.showSuccess('Desktop notifications enabled');
+        } catch (error) {
+            console.error('Failed to enable desktop notifications:', error);
+            this.showError('Failed to enable desktop notifications');
+        }
+    }
+    
     logout() {
-        localStorage.removeItem('turnate_token');
-        this.currentToken = null;
+        if (this.csrfToken) {
+            this.makeRequest('/api/v1/auth/logout', 'POST').catch(() => {});
+        }
+        
+        // Stop pushes to this browser; the server drops the subscription once it is gone
+        if ('serviceWorker' in navigator) {
+            navigator.serviceWorker.getRegistration('/sw.js')
+                .then(registration => registration && registration.pushManager.getSubscription())
+                .then(subscription => subscription && subscription.unsubscribe())
+                .catch(() => {});
+        }
+        this.csrfToken = null;
         this.currentUser = null;
         this.currentChannel = null;
         
@@ -474,13 +558,15 @@ class TurnateApp {
     async makeRequest(url, method = 'GET', data = null) {
         const options = {
             method: method,
+            credentials: 'same-origin',
             headers: {
                 'Content-Type': 'application/json'
             }
         };
         
-        if (this.currentToken) {
-            options.headers['Authorization'] = `Bearer ${this.currentToken}`;
+        // Session cookies are sent automatically; state changes must echo the CSRF token
+        if (this.csrfToken && method !== 'GET') {
+            options.headers['X-CSRF-Token'] = this.csrfToken;
         }
         
         if (data) {
@@ -491,7 +577,8 @@ class TurnateApp {
         const result = await response.json();
         
         if (!response.ok) {
-            throw new Error(result.error || 'Request failed');
+            const details = (result.fields || []).map(f => `${f.field} ${f.message}`).join(', ');
+            throw new Error(details ? `${result.error}: ${details}` : (result.error || 'Request failed'));
         }
         
         return result;
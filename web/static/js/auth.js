@@ -61,16 +61,16 @@ class AuthManager {
                 },
                 body: JSON.stringify({
                     username: username,
-                    password: password
+                    password: password,
+                    use_cookie: true
                 })
             });
             
             const result = await response.json();
             
             if (response.ok) {
-                // Store token
-                localStorage.setItem('turnate_token', result.token);
-                this.app.currentToken = result.token;
+                // Session lives in an HttpOnly cookie; keep the CSRF token for requests
+                this.app.csrfToken = result.csrf_token;
                 this.app.currentUser = result.user;
                 
                 this.showSuccess(result.message || 'Login successful! 🎉');
@@ -134,16 +134,16 @@ class AuthManager {
                     username: username,
                     email: email,
                     display_name: displayName || username,
-                    password: password
+                    password: password,
+                    use_cookie: true
                 })
             });
             
             const result = await response.json();
             
             if (response.ok) {
-                // Store token
-                localStorage.setItem('turnate_token', result.token);
-                this.app.currentToken = result.token;
+                // Session lives in an HttpOnly cookie; keep the CSRF token for requests
+                this.app.csrfToken = result.csrf_token;
                 this.app.currentUser = result.user;
                 
                 this.showSuccess(result.message || 'Registration successful! 🎉');
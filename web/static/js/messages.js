@@ -113,13 +113,13 @@ class MessageManager {
     
     formatMessage(content) {
         // Enhanced message formatting
-        return content
+        return escapeHTML(content)
             // Basic emoji replacements
             .replace(/:\)/g, '😊')
             .replace(/:\(/g, '😢')
             .replace(/:D/g, '😃')
             .replace(/;\)/g, '😉')
-            .replace(/<3/g, '❤️')
+            .replace(/&lt;3/g, '❤️')
             .replace(/:\|/g, '😐')
             .replace(/:P/g, '😛')
             .replace(/:O/g, '😮')
@@ -149,7 +149,7 @@ class MessageManager {
         return `
             <div class="${messageClass}" data-message-id="${message.id}" data-user-id="${message.user_id}">
                 <div class="message-header">
-                    <span class="message-author ${isCurrentUser ? 'current-user' : ''}">${message.display_name || message.username}</span>
+                    <span class="message-author ${isCurrentUser ? 'current-user' : ''}">${escapeHTML(message.display_name || message.username)}</span>
                     <span class="message-time" title="${messageTime.toLocaleString()}">${timeString}</span>
                     ${threadIndicator}
                 </div>
@@ -214,7 +214,7 @@ class MessageManager {
             <div id="typingIndicator" class="typing-indicator p-2">
                 <small class="text-muted">
                     <span class="spinner-grow spinner-grow-sm me-2"></span>
-                    ${user.display_name || user.username} is typing...
+                    ${escapeHTML(user.display_name || user.username)} is typing...
                 </small>
             </div>
         `);
@@ -369,7 +369,7 @@ class MessageManager {
         const editForm = $(`
             <form class="edit-message-form">
                 <div class="input-group">
-                    <input type="text" class="form-control" value="${currentContent}">
+                    <input type="text" class="form-control" value="${escapeHTML(currentContent)}">
                     <button type="submit" class="btn btn-sm btn-primary">Save</button>
                     <button type="button" class="btn btn-sm btn-secondary cancel-edit">Cancel</button>
                 </div>
@@ -0,0 +1,31 @@
+// Service worker for Turnate desktop notifications
+
+// Show each pushed notification; the payload is a notification from the inbox
+self.addEventListener('push', (event) => {
+    let data = {};
+    try {
+        data = event.data ? event.data.json() : {};
+    } catch (error) {
+        data = { title: 'Turnate', body: event.data.text() };
+    }
+    
+    event.waitUntil(self.registration.showNotification(data.title || 'Turnate', {
+        body: data.body || '',
+        tag: data.id,
+        data: data
+    }));
+});
+
+// Focus an open tab, or open the app, when a notification is clicked
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    
+    event.waitUntil(self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windows) => {
+        for (const client of windows) {
+            if ('focus' in client) {
+                return client.focus();
+            }
+        }
+        return self.clients.openWindow('/');
+    }));
+});